@@ -1,10 +1,16 @@
 package api
 
 import (
+	"encoding/hex"
+	"errors"
+	"fmt"
 	"net/http"
 	"strconv"
 
 	"github.com/gin-gonic/gin"
+	"github.com/OhMyDitzzy/vulcan/consensus"
+	"github.com/OhMyDitzzy/vulcan/core"
+	"github.com/OhMyDitzzy/vulcan/script"
 	"github.com/OhMyDitzzy/vulcan/types"
 	"github.com/OhMyDitzzy/vulcan/wallet"
 )
@@ -13,7 +19,10 @@ import (
 func (s *Server) handleHealth(c *gin.Context) {
 	c.JSON(http.StatusOK, gin.H{
 		"status":     "healthy",
+		"network":    s.blockchain.Params().Name,
+		"chain_id":   s.blockchain.Params().ChainID,
 		"height":     s.blockchain.GetHeight(),
+		"coinbase_maturity": s.utxoSet.CoinbaseMaturity(),
 		"mempool":    s.mempool.Size(),
 		"peers":      len(s.p2pNode.GetPeers()),
 	})
@@ -28,7 +37,10 @@ func (s *Server) handleGetBlocks(c *gin.Context) {
 		limit = 100 // Cap at 100 blocks per request
 	}
 	
-	blocks := s.blockchain.GetBlocks(start, limit)
+	blocks := make([]blockResponse, 0, limit)
+	for _, block := range s.blockchain.GetBlocks(start, limit) {
+		blocks = append(blocks, s.newBlockResponse(block))
+	}
 	
 	c.JSON(http.StatusOK, gin.H{
 		"blocks": blocks,
@@ -48,7 +60,58 @@ func (s *Server) handleGetBlock(c *gin.Context) {
 		return
 	}
 	
-	c.JSON(http.StatusOK, block)
+	c.JSON(http.StatusOK, s.newBlockResponse(block))
+}
+
+// Finality statuses of a block.
+const (
+	finalityFinalized   = "finalized"   // Can no longer be reorganized away
+	finalityUnfinalized = "unfinalized" // On the main chain, above the finalized checkpoint
+	finalitySideChain   = "side_chain"  // On a branch that isn't the main chain
+)
+
+// blockResponse is a block with its finality status.
+type blockResponse struct {
+	*core.Block
+	Finality string `json:"finality"`
+}
+
+func (s *Server) newBlockResponse(block *core.Block) blockResponse {
+	status := finalityUnfinalized
+	if s.blockchain.IsFinalized(block.Hash) {
+		status = finalityFinalized
+	} else if !s.blockchain.IsMainChain(block.Hash) {
+		status = finalitySideChain
+	}
+	return blockResponse{Block: block, Finality: status}
+}
+
+// headerResponse is a block header with its hash, which the header itself doesn't carry.
+type headerResponse struct {
+	*types.BlockHeader
+	Hash string `json:"hash"`
+}
+
+// handleGetHeaders returns a paginated list of main-chain block headers.
+func (s *Server) handleGetHeaders(c *gin.Context) {
+	start, _ := strconv.ParseUint(c.DefaultQuery("start", "0"), 10, 64)
+	limit, _ := strconv.ParseUint(c.DefaultQuery("limit", "100"), 10, 64)
+	
+	if limit > 2000 {
+		limit = 2000 // Headers are small, so allow larger pages than blocks
+	}
+	
+	headers := make([]headerResponse, 0, limit)
+	for _, header := range s.blockchain.GetHeaders(start, limit) {
+		headers = append(headers, headerResponse{BlockHeader: header, Hash: header.ComputeHash()})
+	}
+	
+	c.JSON(http.StatusOK, gin.H{
+		"headers": headers,
+		"start":   start,
+		"limit":   limit,
+		"total":   s.blockchain.GetHeight() + 1,
+	})
 }
 
 // handleGetTransaction returns a transaction by ID.
@@ -77,6 +140,8 @@ func (s *Server) handleGetTransaction(c *gin.Context) {
 					"status":      "confirmed",
 					"block":       block.Hash,
 					"block_index": block.Index,
+					"merkle_root": block.MerkleRoot,
+					"proof":       block.MerkleProof(txID),
 				})
 				return
 			}
@@ -121,11 +186,24 @@ type SignTransactionRequest struct {
 }
 
 // TransactionPayload represents the transaction data to sign.
+// Type is "transfer" (the default), "stake" to lock Amount as stake, or
+// "unstake" to release stake outputs covering Amount; To is only used by transfers.
+// A transfer may instead pay to Script, a locking script in its text form
+// (for example "OP_SHA256 <hash> OP_EQUALVERIFY <pubkey> OP_CHECKSIG").
+// The signature is only valid on the chain with ChainID, which defaults to
+// ours; a client may set it to make sure it signs for the chain it expects.
+// LockTime and Sequence time lock the transaction and each of its inputs.
 type TransactionPayload struct {
-	From   string `json:"from" binding:"required"`
-	To     string `json:"to" binding:"required"`
-	Amount uint64 `json:"amount" binding:"required"`
-	Fee    uint64 `json:"fee" binding:"required"`
+	ChainID uint32 `json:"chain_id"`
+	Type    string `json:"type"`
+	From    string `json:"from" binding:"required"`
+	To      string `json:"to"`
+	Script  string `json:"script"`
+	Amount  uint64 `json:"amount" binding:"required"`
+	Fee     uint64 `json:"fee" binding:"required"`
+	
+	LockTime uint32 `json:"lock_time"`
+	Sequence uint32 `json:"sequence"`
 }
 
 // handleSignTransaction signs a transaction with a private key.
@@ -149,49 +227,271 @@ func (s *Server) handleSignTransaction(c *gin.Context) {
 		return
 	}
 	
+	chainID := s.blockchain.Params().ChainID
+	if req.Transaction.ChainID != 0 && req.Transaction.ChainID != chainID {
+		c.JSON(http.StatusBadRequest, gin.H{"error": fmt.Sprintf("chain ID %d does not match this node's chain ID %d", req.Transaction.ChainID, chainID)})
+		return
+	}
+	
+	// Fund the transaction from stake outputs when unstaking, and spendable outputs otherwise
+	coins := s.spendableCoins(w.Address, req.Transaction.Type == "unstake")
+	
 	// Create and sign transaction
-	tx, err := w.CreateAndSignTransaction(
-		req.Transaction.To,
-		req.Transaction.Amount,
-		req.Transaction.Fee,
-	)
+	var tx *types.Transaction
+	switch req.Transaction.Type {
+	case "", "transfer":
+		switch {
+		case req.Transaction.Script != "":
+			lock, assembleErr := script.Assemble(req.Transaction.Script)
+			if assembleErr != nil {
+				c.JSON(http.StatusBadRequest, gin.H{"error": "invalid script: " + assembleErr.Error()})
+				return
+			}
+			tx, err = w.CreateScriptTransaction(chainID, coins, lock, req.Transaction.Amount, req.Transaction.Fee)
+		case req.Transaction.To != "":
+			tx, err = w.CreateAndSignTransaction(chainID, coins, req.Transaction.To, req.Transaction.Amount, req.Transaction.Fee)
+		default:
+			c.JSON(http.StatusBadRequest, gin.H{"error": "to or script is required"})
+			return
+		}
+	case "stake":
+		tx, err = w.CreateStakeTransaction(chainID, coins, req.Transaction.Amount, req.Transaction.Fee)
+	case "unstake":
+		tx, err = w.CreateUnstakeTransaction(chainID, coins, req.Transaction.Amount, req.Transaction.Fee)
+	default:
+		c.JSON(http.StatusBadRequest, gin.H{"error": "unknown transaction type " + req.Transaction.Type})
+		return
+	}
+	if err == nil && (req.Transaction.LockTime != 0 || req.Transaction.Sequence != 0) {
+		// Signatures commit to the time locks, so sign again after setting them
+		setTimeLocks(tx, req.Transaction.LockTime, req.Transaction.Sequence)
+		err = w.SignTransaction(tx)
+	}
 	if err != nil {
-		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
 		return
 	}
 	
 	c.JSON(http.StatusOK, tx)
 }
 
-// handleBroadcastTransaction broadcasts a signed transaction.
-func (s *Server) handleBroadcastTransaction(c *gin.Context) {
-	var tx types.Transaction
-	if err := c.ShouldBindJSON(&tx); err != nil {
+// setTimeLocks sets the lock time of a transaction and the relative lock
+// time of every input, and recomputes the transaction ID, which covers them.
+func setTimeLocks(tx *types.Transaction, lockTime, sequence uint32) {
+	tx.LockTime = lockTime
+	for i := range tx.Inputs {
+		tx.Inputs[i].Sequence = sequence
+	}
+	tx.ID = tx.Hash()
+}
+
+// spendableCoins returns the confirmed outputs of an address that the next
+// block may spend and that pending transactions don't already spend: its
+// stake outputs if stake is set, and its other outputs otherwise.
+func (s *Server) spendableCoins(address string, stake bool) []wallet.Coin {
+	nextHeight := s.blockchain.GetHeight() + 1
+	maturity := s.utxoSet.CoinbaseMaturity()
+	var coins []wallet.Coin
+	for _, utxo := range s.utxoSet.GetUTXOsForAddress(address) {
+		if s.mempool.IsSpent(utxo.OutPoint()) || utxo.Staked != stake || utxo.UnlockHeight > nextHeight {
+			continue
+		}
+		if !utxo.Mature(nextHeight, maturity) {
+			continue
+		}
+		coins = append(coins, wallet.Coin{OutPoint: utxo.OutPoint(), Amount: utxo.Amount})
+	}
+	return coins
+}
+
+// MultisigRequest describes a multisig address: the public keys of its
+// co-signers, and how many of them must sign to spend from it.
+type MultisigRequest struct {
+	Threshold int      `json:"threshold" binding:"required"`
+	PubKeys   []string `json:"pub_keys" binding:"required"`
+}
+
+// handleCreateMultisig returns the address and script of a multisig
+// address. The keys may be given in any order.
+func (s *Server) handleCreateMultisig(c *gin.Context) {
+	var req MultisigRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
 		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
 		return
 	}
 	
-	// Validate transaction
-	if err := tx.Validate(); err != nil {
-		c.JSON(http.StatusBadRequest, gin.H{"error": "invalid transaction: " + err.Error()})
+	lock, err := script.MultisigScript(req.Threshold, req.PubKeys)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+	threshold, pubKeys, _ := script.ParseMultisig(lock)
+	text, _ := script.Disassemble(lock)
+	
+	c.JSON(http.StatusOK, gin.H{
+		"address":   types.ScriptAddress(lock),
+		"script":    text,
+		"threshold": threshold,
+		"pub_keys":  pubKeys,
+	})
+}
+
+// MultisigTransactionRequest requests a transaction spending from the
+// multisig address of Script, in its text form, optionally time locked
+// like a TransactionPayload.
+type MultisigTransactionRequest struct {
+	Script string `json:"script" binding:"required"`
+	To     string `json:"to" binding:"required"`
+	Amount uint64 `json:"amount" binding:"required"`
+	Fee    uint64 `json:"fee" binding:"required"`
+	
+	LockTime uint32 `json:"lock_time"`
+	Sequence uint32 `json:"sequence"`
+}
+
+// handleCreateMultisigTransaction creates an unsigned transaction spending
+// from a multisig address, for its co-signers to sign, along with the
+// signature hash of each input. Co-signers sign with their own keys, such
+// as with `vulcan multisig sign`, and never send them to the node.
+func (s *Server) handleCreateMultisigTransaction(c *gin.Context) {
+	var req MultisigTransactionRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+	
+	lock, err := assembleMultisig(req.Script)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+	
+	address := types.ScriptAddress(lock)
+	tx, err := wallet.CreateMultisigTransaction(s.blockchain.Params().ChainID, s.spendableCoins(address, false), address, req.To, req.Amount, req.Fee)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+	setTimeLocks(tx, req.LockTime, req.Sequence)
+	
+	sighashes := make([]string, len(tx.Inputs))
+	for i := range tx.Inputs {
+		sighashes[i] = hex.EncodeToString(tx.DataToSign(i))
+	}
+	
+	c.JSON(http.StatusOK, gin.H{
+		"transaction": tx,
+		"sighashes":   sighashes,
+	})
+}
+
+// CombineRequest carries a multisig transaction, the script of the
+// multisig address it spends from, and the signatures collected from
+// co-signers: for each co-signer's public key, its signature of every input.
+type CombineRequest struct {
+	Script      string              `json:"script" binding:"required"`
+	Transaction types.Transaction   `json:"transaction" binding:"required"`
+	Signatures  map[string][]string `json:"signatures" binding:"required"`
+}
+
+// handleCombineMultisig puts the collected signatures into a multisig
+// transaction, and returns it ready to be broadcast.
+func (s *Server) handleCombineMultisig(c *gin.Context) {
+	var req CombineRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+	
+	lock, err := assembleMultisig(req.Script)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+	
+	tx := &req.Transaction
+	for i := range tx.Inputs {
+		signatures := make(map[string]string, len(req.Signatures))
+		for pubKey, sigs := range req.Signatures {
+			if len(sigs) != len(tx.Inputs) {
+				c.JSON(http.StatusBadRequest, gin.H{"error": fmt.Sprintf("%s signed %d inputs, the transaction has %d", pubKey, len(sigs), len(tx.Inputs))})
+				return
+			}
+			signatures[pubKey] = sigs[i]
+		}
+		unlock, err := script.MultisigUnlock(lock, signatures)
+		if err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": fmt.Sprintf("input %d: %v", i, err)})
+			return
+		}
+		tx.SetScript(i, unlock)
+	}
+	
+	c.JSON(http.StatusOK, tx)
+}
+
+// assembleMultisig parses the text form of a multisig script.
+func assembleMultisig(text string) ([]byte, error) {
+	lock, err := script.Assemble(text)
+	if err != nil {
+		return nil, fmt.Errorf("invalid script: %w", err)
+	}
+	if _, _, err := script.ParseMultisig(lock); err != nil {
+		return nil, err
+	}
+	return lock, nil
+}
+
+// handleGetAnchors returns where data, in hex, was anchored on the main
+// chain, earliest first: the first block is the earliest proof that the
+// data existed.
+func (s *Server) handleGetAnchors(c *gin.Context) {
+	data, err := hex.DecodeString(c.Param("data"))
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "data must be hex"})
 		return
 	}
 	
-	// Verify signature
-	valid, err := wallet.VerifyTransactionSignature(&tx)
-	if err != nil || !valid {
-		c.JSON(http.StatusBadRequest, gin.H{"error": "invalid signature"})
+	anchors, err := s.blockchain.GetAnchors(data)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+	if len(anchors) == 0 {
+		c.JSON(http.StatusNotFound, gin.H{"error": "data is not anchored on the main chain"})
 		return
 	}
 	
-	// Validate against UTXO set
-	if err := s.utxoSet.ValidateTransaction(&tx); err != nil {
-		c.JSON(http.StatusBadRequest, gin.H{"error": "transaction validation failed: " + err.Error()})
+	c.JSON(http.StatusOK, gin.H{
+		"data":    hex.EncodeToString(data),
+		"anchors": anchors,
+	})
+}
+
+// handleBroadcastTransaction broadcasts a signed transaction.
+func (s *Server) handleBroadcastTransaction(c *gin.Context) {
+	var tx types.Transaction
+	if err := c.ShouldBindJSON(&tx); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+	
+	// Validate transaction, its signatures and its inputs against the UTXO set.
+	// A transaction that is only time locked is held until it unlocks
+	err := s.blockchain.CheckTransaction(&tx)
+	held := errors.Is(err, core.ErrNonFinal)
+	if err != nil && !held {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "invalid transaction: " + err.Error()})
 		return
 	}
 	
 	// Add to mempool
-	if err := s.mempool.AddTransaction(&tx); err != nil {
+	if held {
+		err = s.mempool.HoldTransaction(&tx)
+	} else {
+		err = s.mempool.AddTransaction(&tx)
+	}
+	if err != nil {
 		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
 		return
 	}
@@ -199,9 +499,14 @@ func (s *Server) handleBroadcastTransaction(c *gin.Context) {
 	// Broadcast to peers
 	s.p2pNode.BroadcastTransaction(&tx)
 	
+	message := "transaction broadcast successfully"
+	if held {
+		message = "transaction broadcast successfully, held until its time lock passes"
+	}
 	c.JSON(http.StatusOK, gin.H{
-		"message": "transaction broadcast successfully",
+		"message": message,
 		"tx_id":   tx.ID,
+		"held":    held,
 	})
 }
 
@@ -218,8 +523,12 @@ func (s *Server) handleGetMempool(c *gin.Context) {
 // MineRequest represents a mining request.
 type MineRequest struct {
 	MinerAddress string `json:"miner_address" binding:"required"`
+	Count        int    `json:"count"` // Number of blocks to mine, one if unset
 }
 
+// maxMineCount bounds the number of blocks a single mining request mines.
+const maxMineCount = 1000
+
 func (s *Server) handleMine(c *gin.Context) {
 	var req MineRequest
 	if err := c.ShouldBindJSON(&req); err != nil {
@@ -231,44 +540,258 @@ func (s *Server) handleMine(c *gin.Context) {
 		c.JSON(http.StatusBadRequest, gin.H{"error": "miner_address is required"})
 		return
 	}
-
-	heightBefore := s.blockchain.GetHeight()
-
-	if err := s.miner.MineBlock(req.MinerAddress); err != nil {
-		c.JSON(http.StatusInternalServerError, gin.H{"error": "mining failed: " + err.Error()})
-		return
-	}
 	
-	latestBlock := s.blockchain.GetLatestBlock()
-
-	if latestBlock == nil || latestBlock.Index != heightBefore + 1 {
-		c.JSON(http.StatusInternalServerError, gin.H{
-			"error": "block was not added to chain",
-		})
+	count := req.Count
+	if count == 0 {
+		count = 1
+	}
+	if count < 0 || count > maxMineCount {
+		c.JSON(http.StatusBadRequest, gin.H{"error": fmt.Sprintf("count must be between 1 and %d", maxMineCount)})
 		return
 	}
-	
-	if s.p2pNode != nil {
-		go s.p2pNode.BroadcastBlock(latestBlock)
+
+	var mined []*core.Block
+	for i := 0; i < count; i++ {
+		heightBefore := s.blockchain.GetHeight()
+
+		if err := s.miner.MineBlock(c.Request.Context(), req.MinerAddress); err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "mining failed: " + err.Error()})
+			return
+		}
+		
+		latestBlock := s.blockchain.GetLatestBlock()
+
+		if latestBlock == nil || latestBlock.Index != heightBefore + 1 {
+			c.JSON(http.StatusInternalServerError, gin.H{
+				"error": "block was not added to chain",
+			})
+			return
+		}
+		
+		if s.p2pNode != nil {
+			go s.p2pNode.BroadcastBlock(latestBlock)
+		}
+		mined = append(mined, latestBlock)
 	}
 	
 	c.JSON(http.StatusOK, gin.H{
 		"message": "block mined successfully",
-		"block":   latestBlock,
+		"block":   mined[len(mined)-1],
+		"blocks":  mined,
 	})
 }
 
 // handleGetBalance returns the balance for an address.
+// Coinbase outputs that can't be spent in the next block yet are immature;
+// the rest of the balance is mature.
 func (s *Server) handleGetBalance(c *gin.Context) {
 	address := c.Param("address")
 	
 	balance := s.utxoSet.GetBalance(address)
 	utxos := s.utxoSet.GetUTXOsForAddress(address)
 	
+	immature := s.utxoSet.GetImmatureBalance(address, s.blockchain.GetHeight()+1)
+	
+	c.JSON(http.StatusOK, gin.H{
+		"address":  address,
+		"balance":  balance,
+		"mature":   balance - immature,
+		"immature": immature,
+		"staked":   s.utxoSet.GetStake(address),
+		"utxos":    utxos,
+	})
+}
+
+// handleGetSupply returns the coins in circulation and the emission schedule.
+// Coins a coinbase didn't claim, and slashed stake that was burned, were
+// issued by the schedule but are not in circulation.
+func (s *Server) handleGetSupply(c *gin.Context) {
+	height := s.blockchain.GetHeight()
+	emission := s.blockchain.Params().Emission
+	issued := emission.Issued(height)
+	circulating := s.utxoSet.Supply()
+	
+	var burned uint64
+	if issued > circulating {
+		burned = issued - circulating
+	}
+	
+	var staked uint64
+	for _, stake := range s.utxoSet.Stakes() {
+		staked += stake
+	}
+	
+	c.JSON(http.StatusOK, gin.H{
+		"height":           height,
+		"circulating":      circulating,
+		"staked":           staked,
+		"issued":           issued,
+		"burned":           burned,
+		"max_supply":       emission.MaxSupply,
+		"next_subsidy":     emission.Subsidy(height + 1),
+		"halving_interval": emission.HalvingInterval,
+	})
+}
+
+// handleGetConsensus returns the consensus engine and, for Proof-of-Authority,
+// the current signers and the votes this node casts, or for Proof-of-Stake,
+// the stake distribution.
+func (s *Server) handleGetConsensus(c *gin.Context) {
+	response := gin.H{"engine": s.engine.Name()}
+	
+	if pos, ok := s.engine.(*consensus.ProofOfStake); ok {
+		response["stakes"] = s.blockchain.Stakes()
+		response["proposer"] = pos.Address()
+	}
+	
+	if poa, ok := s.engine.(*consensus.ProofOfAuthority); ok {
+		tip := s.blockchain.GetLatestBlock()
+		signers, err := poa.Signers(s.blockchain, &tip.BlockHeader)
+		if err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+			return
+		}
+		
+		response["signers"] = signers
+		response["signer"] = poa.Address()
+		response["proposals"] = poa.Proposals()
+	}
+	
+	c.JSON(http.StatusOK, response)
+}
+
+// handleGetFinality returns the finalized checkpoint and, when this node
+// runs the finality gadget, the validators and the votes for checkpoints
+// that aren't finalized yet.
+func (s *Server) handleGetFinality(c *gin.Context) {
+	response := gin.H{"enabled": s.finality != nil}
+	
+	if finalized := s.blockchain.GetFinalized(); finalized != nil {
+		response["finalized_height"] = finalized.Index
+		response["finalized_hash"] = finalized.Hash
+	}
+	
+	if s.finality != nil {
+		response["checkpoint_interval"] = s.finality.Interval()
+		response["validators"] = s.finality.Validators()
+		response["quorum"] = s.finality.Quorum()
+		response["validator"] = s.finality.Address()
+		response["pending"] = s.finality.Pending()
+	}
+	
+	c.JSON(http.StatusOK, response)
+}
+
+// ProposalRequest represents a vote to add or remove a block signer.
+type ProposalRequest struct {
+	Address   string `json:"address" binding:"required"`
+	Authorize bool   `json:"authorize"`
+}
+
+// handleAddProposal makes this node vote for a signer set change in the
+// blocks it signs.
+func (s *Server) handleAddProposal(c *gin.Context) {
+	poa, ok := s.engine.(*consensus.ProofOfAuthority)
+	if !ok {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "consensus engine has no signer votes"})
+		return
+	}
+	
+	var req ProposalRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+	
+	if err := poa.Propose(req.Address, req.Authorize); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+	
+	c.JSON(http.StatusOK, gin.H{
+		"message":   "proposal added",
+		"address":   req.Address,
+		"authorize": req.Authorize,
+	})
+}
+
+// handleDiscardProposal withdraws this node's vote for an address.
+func (s *Server) handleDiscardProposal(c *gin.Context) {
+	poa, ok := s.engine.(*consensus.ProofOfAuthority)
+	if !ok {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "consensus engine has no signer votes"})
+		return
+	}
+	
+	poa.Discard(c.Param("address"))
+	c.JSON(http.StatusOK, gin.H{"message": "proposal discarded"})
+}
+
+// SlashRequest reports two blocks signed by the same staker for the same slot.
+type SlashRequest struct {
+	BlockA   string `json:"block_a" binding:"required"`
+	BlockB   string `json:"block_b" binding:"required"`
+	Reporter string `json:"reporter" binding:"required"`
+	Fee      uint64 `json:"fee" binding:"required"`
+}
+
+// handleSlash builds a slash transaction from two equivocating blocks known
+// to this node and broadcasts it. It slashes all of the offender's stake,
+// and pays the reporter the largest reward allowed minus the fee.
+func (s *Server) handleSlash(c *gin.Context) {
+	var req SlashRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+	
+	a := s.blockchain.GetHeader(req.BlockA)
+	b := s.blockchain.GetHeader(req.BlockB)
+	if a == nil || b == nil {
+		c.JSON(http.StatusNotFound, gin.H{"error": "block not found"})
+		return
+	}
+	
+	evidence := consensus.EncodeEvidence(a, b)
+	offender, evidenceIndex, err := consensus.VerifyEquivocation(evidence, s.blockchain.Params().ChainID)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "invalid evidence: " + err.Error()})
+		return
+	}
+	
+	nextHeight := s.blockchain.GetHeight() + 1
+	var prevOuts []types.OutPoint
+	var slashed uint64
+	for _, utxo := range s.utxoSet.GetUTXOsForAddress(offender) {
+		if utxo.Slashable(nextHeight, evidenceIndex) && !s.mempool.IsSpent(utxo.OutPoint()) {
+			prevOuts = append(prevOuts, utxo.OutPoint())
+			slashed += utxo.Amount
+		}
+	}
+	
+	reward := slashed / consensus.SlashRewardDivisor
+	if reward <= req.Fee {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "slashable stake does not cover the fee"})
+		return
+	}
+	
+	outputs := []types.TxOutput{{Amount: reward - req.Fee, Address: req.Reporter}}
+	tx := types.NewSlashTransaction(s.blockchain.Params().ChainID, prevOuts, evidence, outputs, req.Fee)
+	if err := s.blockchain.CheckTransaction(tx); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "invalid transaction: " + err.Error()})
+		return
+	}
+	if err := s.mempool.AddTransaction(tx); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+	s.p2pNode.BroadcastTransaction(tx)
+	
 	c.JSON(http.StatusOK, gin.H{
-		"address": address,
-		"balance": balance,
-		"utxos":   utxos,
+		"message":  "slash transaction broadcast successfully",
+		"tx_id":    tx.ID,
+		"offender": offender,
+		"slashed":  slashed,
 	})
 }
 
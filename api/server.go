@@ -4,7 +4,9 @@ import (
 	"fmt"
 	"github.com/gin-contrib/cors"
 	"github.com/gin-gonic/gin"
+	"github.com/OhMyDitzzy/vulcan/consensus"
 	"github.com/OhMyDitzzy/vulcan/core"
+	"github.com/OhMyDitzzy/vulcan/finality"
 	"github.com/OhMyDitzzy/vulcan/miner"
 	"github.com/OhMyDitzzy/vulcan/p2p"
 	"github.com/OhMyDitzzy/vulcan/txpool"
@@ -21,11 +23,13 @@ type Server struct {
 	miner      *miner.Miner
 	p2pNode    *p2p.Node
 	utxoSet    *core.UTXOSet
+	engine     consensus.Engine
+	finality   *finality.Gadget
 }
 
 // NewServer creates a new API server instance.
 // initialize the Gin router with middleware and register all endpoints.
-func NewServer(port int, bc *core.Blockchain, mp *txpool.Mempool, m *miner.Miner, p2p *p2p.Node, utxo *core.UTXOSet) *Server {
+func NewServer(port int, bc *core.Blockchain, mp *txpool.Mempool, m *miner.Miner, p2p *p2p.Node, utxo *core.UTXOSet, engine consensus.Engine, gadget *finality.Gadget) *Server {
 	gin.SetMode(gin.ReleaseMode)
 	
 	router := gin.Default()
@@ -44,6 +48,8 @@ func NewServer(port int, bc *core.Blockchain, mp *txpool.Mempool, m *miner.Miner
 		miner:      m,
 		p2pNode:    p2p,
 		utxoSet:    utxo,
+		engine:     engine,
+		finality:   gadget,
 	}
 	
 	server.setupRoutes()
@@ -51,7 +57,7 @@ func NewServer(port int, bc *core.Blockchain, mp *txpool.Mempool, m *miner.Miner
 }
 
 // setupRoutes registers all API endpoints.
-// Organize endpoints by functionality: blockchain, wallet, transactions, mining, peers.
+// Organize endpoints by functionality: blockchain, wallet, multisig, anchors, transactions, mining, supply, consensus, finality, peers.
 func (s *Server) setupRoutes() {
 	api := s.router.Group("/")
 	
@@ -59,17 +65,32 @@ func (s *Server) setupRoutes() {
 	
 	api.GET("/blockchain/blocks", s.handleGetBlocks)
 	api.GET("/blockchain/block/:hash", s.handleGetBlock)
+	api.GET("/blockchain/headers", s.handleGetHeaders)
 	api.GET("/blockchain/tx/:txid", s.handleGetTransaction)
 	
 	api.GET("/wallet/new", s.handleNewWallet)
 	api.POST("/wallet/sign", s.handleSignTransaction)
 	
+	api.POST("/multisig", s.handleCreateMultisig)
+	api.POST("/multisig/tx", s.handleCreateMultisigTransaction)
+	api.POST("/multisig/combine", s.handleCombineMultisig)
+	
+	api.GET("/anchor/:data", s.handleGetAnchors)
+	
 	api.POST("/tx", s.handleBroadcastTransaction)
 	api.GET("/mempool", s.handleGetMempool)
 
 	api.POST("/mine", s.handleMine)
 
 	api.GET("/balance/:address", s.handleGetBalance)
+	api.GET("/supply", s.handleGetSupply)
+	
+	api.GET("/consensus", s.handleGetConsensus)
+	api.POST("/consensus/proposals", s.handleAddProposal)
+	api.DELETE("/consensus/proposals/:address", s.handleDiscardProposal)
+	api.POST("/consensus/slash", s.handleSlash)
+	
+	api.GET("/finality", s.handleGetFinality)
 	
 	api.GET("/peers", s.handleGetPeers)
 	api.POST("/peers", s.handleAddPeer)
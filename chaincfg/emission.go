@@ -0,0 +1,59 @@
+package chaincfg
+
+import "math"
+
+// Emission is the schedule new coins are created by.
+// The genesis block creates the genesis allocation, and every later block
+// may create a subsidy that halves every HalvingInterval blocks. No block
+// may take the coins ever created above MaxSupply, so the last subsidies
+// are cut short once the cap is reached.
+type Emission struct {
+	GenesisAllocation uint64 // Coins created by the genesis coinbase
+	InitialSubsidy    uint64 // Subsidy of the blocks before the first halving
+	HalvingInterval   uint64 // Blocks between halvings, or zero to never halve
+	MaxSupply         uint64 // Cap on the coins ever created, including the genesis allocation
+}
+
+// Subsidy returns the coins the block at the given height may create,
+// leaving out fees. At height zero, this is the genesis allocation.
+func (e Emission) Subsidy(height uint64) uint64 {
+	if height == 0 {
+		return e.Issued(0)
+	}
+	return e.Issued(height) - e.Issued(height-1)
+}
+
+// Issued returns the coins created by the blocks up to and including the
+// given height, if every block claimed its full subsidy.
+func (e Emission) Issued(height uint64) uint64 {
+	total := e.GenesisAllocation
+	remaining := height
+	for halvings := uint(0); remaining > 0 && halvings < 64 && total < e.MaxSupply; halvings++ {
+		blocks := remaining
+		if e.HalvingInterval != 0 && blocks > e.HalvingInterval {
+			blocks = e.HalvingInterval
+		}
+		total = addCapped(total, mulCapped(e.InitialSubsidy>>halvings, blocks))
+		remaining -= blocks
+	}
+
+	if total > e.MaxSupply {
+		return e.MaxSupply
+	}
+	return total
+}
+
+// addCapped and mulCapped saturate at the largest uint64 instead of wrapping.
+func addCapped(a, b uint64) uint64 {
+	if a > math.MaxUint64-b {
+		return math.MaxUint64
+	}
+	return a + b
+}
+
+func mulCapped(a, b uint64) uint64 {
+	if a != 0 && b > math.MaxUint64/a {
+		return math.MaxUint64
+	}
+	return a * b
+}
@@ -0,0 +1,93 @@
+package chaincfg
+
+import (
+	"math"
+	"testing"
+)
+
+func TestSubsidy(t *testing.T) {
+	tests := []struct {
+		name     string
+		emission Emission
+		height   uint64
+		want     uint64
+	}{
+		{"genesis", defaultEmission, 0, 1000000},
+		{"first block", defaultEmission, 1, 50},
+		{"last block before halving", defaultEmission, 210000, 50},
+		{"first halving", defaultEmission, 210001, 25},
+		{"second halving", defaultEmission, 420001, 12},
+		{"sixth halving", defaultEmission, 6*210000 + 1, 0},
+		{"never halving", Emission{InitialSubsidy: 50, MaxSupply: math.MaxUint64}, 1 << 40, 50},
+
+		// 10 at genesis and 4 a block reaches the cap of 21 in block 3
+		{"below the cap", Emission{10, 4, 0, 21}, 2, 4},
+		{"cut short by the cap", Emission{10, 4, 0, 21}, 3, 3},
+		{"after the cap", Emission{10, 4, 0, 21}, 4, 0},
+		{"exactly at the cap", Emission{10, 4, 0, 22}, 3, 4},
+		{"after exactly reaching the cap", Emission{10, 4, 0, 22}, 4, 0},
+		{"genesis above the cap", Emission{30, 4, 0, 21}, 0, 21},
+		{"no room after genesis", Emission{30, 4, 0, 21}, 1, 0},
+		{"overflowing schedule", Emission{0, math.MaxUint64, 0, math.MaxUint64}, 2, 0},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := tt.emission.Subsidy(tt.height); got != tt.want {
+				t.Fatalf("Subsidy(%d) = %d, want %d", tt.height, got, tt.want)
+			}
+		})
+	}
+}
+
+func TestIssuedIsSumOfSubsidies(t *testing.T) {
+	emissions := map[string]Emission{
+		"halving every 7 blocks": {100, 64, 7, 1000},
+		"cap mid-halving":        {0, 64, 7, 500},
+		"never capped":           {5, 64, 3, math.MaxUint64},
+	}
+
+	for name, emission := range emissions {
+		t.Run(name, func(t *testing.T) {
+			var total uint64
+			for height := uint64(0); height <= 100; height++ {
+				total += emission.Subsidy(height)
+				if issued := emission.Issued(height); issued != total {
+					t.Fatalf("Issued(%d) = %d, but the subsidies up to it add up to %d", height, issued, total)
+				}
+				if total > emission.MaxSupply {
+					t.Fatalf("%d coins issued by height %d, more than the cap of %d", total, height, emission.MaxSupply)
+				}
+			}
+		})
+	}
+}
+
+func TestDefaultEmissionMaxSupply(t *testing.T) {
+	// After four halvings 20,530,000 coins exist, and blocks of the fifth
+	// era create 3, so the cap of 21,000,000 is reached 156,667 blocks in
+	// with a last subsidy of 2
+	last := uint64(4*210000 + 156667)
+	tests := []struct {
+		height uint64
+		want   uint64
+	}{
+		{4 * 210000, 6},
+		{last - 1, 3},
+		{last, 2},
+		{last + 1, 0},
+		{5 * 210000, 0},
+	}
+	for _, tt := range tests {
+		if got := defaultEmission.Subsidy(tt.height); got != tt.want {
+			t.Errorf("Subsidy(%d) = %d, want %d", tt.height, got, tt.want)
+		}
+	}
+
+	if got := defaultEmission.Issued(last); got != defaultEmission.MaxSupply {
+		t.Fatalf("Issued(%d) = %d, want the cap of %d", last, got, defaultEmission.MaxSupply)
+	}
+	if got := defaultEmission.Issued(math.MaxUint64); got != defaultEmission.MaxSupply {
+		t.Fatalf("Issued = %d, want the cap of %d", got, defaultEmission.MaxSupply)
+	}
+}
@@ -0,0 +1,155 @@
+package chaincfg
+
+import (
+	"bytes"
+	"crypto/sha256"
+	"encoding/binary"
+	"encoding/json"
+	"fmt"
+	"os"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/OhMyDitzzy/vulcan/types"
+	"github.com/OhMyDitzzy/vulcan/wallet"
+)
+
+// Allocation pre-funds an address in the genesis block.
+type Allocation struct {
+	Address string `json:"address"`
+	Amount  uint64 `json:"amount"`
+}
+
+// Bits is a compact Proof-of-Work target, written in JSON as a hex string
+// such as "1f00ffff".
+type Bits uint32
+
+func (b Bits) MarshalJSON() ([]byte, error) {
+	return json.Marshal(fmt.Sprintf("%08x", uint32(b)))
+}
+
+func (b *Bits) UnmarshalJSON(data []byte) error {
+	var s string
+	if err := json.Unmarshal(data, &s); err != nil {
+		return fmt.Errorf("bits must be a hex string: %w", err)
+	}
+	value, err := strconv.ParseUint(strings.TrimPrefix(s, "0x"), 16, 32)
+	if err != nil {
+		return fmt.Errorf("invalid bits %q: %w", s, err)
+	}
+	*b = Bits(value)
+	return nil
+}
+
+// Genesis is a genesis specification, which starts a new chain on top of
+// a network's rules. Every node of the chain must use the same one.
+type Genesis struct {
+	Timestamp time.Time    `json:"timestamp"`            // Timestamp of the genesis block
+	ChainID   uint32       `json:"chain_id"`             // Chain ID of the new chain
+	Bits      Bits         `json:"bits,omitempty"`       // Initial Proof-of-Work target, or the network's limit if unset
+	ExtraData string       `json:"extra_data,omitempty"` // Free text carried by the genesis coinbase
+	Alloc     []Allocation `json:"alloc"`                // Pre-funded addresses, in coinbase output order
+}
+
+// ParseGenesis decodes a JSON genesis specification. Unknown fields are
+// rejected, so a misspelled field can't silently fall back to a default.
+func ParseGenesis(data []byte) (*Genesis, error) {
+	dec := json.NewDecoder(bytes.NewReader(data))
+	dec.DisallowUnknownFields()
+
+	var g Genesis
+	if err := dec.Decode(&g); err != nil {
+		return nil, fmt.Errorf("invalid genesis specification: %w", err)
+	}
+	return &g, nil
+}
+
+// LoadGenesis reads a JSON genesis specification from a file.
+func LoadGenesis(path string) (*Genesis, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+	return ParseGenesis(data)
+}
+
+// Apply returns a copy of the network parameters with the genesis block
+// and chain ID replaced by the specification's. The genesis allocation of
+// the emission schedule becomes the sum of the allocations, and the network
+// magic is derived from the specification, so nodes of the new chain don't
+// talk to nodes of the base network or of other chains.
+func (g *Genesis) Apply(base *Params) (*Params, error) {
+	if g.Timestamp.IsZero() {
+		return nil, fmt.Errorf("genesis timestamp is required")
+	}
+	if g.ChainID == 0 {
+		return nil, fmt.Errorf("genesis chain_id is required")
+	}
+	if len(g.ExtraData) > types.MaxCoinbasePayload {
+		return nil, fmt.Errorf("genesis extra_data is %d bytes, at most %d are allowed", len(g.ExtraData), types.MaxCoinbasePayload)
+	}
+
+	bits := base.PowLimitBits
+	if g.Bits != 0 {
+		target := types.CompactToBig(uint32(g.Bits))
+		if target.Sign() <= 0 || target.Cmp(base.PowLimit()) > 0 {
+			return nil, fmt.Errorf("genesis bits %08x are outside the range allowed by %s", uint32(g.Bits), base.Name)
+		}
+		bits = uint32(g.Bits)
+	}
+
+	if len(g.Alloc) == 0 {
+		return nil, fmt.Errorf("genesis needs at least one allocation")
+	}
+	var total uint64
+	seen := make(map[string]bool, len(g.Alloc))
+	for i, alloc := range g.Alloc {
+		if _, err := wallet.AddressToPublicKey(alloc.Address); err != nil {
+			return nil, fmt.Errorf("allocation %d: invalid address: %w", i, err)
+		}
+		if seen[alloc.Address] {
+			return nil, fmt.Errorf("allocation %d: duplicate address %s", i, alloc.Address)
+		}
+		seen[alloc.Address] = true
+		if alloc.Amount == 0 {
+			return nil, fmt.Errorf("allocation %d: amount must be greater than zero", i)
+		}
+		if total+alloc.Amount < total {
+			return nil, fmt.Errorf("genesis allocations overflow")
+		}
+		total += alloc.Amount
+	}
+	if total > base.Emission.MaxSupply {
+		return nil, fmt.Errorf("genesis allocates %d coins, more than the maximum supply of %d", total, base.Emission.MaxSupply)
+	}
+
+	params := *base
+	params.Net = g.net(base.Net, bits)
+	params.ChainID = g.ChainID
+	params.GenesisTimestamp = g.Timestamp.UTC()
+	params.GenesisBits = bits
+	params.GenesisExtra = []byte(g.ExtraData)
+	params.GenesisAlloc = append([]Allocation(nil), g.Alloc...)
+	params.Emission.GenesisAllocation = total
+	return &params, nil
+}
+
+// net derives the network magic of the chain a specification starts on top
+// of a network with the given magic, from everything that makes up its
+// genesis block.
+func (g *Genesis) net(baseNet, bits uint32) uint32 {
+	e := types.NewEncoder()
+	e.WriteUint32(baseNet)
+	e.WriteUint32(g.ChainID)
+	e.WriteTime(g.Timestamp)
+	e.WriteUint32(bits)
+	e.WriteString(g.ExtraData)
+	e.WriteVarInt(uint64(len(g.Alloc)))
+	for _, alloc := range g.Alloc {
+		e.WriteString(alloc.Address)
+		e.WriteUint64(alloc.Amount)
+	}
+	hash := sha256.Sum256(e.Bytes())
+	return binary.BigEndian.Uint32(hash[:4])
+}
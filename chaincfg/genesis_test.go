@@ -0,0 +1,165 @@
+package chaincfg
+
+import (
+	"encoding/json"
+	"math"
+	"reflect"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/OhMyDitzzy/vulcan/wallet"
+)
+
+func newAddress(t *testing.T) string {
+	t.Helper()
+	w, err := wallet.NewWallet()
+	if err != nil {
+		t.Fatal(err)
+	}
+	return w.Address
+}
+
+// testGenesis returns a valid specification with two allocations.
+func testGenesis(t *testing.T) *Genesis {
+	t.Helper()
+	return &Genesis{
+		Timestamp: time.Unix(1700000000, 0).UTC(),
+		ChainID:   42,
+		Bits:      0x1f7fffff,
+		ExtraData: "a new chain",
+		Alloc:     []Allocation{{Address: newAddress(t), Amount: 600}, {Address: newAddress(t), Amount: 400}},
+	}
+}
+
+func TestParseGenesis(t *testing.T) {
+	g := testGenesis(t)
+	data, err := json.Marshal(g)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !strings.Contains(string(data), `"bits":"1f7fffff"`) {
+		t.Fatalf("bits aren't encoded as hex: %s", data)
+	}
+	got, err := ParseGenesis(data)
+	if err != nil {
+		t.Fatalf("ParseGenesis failed: %v", err)
+	}
+	if !reflect.DeepEqual(got, g) {
+		t.Fatalf("got %+v, want %+v", got, g)
+	}
+	if got, err := ParseGenesis([]byte(`{"chain_id": 7, "bits": "0x1f00ffff"}`)); err != nil || got.Bits != 0x1f00ffff {
+		t.Fatalf("bits with a 0x prefix: got %08x (%v)", uint32(got.Bits), err)
+	}
+
+	tests := map[string]string{
+		"not JSON":         `chain_id: 7`,
+		"truncated":        `{"chain_id": 7`,
+		"unknown field":    `{"chain_id": 7, "chainid": 8}`,
+		"bits as a number": `{"bits": 520159231}`,
+		"bits not hex":     `{"bits": "1f00fffg"}`,
+		"bits too long":    `{"bits": "1f00ffff00"}`,
+		"negative amount":  `{"alloc": [{"address": "04beef", "amount": -1}]}`,
+		"wrong type":       `{"chain_id": "7"}`,
+	}
+	for name, spec := range tests {
+		t.Run(name, func(t *testing.T) {
+			if _, err := ParseGenesis([]byte(spec)); err == nil {
+				t.Fatal("ParseGenesis succeeded")
+			}
+		})
+	}
+}
+
+func TestGenesisApply(t *testing.T) {
+	g := testGenesis(t)
+	base := RegTestParams
+	params, err := g.Apply(&base)
+	if err != nil {
+		t.Fatalf("Apply failed: %v", err)
+	}
+	if params.ChainID != 42 || params.GenesisBits != 0x1f7fffff || !params.GenesisTimestamp.Equal(g.Timestamp) || string(params.GenesisExtra) != g.ExtraData {
+		t.Fatalf("genesis block isn't the specification's: %+v", params)
+	}
+	if params.Emission.GenesisAllocation != 1000 || !reflect.DeepEqual(params.GenesisAlloc, g.Alloc) {
+		t.Fatalf("got allocations %+v of %d coins, want the specification's 1000", params.GenesisAlloc, params.Emission.GenesisAllocation)
+	}
+	if params.Net == base.Net {
+		t.Fatal("the new chain has the base network's magic")
+	}
+	if !reflect.DeepEqual(base, RegTestParams) {
+		t.Fatal("Apply changed the base network's parameters")
+	}
+
+	// Without bits, the chain starts at the network's limit
+	g.Bits = 0
+	if params, err := g.Apply(&base); err != nil || params.GenesisBits != base.PowLimitBits {
+		t.Fatalf("got bits %08x (%v), want the limit %08x", params.GenesisBits, err, base.PowLimitBits)
+	}
+}
+
+func TestGenesisApplyRejects(t *testing.T) {
+	tests := []struct {
+		name   string
+		change func(g *Genesis)
+		want   string
+	}{
+		{"no timestamp", func(g *Genesis) { g.Timestamp = time.Time{} }, "timestamp is required"},
+		{"no chain ID", func(g *Genesis) { g.ChainID = 0 }, "chain_id is required"},
+		{"long extra data", func(g *Genesis) { g.ExtraData = strings.Repeat("x", 101) }, "extra_data"},
+		{"bits above the limit", func(g *Genesis) { g.Bits = 0x2100ffff }, "outside the range"},
+		{"zero target", func(g *Genesis) { g.Bits = 0x01000000 }, "outside the range"},
+		{"no allocations", func(g *Genesis) { g.Alloc = nil }, "at least one allocation"},
+		{"invalid address", func(g *Genesis) { g.Alloc[1].Address = "04beef" }, "allocation 1: invalid address"},
+		{"duplicate address", func(g *Genesis) { g.Alloc = append(g.Alloc, g.Alloc[0]) }, "allocation 2: duplicate address"},
+		{"zero amount", func(g *Genesis) { g.Alloc[0].Amount = 0 }, "allocation 0: amount"},
+		{"overflowing total", func(g *Genesis) { g.Alloc[0].Amount = math.MaxUint64 }, "overflow"},
+		{"above the maximum supply", func(g *Genesis) { g.Alloc[0].Amount = defaultEmission.MaxSupply }, "more than the maximum supply"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			g := testGenesis(t)
+			tt.change(g)
+			_, err := g.Apply(&RegTestParams)
+			if err == nil || !strings.Contains(err.Error(), tt.want) {
+				t.Fatalf("got %v, want an error containing %q", err, tt.want)
+			}
+		})
+	}
+}
+
+func TestGenesisNet(t *testing.T) {
+	g := testGenesis(t)
+	net := g.net(RegTestParams.Net, uint32(g.Bits))
+	if copied := *g; copied.net(RegTestParams.Net, uint32(g.Bits)) != net {
+		t.Fatal("the same specification gives another magic")
+	}
+
+	// Every part of the genesis block changes the magic
+	other := newAddress(t)
+	changes := map[string]func(g *Genesis){
+		"chain ID":          func(g *Genesis) { g.ChainID++ },
+		"timestamp":         func(g *Genesis) { g.Timestamp = g.Timestamp.Add(time.Second) },
+		"extra data":        func(g *Genesis) { g.ExtraData += "!" },
+		"allocation amount": func(g *Genesis) { g.Alloc[0].Amount++ },
+		"allocation owner":  func(g *Genesis) { g.Alloc[0].Address = other },
+		"allocation order":  func(g *Genesis) { g.Alloc[0], g.Alloc[1] = g.Alloc[1], g.Alloc[0] },
+		"extra allocation":  func(g *Genesis) { g.Alloc = append(g.Alloc, Allocation{Address: other, Amount: 1}) },
+	}
+	for name, change := range changes {
+		t.Run(name, func(t *testing.T) {
+			changed := *g
+			changed.Alloc = append([]Allocation(nil), g.Alloc...)
+			change(&changed)
+			if changed.net(RegTestParams.Net, uint32(g.Bits)) == net {
+				t.Fatal("magic didn't change")
+			}
+		})
+	}
+	if g.net(RegTestParams.Net, 0x1f00ffff) == net {
+		t.Fatal("magic didn't change with the bits")
+	}
+	if g.net(TestNetParams.Net, uint32(g.Bits)) == net {
+		t.Fatal("magic didn't change with the base network")
+	}
+}
@@ -0,0 +1,153 @@
+// Package chaincfg defines the parameters of the networks a node can join.
+//
+// Everything that nodes of one network must agree on, from the genesis
+// block and difficulty rules to the coin supply, is collected in a Params
+// value, so selecting a network selects all of it consistently.
+package chaincfg
+
+import (
+	"fmt"
+	"math/big"
+	"strings"
+	"time"
+
+	"github.com/OhMyDitzzy/vulcan/types"
+)
+
+// Params defines a network.
+type Params struct {
+	// Name is the name the network is selected by.
+	Name string
+
+	// Net is the network magic that starts every p2p message, so nodes
+	// of different networks can't talk to each other by accident.
+	Net uint32
+
+	// ChainID identifies the network's transactions, so a transaction
+	// signed for one network can't be replayed on another.
+	ChainID uint32
+
+	// DefaultPort and DefaultAPIPort are the p2p and API ports nodes listen
+	// on unless configured otherwise.
+	DefaultPort    int
+	DefaultAPIPort int
+
+	// GenesisTimestamp is the timestamp of the genesis block, GenesisBits
+	// its compact Proof-of-Work target and GenesisExtra free data carried
+	// by its coinbase. GenesisAlloc lists the coinbase outputs, which must
+	// add up to the emission schedule's genesis allocation.
+	GenesisTimestamp time.Time
+	GenesisBits      uint32
+	GenesisExtra     []byte
+	GenesisAlloc     []Allocation
+
+	// PowLimitBits is the easiest target a Proof-of-Work block may use, in
+	// compact form.
+	PowLimitBits uint32
+
+	// TargetBlockTime is the block interval Proof-of-Work retargeting aims for.
+	TargetBlockTime time.Duration
+
+	// NoRetarget keeps every Proof-of-Work block at GenesisBits.
+	NoRetarget bool
+
+	// Emission is the schedule new coins are created by.
+	Emission Emission
+
+	// CoinbaseMaturity is the number of blocks a coinbase output must be
+	// buried under before it can be spent. A reorganization can drop a
+	// block and the reward it created, which would also invalidate every
+	// transaction spending the reward, so rewards are only spendable once
+	// such a deep reorganization is unlikely.
+	CoinbaseMaturity uint64
+
+	// MineOnDemand disables automatic mining: blocks are only mined when
+	// requested through the API, so tests control exactly when they appear.
+	MineOnDemand bool
+}
+
+// PowLimit returns PowLimitBits as a 256-bit number.
+func (p *Params) PowLimit() *big.Int {
+	return types.CompactToBig(p.PowLimitBits)
+}
+
+// genesisAlloc is the genesis allocation of the built-in networks.
+var genesisAlloc = []Allocation{
+	{Address: "04f8a1c2d3e4f5a6b7c8d9e0f1a2b3c4d5e6f7a8b9c0d1e2f3a4b5c6d7e8f9a0b1c2d3e4f5a6b7c8d9e0f1a2b3c4d5e6f7a8b9c0d1e2f3a4b5c6d7e8f9", Amount: 1000000},
+}
+
+// defaultEmission is the emission schedule of the built-in networks.
+var defaultEmission = Emission{
+	GenesisAllocation: 1000000,
+	InitialSubsidy:    50,
+	HalvingInterval:   210000,
+	MaxSupply:         21000000,
+}
+
+// MainNetParams defines the main network.
+var MainNetParams = Params{
+	Name:             "mainnet",
+	Net:              0x56554c43, // "VULC"
+	ChainID:          1,
+	DefaultPort:      6000,
+	DefaultAPIPort:   8080,
+	GenesisTimestamp: time.Unix(1577836800, 0).UTC(), // 2020-01-01
+	GenesisBits:      0x1f00ffff,
+	GenesisAlloc:     genesisAlloc,
+	PowLimitBits:     0x1f00ffff, // About 65536 hashes per block
+	TargetBlockTime:  10 * time.Second,
+	Emission:         defaultEmission,
+	CoinbaseMaturity: 100,
+}
+
+// TestNetParams defines the public test network. It follows the main
+// network's rules, but starts from its own genesis block.
+var TestNetParams = Params{
+	Name:             "testnet",
+	Net:              0x76756c74, // "vult"
+	ChainID:          2,
+	DefaultPort:      16000,
+	DefaultAPIPort:   18080,
+	GenesisTimestamp: time.Unix(1704067200, 0).UTC(), // 2024-01-01
+	GenesisBits:      0x1f00ffff,
+	GenesisAlloc:     genesisAlloc,
+	PowLimitBits:     0x1f00ffff,
+	TargetBlockTime:  10 * time.Second,
+	Emission:         defaultEmission,
+	CoinbaseMaturity: 100,
+}
+
+// RegTestParams defines a private network for regression testing.
+// Blocks take a hash or two to mine, the difficulty never changes, and
+// blocks are only mined on request.
+var RegTestParams = Params{
+	Name:             "regtest",
+	Net:              0x76756c72, // "vulr"
+	ChainID:          3,
+	DefaultPort:      26000,
+	DefaultAPIPort:   28080,
+	GenesisTimestamp: time.Unix(1577836800, 0).UTC(),
+	GenesisBits:      0x207fffff,
+	GenesisAlloc:     genesisAlloc,
+	PowLimitBits:     0x207fffff, // Every other hash is below the target
+	TargetBlockTime:  10 * time.Second,
+	NoRetarget:       true,
+	Emission:         defaultEmission,
+	CoinbaseMaturity: 100,
+	MineOnDemand:     true,
+}
+
+// Networks lists the built-in networks.
+var Networks = []*Params{&MainNetParams, &TestNetParams, &RegTestParams}
+
+// Lookup returns the built-in network with the given name.
+func Lookup(name string) (*Params, error) {
+	names := make([]string, len(Networks))
+	for i, params := range Networks {
+		if params.Name == name {
+			return params, nil
+		}
+		names[i] = params.Name
+	}
+	return nil, fmt.Errorf("unknown network %q (%s)", name, strings.Join(names, ", "))
+}
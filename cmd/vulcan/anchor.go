@@ -0,0 +1,55 @@
+package main
+
+import (
+	"encoding/hex"
+	"flag"
+	"log"
+
+	"github.com/OhMyDitzzy/vulcan/script"
+	"github.com/OhMyDitzzy/vulcan/wallet"
+)
+
+// runAnchor implements `vulcan anchor`, which anchors data, such as the
+// hash of a document, in a transaction with a data output. The transaction
+// is built and signed here from the key's coins, paying only the fee, and
+// broadcast through the node's API, so the key never leaves this process.
+// Once a block includes it, GET /anchor/:data finds the data.
+func runAnchor(args []string) {
+	fs := flag.NewFlagSet("anchor", flag.ExitOnError)
+	node := fs.String("node", "http://localhost:8080", "API of a node to broadcast the transaction through")
+	key := fs.String("key", "", "Private key paying the fee")
+	dataHex := fs.String("data", "", "Data to anchor (hex, at most 80 bytes)")
+	fee := fs.Uint64("fee", 1, "Fee of the transaction")
+	fs.Parse(args)
+
+	w, err := wallet.FromPrivateKey(*key)
+	if err != nil {
+		log.Fatalf("Invalid key: %v", err)
+	}
+	data, err := hex.DecodeString(*dataHex)
+	if err != nil || len(data) == 0 {
+		log.Fatalf("Invalid data %q", *dataHex)
+	}
+	lock, err := script.DataScript(data)
+	if err != nil {
+		log.Fatalf("Invalid data: %v", err)
+	}
+
+	n := &apiNode{url: *node}
+	health, err := n.health()
+	if err != nil {
+		log.Fatalf("%v", err)
+	}
+	coins, err := n.coins(w.Address, *fee)
+	if err != nil {
+		log.Fatalf("%v", err)
+	}
+	tx, err := w.CreateDataTransaction(health.ChainID, coins, lock, *fee)
+	if err != nil {
+		log.Fatalf("Failed to create transaction: %v", err)
+	}
+	if err := n.post("/tx", tx, nil); err != nil {
+		log.Fatalf("Failed to broadcast transaction: %v", err)
+	}
+	log.Printf("Anchored %x in %s", data, tx.ID)
+}
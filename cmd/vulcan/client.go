@@ -0,0 +1,150 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"time"
+
+	"github.com/OhMyDitzzy/vulcan/core"
+	"github.com/OhMyDitzzy/vulcan/types"
+	"github.com/OhMyDitzzy/vulcan/wallet"
+)
+
+// apiNode is the API of a node, for the commands that use one instead of
+// running their own. They keep their keys, and only send it signatures
+// and signed transactions.
+type apiNode struct {
+	url  string
+	mine bool          // Mine a block after broadcasting, instead of waiting for one
+	wait time.Duration // How long to wait for a transaction to confirm
+}
+
+type apiHealth struct {
+	Network          string `json:"network"`
+	ChainID          uint32 `json:"chain_id"`
+	Height           uint64 `json:"height"`
+	CoinbaseMaturity uint64 `json:"coinbase_maturity"`
+}
+
+func (n *apiNode) health() (*apiHealth, error) {
+	var health apiHealth
+	if err := n.get("/health", &health); err != nil {
+		return nil, err
+	}
+	return &health, nil
+}
+
+// coins returns the confirmed coins of an address that the next block may
+// spend, failing unless they add up to at least amount.
+func (n *apiNode) coins(address string, amount uint64) ([]wallet.Coin, error) {
+	health, err := n.health()
+	if err != nil {
+		return nil, err
+	}
+	var balance struct {
+		UTXOs []*core.UTXO `json:"utxos"`
+	}
+	if err := n.get("/balance/"+address, &balance); err != nil {
+		return nil, err
+	}
+
+	nextHeight := health.Height + 1
+	var coins []wallet.Coin
+	var total uint64
+	for _, utxo := range balance.UTXOs {
+		if utxo.Staked || utxo.UnlockHeight > nextHeight || !utxo.Mature(nextHeight, health.CoinbaseMaturity) {
+			continue
+		}
+		coins = append(coins, wallet.Coin{OutPoint: utxo.OutPoint(), Amount: utxo.Amount})
+		total += utxo.Amount
+	}
+	if total < amount {
+		return nil, fmt.Errorf("%s holds %d coins, expected %d", address, total, amount)
+	}
+	return coins, nil
+}
+
+// transaction returns a transaction known to the node.
+func (n *apiNode) transaction(txID string) (*types.Transaction, error) {
+	var resp struct {
+		Transaction *types.Transaction `json:"transaction"`
+	}
+	if err := n.get("/blockchain/tx/"+txID, &resp); err != nil {
+		return nil, err
+	}
+	return resp.Transaction, nil
+}
+
+// broadcast sends a transaction to the node and waits until it is
+// confirmed, mining the block itself, paid to miner, if the node is
+// mined on request.
+func (n *apiNode) broadcast(tx *types.Transaction, miner string) error {
+	if err := n.post("/tx", tx, nil); err != nil {
+		return err
+	}
+	if n.mine {
+		if err := n.post("/mine", map[string]interface{}{"miner_address": miner}, nil); err != nil {
+			return err
+		}
+	}
+
+	deadline := time.Now().Add(n.wait)
+	for {
+		var resp struct {
+			Status string `json:"status"`
+		}
+		if err := n.get("/blockchain/tx/"+tx.ID, &resp); err == nil && resp.Status == "confirmed" {
+			return nil
+		}
+		if time.Now().After(deadline) {
+			return fmt.Errorf("transaction %s was not confirmed within %s", tx.ID, n.wait)
+		}
+		time.Sleep(2 * time.Second)
+	}
+}
+
+func (n *apiNode) get(path string, out interface{}) error {
+	resp, err := http.Get(n.url + path)
+	if err != nil {
+		return err
+	}
+	return decodeResponse(resp, out)
+}
+
+func (n *apiNode) post(path string, body, out interface{}) error {
+	data, err := json.Marshal(body)
+	if err != nil {
+		return err
+	}
+	resp, err := http.Post(n.url+path, "application/json", bytes.NewReader(data))
+	if err != nil {
+		return err
+	}
+	return decodeResponse(resp, out)
+}
+
+// decodeResponse decodes a successful API response into out, and turns an
+// error response into an error.
+func decodeResponse(resp *http.Response, out interface{}) error {
+	defer resp.Body.Close()
+	data, err := io.ReadAll(resp.Body)
+	if err != nil {
+		return err
+	}
+	if resp.StatusCode != http.StatusOK {
+		var apiErr struct {
+			Error string `json:"error"`
+		}
+		if json.Unmarshal(data, &apiErr) == nil && apiErr.Error != "" {
+			return fmt.Errorf("%s", apiErr.Error)
+		}
+		return fmt.Errorf("%s: %s", resp.Status, data)
+	}
+	if out == nil {
+		return nil
+	}
+	return json.Unmarshal(data, out)
+}
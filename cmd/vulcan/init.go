@@ -0,0 +1,89 @@
+package main
+
+import (
+	"encoding/json"
+	"flag"
+	"fmt"
+	"log"
+
+	"github.com/OhMyDitzzy/vulcan/chaincfg"
+	"github.com/OhMyDitzzy/vulcan/store"
+)
+
+// runInit implements `vulcan init`, which starts a data directory on the
+// chain described by a genesis specification instead of its network's
+// built-in genesis block.
+func runInit(args []string) {
+	fs := flag.NewFlagSet("init", flag.ExitOnError)
+	genesisPath := fs.String("genesis", "", "Genesis specification file (JSON)")
+	networkName := fs.String("network", getEnv("NETWORK", "mainnet"), "Network whose rules the chain follows (mainnet, testnet, regtest)")
+	dbPath := fs.String("db-path", getEnv("DB_PATH", ""), "Database directory path (defaults to ./data, or ./data-<network> outside mainnet)")
+	fs.Parse(args)
+
+	if *genesisPath == "" {
+		log.Fatalf("A genesis specification is required (--genesis=file.json)")
+	}
+	base, err := chaincfg.Lookup(*networkName)
+	if err != nil {
+		log.Fatalf("Invalid network: %v", err)
+	}
+	if *dbPath == "" {
+		*dbPath = defaultDataDir(base)
+	}
+
+	genesis, err := chaincfg.LoadGenesis(*genesisPath)
+	if err != nil {
+		log.Fatalf("Failed to load genesis specification: %v", err)
+	}
+	params, err := genesis.Apply(base)
+	if err != nil {
+		log.Fatalf("Invalid genesis specification: %v", err)
+	}
+	spec, err := json.Marshal(genesis)
+	if err != nil {
+		log.Fatalf("Failed to encode genesis specification: %v", err)
+	}
+
+	db, err := store.NewBadgerStore(*dbPath)
+	if err != nil {
+		log.Fatalf("Failed to create database: %v", err)
+	}
+	defer db.Close()
+
+	if _, err := db.GetBlock(0); err == nil {
+		log.Fatalf("Data directory %s already holds a chain", *dbPath)
+	}
+	if existing, err := db.GetGenesis(); err != nil {
+		log.Fatalf("Failed to read database: %v", err)
+	} else if existing != nil {
+		log.Fatalf("Data directory %s is already initialized", *dbPath)
+	}
+
+	batch := store.NewBatch()
+	batch.SetGenesis(spec)
+	if err := db.Write(batch); err != nil {
+		log.Fatalf("Failed to write genesis specification: %v", err)
+	}
+
+	fmt.Printf("Initialized %s on %s\n", *dbPath, params.Name)
+	fmt.Printf("  - Chain ID:     %d\n", params.ChainID)
+	fmt.Printf("  - Allocations:  %d (%d coins)\n", len(params.GenesisAlloc), params.Emission.GenesisAllocation)
+	fmt.Printf("  - Genesis bits: %08x\n", params.GenesisBits)
+}
+
+// loadGenesis applies the genesis specification a data directory was
+// initialized with, if any, to the network parameters.
+func loadGenesis(db store.Store, base *chaincfg.Params) (*chaincfg.Params, error) {
+	spec, err := db.GetGenesis()
+	if err != nil {
+		return nil, err
+	}
+	if spec == nil {
+		return base, nil
+	}
+	genesis, err := chaincfg.ParseGenesis(spec)
+	if err != nil {
+		return nil, err
+	}
+	return genesis.Apply(base)
+}
@@ -1,6 +1,7 @@
 package main
 
 import (
+	"crypto/ecdsa"
 	"flag"
 	"fmt"
 	"log"
@@ -11,33 +12,78 @@ import (
 	"time"
 
 	"github.com/OhMyDitzzy/vulcan/api"
+	"github.com/OhMyDitzzy/vulcan/chaincfg"
 	"github.com/OhMyDitzzy/vulcan/consensus"
 	"github.com/OhMyDitzzy/vulcan/core"
+	"github.com/OhMyDitzzy/vulcan/finality"
 	"github.com/OhMyDitzzy/vulcan/miner"
 	"github.com/OhMyDitzzy/vulcan/p2p"
 	"github.com/OhMyDitzzy/vulcan/store"
 	"github.com/OhMyDitzzy/vulcan/txpool"
+	"github.com/OhMyDitzzy/vulcan/wallet"
 )
 
 func main() {
+	if len(os.Args) > 1 && os.Args[1] == "init" {
+		runInit(os.Args[2:])
+		return
+	}
+	if len(os.Args) > 1 && os.Args[1] == "swap" {
+		runSwap(os.Args[2:])
+		return
+	}
+	if len(os.Args) > 1 && os.Args[1] == "multisig" {
+		runMultisig(os.Args[2:])
+		return
+	}
+	if len(os.Args) > 1 && os.Args[1] == "anchor" {
+		runAnchor(os.Args[2:])
+		return
+	}
+
 	// Parse command-line flags
-	apiPort := flag.Int("api-port", getEnvInt("API_PORT", 8080), "API server port")
-	p2pPort := flag.Int("port", getEnvInt("P2P_PORT", 6000), "P2P network port")
-	dbPath := flag.String("db-path", getEnv("DB_PATH", "./data"), "Database directory path")
+	networkName := flag.String("network", getEnv("NETWORK", "mainnet"), "Network to join (mainnet, testnet, regtest)")
+	apiPort := flag.Int("api-port", getEnvInt("API_PORT", 0), "API server port (0 uses the network's default)")
+	p2pPort := flag.Int("port", getEnvInt("P2P_PORT", 0), "P2P network port (0 uses the network's default)")
+	dbPath := flag.String("db-path", getEnv("DB_PATH", ""), "Database directory path (defaults to ./data, or ./data-<network> outside mainnet)")
 	peersStr := flag.String("peers", getEnv("BOOTSTRAP_PEERS", ""), "Comma-separated list of bootstrap peers")
 	enableMining := flag.Bool("mining", getEnvBool("ENABLE_MINING", false), "Enable automatic mining")
 	minerAddress := flag.String("miner-address", getEnv("MINER_ADDRESS", ""), "Address to receive mining rewards")
-	difficulty := flag.Int("difficulty", getEnvInt("DIFFICULTY", 4), "Mining difficulty (leading zeros)")
+	consensusName := flag.String("consensus", getEnv("CONSENSUS", "pow"), "Consensus engine (pow, poa, pos)")
+	minerThreads := flag.Int("miner-threads", getEnvInt("MINER_THREADS", 0), "Number of mining threads (0 uses every CPU)")
+	poaSigners := flag.String("poa-signers", getEnv("POA_SIGNERS", ""), "Comma-separated list of initial PoA signer addresses")
+	poaKey := flag.String("poa-key", getEnv("POA_KEY", ""), "Private key this node signs PoA blocks with")
+	poaPeriod := flag.Int("poa-period", getEnvInt("POA_PERIOD", 5), "Minimum number of seconds between PoA blocks")
+	posValidators := flag.String("pos-validators", getEnv("POS_VALIDATORS", ""), "Comma-separated list of genesis PoS validator addresses")
+	posKey := flag.String("pos-key", getEnv("POS_KEY", ""), "Private key this node proposes PoS blocks with")
+	posSlot := flag.Int("pos-slot", getEnvInt("POS_SLOT", 5), "Length of a PoS slot in seconds")
+	finalityValidators := flag.String("finality-validators", getEnv("FINALITY_VALIDATORS", ""), "Comma-separated list of finality validator addresses (empty disables finality)")
+	finalityKey := flag.String("finality-key", getEnv("FINALITY_KEY", ""), "Private key this node signs finality votes with")
+	checkpointInterval := flag.Int("checkpoint-interval", getEnvInt("CHECKPOINT_INTERVAL", finality.DefaultCheckpointInterval), "Number of blocks between finality checkpoints")
 	
 	flag.Parse()
 
+	params, err := chaincfg.Lookup(*networkName)
+	if err != nil {
+		log.Fatalf("Invalid network: %v", err)
+	}
+	if *apiPort == 0 {
+		*apiPort = params.DefaultAPIPort
+	}
+	if *p2pPort == 0 {
+		*p2pPort = params.DefaultPort
+	}
+	if *dbPath == "" {
+		*dbPath = defaultDataDir(params)
+	}
+
 	fmt.Println("╔══════════════════════════════════════╗")
 	fmt.Println("║    Vulcan Blockchain Node v1.0.0     ║")
 	fmt.Println("╚══════════════════════════════════════╝")
 	fmt.Println()
 
 	// Initialize components
-	log.Println("Initializing blockchain node...")
+	log.Printf("Initializing blockchain node on %s...", params.Name)
 	
 	// Create database
 	db, err := store.NewBadgerStore(*dbPath)
@@ -47,33 +93,66 @@ func main() {
 	defer db.Close()
 	log.Printf("✓ Database initialized at %s", *dbPath)
 
+	// Apply the genesis specification of an initialized data directory
+	params, err = loadGenesis(db, params)
+	if err != nil {
+		log.Fatalf("Failed to load genesis specification: %v", err)
+	}
+
 	// Initialize UTXO set
-	utxoSet := core.NewUTXOSet()
+	utxoSet := core.NewUTXOSet(params.CoinbaseMaturity)
 	
+	// Initialize transaction pool
+	mempool := txpool.NewMempool()
+	log.Println("✓ Transaction pool initialized")
+
+	// Initialize consensus
+	engine, err := newEngine(*consensusName, engineConfig{
+		params:        params,
+		minerThreads:  *minerThreads,
+		poaSigners:    *poaSigners,
+		poaKey:        *poaKey,
+		poaPeriod:     time.Duration(*poaPeriod) * time.Second,
+		posValidators: *posValidators,
+		posKey:        *posKey,
+		posSlot:       time.Duration(*posSlot) * time.Second,
+	})
+	if err != nil {
+		log.Fatalf("Failed to initialize consensus: %v", err)
+	}
+	log.Printf("✓ Consensus engine initialized (%s)", engine.Name())
+
 	// Initialize blockchain with genesis block
-	blockchain := core.NewBlockchain(db, utxoSet)
+	blockchain := core.NewBlockchain(params, db, utxoSet, mempool, engine)
 	if err := blockchain.Initialize(); err != nil {
 		log.Fatalf("Failed to initialize blockchain: %v", err)
 	}
-	log.Printf("✓ Blockchain initialized (height: %d)", blockchain.GetHeight())
+	log.Printf("✓ Blockchain initialized (height: %d, genesis: %s)", blockchain.GetHeight(), blockchain.GetBlock(0).Hash)
+	log.Printf("✓ Chainstate loaded (%d UTXOs)", utxoSet.Count())
 
-	// Rebuild UTXO set from blockchain
-	log.Println("Rebuilding UTXO set from blockchain...")
-	if err := utxoSet.Rebuild(blockchain); err != nil {
-		log.Fatalf("Failed to rebuild UTXO set: %v", err)
+	// Initialize finality gadget
+	var gadget *finality.Gadget
+	if *finalityValidators != "" {
+		key, err := parseKey(*finalityKey)
+		if err != nil {
+			log.Fatalf("Invalid finality key: %v", err)
+		}
+		if *checkpointInterval <= 0 {
+			log.Fatalf("Checkpoint interval must be positive")
+		}
+		gadget, err = finality.NewGadget(blockchain, splitList(*finalityValidators), uint64(*checkpointInterval), key)
+		if err != nil {
+			log.Fatalf("Failed to initialize finality gadget: %v", err)
+		}
+		log.Printf("✓ Finality gadget initialized (%d validators, checkpoint every %d blocks)", len(gadget.Validators()), gadget.Interval())
 	}
-	log.Printf("✓ UTXO set rebuilt (%d UTXOs)", utxoSet.Count())
-
-	// Initialize transaction pool
-	mempool := txpool.NewMempool()
-	log.Println("✓ Transaction pool initialized")
-
-	// Initialize consensus
-	pow := consensus.NewProofOfWork(*difficulty, 10*time.Second)
-	log.Printf("✓ Proof-of-Work consensus initialized (difficulty: %d)", *difficulty)
 
 	// Initialize miner
-	blockMiner := miner.NewMiner(blockchain, mempool, pow, utxoSet)
+	blockMiner := miner.NewMiner(blockchain, mempool, engine, utxoSet)
+	if *enableMining && params.MineOnDemand {
+		log.Printf("⚠ Automatic mining is disabled on %s, mine blocks with POST /mine", params.Name)
+		*enableMining = false
+	}
 	if *enableMining {
 		if *minerAddress == "" {
 			log.Println("⚠ Mining enabled but no miner address specified")
@@ -89,14 +168,17 @@ func main() {
 		peers = strings.Split(*peersStr, ",")
 	}
 	
-	p2pNode := p2p.NewNode(*p2pPort, blockchain, mempool, peers)
+	p2pNode := p2p.NewNode(params, *p2pPort, blockchain, mempool, engine, gadget, peers)
 	if err := p2pNode.Start(); err != nil {
 		log.Fatalf("Failed to start P2P node: %v", err)
 	}
 	log.Printf("✓ P2P node started on port %d", *p2pPort)
+	if gadget != nil {
+		go gadget.Start(p2pNode.BroadcastVote)
+	}
 
 	// Initialize API server
-	apiServer := api.NewServer(*apiPort, blockchain, mempool, blockMiner, p2pNode, utxoSet)
+	apiServer := api.NewServer(*apiPort, blockchain, mempool, blockMiner, p2pNode, utxoSet, engine, gadget)
 	go func() {
 		log.Printf("✓ API server starting on port %d", *apiPort)
 		if err := apiServer.Start(); err != nil {
@@ -107,6 +189,8 @@ func main() {
 	// Print node information
 	fmt.Println()
 	fmt.Println("Node Information:")
+	fmt.Printf("  - Network:       %s\n", params.Name)
+	fmt.Printf("  - Chain ID:      %d\n", params.ChainID)
 	fmt.Printf("  - API Endpoint:  http://localhost:%d\n", *apiPort)
 	fmt.Printf("  - P2P Address:   localhost:%d\n", *p2pPort)
 	fmt.Printf("  - Blockchain Height: %d\n", blockchain.GetHeight())
@@ -127,10 +211,72 @@ func main() {
 	if *enableMining {
 		blockMiner.Stop()
 	}
+	if gadget != nil {
+		gadget.Stop()
+	}
 	p2pNode.Stop()
 	log.Println("✓ Node stopped successfully")
 }
 
+// engineConfig holds the settings of every consensus engine.
+type engineConfig struct {
+	params        *chaincfg.Params
+	minerThreads  int
+	poaSigners    string
+	poaKey        string
+	poaPeriod     time.Duration
+	posValidators string
+	posKey        string
+	posSlot       time.Duration
+}
+
+// newEngine creates the consensus engine selected by name.
+func newEngine(name string, cfg engineConfig) (consensus.Engine, error) {
+	switch name {
+	case "pow":
+		return consensus.NewProofOfWork(cfg.params, cfg.minerThreads), nil
+	case "poa":
+		key, err := parseKey(cfg.poaKey)
+		if err != nil {
+			return nil, fmt.Errorf("invalid PoA key: %w", err)
+		}
+		return consensus.NewProofOfAuthority(cfg.params, splitList(cfg.poaSigners), cfg.poaPeriod, key)
+	case "pos":
+		key, err := parseKey(cfg.posKey)
+		if err != nil {
+			return nil, fmt.Errorf("invalid PoS key: %w", err)
+		}
+		return consensus.NewProofOfStake(cfg.params, splitList(cfg.posValidators), cfg.posSlot, key)
+	default:
+		return nil, fmt.Errorf("unknown consensus engine %q", name)
+	}
+}
+
+// defaultDataDir returns the database directory of a network, keeping the
+// data of every network apart.
+func defaultDataDir(params *chaincfg.Params) string {
+	if params == &chaincfg.MainNetParams {
+		return "./data"
+	}
+	return "./data-" + params.Name
+}
+
+// parseKey parses a hex private key, or returns nil if it is empty.
+func parseKey(hexKey string) (*ecdsa.PrivateKey, error) {
+	if hexKey == "" {
+		return nil, nil
+	}
+	return wallet.PrivateKeyFromHex(hexKey)
+}
+
+// splitList splits a comma-separated list, returning nil if it is empty.
+func splitList(list string) []string {
+	if list == "" {
+		return nil
+	}
+	return strings.Split(list, ",")
+}
+
 // Helper functions to read environment variables with defaults
 func getEnv(key, defaultValue string) string {
 	if value := os.Getenv(key); value != "" {
@@ -0,0 +1,90 @@
+package main
+
+import (
+	"encoding/hex"
+	"encoding/json"
+	"flag"
+	"fmt"
+	"io"
+	"log"
+	"os"
+
+	"github.com/OhMyDitzzy/vulcan/types"
+	"github.com/OhMyDitzzy/vulcan/wallet"
+)
+
+// runMultisig implements `vulcan multisig sign`, which signs a transaction
+// spending from a multisig address as one of its co-signers. It reads the
+// transaction and its signature hashes as POST /multisig/tx returns them,
+// and prints the co-signer's signatures for POST /multisig/combine. The key
+// never leaves this process, and what it signs is computed here from the
+// transaction rather than taken from the node.
+func runMultisig(args []string) {
+	if len(args) == 0 || args[0] != "sign" {
+		log.Fatalf("Usage: vulcan multisig sign --key=<private key> [--tx=<file>]")
+	}
+	fs := flag.NewFlagSet("multisig sign", flag.ExitOnError)
+	node := fs.String("node", "http://localhost:8080", "API of a node on the transaction's chain")
+	key := fs.String("key", "", "Private key of the co-signer")
+	txPath := fs.String("tx", "-", "Response of POST /multisig/tx to sign (- reads standard input)")
+	fs.Parse(args[1:])
+
+	w, err := wallet.FromPrivateKey(*key)
+	if err != nil {
+		log.Fatalf("Invalid key: %v", err)
+	}
+
+	var data []byte
+	if *txPath == "-" {
+		data, err = io.ReadAll(os.Stdin)
+	} else {
+		data, err = os.ReadFile(*txPath)
+	}
+	if err != nil {
+		log.Fatalf("Failed to read transaction: %v", err)
+	}
+	var unsigned struct {
+		Transaction types.Transaction `json:"transaction"`
+		Sighashes   []string          `json:"sighashes"`
+	}
+	if err := json.Unmarshal(data, &unsigned); err != nil {
+		log.Fatalf("Invalid transaction: %v", err)
+	}
+	tx := &unsigned.Transaction
+	if len(tx.Inputs) == 0 {
+		log.Fatalf("Transaction has no inputs to sign")
+	}
+	if len(unsigned.Sighashes) != len(tx.Inputs) {
+		log.Fatalf("Got %d signature hashes for %d inputs", len(unsigned.Sighashes), len(tx.Inputs))
+	}
+	for i, sighash := range unsigned.Sighashes {
+		if sighash != hex.EncodeToString(tx.DataToSign(i)) {
+			log.Fatalf("Signature hash of input %d does not match the transaction", i)
+		}
+	}
+
+	// Signatures commit to the chain ID, so only sign for the node's chain
+	health, err := (&apiNode{url: *node}).health()
+	if err != nil {
+		log.Fatalf("%v", err)
+	}
+	if tx.ChainID != health.ChainID {
+		log.Fatalf("Transaction is for chain %d, the node is on chain %d", tx.ChainID, health.ChainID)
+	}
+
+	for _, out := range tx.Outputs {
+		log.Printf("Signing a payment of %d coins to %s", out.Amount, out.Address)
+	}
+	signatures, err := w.Cosign(tx)
+	if err != nil {
+		log.Fatalf("Failed to sign: %v", err)
+	}
+	out, err := json.MarshalIndent(map[string]interface{}{
+		"pub_key":    w.Address,
+		"signatures": signatures,
+	}, "", "  ")
+	if err != nil {
+		log.Fatalf("Failed to encode signatures: %v", err)
+	}
+	fmt.Println(string(out))
+}
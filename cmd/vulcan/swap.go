@@ -0,0 +1,219 @@
+package main
+
+import (
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/hex"
+	"flag"
+	"fmt"
+	"log"
+	"time"
+
+	"github.com/OhMyDitzzy/vulcan/swap"
+	"github.com/OhMyDitzzy/vulcan/types"
+	"github.com/OhMyDitzzy/vulcan/wallet"
+)
+
+// runSwap implements `vulcan swap`, which performs an atomic swap between
+// two chains through the API of a node on each: Alice trades amount-a coins
+// on chain A for Bob's amount-b coins on chain B. It plays both parties, so
+// it needs both private keys; every step is one the party could take on
+// its own, and the secret only passes between them through chain B. Keys
+// never leave this process: every transaction is built and signed here, and
+// the nodes only see signed transactions.
+//
+// The contracts' lock times are Unix times rather than block heights, so
+// the timeouts mean the same on both chains whatever their block times.
+//
+// `vulcan swap refund` takes the coins of an HTLC back after its lock time.
+func runSwap(args []string) {
+	if len(args) > 0 && args[0] == "refund" {
+		runRefund(args[1:])
+		return
+	}
+
+	fs := flag.NewFlagSet("swap", flag.ExitOnError)
+	nodeA := fs.String("node-a", "http://localhost:8080", "API of a node on chain A")
+	nodeB := fs.String("node-b", "http://localhost:18080", "API of a node on chain B")
+	keyA := fs.String("key-a", "", "Private key of Alice, who pays on chain A")
+	keyB := fs.String("key-b", "", "Private key of Bob, who pays on chain B")
+	amountA := fs.Uint64("amount-a", 0, "Coins Alice pays on chain A")
+	amountB := fs.Uint64("amount-b", 0, "Coins Bob pays on chain B")
+	fee := fs.Uint64("fee", 1, "Fee of every transaction")
+	timeoutA := fs.Duration("timeout-a", 48*time.Hour, "Time before Alice can take her coins back on chain A")
+	timeoutB := fs.Duration("timeout-b", 24*time.Hour, "Time before Bob can take his coins back on chain B")
+	mine := fs.Bool("mine", false, "Mine a block after every transaction, for regtest nodes")
+	wait := fs.Duration("wait", 10*time.Minute, "How long to wait for each transaction to confirm")
+	fs.Parse(args)
+
+	if *keyA == "" || *keyB == "" || *amountA == 0 || *amountB == 0 {
+		log.Fatalf("--key-a, --key-b, --amount-a and --amount-b are required")
+	}
+	// Bob must have time to claim on chain A after Alice revealed the secret on chain B
+	if *timeoutA <= *timeoutB {
+		log.Fatalf("--timeout-a must be longer than --timeout-b")
+	}
+	alice, err := wallet.FromPrivateKey(*keyA)
+	if err != nil {
+		log.Fatalf("Invalid key of Alice: %v", err)
+	}
+	bob, err := wallet.FromPrivateKey(*keyB)
+	if err != nil {
+		log.Fatalf("Invalid key of Bob: %v", err)
+	}
+
+	a := &apiNode{url: *nodeA, mine: *mine, wait: *wait}
+	b := &apiNode{url: *nodeB, mine: *mine, wait: *wait}
+	healthA, err := a.health()
+	if err != nil {
+		log.Fatalf("Chain A: %v", err)
+	}
+	healthB, err := b.health()
+	if err != nil {
+		log.Fatalf("Chain B: %v", err)
+	}
+	log.Printf("Chain A: %s (chain ID %d) at height %d", healthA.Network, healthA.ChainID, healthA.Height)
+	log.Printf("Chain B: %s (chain ID %d) at height %d", healthB.Network, healthB.ChainID, healthB.Height)
+
+	// Alice picks the secret, and only shares its hash
+	secret := make([]byte, 32)
+	if _, err := rand.Read(secret); err != nil {
+		log.Fatalf("Failed to generate secret: %v", err)
+	}
+	hash := sha256.Sum256(secret)
+	log.Printf("Alice chose a secret with hash %x", hash)
+
+	// Alice locks her coins on chain A for Bob
+	start := time.Now()
+	htlcA := &swap.HTLC{Hash: hash, Recipient: bob.Address, Sender: alice.Address, LockTime: uint32(start.Add(*timeoutA).Unix())}
+	addrA := fund(a, "A", healthA.ChainID, alice, htlcA, *amountA, *fee)
+
+	// Bob checks Alice's contract before locking his coins on chain B for her
+	if _, err := a.coins(addrA, *amountA); err != nil {
+		log.Fatalf("Bob could not find Alice's contract on chain A: %v", err)
+	}
+	htlcB := &swap.HTLC{Hash: hash, Recipient: alice.Address, Sender: bob.Address, LockTime: uint32(start.Add(*timeoutB).Unix())}
+	addrB := fund(b, "B", healthB.ChainID, bob, htlcB, *amountB, *fee)
+
+	// Alice claims Bob's coins on chain B, revealing the secret
+	coinsB, err := b.coins(addrB, *amountB)
+	if err != nil {
+		log.Fatalf("Alice could not find Bob's contract on chain B: %v", err)
+	}
+	claimB, err := htlcB.Claim(alice, healthB.ChainID, coinsB, secret, alice.Address, *fee)
+	if err != nil {
+		log.Fatalf("Alice failed to claim on chain B: %v", err)
+	}
+	if err := b.broadcast(claimB, alice.Address); err != nil {
+		log.Fatalf("Alice failed to claim on chain B: %v", err)
+	}
+	log.Printf("Alice claimed %d coins on chain B in %s", claimB.OutputTotal(), claimB.ID)
+
+	// Bob learns the secret from Alice's claim and claims her coins on chain A
+	revealed, err := b.transaction(claimB.ID)
+	if err != nil {
+		log.Fatalf("Bob could not find Alice's claim on chain B: %v", err)
+	}
+	learned, err := htlcB.ExtractSecret(revealed)
+	if err != nil {
+		log.Fatalf("Bob could not learn the secret: %v", err)
+	}
+	coinsA, err := a.coins(addrA, *amountA)
+	if err != nil {
+		log.Fatalf("Bob could not find Alice's contract on chain A: %v", err)
+	}
+	claimA, err := htlcA.Claim(bob, healthA.ChainID, coinsA, learned, bob.Address, *fee)
+	if err != nil {
+		log.Fatalf("Bob failed to claim on chain A: %v", err)
+	}
+	if err := a.broadcast(claimA, bob.Address); err != nil {
+		log.Fatalf("Bob failed to claim on chain A: %v", err)
+	}
+	log.Printf("Bob claimed %d coins on chain A in %s", claimA.OutputTotal(), claimA.ID)
+	log.Printf("✓ Swap complete")
+}
+
+// fund has a party lock amount coins in an HTLC and waits until it is
+// confirmed. The funding transaction is signed locally from the party's
+// coins. It returns the HTLC's address.
+func fund(node *apiNode, chain string, chainID uint32, w *wallet.Wallet, htlc *swap.HTLC, amount, fee uint64) string {
+	address, err := htlc.Address()
+	if err != nil {
+		log.Fatalf("Invalid contract on chain %s: %v", chain, err)
+	}
+
+	coins, err := node.coins(w.Address, amount+fee)
+	var tx *types.Transaction
+	if err == nil {
+		tx, err = w.CreateAndSignTransaction(chainID, coins, address, amount, fee)
+	}
+	if err == nil {
+		err = node.broadcast(tx, w.Address)
+	}
+	if err != nil {
+		log.Fatalf("Failed to fund the contract on chain %s: %v", chain, err)
+	}
+	log.Printf("Locked %d coins on chain %s in %s, refundable from %s", amount, chain, address, describeLock(htlc.LockTime))
+	return address
+}
+
+func describeLock(lockTime uint32) string {
+	if lockTime < types.LockTimeThreshold {
+		return fmt.Sprintf("block %d", lockTime)
+	}
+	return time.Unix(int64(lockTime), 0).UTC().Format(time.RFC3339)
+}
+
+// runRefund implements `vulcan swap refund`, which sends the coins of an
+// HTLC back to its sender. Before the lock time, the node holds the refund
+// until it becomes valid.
+func runRefund(args []string) {
+	fs := flag.NewFlagSet("swap refund", flag.ExitOnError)
+	node := fs.String("node", "http://localhost:8080", "API of a node on the contract's chain")
+	key := fs.String("key", "", "Private key of the contract's sender")
+	hashHex := fs.String("hash", "", "Hash of the contract's secret (hex)")
+	recipient := fs.String("recipient", "", "Public key of the contract's recipient")
+	lockTime := fs.Uint("lock-time", 0, "Lock time of the contract")
+	fee := fs.Uint64("fee", 1, "Fee of the refund")
+	fs.Parse(args)
+
+	sender, err := wallet.FromPrivateKey(*key)
+	if err != nil {
+		log.Fatalf("Invalid key: %v", err)
+	}
+	htlc := &swap.HTLC{Recipient: *recipient, Sender: sender.Address, LockTime: uint32(*lockTime)}
+	if hash, err := hex.DecodeString(*hashHex); err != nil || len(hash) != len(htlc.Hash) {
+		log.Fatalf("Invalid hash %q", *hashHex)
+	} else {
+		copy(htlc.Hash[:], hash)
+	}
+	address, err := htlc.Address()
+	if err != nil {
+		log.Fatalf("Invalid contract: %v", err)
+	}
+
+	n := &apiNode{url: *node}
+	health, err := n.health()
+	if err != nil {
+		log.Fatalf("%v", err)
+	}
+	coins, err := n.coins(address, 1)
+	if err != nil {
+		log.Fatalf("%v", err)
+	}
+	tx, err := htlc.Refund(sender, health.ChainID, coins, sender.Address, *fee)
+	if err != nil {
+		log.Fatalf("Failed to create refund: %v", err)
+	}
+	var resp struct {
+		Held bool `json:"held"`
+	}
+	if err := n.post("/tx", tx, &resp); err != nil {
+		log.Fatalf("Failed to broadcast refund: %v", err)
+	}
+	if resp.Held {
+		log.Printf("Refund %s is held until %s", tx.ID, describeLock(htlc.LockTime))
+	} else {
+		log.Printf("Refunded %d coins in %s", tx.OutputTotal(), tx.ID)
+	}
+}
@@ -0,0 +1,64 @@
+package consensus
+
+import (
+	"math/big"
+
+	"github.com/OhMyDitzzy/vulcan/chaincfg"
+	"github.com/OhMyDitzzy/vulcan/types"
+)
+
+// RetargetWindow is the number of recent blocks whose targets and
+// timestamps the retarget rule averages over.
+const RetargetWindow = 17
+
+// calcNextRequiredBits returns the compact target required for the block after parent.
+// The target is retargeted every block: we take the average target of the
+// last RetargetWindow blocks and scale it by how long those blocks actually
+// took compared to how long they should have taken, at the network's
+// target block time. The measured timespan is
+// damped to a quarter of its deviation and clamped, so a few blocks with
+// odd timestamps only nudge the target instead of swinging it. Timespans are
+// measured between median times past, which a single miner can't skew.
+// Since this only depends on the branch's own history, all nodes agree on it.
+// Networks without retargeting keep the genesis target.
+func calcNextRequiredBits(chain ChainReader, parent *types.BlockHeader, params *chaincfg.Params) uint32 {
+	if params.NoRetarget {
+		return parent.Bits
+	}
+
+	// Wait until both ends of the window have a full median time past
+	// that doesn't include the arbitrary genesis timestamp
+	if parent.Index < RetargetWindow+MedianTimeBlocks {
+		return parent.Bits
+	}
+
+	window := ancestors(chain, parent, RetargetWindow+1)
+	if len(window) != RetargetWindow+1 {
+		return parent.Bits
+	}
+	first := window[RetargetWindow]
+
+	avgTarget := new(big.Int)
+	for _, h := range window[:RetargetWindow] {
+		avgTarget.Add(avgTarget, types.CompactToBig(h.Bits))
+	}
+	avgTarget.Div(avgTarget, big.NewInt(RetargetWindow))
+
+	expected := int64(RetargetWindow * params.TargetBlockTime)
+	actual := int64(MedianTimePast(chain, parent).Sub(MedianTimePast(chain, first)))
+
+	timespan := expected + (actual-expected)/4
+	if minTimespan := expected * 3 / 4; timespan < minTimespan {
+		timespan = minTimespan
+	}
+	if maxTimespan := expected * 3 / 2; timespan > maxTimespan {
+		timespan = maxTimespan
+	}
+
+	next := avgTarget.Mul(avgTarget, big.NewInt(timespan))
+	next.Div(next, big.NewInt(expected))
+	if powLimit := params.PowLimit(); next.Cmp(powLimit) > 0 {
+		next.Set(powLimit)
+	}
+	return types.BigToCompact(next)
+}
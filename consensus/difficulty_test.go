@@ -0,0 +1,101 @@
+package consensus
+
+import (
+	"math/big"
+	"testing"
+	"time"
+
+	"github.com/OhMyDitzzy/vulcan/chaincfg"
+	"github.com/OhMyDitzzy/vulcan/types"
+)
+
+// testChain is a block tree of headers, looked up by hash.
+type testChain map[string]*types.BlockHeader
+
+func (c testChain) GetHeader(hash string) *types.BlockHeader {
+	return c[hash]
+}
+
+// buildChain returns a chain of n+1 headers with the given bits, where
+// every block after genesis comes spacing after its parent, and its tip.
+func buildChain(n int, bits uint32, spacing time.Duration) (testChain, *types.BlockHeader) {
+	chain := make(testChain)
+	start := time.Unix(1700000000, 0).UTC()
+
+	var parent *types.BlockHeader
+	for i := 0; i <= n; i++ {
+		h := &types.BlockHeader{
+			Version:   types.BlockVersion,
+			Index:     uint64(i),
+			Timestamp: start.Add(time.Duration(i) * spacing),
+			Bits:      bits,
+		}
+		if parent != nil {
+			h.PreviousHash = parent.ComputeHash()
+		}
+		chain[h.ComputeHash()] = h
+		parent = h
+	}
+	return chain, parent
+}
+
+func TestCalcNextRequiredBits(t *testing.T) {
+	params := chaincfg.MainNetParams
+	const bits = 0x1e0fffff
+	target := types.CompactToBig(bits)
+	spacing := params.TargetBlockTime
+	length := RetargetWindow + MedianTimeBlocks + 5
+
+	scaled := func(num, den int64) *big.Int {
+		n := new(big.Int).Mul(target, big.NewInt(num))
+		return n.Div(n, big.NewInt(den))
+	}
+
+	tests := []struct {
+		name    string
+		spacing time.Duration
+		want    *big.Int
+	}{
+		{"on time", spacing, target},
+		// A quarter of the deviation counts: 1 - (1 - 1/2)/4
+		{"twice as fast", spacing / 2, scaled(7, 8)},
+		// 1 + (2 - 1)/4
+		{"twice as slow", spacing * 2, scaled(5, 4)},
+		{"clamped fast", time.Nanosecond, scaled(3, 4)},
+		{"clamped slow", spacing * 100, scaled(3, 2)},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			chain, tip := buildChain(length, bits, tt.spacing)
+			got := calcNextRequiredBits(chain, tip, &params)
+			if want := types.BigToCompact(tt.want); got != want {
+				t.Fatalf("got bits %08x, want %08x", got, want)
+			}
+		})
+	}
+}
+
+func TestCalcNextRequiredBitsLimits(t *testing.T) {
+	params := chaincfg.MainNetParams
+	spacing := params.TargetBlockTime
+
+	// The target never rises above the proof-of-work limit
+	chain, tip := buildChain(RetargetWindow+MedianTimeBlocks+5, params.PowLimitBits, spacing*10)
+	if got := calcNextRequiredBits(chain, tip, &params); got != params.PowLimitBits {
+		t.Fatalf("got bits %08x, want the limit %08x", got, params.PowLimitBits)
+	}
+
+	// Young chains keep their target until the window is full
+	chain, tip = buildChain(RetargetWindow+MedianTimeBlocks-1, 0x1e0fffff, spacing*10)
+	if got := calcNextRequiredBits(chain, tip, &params); got != 0x1e0fffff {
+		t.Fatalf("got bits %08x before the window is full, want 1e0fffff", got)
+	}
+
+	// Networks without retargeting keep the parent's target
+	regtest := chaincfg.RegTestParams
+	chain, tip = buildChain(RetargetWindow+MedianTimeBlocks+5, 0x1f00ffff, spacing/10)
+	if got := calcNextRequiredBits(chain, tip, &regtest); got != 0x1f00ffff {
+		t.Fatalf("got bits %08x without retargeting, want 1f00ffff", got)
+	}
+}
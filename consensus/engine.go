@@ -0,0 +1,93 @@
+package consensus
+
+import (
+	"context"
+	"math/big"
+	"sort"
+	"time"
+
+	"github.com/OhMyDitzzy/vulcan/types"
+)
+
+// MedianTimeBlocks is the number of previous blocks whose median
+// timestamp a new block must be later than.
+const MedianTimeBlocks = 11
+
+// ChainReader gives an engine read access to the block tree.
+// Engines only ever see headers, so they don't depend on how blocks and
+// their bodies are stored.
+type ChainReader interface {
+	// GetHeader returns the header of the block with the given hash,
+	// on any branch, or nil if the block is unknown.
+	GetHeader(hash string) *types.BlockHeader
+}
+
+// Engine is a consensus algorithm.
+// It decides who may produce a block and how: it fills in and seals the
+// consensus fields of new headers, verifies them on headers from peers,
+// and defines how much work a block adds to its branch and what its
+// producer is rewarded. The blockchain, miner and p2p layer only talk to
+// this interface, so nodes can run different engines.
+type Engine interface {
+	// Name returns the name the engine is selected by.
+	Name() string
+
+	// PrepareGenesis fills in the consensus fields of the genesis header,
+	// such as the initial difficulty or set of block signers.
+	PrepareGenesis(header *types.BlockHeader)
+
+	// Prepare fills in the consensus fields of a new header, such as its
+	// difficulty, for a block on top of the header's parent.
+	Prepare(chain ChainReader, header *types.BlockHeader) error
+
+	// Seal finalizes a prepared header so it satisfies the consensus rules,
+	// for example by finding a proof-of-work nonce. The header's fields
+	// other than the consensus ones must not change afterwards.
+	// It returns the context's error if ctx is cancelled first.
+	Seal(ctx context.Context, chain ChainReader, header *types.BlockHeader) error
+
+	// VerifyHeader checks that a header's consensus fields and seal are
+	// valid for a block on top of its parent.
+	VerifyHeader(chain ChainReader, header *types.BlockHeader) error
+
+	// CalcDifficulty returns the difficulty, in the header's Bits field,
+	// required for a block on top of parent.
+	CalcDifficulty(chain ChainReader, parent *types.BlockHeader) uint32
+
+	// BlockReward returns the amount the coinbase of the block may create,
+	// on top of the fees of the block's transactions. For the genesis block
+	// it is the genesis allocation, and chain may be nil.
+	BlockReward(chain ChainReader, header *types.BlockHeader) uint64
+
+	// Work returns how much the block adds to its branch's total work,
+	// which fork choice compares.
+	Work(header *types.BlockHeader) *big.Int
+}
+
+// ancestors returns the header and up to n-1 of its ancestors, newest first.
+func ancestors(chain ChainReader, header *types.BlockHeader, n int) []*types.BlockHeader {
+	headers := make([]*types.BlockHeader, 0, n)
+	for h := header; h != nil && len(headers) < n; {
+		headers = append(headers, h)
+		if h.Index == 0 {
+			break
+		}
+		h = chain.GetHeader(h.PreviousHash)
+	}
+	return headers
+}
+
+// MedianTimePast returns the median timestamp of a header and the blocks
+// before it, looking back at most MedianTimeBlocks blocks.
+func MedianTimePast(chain ChainReader, header *types.BlockHeader) time.Time {
+	headers := ancestors(chain, header, MedianTimeBlocks)
+	timestamps := make([]time.Time, len(headers))
+	for i, h := range headers {
+		timestamps[i] = h.Timestamp
+	}
+
+	sort.Slice(timestamps, func(i, j int) bool {
+		return timestamps[i].Before(timestamps[j])
+	})
+	return timestamps[len(timestamps)/2]
+}
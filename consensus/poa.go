@@ -0,0 +1,607 @@
+package consensus
+
+import (
+	"context"
+	"crypto/ecdsa"
+	"errors"
+	"fmt"
+	"math/big"
+	"sort"
+	"sync"
+	"time"
+
+	"github.com/OhMyDitzzy/vulcan/chaincfg"
+	"github.com/OhMyDitzzy/vulcan/types"
+	"github.com/OhMyDitzzy/vulcan/wallet"
+)
+
+// Proof-of-Authority block weights, stored in the header's Bits field.
+// A block signed by the signer whose turn it is weighs more than one signed
+// out of turn, so fork choice prefers the chain where signers kept to the
+// rotation.
+const (
+	DiffInTurn uint32 = 2
+	DiffNoTurn uint32 = 1
+)
+
+const (
+	// checkpointInterval is how often signer snapshots are kept for good,
+	// so the signer set at any block can be rebuilt without replaying every
+	// vote from genesis.
+	checkpointInterval = 1024
+
+	// maxRecentSnapshots bounds the cache of snapshots between checkpoints.
+	maxRecentSnapshots = 128
+)
+
+// ErrUnauthorizedSigner is returned when sealing a block with a key that
+// isn't in the signer set.
+var ErrUnauthorizedSigner = errors.New("not an authorized signer")
+
+// ErrRecentlySigned is returned when sealing a block too soon after the
+// last block we signed.
+var ErrRecentlySigned = errors.New("signed recently, must wait for others")
+
+// ProofOfAuthority implements the Proof-of-Authority consensus algorithm.
+// In our blockchain, this is meant for private networks run by a few known
+// parties: instead of burning CPU on proof-of-work, blocks are signed by an
+// authorized set of signers taking turns in a fixed rotation. Anyone can
+// verify a block by checking its signature against the signer set.
+//
+// The initial signers are stored in the genesis block. Signers change the
+// set by voting: a signer puts a vote to add or remove an address in the
+// header of a block it signs, and the change takes effect as soon as more
+// than half of the current signers voted for it.
+//
+// A signer may only sign one of any len(signers)/2+1 consecutive blocks, so
+// a minority of signers can't take over the chain. The signer whose turn it
+// is seals right away; the others wait one period more for every place they
+// are behind in the rotation, so the chain keeps growing when a signer is
+// offline.
+type ProofOfAuthority struct {
+	params  *chaincfg.Params  // Network the engine signs for
+	signers []string          // Genesis signers
+	period  time.Duration     // Minimum time between blocks
+	key     *ecdsa.PrivateKey // Our signing key, or nil if we don't sign
+	address string            // Address of key
+
+	mu          sync.Mutex
+	proposals   map[string]bool      // Votes we cast: address -> authorize
+	checkpoints map[string]*snapshot // Snapshots at checkpoint blocks, by hash
+	recent      map[string]*snapshot // Other recently used snapshots, by hash
+}
+
+// NewProofOfAuthority creates a Proof-of-Authority engine for a network
+// started by the given signers, producing a block at most every period.
+// If key is not nil, the engine seals blocks with it.
+func NewProofOfAuthority(params *chaincfg.Params, signers []string, period time.Duration, key *ecdsa.PrivateKey) (*ProofOfAuthority, error) {
+	if len(signers) == 0 {
+		return nil, fmt.Errorf("at least one signer is required")
+	}
+	for _, signer := range signers {
+		if _, err := wallet.AddressToPublicKey(signer); err != nil {
+			return nil, fmt.Errorf("invalid signer %s: %w", signer, err)
+		}
+	}
+	if period <= 0 {
+		return nil, fmt.Errorf("block period must be positive")
+	}
+
+	poa := &ProofOfAuthority{
+		params:      params,
+		signers:     append([]string(nil), signers...),
+		period:      period,
+		key:         key,
+		proposals:   make(map[string]bool),
+		checkpoints: make(map[string]*snapshot),
+		recent:      make(map[string]*snapshot),
+	}
+	if key != nil {
+		poa.address = wallet.PublicKeyToAddress(&key.PublicKey)
+	}
+	return poa, nil
+}
+
+var _ Engine = (*ProofOfAuthority)(nil)
+
+func (poa *ProofOfAuthority) Name() string {
+	return "poa"
+}
+
+// Address returns the address we sign blocks as, or "" if we don't sign.
+func (poa *ProofOfAuthority) Address() string {
+	return poa.address
+}
+
+// Propose makes us vote to add (authorize) or remove an address from the
+// signer set in the blocks we sign, until the vote has passed.
+func (poa *ProofOfAuthority) Propose(address string, authorize bool) error {
+	if _, err := wallet.AddressToPublicKey(address); err != nil {
+		return fmt.Errorf("invalid address: %w", err)
+	}
+
+	poa.mu.Lock()
+	defer poa.mu.Unlock()
+	poa.proposals[address] = authorize
+	return nil
+}
+
+// Discard withdraws our proposal for an address.
+func (poa *ProofOfAuthority) Discard(address string) {
+	poa.mu.Lock()
+	defer poa.mu.Unlock()
+	delete(poa.proposals, address)
+}
+
+// Proposals returns the votes we are casting.
+func (poa *ProofOfAuthority) Proposals() map[string]bool {
+	poa.mu.Lock()
+	defer poa.mu.Unlock()
+
+	proposals := make(map[string]bool, len(poa.proposals))
+	for address, authorize := range poa.proposals {
+		proposals[address] = authorize
+	}
+	return proposals
+}
+
+// Signers returns the signers allowed to sign the block after header.
+func (poa *ProofOfAuthority) Signers(chain ChainReader, header *types.BlockHeader) ([]string, error) {
+	snap, err := poa.snapshot(chain, header)
+	if err != nil {
+		return nil, err
+	}
+	return append([]string(nil), snap.signers...), nil
+}
+
+// PrepareGenesis records the initial signers in the genesis block.
+func (poa *ProofOfAuthority) PrepareGenesis(header *types.BlockHeader) {
+	header.Bits = DiffNoTurn
+	header.Extra = encodeSigners(poa.signers)
+}
+
+// Prepare sets the header's weight for our turn, its timestamp to no earlier
+// than one period after its parent, and one of our proposals as its vote.
+func (poa *ProofOfAuthority) Prepare(chain ChainReader, header *types.BlockHeader) error {
+	parent := chain.GetHeader(header.PreviousHash)
+	if parent == nil {
+		return fmt.Errorf("unknown previous block %s", header.PreviousHash)
+	}
+	snap, err := poa.snapshot(chain, parent)
+	if err != nil {
+		return err
+	}
+
+	header.Bits = snap.difficulty(header.Index, poa.address)
+	header.Nonce = 0
+	header.Seal = nil
+
+	if earliest := parent.Timestamp.Add(poa.period); header.Timestamp.Before(earliest) {
+		header.Timestamp = earliest
+	}
+
+	// Vote for the first of our proposals that would still change the set
+	header.Extra = nil
+	proposals := poa.Proposals()
+	addresses := make([]string, 0, len(proposals))
+	for address := range proposals {
+		addresses = append(addresses, address)
+	}
+	sort.Strings(addresses)
+	for _, address := range addresses {
+		if snap.validVote(address, proposals[address]) {
+			header.Extra = encodeVote(address, proposals[address])
+			break
+		}
+	}
+	return nil
+}
+
+// Seal signs the header once it is our turn to.
+// It waits until the header's timestamp, plus one period for every place
+// we are behind the in-turn signer, and returns the context's error if ctx
+// is cancelled first.
+func (poa *ProofOfAuthority) Seal(ctx context.Context, chain ChainReader, header *types.BlockHeader) error {
+	if poa.key == nil {
+		return fmt.Errorf("no signing key configured")
+	}
+
+	parent := chain.GetHeader(header.PreviousHash)
+	if parent == nil {
+		return fmt.Errorf("unknown previous block %s", header.PreviousHash)
+	}
+	snap, err := poa.snapshot(chain, parent)
+	if err != nil {
+		return err
+	}
+	if !snap.isSigner(poa.address) {
+		return ErrUnauthorizedSigner
+	}
+	if snap.signedRecently(header.Index, poa.address) {
+		return ErrRecentlySigned
+	}
+
+	delay := time.Until(header.Timestamp)
+	if header.Bits != DiffInTurn {
+		delay += time.Duration(snap.turnOffset(header.Index, poa.address)) * poa.period
+	}
+
+	timer := time.NewTimer(delay)
+	defer timer.Stop()
+	select {
+	case <-ctx.Done():
+		return ctx.Err()
+	case <-timer.C:
+	}
+
+	signature, err := wallet.Sign(header.SealHash(), poa.key)
+	if err != nil {
+		return fmt.Errorf("failed to sign block: %w", err)
+	}
+	header.Seal = encodeSeal(poa.address, signature)
+	return nil
+}
+
+// VerifyHeader checks that the header was signed by a signer allowed to
+// sign it, with the weight matching the signer's turn, at least one period
+// after its parent, and that its vote, if any, is valid.
+func (poa *ProofOfAuthority) VerifyHeader(chain ChainReader, header *types.BlockHeader) error {
+	parent := chain.GetHeader(header.PreviousHash)
+	if parent == nil {
+		return fmt.Errorf("unknown previous block %s", header.PreviousHash)
+	}
+	snap, err := poa.snapshot(chain, parent)
+	if err != nil {
+		return err
+	}
+
+	if header.Timestamp.Before(parent.Timestamp.Add(poa.period)) {
+		return fmt.Errorf("block is less than %v after its parent", poa.period)
+	}
+	if header.Nonce != 0 {
+		return fmt.Errorf("nonce must be zero")
+	}
+
+	signer, _, err := decodeSeal(header.Seal)
+	if err != nil {
+		return err
+	}
+	if !snap.isSigner(signer) {
+		return fmt.Errorf("block signed by unauthorized signer %s", signer)
+	}
+	if snap.signedRecently(header.Index, signer) {
+		return fmt.Errorf("signer %s signed too recently", signer)
+	}
+	if expected := snap.difficulty(header.Index, signer); header.Bits != expected {
+		return fmt.Errorf("incorrect difficulty: expected %d, got %d", expected, header.Bits)
+	}
+
+	if len(header.Extra) > 0 {
+		address, authorize, err := decodeVote(header.Extra)
+		if err != nil {
+			return err
+		}
+		if !snap.validVote(address, authorize) {
+			return fmt.Errorf("vote for %s would not change the signer set", address)
+		}
+	}
+
+	_, err = verifySeal(header, header.SealHash())
+	return err
+}
+
+// CalcDifficulty returns the weight of a block we would sign on top of parent.
+func (poa *ProofOfAuthority) CalcDifficulty(chain ChainReader, parent *types.BlockHeader) uint32 {
+	snap, err := poa.snapshot(chain, parent)
+	if err != nil {
+		return DiffNoTurn
+	}
+	return snap.difficulty(parent.Index+1, poa.address)
+}
+
+// BlockReward returns the subsidy for the block's height.
+func (poa *ProofOfAuthority) BlockReward(chain ChainReader, header *types.BlockHeader) uint64 {
+	return poa.params.Emission.Subsidy(header.Index)
+}
+
+// Work returns the block's weight, so the heaviest chain is the one with
+// the most in-turn blocks.
+func (poa *ProofOfAuthority) Work(header *types.BlockHeader) *big.Int {
+	return new(big.Int).SetUint64(uint64(header.Bits))
+}
+
+// snapshot returns the signer set and voting state after header.
+// Snapshots are cached, so usually only the last few headers have to be
+// replayed on top of a cached one.
+func (poa *ProofOfAuthority) snapshot(chain ChainReader, header *types.BlockHeader) (*snapshot, error) {
+	var (
+		snap    *snapshot
+		headers []*types.BlockHeader
+	)
+	for h := header; snap == nil; {
+		hash := h.ComputeHash()
+
+		poa.mu.Lock()
+		snap = poa.checkpoints[hash]
+		if snap == nil {
+			snap = poa.recent[hash]
+		}
+		poa.mu.Unlock()
+		if snap != nil {
+			break
+		}
+
+		if h.Index == 0 {
+			signers, err := decodeSigners(h.Extra)
+			if err != nil {
+				return nil, fmt.Errorf("invalid genesis signers: %w", err)
+			}
+			snap = newSnapshot(signers)
+			break
+		}
+
+		headers = append(headers, h)
+		parent := chain.GetHeader(h.PreviousHash)
+		if parent == nil {
+			return nil, fmt.Errorf("unknown ancestor %s", h.PreviousHash)
+		}
+		h = parent
+	}
+
+	// Replay the headers oldest first. They are all in the block tree, so
+	// their seals and votes were verified when they were added.
+	for i := len(headers) - 1; i >= 0; i-- {
+		next, err := snap.apply(headers[i])
+		if err != nil {
+			return nil, err
+		}
+		snap = next
+
+		if headers[i].Index%checkpointInterval == 0 {
+			poa.mu.Lock()
+			poa.checkpoints[headers[i].ComputeHash()] = snap
+			poa.mu.Unlock()
+		}
+	}
+
+	poa.mu.Lock()
+	if len(poa.recent) >= maxRecentSnapshots {
+		poa.recent = make(map[string]*snapshot)
+	}
+	poa.recent[header.ComputeHash()] = snap
+	poa.mu.Unlock()
+	return snap, nil
+}
+
+// snapshot is the signer set and voting state after a block.
+// Snapshots are never modified once built; apply returns a new one.
+type snapshot struct {
+	signers []string                   // Sorted authorized signers
+	recents map[uint64]string          // Signers of the last blocks, by index
+	votes   map[string]map[string]bool // Address -> voting signer -> authorize
+}
+
+func newSnapshot(signers []string) *snapshot {
+	snap := &snapshot{
+		signers: append([]string(nil), signers...),
+		recents: make(map[uint64]string),
+		votes:   make(map[string]map[string]bool),
+	}
+	sort.Strings(snap.signers)
+	return snap
+}
+
+func (s *snapshot) copy() *snapshot {
+	cpy := newSnapshot(s.signers)
+	for index, signer := range s.recents {
+		cpy.recents[index] = signer
+	}
+	for address, votes := range s.votes {
+		cpy.votes[address] = make(map[string]bool, len(votes))
+		for signer, authorize := range votes {
+			cpy.votes[address][signer] = authorize
+		}
+	}
+	return cpy
+}
+
+func (s *snapshot) isSigner(address string) bool {
+	i := sort.SearchStrings(s.signers, address)
+	return i < len(s.signers) && s.signers[i] == address
+}
+
+// recentLimit is the number of consecutive blocks of which a signer may
+// only sign one.
+func (s *snapshot) recentLimit() uint64 {
+	return uint64(len(s.signers)/2 + 1)
+}
+
+// signedRecently reports whether signer signed one of the blocks within
+// the recent limit before the block at index.
+func (s *snapshot) signedRecently(index uint64, signer string) bool {
+	for seen, recent := range s.recents {
+		if recent == signer && index-seen < s.recentLimit() {
+			return true
+		}
+	}
+	return false
+}
+
+// turnOffset returns how many places signer is behind the in-turn signer
+// for the block at index.
+func (s *snapshot) turnOffset(index uint64, signer string) int {
+	n := len(s.signers)
+	pos := sort.SearchStrings(s.signers, signer)
+	return (pos - int(index%uint64(n)) + n) % n
+}
+
+// difficulty returns the weight of the block at index if signer signs it.
+func (s *snapshot) difficulty(index uint64, signer string) uint32 {
+	if s.isSigner(signer) && s.turnOffset(index, signer) == 0 {
+		return DiffInTurn
+	}
+	return DiffNoTurn
+}
+
+// validVote reports whether a vote would change the signer set if it passed.
+// The last signer can't be voted out, or nobody could sign blocks anymore.
+func (s *snapshot) validVote(address string, authorize bool) bool {
+	if !authorize && len(s.signers) == 1 {
+		return false
+	}
+	return s.isSigner(address) != authorize
+}
+
+// apply returns the snapshot after header.
+func (s *snapshot) apply(header *types.BlockHeader) (*snapshot, error) {
+	signer, _, err := decodeSeal(header.Seal)
+	if err != nil {
+		return nil, fmt.Errorf("block %d: %w", header.Index, err)
+	}
+
+	snap := s.copy()
+	snap.forgetRecent(header.Index)
+	snap.recents[header.Index] = signer
+
+	if len(header.Extra) == 0 {
+		return snap, nil
+	}
+	address, authorize, err := decodeVote(header.Extra)
+	if err != nil {
+		return nil, fmt.Errorf("block %d: %w", header.Index, err)
+	}
+
+	// A signer's latest vote for an address replaces its earlier one
+	if snap.votes[address] == nil {
+		snap.votes[address] = make(map[string]bool)
+	}
+	snap.votes[address][signer] = authorize
+
+	tally := 0
+	for _, vote := range snap.votes[address] {
+		if vote == authorize {
+			tally++
+		}
+	}
+	if tally <= len(snap.signers)/2 {
+		return snap, nil
+	}
+
+	delete(snap.votes, address)
+	if authorize {
+		snap.signers = append(snap.signers, address)
+		sort.Strings(snap.signers)
+		return snap, nil
+	}
+
+	i := sort.SearchStrings(snap.signers, address)
+	snap.signers = append(snap.signers[:i], snap.signers[i+1:]...)
+	for _, votes := range snap.votes {
+		delete(votes, address)
+	}
+	return snap, nil
+}
+
+// forgetRecent drops the recent signers that no longer restrict who may
+// sign the block at index.
+func (s *snapshot) forgetRecent(index uint64) {
+	for seen := range s.recents {
+		if index-seen >= s.recentLimit() {
+			delete(s.recents, seen)
+		}
+	}
+}
+
+// The genesis block's Extra field holds the initial signers; other blocks
+// hold either nothing or one vote.
+
+func encodeSigners(signers []string) []byte {
+	e := types.NewEncoder()
+	e.WriteVarInt(uint64(len(signers)))
+	for _, signer := range signers {
+		e.WriteString(signer)
+	}
+	return e.Bytes()
+}
+
+func decodeSigners(data []byte) ([]string, error) {
+	d := types.NewDecoder(data)
+	signers := make([]string, d.ReadCount())
+	for i := range signers {
+		signers[i] = d.ReadString()
+	}
+	if err := d.Finish(); err != nil {
+		return nil, err
+	}
+	if len(signers) == 0 {
+		return nil, fmt.Errorf("no signers")
+	}
+	return signers, nil
+}
+
+func encodeVote(address string, authorize bool) []byte {
+	e := types.NewEncoder()
+	e.WriteString(address)
+	if authorize {
+		e.WriteUint8(1)
+	} else {
+		e.WriteUint8(0)
+	}
+	return e.Bytes()
+}
+
+func decodeVote(data []byte) (string, bool, error) {
+	d := types.NewDecoder(data)
+	address := d.ReadString()
+	authorize := d.ReadUint8()
+	if authorize > 1 {
+		d.Fail("invalid vote %d", authorize)
+	}
+	if err := d.Finish(); err != nil {
+		return "", false, fmt.Errorf("invalid vote: %w", err)
+	}
+	return address, authorize == 1, nil
+}
+
+func encodeSeal(signer, signature string) []byte {
+	e := types.NewEncoder()
+	e.WriteString(signer)
+	e.WriteString(signature)
+	return e.Bytes()
+}
+
+func decodeSeal(data []byte) (signer, signature string, err error) {
+	d := types.NewDecoder(data)
+	signer = d.ReadString()
+	signature = d.ReadString()
+	if err := d.Finish(); err != nil {
+		return "", "", fmt.Errorf("invalid block seal: %w", err)
+	}
+	return signer, signature, nil
+}
+
+// verifySeal checks that the signature in a header's seal signs hash, the
+// header's hash as signed by the engine, and returns the signer.
+// The signature must be canonical, so only the signer can seal a header.
+func verifySeal(header *types.BlockHeader, hash []byte) (string, error) {
+	signer, signature, err := decodeSeal(header.Seal)
+	if err != nil {
+		return "", err
+	}
+	if !wallet.IsCanonicalSignature(signature) {
+		return "", fmt.Errorf("block signature is not canonical")
+	}
+
+	pubKey, err := wallet.AddressToPublicKey(signer)
+	if err != nil {
+		return "", fmt.Errorf("invalid signer: %w", err)
+	}
+	valid, err := wallet.Verify(hash, signature, pubKey)
+	if err != nil {
+		return "", fmt.Errorf("invalid block signature: %w", err)
+	}
+	if !valid {
+		return "", fmt.Errorf("block signature verification failed")
+	}
+	return signer, nil
+}
@@ -0,0 +1,304 @@
+package consensus
+
+import (
+	"context"
+	"errors"
+	"sort"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/OhMyDitzzy/vulcan/chaincfg"
+	"github.com/OhMyDitzzy/vulcan/types"
+	"github.com/OhMyDitzzy/vulcan/wallet"
+)
+
+const testPeriod = time.Second
+
+// poaNetwork is a PoA chain with an engine per signer key, by address,
+// and one without a key that only verifies.
+type poaNetwork struct {
+	t        *testing.T
+	chain    testChain
+	engines  map[string]*ProofOfAuthority
+	verifier *ProofOfAuthority
+	genesis  *types.BlockHeader
+}
+
+// newPoANetwork starts a chain signed by signers of the given number, and
+// creates engines for them and for extra keys that aren't signers yet.
+// Blocks are timestamped in the past, so sealing never waits.
+func newPoANetwork(t *testing.T, signers, extra int) (*poaNetwork, []string) {
+	t.Helper()
+	keys := make(map[string]*wallet.Wallet)
+	var addresses []string
+	for i := 0; i < signers+extra; i++ {
+		w := newWallet(t)
+		keys[w.Address] = w
+		addresses = append(addresses, w.Address)
+	}
+	genesisSigners := append([]string(nil), addresses[:signers]...)
+	sort.Strings(genesisSigners)
+
+	net := &poaNetwork{t: t, chain: make(testChain), engines: make(map[string]*ProofOfAuthority)}
+	for address, w := range keys {
+		engine, err := NewProofOfAuthority(&chaincfg.RegTestParams, genesisSigners, testPeriod, w.PrivateKey)
+		if err != nil {
+			t.Fatal(err)
+		}
+		net.engines[address] = engine
+	}
+	verifier, err := NewProofOfAuthority(&chaincfg.RegTestParams, genesisSigners, testPeriod, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	net.verifier = verifier
+
+	net.genesis = &types.BlockHeader{
+		Version:   types.BlockVersion,
+		Timestamp: time.Unix(1577836800, 0).UTC(),
+	}
+	net.engines[genesisSigners[0]].PrepareGenesis(net.genesis)
+	net.chain[net.genesis.ComputeHash()] = net.genesis
+	return net, append(genesisSigners, addresses[signers:]...)
+}
+
+func newWallet(t *testing.T) *wallet.Wallet {
+	t.Helper()
+	w, err := wallet.NewWallet()
+	if err != nil {
+		t.Fatal(err)
+	}
+	return w
+}
+
+// seal has signer prepare and seal a block on parent, without adding it.
+func (net *poaNetwork) seal(parent *types.BlockHeader, signer string) (*types.BlockHeader, error) {
+	header := &types.BlockHeader{
+		Version:      types.BlockVersion,
+		Index:        parent.Index + 1,
+		Timestamp:    parent.Timestamp,
+		PreviousHash: parent.ComputeHash(),
+	}
+	engine := net.engines[signer]
+	if err := engine.Prepare(net.chain, header); err != nil {
+		return nil, err
+	}
+	if err := engine.Seal(context.Background(), net.chain, header); err != nil {
+		return nil, err
+	}
+	return header, nil
+}
+
+// extend has signer sign a block on parent, checks it with the verifying
+// engine, and adds it to the chain.
+func (net *poaNetwork) extend(parent *types.BlockHeader, signer string) *types.BlockHeader {
+	net.t.Helper()
+	header, err := net.seal(parent, signer)
+	if err != nil {
+		net.t.Fatalf("sealing block %d by %s failed: %v", parent.Index+1, signer[:8], err)
+	}
+	if err := net.verifier.VerifyHeader(net.chain, header); err != nil {
+		net.t.Fatalf("block %d by %s rejected: %v", header.Index, signer[:8], err)
+	}
+	net.chain[header.ComputeHash()] = header
+	return header
+}
+
+func (net *poaNetwork) signers(header *types.BlockHeader) []string {
+	net.t.Helper()
+	signers, err := net.verifier.Signers(net.chain, header)
+	if err != nil {
+		net.t.Fatal(err)
+	}
+	return signers
+}
+
+func TestPoARotation(t *testing.T) {
+	net, signers := newPoANetwork(t, 3, 0)
+
+	// Block i is in turn for signers[i%3]
+	tip := net.genesis
+	for i := 1; i <= 6; i++ {
+		tip = net.extend(tip, signers[i%3])
+		if tip.Bits != DiffInTurn {
+			t.Fatalf("block %d by the in-turn signer weighs %d, want %d", i, tip.Bits, DiffInTurn)
+		}
+	}
+
+	// A signer out of turn may sign, for less weight
+	outOfTurn := net.extend(tip, signers[(tip.Index+2)%3])
+	if outOfTurn.Bits != DiffNoTurn {
+		t.Fatalf("block by an out-of-turn signer weighs %d, want %d", outOfTurn.Bits, DiffNoTurn)
+	}
+
+	// The same signer can't sign the next block as well
+	signer := signers[(tip.Index+2)%3]
+	if _, err := net.seal(outOfTurn, signer); !errors.Is(err, ErrRecentlySigned) {
+		t.Fatalf("got %v, want ErrRecentlySigned", err)
+	}
+}
+
+func TestPoAVerifyHeaderRejects(t *testing.T) {
+	net, addresses := newPoANetwork(t, 3, 1)
+	signers, outsider := addresses[:3], addresses[3]
+	tip := net.extend(net.genesis, signers[1])
+
+	if _, err := net.seal(tip, outsider); !errors.Is(err, ErrUnauthorizedSigner) {
+		t.Fatalf("got %v, want ErrUnauthorizedSigner", err)
+	}
+
+	// Tampered headers are signed again unless the seal is what's tampered
+	// with, so each is rejected for the reason under test
+	tests := []struct {
+		name   string
+		tamper func(h *types.BlockHeader)
+		reseal bool
+		want   string
+	}{
+		{"too soon", func(h *types.BlockHeader) { h.Timestamp = tip.Timestamp }, true, "after its parent"},
+		{"nonce", func(h *types.BlockHeader) { h.Nonce = 1 }, true, "nonce"},
+		{"wrong weight", func(h *types.BlockHeader) { h.Bits = DiffNoTurn }, true, "incorrect difficulty"},
+		{"vote for a signer", func(h *types.BlockHeader) { h.Extra = encodeVote(signers[0], true) }, true, "would not change"},
+		{"invalid vote", func(h *types.BlockHeader) { h.Extra = []byte{1} }, true, ""},
+		{"changed after sealing", func(h *types.BlockHeader) { h.MerkleRoot = "ff" }, false, ""},
+		{"no seal", func(h *types.BlockHeader) { h.Seal = nil }, false, ""},
+		{"outsider's seal", func(h *types.BlockHeader) {
+			signature, _ := wallet.Sign(h.SealHash(), net.engines[outsider].key)
+			h.Seal = encodeSeal(outsider, signature)
+		}, false, "unauthorized signer"},
+		{"seal claiming another signer", func(h *types.BlockHeader) {
+			_, signature, _ := decodeSeal(h.Seal)
+			h.Seal = encodeSeal(signers[0], signature)
+		}, false, ""},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			header, err := net.seal(tip, signers[2])
+			if err != nil {
+				t.Fatal(err)
+			}
+			if err := net.verifier.VerifyHeader(net.chain, header); err != nil {
+				t.Fatalf("untampered block rejected: %v", err)
+			}
+			tt.tamper(header)
+			if tt.reseal {
+				signature, _ := wallet.Sign(header.SealHash(), net.engines[signers[2]].key)
+				header.Seal = encodeSeal(signers[2], signature)
+			}
+			err = net.verifier.VerifyHeader(net.chain, header)
+			if err == nil || !strings.Contains(err.Error(), tt.want) {
+				t.Fatalf("got %v, want an error containing %q", err, tt.want)
+			}
+		})
+	}
+
+	// A signer that signed recently is rejected even if it signs anyway
+	header := &types.BlockHeader{
+		Version:      types.BlockVersion,
+		Index:        tip.Index + 1,
+		Timestamp:    tip.Timestamp.Add(testPeriod),
+		PreviousHash: tip.ComputeHash(),
+		Bits:         DiffNoTurn,
+	}
+	signature, _ := wallet.Sign(header.SealHash(), net.engines[signers[1]].key)
+	header.Seal = encodeSeal(signers[1], signature)
+	if err := net.verifier.VerifyHeader(net.chain, header); err == nil || !strings.Contains(err.Error(), "too recently") {
+		t.Fatalf("got %v, want a signer that signed recently rejected", err)
+	}
+}
+
+func TestPoAVoting(t *testing.T) {
+	net, addresses := newPoANetwork(t, 3, 1)
+	signers, candidate := addresses[:3], addresses[3]
+
+	for _, signer := range signers[:2] {
+		if err := net.engines[signer].Propose(candidate, true); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	// One vote of three isn't a majority
+	tip := net.extend(net.genesis, signers[1])
+	if address, authorize, err := decodeVote(tip.Extra); err != nil || address != candidate || !authorize {
+		t.Fatalf("block carries vote %s %v (%v), want to add the candidate", address, authorize, err)
+	}
+	if got := net.signers(tip); len(got) != 3 {
+		t.Fatalf("one vote changed the signer set to %d signers", len(got))
+	}
+
+	// A signer's repeated vote counts once
+	tip = net.extend(tip, signers[2])
+	tip = net.extend(tip, signers[1])
+	if got := net.signers(tip); len(got) != 3 {
+		t.Fatalf("a repeated vote changed the signer set to %d signers", len(got))
+	}
+
+	// The second vote passes it
+	tip = net.extend(tip, signers[0])
+	got := net.signers(tip)
+	if len(got) != 4 || !contains(got, candidate) {
+		t.Fatalf("signers are %d after the vote passed, want 4 including the candidate", len(got))
+	}
+
+	// Passed proposals are no longer voted for, and the new signer signs
+	tip = net.extend(tip, candidate)
+	tip = net.extend(tip, signers[1])
+	if len(tip.Extra) != 0 {
+		t.Fatal("a passed proposal is still voted for")
+	}
+
+	// Removing a signer takes more than half of the four signers
+	for _, signer := range []string{signers[0], signers[1], signers[2]} {
+		if err := net.engines[signer].Propose(candidate, false); err != nil {
+			t.Fatal(err)
+		}
+	}
+	tip = net.extend(tip, signers[2])
+	tip = net.extend(tip, signers[0])
+	if got := net.signers(tip); len(got) != 4 {
+		t.Fatalf("two of four votes removed a signer, leaving %d", len(got))
+	}
+	tip = net.extend(tip, signers[1])
+	if got := net.signers(tip); len(got) != 3 || contains(got, candidate) {
+		t.Fatalf("signers are %d after the removal passed, want the 3 genesis signers", len(got))
+	}
+
+	// The removed signer can't sign anymore
+	if _, err := net.seal(tip, candidate); !errors.Is(err, ErrUnauthorizedSigner) {
+		t.Fatalf("got %v, want ErrUnauthorizedSigner", err)
+	}
+}
+
+func TestPoALastSignerCantBeRemoved(t *testing.T) {
+	net, signers := newPoANetwork(t, 1, 0)
+	if err := net.engines[signers[0]].Propose(signers[0], false); err != nil {
+		t.Fatal(err)
+	}
+
+	tip := net.extend(net.genesis, signers[0])
+	if len(tip.Extra) != 0 {
+		t.Fatal("the last signer voted itself out")
+	}
+
+	header, err := net.seal(tip, signers[0])
+	if err != nil {
+		t.Fatal(err)
+	}
+	header.Extra = encodeVote(signers[0], false)
+	signature, _ := wallet.Sign(header.SealHash(), net.engines[signers[0]].key)
+	header.Seal = encodeSeal(signers[0], signature)
+	if err := net.verifier.VerifyHeader(net.chain, header); err == nil || !strings.Contains(err.Error(), "would not change") {
+		t.Fatalf("got %v, want a vote removing the last signer rejected", err)
+	}
+}
+
+func contains(list []string, s string) bool {
+	for _, item := range list {
+		if item == s {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,453 @@
+package consensus
+
+import (
+	"bytes"
+	"context"
+	"crypto/ecdsa"
+	"crypto/sha256"
+	"errors"
+	"fmt"
+	"math/big"
+	"sort"
+	"time"
+
+	"github.com/OhMyDitzzy/vulcan/chaincfg"
+	"github.com/OhMyDitzzy/vulcan/types"
+	"github.com/OhMyDitzzy/vulcan/wallet"
+)
+
+const (
+	// EpochLength is the number of blocks that share a proposer election
+	// seed. The seed comes from the first block of the epoch, so a proposer
+	// can only try to bias the election once per epoch.
+	EpochLength = 32
+
+	// UnbondingPeriod is the number of blocks unstaked coins stay locked.
+	// They can still be slashed in that time, and evidence older than this
+	// is no longer accepted, so stakers can't escape slashing by unstaking
+	// right after equivocating.
+	UnbondingPeriod uint64 = 100
+
+	// SlashRewardDivisor limits the reward for reporting an equivocation to
+	// this fraction of the slashed stake. The rest is burned.
+	SlashRewardDivisor = 10
+
+	// maxSealSlots is how many slots ahead Seal looks for one we propose.
+	maxSealSlots = 10000
+)
+
+// ErrNotProposer is returned when sealing a block while we aren't elected
+// to propose any of the upcoming slots.
+var ErrNotProposer = errors.New("not elected to propose a block")
+
+// StakeReader is implemented by chains that track stake, so a
+// Proof-of-Stake engine can tell which slots we propose.
+type StakeReader interface {
+	ChainReader
+
+	// Stakes returns the stake locked by each address after the main-chain tip.
+	Stakes() map[string]uint64
+}
+
+// StakeVerifier is implemented by engines that elect block producers by
+// stake. The stake locked after a block is only known once the block has
+// been connected, which may be long after its header was verified if it is
+// on a side chain, so the blockchain calls VerifyStake whenever it connects
+// a block, with the stakes after the block's parent.
+type StakeVerifier interface {
+	VerifyStake(chain ChainReader, header *types.BlockHeader, stakes map[string]uint64) error
+}
+
+// ProofOfStake implements a Proof-of-Stake consensus algorithm.
+// In our blockchain, time is divided into fixed slots and each slot has one
+// proposer, elected at random with a probability proportional to the coins
+// it locked with stake transactions. The election is seeded from the first
+// block of the epoch, so every node elects the same proposer, and it uses
+// the stakes after the parent block. A slot without a block is skipped.
+//
+// A block carries its slot in the header's Extra field and is sealed with
+// the proposer's signature, which commits to the network's chain ID. A
+// proposer who signs two different blocks for the same slot can be slashed:
+// anyone holding both headers can put them in a slash transaction that
+// destroys the proposer's stake.
+//
+// Until anything is staked, the genesis validators are elected with equal
+// weight, so a new network can produce the blocks that fund the first stakes.
+type ProofOfStake struct {
+	params     *chaincfg.Params  // Network the engine proposes for
+	validators []string          // Genesis validators
+	slot       time.Duration     // Slot length
+	key        *ecdsa.PrivateKey // Our signing key, or nil if we don't propose
+	address    string            // Address of key
+}
+
+// NewProofOfStake creates a Proof-of-Stake engine for a network started by
+// the given validators, with slots of the given length.
+// If key is not nil, the engine proposes blocks with it.
+func NewProofOfStake(params *chaincfg.Params, validators []string, slot time.Duration, key *ecdsa.PrivateKey) (*ProofOfStake, error) {
+	if len(validators) == 0 {
+		return nil, fmt.Errorf("at least one validator is required")
+	}
+	for _, validator := range validators {
+		if _, err := wallet.AddressToPublicKey(validator); err != nil {
+			return nil, fmt.Errorf("invalid validator %s: %w", validator, err)
+		}
+	}
+	if slot <= 0 {
+		return nil, fmt.Errorf("slot length must be positive")
+	}
+
+	pos := &ProofOfStake{
+		params:     params,
+		validators: append([]string(nil), validators...),
+		slot:       slot,
+		key:        key,
+	}
+	sort.Strings(pos.validators)
+	if key != nil {
+		pos.address = wallet.PublicKeyToAddress(&key.PublicKey)
+	}
+	return pos, nil
+}
+
+var (
+	_ Engine        = (*ProofOfStake)(nil)
+	_ StakeVerifier = (*ProofOfStake)(nil)
+)
+
+func (pos *ProofOfStake) Name() string {
+	return "pos"
+}
+
+// Address returns the address we propose blocks as, or "" if we don't.
+func (pos *ProofOfStake) Address() string {
+	return pos.address
+}
+
+// PrepareGenesis records the genesis validators in the genesis block.
+func (pos *ProofOfStake) PrepareGenesis(header *types.BlockHeader) {
+	header.Extra = encodeSigners(pos.validators)
+}
+
+// Prepare clears the consensus fields; Seal picks the slot.
+func (pos *ProofOfStake) Prepare(chain ChainReader, header *types.BlockHeader) error {
+	if chain.GetHeader(header.PreviousHash) == nil {
+		return fmt.Errorf("unknown previous block %s", header.PreviousHash)
+	}
+	header.Bits = 0
+	header.Nonce = 0
+	header.Extra = nil
+	header.Seal = nil
+	return nil
+}
+
+// Seal waits for the next slot we are elected to propose and signs the
+// header for it. The chain must be a StakeReader whose tip is the header's
+// parent. It returns the context's error if ctx is cancelled first.
+func (pos *ProofOfStake) Seal(ctx context.Context, chain ChainReader, header *types.BlockHeader) error {
+	if pos.key == nil {
+		return fmt.Errorf("no signing key configured")
+	}
+	stakeReader, ok := chain.(StakeReader)
+	if !ok {
+		return fmt.Errorf("chain does not track stake")
+	}
+
+	parent := chain.GetHeader(header.PreviousHash)
+	if parent == nil {
+		return fmt.Errorf("unknown previous block %s", header.PreviousHash)
+	}
+	parentSlot, err := slotOf(parent)
+	if err != nil {
+		return err
+	}
+
+	stakes := stakeReader.Stakes()
+	slot := pos.slotAt(time.Now())
+	if slot <= parentSlot {
+		slot = parentSlot + 1
+	}
+	found := false
+	for end := slot + maxSealSlots; slot < end; slot++ {
+		proposer, err := pos.proposer(chain, parent, slot, stakes)
+		if err != nil {
+			return err
+		}
+		if proposer == pos.address {
+			found = true
+			break
+		}
+	}
+	if !found {
+		return ErrNotProposer
+	}
+
+	start := pos.slotStart(slot)
+	timer := time.NewTimer(time.Until(start))
+	defer timer.Stop()
+	select {
+	case <-ctx.Done():
+		return ctx.Err()
+	case <-timer.C:
+	}
+
+	header.Timestamp = start
+	header.Extra = encodeSlot(slot)
+	signature, err := wallet.Sign(sealHash(header, pos.params.ChainID), pos.key)
+	if err != nil {
+		return fmt.Errorf("failed to sign block: %w", err)
+	}
+	header.Seal = encodeSeal(pos.address, signature)
+	return nil
+}
+
+// VerifyHeader checks that the header is for a slot after its parent's,
+// timestamped at the start of that slot, and signed by the signer in its
+// seal. Whether that signer was elected for the slot depends on the stakes,
+// which VerifyStake checks.
+func (pos *ProofOfStake) VerifyHeader(chain ChainReader, header *types.BlockHeader) error {
+	parent := chain.GetHeader(header.PreviousHash)
+	if parent == nil {
+		return fmt.Errorf("unknown previous block %s", header.PreviousHash)
+	}
+	parentSlot, err := slotOf(parent)
+	if err != nil {
+		return err
+	}
+	slot, err := slotOf(header)
+	if err != nil {
+		return err
+	}
+
+	if slot <= parentSlot {
+		return fmt.Errorf("slot %d is not after the parent's slot %d", slot, parentSlot)
+	}
+	if !header.Timestamp.Equal(pos.slotStart(slot)) {
+		return fmt.Errorf("block timestamp is not the start of slot %d", slot)
+	}
+	if header.Bits != 0 || header.Nonce != 0 {
+		return fmt.Errorf("bits and nonce must be zero")
+	}
+
+	_, err = verifySeal(header, sealHash(header, pos.params.ChainID))
+	return err
+}
+
+// sealHash returns the hash a proposer signs: the header's seal hash and
+// the chain ID, so a block signed for one network never verifies on
+// another, and can't be used as evidence against its signer there.
+func sealHash(header *types.BlockHeader, chainID uint32) []byte {
+	e := types.NewEncoder()
+	e.WriteUint32(chainID)
+	e.WriteBytes(header.SealHash())
+	hash := sha256.Sum256(e.Bytes())
+	return hash[:]
+}
+
+// VerifyStake checks that the header's signer was elected to propose its
+// slot, given the stakes after its parent.
+func (pos *ProofOfStake) VerifyStake(chain ChainReader, header *types.BlockHeader, stakes map[string]uint64) error {
+	parent := chain.GetHeader(header.PreviousHash)
+	if parent == nil {
+		return fmt.Errorf("unknown previous block %s", header.PreviousHash)
+	}
+	slot, err := slotOf(header)
+	if err != nil {
+		return err
+	}
+	signer, _, err := decodeSeal(header.Seal)
+	if err != nil {
+		return err
+	}
+
+	proposer, err := pos.proposer(chain, parent, slot, stakes)
+	if err != nil {
+		return err
+	}
+	if signer != proposer {
+		return fmt.Errorf("block signed by %s, but %s was elected for slot %d", signer, proposer, slot)
+	}
+	return nil
+}
+
+// CalcDifficulty returns zero, since blocks aren't mined.
+func (pos *ProofOfStake) CalcDifficulty(chain ChainReader, parent *types.BlockHeader) uint32 {
+	return 0
+}
+
+// BlockReward returns the subsidy for the block's height.
+func (pos *ProofOfStake) BlockReward(chain ChainReader, header *types.BlockHeader) uint64 {
+	return pos.params.Emission.Subsidy(header.Index)
+}
+
+// Work returns one for every block, so the longest chain wins.
+func (pos *ProofOfStake) Work(header *types.BlockHeader) *big.Int {
+	return big.NewInt(1)
+}
+
+// slotAt returns the slot a time falls in.
+func (pos *ProofOfStake) slotAt(t time.Time) uint64 {
+	return uint64(t.UnixNano() / int64(pos.slot))
+}
+
+// slotStart returns the time a slot begins.
+func (pos *ProofOfStake) slotStart(slot uint64) time.Time {
+	return time.Unix(0, int64(slot)*int64(pos.slot)).UTC()
+}
+
+// proposer returns the address elected to propose the given slot on top of
+// parent. Each staker is elected with a probability proportional to its
+// stake, using a seed derived from the first block of the parent's epoch
+// and the slot.
+func (pos *ProofOfStake) proposer(chain ChainReader, parent *types.BlockHeader, slot uint64, stakes map[string]uint64) (string, error) {
+	addresses := make([]string, 0, len(stakes))
+	var total uint64
+	for address, stake := range stakes {
+		if stake == 0 {
+			continue
+		}
+		addresses = append(addresses, address)
+		total += stake
+	}
+	sort.Strings(addresses)
+
+	// Bootstrap with the genesis validators until anything is staked
+	weight := func(address string) uint64 { return stakes[address] }
+	if total == 0 {
+		addresses = pos.validators
+		total = uint64(len(addresses))
+		weight = func(string) uint64 { return 1 }
+	}
+
+	seed, err := electionSeed(chain, parent, slot)
+	if err != nil {
+		return "", err
+	}
+	pick := new(big.Int).Mod(new(big.Int).SetBytes(seed), new(big.Int).SetUint64(total)).Uint64()
+	for _, address := range addresses {
+		if pick < weight(address) {
+			return address, nil
+		}
+		pick -= weight(address)
+	}
+	return addresses[len(addresses)-1], nil
+}
+
+// electionSeed returns the seed of the election for a slot on top of parent:
+// the hash of the first block of the parent's epoch and the slot.
+func electionSeed(chain ChainReader, parent *types.BlockHeader, slot uint64) ([]byte, error) {
+	epochStart := parent
+	for epochStart.Index%EpochLength != 0 {
+		epochStart = chain.GetHeader(epochStart.PreviousHash)
+		if epochStart == nil {
+			return nil, fmt.Errorf("unknown ancestor of block %d", parent.Index)
+		}
+	}
+
+	e := types.NewEncoder()
+	e.WriteString(epochStart.ComputeHash())
+	e.WriteUint64(slot)
+	seed := sha256.Sum256(e.Bytes())
+	return seed[:], nil
+}
+
+// slotOf returns the slot of a block. The genesis block is at slot zero.
+func slotOf(header *types.BlockHeader) (uint64, error) {
+	if header.Index == 0 {
+		return 0, nil
+	}
+
+	d := types.NewDecoder(header.Extra)
+	slot := d.ReadUint64()
+	if err := d.Finish(); err != nil {
+		return 0, fmt.Errorf("invalid block slot: %w", err)
+	}
+	return slot, nil
+}
+
+func encodeSlot(slot uint64) []byte {
+	e := types.NewEncoder()
+	e.WriteUint64(slot)
+	return e.Bytes()
+}
+
+// EncodeEvidence returns the proof that two headers were signed for the
+// same slot, as carried in the payload of a slash transaction.
+// The headers are ordered by hash, so the same pair is always encoded the same.
+func EncodeEvidence(a, b *types.BlockHeader) []byte {
+	if a.ComputeHash() > b.ComputeHash() {
+		a, b = b, a
+	}
+
+	e := types.NewEncoder()
+	e.WriteBytes(a.Serialize())
+	e.WriteBytes(b.Serialize())
+	return e.Bytes()
+}
+
+// VerifyEquivocation checks the evidence in a slash transaction on the
+// chain with the given ID: two block headers with different signed
+// contents for the same slot, both signed for that chain by the same
+// signer. It returns the signer, who is to be slashed, and the highest
+// index of the two blocks, which bounds which of the signer's stake the
+// evidence can slash and how long it is valid.
+func VerifyEquivocation(evidence []byte, chainID uint32) (string, uint64, error) {
+	d := types.NewDecoder(evidence)
+	dataA := d.ReadBytes()
+	dataB := d.ReadBytes()
+	if err := d.Finish(); err != nil {
+		return "", 0, fmt.Errorf("invalid evidence: %w", err)
+	}
+	if bytes.Equal(dataA, dataB) {
+		return "", 0, fmt.Errorf("evidence contains the same block twice")
+	}
+
+	a, err := types.DeserializeBlockHeader(dataA)
+	if err != nil {
+		return "", 0, fmt.Errorf("invalid evidence: %w", err)
+	}
+	b, err := types.DeserializeBlockHeader(dataB)
+	if err != nil {
+		return "", 0, fmt.Errorf("invalid evidence: %w", err)
+	}
+	if a.ComputeHash() >= b.ComputeHash() {
+		return "", 0, fmt.Errorf("evidence headers are not in canonical order")
+	}
+	// Headers that differ only in their seals are one block signed once
+	if bytes.Equal(a.SealHash(), b.SealHash()) {
+		return "", 0, fmt.Errorf("evidence blocks have the same signed contents")
+	}
+
+	if a.Index == 0 || b.Index == 0 {
+		return "", 0, fmt.Errorf("evidence must not contain the genesis block")
+	}
+	slotA, err := slotOf(a)
+	if err != nil {
+		return "", 0, err
+	}
+	slotB, err := slotOf(b)
+	if err != nil {
+		return "", 0, err
+	}
+	if slotA != slotB {
+		return "", 0, fmt.Errorf("evidence blocks are for different slots")
+	}
+
+	signerA, err := verifySeal(a, sealHash(a, chainID))
+	if err != nil {
+		return "", 0, err
+	}
+	signerB, err := verifySeal(b, sealHash(b, chainID))
+	if err != nil {
+		return "", 0, err
+	}
+	if signerA != signerB {
+		return "", 0, fmt.Errorf("evidence blocks have different signers")
+	}
+
+	index := a.Index
+	if b.Index > index {
+		index = b.Index
+	}
+	return signerA, index, nil
+}
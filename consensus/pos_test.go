@@ -0,0 +1,342 @@
+package consensus
+
+import (
+	"bytes"
+	"context"
+	"crypto/ecdsa"
+	"encoding/hex"
+	"math/big"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/OhMyDitzzy/vulcan/chaincfg"
+	"github.com/OhMyDitzzy/vulcan/types"
+	"github.com/OhMyDitzzy/vulcan/wallet"
+	"github.com/btcsuite/btcd/btcec/v2"
+)
+
+const testSlot = time.Millisecond
+
+// stakeChain is a testChain that tracks stake, as Seal needs.
+type stakeChain struct {
+	testChain
+	stakes map[string]uint64
+}
+
+func (c stakeChain) Stakes() map[string]uint64 {
+	return c.stakes
+}
+
+// newProofOfStake returns an engine proposing with w's key, or only
+// verifying if w is nil.
+func newProofOfStake(t *testing.T, validators []string, w *wallet.Wallet) *ProofOfStake {
+	t.Helper()
+	var key *ecdsa.PrivateKey
+	if w != nil {
+		key = w.PrivateKey
+	}
+	engine, err := NewProofOfStake(&chaincfg.RegTestParams, validators, testSlot, key)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return engine
+}
+
+// posGenesis returns a genesis header for engine, added to chain.
+func posGenesis(chain testChain, engine *ProofOfStake) *types.BlockHeader {
+	genesis := &types.BlockHeader{Version: types.BlockVersion}
+	engine.PrepareGenesis(genesis)
+	chain[genesis.ComputeHash()] = genesis
+	return genesis
+}
+
+// signSlot returns a header on parent for slot, signed by w for the chain
+// with the given ID. root tells apart headers that are otherwise the same.
+func signSlot(engine *ProofOfStake, parent *types.BlockHeader, slot uint64, root string, w *wallet.Wallet, chainID uint32) *types.BlockHeader {
+	header := &types.BlockHeader{
+		Version:      types.BlockVersion,
+		Index:        parent.Index + 1,
+		Timestamp:    engine.slotStart(slot),
+		PreviousHash: parent.ComputeHash(),
+		MerkleRoot:   root,
+		Extra:        encodeSlot(slot),
+	}
+	signature, _ := wallet.Sign(sealHash(header, chainID), w.PrivateKey)
+	header.Seal = encodeSeal(w.Address, signature)
+	return header
+}
+
+// malleate returns a copy of header with the signature in its seal replaced
+// by its high-S form, which is just as valid a signature of the same hash.
+func malleate(header *types.BlockHeader) *types.BlockHeader {
+	signer, signature, _ := decodeSeal(header.Seal)
+	der, _ := hex.DecodeString(signature)
+	rLen := int(der[3])
+	r, s := der[4:4+rLen], der[6+rLen:]
+	highS := new(big.Int).Sub(btcec.S256().N, new(big.Int).SetBytes(s))
+
+	derInt := func(b []byte) []byte {
+		b = bytes.TrimLeft(b, "\x00")
+		if b[0]&0x80 != 0 {
+			b = append([]byte{0}, b...)
+		}
+		return append([]byte{0x02, byte(len(b))}, b...)
+	}
+	body := append(derInt(r), derInt(highS.Bytes())...)
+	malleated := append([]byte{0x30, byte(len(body))}, body...)
+
+	copied := *header
+	copied.Seal = encodeSeal(signer, hex.EncodeToString(malleated))
+	return &copied
+}
+
+func TestPoSElection(t *testing.T) {
+	a, b, c := newWallet(t).Address, newWallet(t).Address, newWallet(t).Address
+	engine := newProofOfStake(t, []string{a, b}, nil)
+	chain := make(testChain)
+	parent := posGenesis(chain, engine)
+
+	elect := func(slot uint64, stakes map[string]uint64) string {
+		proposer, err := engine.proposer(chain, parent, slot, stakes)
+		if err != nil {
+			t.Fatal(err)
+		}
+		return proposer
+	}
+
+	// Until anything is staked, the genesis validators take turns at random
+	counts := make(map[string]int)
+	for slot := uint64(1); slot <= 1000; slot++ {
+		counts[elect(slot, nil)]++
+	}
+	if len(counts) != 2 || counts[a] < 400 || counts[b] < 400 {
+		t.Fatalf("bootstrap election counts are %v, want both validators about half", counts)
+	}
+
+	// Afterwards stakers are elected in proportion to their stake, and
+	// validators without stake aren't
+	stakes := map[string]uint64{a: 0, b: 100, c: 300}
+	counts = make(map[string]int)
+	for slot := uint64(1); slot <= 4000; slot++ {
+		counts[elect(slot, stakes)]++
+	}
+	if counts[a] != 0 || counts[c] < 2800 || counts[c] > 3200 {
+		t.Fatalf("election counts are %v, want about 3000 for the staker with 3/4 of the stake", counts)
+	}
+
+	// Every node elects the same proposer, whatever the map order
+	for slot := uint64(1); slot <= 100; slot++ {
+		if elect(slot, stakes) != elect(slot, map[string]uint64{c: 300, b: 100}) {
+			t.Fatalf("slot %d elected different proposers for the same stakes", slot)
+		}
+	}
+}
+
+func TestPoSElectionSeed(t *testing.T) {
+	w := newWallet(t)
+	engine := newProofOfStake(t, []string{w.Address}, w)
+	chain := make(testChain)
+
+	headers := []*types.BlockHeader{posGenesis(chain, engine)}
+	for i := 1; i <= EpochLength+1; i++ {
+		header := signSlot(engine, headers[i-1], uint64(i), "", w, chaincfg.RegTestParams.ChainID)
+		chain[header.ComputeHash()] = header
+		headers = append(headers, header)
+	}
+
+	seed := func(parent *types.BlockHeader, slot uint64) string {
+		s, err := electionSeed(chain, parent, slot)
+		if err != nil {
+			t.Fatal(err)
+		}
+		return string(s)
+	}
+
+	// The seed comes from the first block of the parent's epoch
+	if seed(headers[1], 100) != seed(headers[EpochLength-1], 100) {
+		t.Fatal("blocks in the same epoch give different seeds")
+	}
+	if seed(headers[EpochLength-1], 100) == seed(headers[EpochLength], 100) {
+		t.Fatal("a new epoch didn't change the seed")
+	}
+	if seed(headers[1], 100) == seed(headers[1], 101) {
+		t.Fatal("different slots share a seed")
+	}
+}
+
+func TestPoSSealAndVerify(t *testing.T) {
+	w, other := newWallet(t), newWallet(t)
+	engine := newProofOfStake(t, []string{w.Address}, w)
+	chain := stakeChain{testChain: make(testChain)}
+	genesis := posGenesis(chain.testChain, engine)
+
+	header := &types.BlockHeader{Version: types.BlockVersion, Index: 1, PreviousHash: genesis.ComputeHash()}
+	if err := engine.Prepare(chain, header); err != nil {
+		t.Fatal(err)
+	}
+	if err := engine.Seal(context.Background(), chain, header); err != nil {
+		t.Fatal(err)
+	}
+	verifier := newProofOfStake(t, []string{w.Address}, nil)
+	if err := verifier.VerifyHeader(chain, header); err != nil {
+		t.Fatalf("sealed block rejected: %v", err)
+	}
+	if err := verifier.VerifyStake(chain, header, nil); err != nil {
+		t.Fatalf("sealed block's proposer rejected: %v", err)
+	}
+
+	// Only the elected proposer may sign a slot
+	stakes := map[string]uint64{other.Address: 1}
+	if err := verifier.VerifyStake(chain, header, stakes); err == nil || !strings.Contains(err.Error(), "was elected") {
+		t.Fatalf("got %v, want a block by a proposer that wasn't elected rejected", err)
+	}
+
+	// A key that is never elected can't seal
+	outsider := newProofOfStake(t, []string{w.Address}, other)
+	header = &types.BlockHeader{Version: types.BlockVersion, Index: 1, PreviousHash: genesis.ComputeHash()}
+	if err := outsider.Seal(context.Background(), chain, header); err != ErrNotProposer {
+		t.Fatalf("got %v, want ErrNotProposer", err)
+	}
+}
+
+func TestPoSVerifyHeaderRejects(t *testing.T) {
+	w := newWallet(t)
+	engine := newProofOfStake(t, []string{w.Address}, nil)
+	chain := make(testChain)
+	genesis := posGenesis(chain, engine)
+	parent := signSlot(engine, genesis, 10, "", w, chaincfg.RegTestParams.ChainID)
+	chain[parent.ComputeHash()] = parent
+
+	if err := engine.VerifyHeader(chain, signSlot(engine, parent, 11, "", w, chaincfg.RegTestParams.ChainID)); err != nil {
+		t.Fatalf("valid block rejected: %v", err)
+	}
+
+	resign := func(h *types.BlockHeader) {
+		signature, _ := wallet.Sign(sealHash(h, chaincfg.RegTestParams.ChainID), w.PrivateKey)
+		h.Seal = encodeSeal(w.Address, signature)
+	}
+	tests := []struct {
+		name   string
+		header *types.BlockHeader
+		want   string
+	}{
+		{"parent's slot", signSlot(engine, parent, 10, "", w, chaincfg.RegTestParams.ChainID), "not after"},
+		{"earlier slot", signSlot(engine, parent, 9, "", w, chaincfg.RegTestParams.ChainID), "not after"},
+		{"other network", signSlot(engine, parent, 11, "", w, chaincfg.RegTestParams.ChainID+1), ""},
+		{"timestamp", func() *types.BlockHeader {
+			h := signSlot(engine, parent, 11, "", w, chaincfg.RegTestParams.ChainID)
+			h.Timestamp = h.Timestamp.Add(time.Nanosecond)
+			resign(h)
+			return h
+		}(), "start of slot"},
+		{"bits", func() *types.BlockHeader {
+			h := signSlot(engine, parent, 11, "", w, chaincfg.RegTestParams.ChainID)
+			h.Bits = 1
+			resign(h)
+			return h
+		}(), "bits and nonce"},
+		{"invalid slot", func() *types.BlockHeader {
+			h := signSlot(engine, parent, 11, "", w, chaincfg.RegTestParams.ChainID)
+			h.Extra = append(h.Extra, 0)
+			resign(h)
+			return h
+		}(), "invalid block slot"},
+		{"high-S seal", malleate(signSlot(engine, parent, 11, "", w, chaincfg.RegTestParams.ChainID)), "not canonical"},
+		{"changed after sealing", func() *types.BlockHeader {
+			h := signSlot(engine, parent, 11, "", w, chaincfg.RegTestParams.ChainID)
+			h.MerkleRoot = "ff"
+			return h
+		}(), ""},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			err := engine.VerifyHeader(chain, tt.header)
+			if err == nil || !strings.Contains(err.Error(), tt.want) {
+				t.Fatalf("got %v, want an error containing %q", err, tt.want)
+			}
+		})
+	}
+}
+
+func TestVerifyEquivocation(t *testing.T) {
+	w, other := newWallet(t), newWallet(t)
+	engine := newProofOfStake(t, []string{w.Address}, nil)
+	chain := make(testChain)
+	genesis := posGenesis(chain, engine)
+	chainID := chaincfg.RegTestParams.ChainID
+
+	a := signSlot(engine, genesis, 5, "aa", w, chainID)
+	b := signSlot(engine, genesis, 5, "bb", w, chainID)
+
+	evidence := EncodeEvidence(a, b)
+	if string(evidence) != string(EncodeEvidence(b, a)) {
+		t.Fatal("the same pair of headers encodes differently")
+	}
+	signer, index, err := VerifyEquivocation(evidence, chainID)
+	if err != nil {
+		t.Fatalf("valid evidence rejected: %v", err)
+	}
+	if signer != w.Address || index != 1 {
+		t.Fatalf("got signer %s at %d, want %s at 1", signer[:8], index, w.Address[:8])
+	}
+
+	// A second seal made from an honest one without the key is still a
+	// valid signature, but not evidence
+	_, signature, _ := decodeSeal(malleate(a).Seal)
+	pubKey, _ := wallet.AddressToPublicKey(w.Address)
+	if valid, err := wallet.Verify(sealHash(a, chainID), signature, pubKey); err != nil || !valid {
+		t.Fatalf("malleated signature doesn't verify (%v)", err)
+	}
+
+	// The index is the higher of the two blocks'
+	parent := signSlot(engine, genesis, 1, "", w, chainID)
+	higher := signSlot(engine, parent, 5, "cc", w, chainID)
+	if _, index, err := VerifyEquivocation(EncodeEvidence(a, higher), chainID); err != nil || index != 2 {
+		t.Fatalf("got index %d (%v), want 2", index, err)
+	}
+
+	// Evidence with the headers in the wrong order
+	first, second := a, b
+	if first.ComputeHash() > second.ComputeHash() {
+		first, second = second, first
+	}
+	e := types.NewEncoder()
+	e.WriteBytes(second.Serialize())
+	e.WriteBytes(first.Serialize())
+	reversed := e.Bytes()
+
+	tests := []struct {
+		name     string
+		evidence []byte
+		chainID  uint32
+		want     string
+	}{
+		{"other network", evidence, chainID + 1, ""},
+		{"same block twice", EncodeEvidence(a, a), chainID, "same block"},
+		{"wrong order", reversed, chainID, "canonical order"},
+		{"different slots", EncodeEvidence(a, signSlot(engine, genesis, 6, "bb", w, chainID)), chainID, "different slots"},
+		{"different signers", EncodeEvidence(a, signSlot(engine, genesis, 5, "bb", other, chainID)), chainID, "different signers"},
+		{"genesis", EncodeEvidence(a, genesis), chainID, "genesis"},
+		{"one block with a malleated seal", EncodeEvidence(a, malleate(a)), chainID, "same signed contents"},
+		{"trailing byte", append(append([]byte(nil), evidence...), 0), chainID, "invalid evidence"},
+	}
+	for n := 0; n < len(evidence); n += 17 {
+		tests = append(tests, struct {
+			name     string
+			evidence []byte
+			chainID  uint32
+			want     string
+		}{"truncated", evidence[:n], chainID, "invalid evidence"})
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			_, _, err := VerifyEquivocation(tt.evidence, tt.chainID)
+			if err == nil || !strings.Contains(err.Error(), tt.want) {
+				t.Fatalf("got %v, want an error containing %q", err, tt.want)
+			}
+		})
+	}
+}
@@ -1,160 +1,268 @@
 package consensus
 
 import (
+	"context"
+	"crypto/sha256"
 	"fmt"
-	"strings"
+	"math"
+	"math/big"
+	"runtime"
+	"sync"
+	"sync/atomic"
 	"time"
 
-	"github.com/OhMyDitzzy/vulcan/core"
+	"github.com/OhMyDitzzy/vulcan/chaincfg"
+	"github.com/OhMyDitzzy/vulcan/types"
 )
 
 // ProofOfWork implements the Proof-of-Work consensus algorithm.
 // In our blockchain, miners must find a nonce that produces a block hash
-// with a specific number of leading zeros (difficulty). This ensures
-// that blocks are mined at a predictable rate and provides security
-// against attacks by making chain rewriting computationally expensive.
+// which, read as a 256-bit number, is at or below a target. A lower target
+// means fewer valid hashes and more work. This ensures that blocks are
+// mined at a predictable rate and provides security against attacks by
+// making chain rewriting computationally expensive.
+// The target of each block is a consensus rule derived from the chain
+// (see CalcDifficulty), so every node agrees on it.
 type ProofOfWork struct {
-	difficulty      int
-	targetBlockTime time.Duration
+	params   *chaincfg.Params // Network the engine mines for
+	powLimit *big.Int         // Easiest allowed target
+	threads  int              // Number of worker goroutines hashing in parallel
+	maxNonce uint64           // Largest nonce tried before the timestamp is bumped
 }
 
-// NewProofOfWork creates a new ProofOfWork instance.
-// Configure the difficulty (number of leading zeros required)
-// and target block time for dynamic difficulty adjustment.
-func NewProofOfWork(difficulty int, targetBlockTime time.Duration) *ProofOfWork {
-	if difficulty < 1 {
-		difficulty = 1
+// NewProofOfWork creates a new ProofOfWork instance for the given network
+// that mines with the given number of worker goroutines, or one per CPU if
+// threads is zero or less.
+func NewProofOfWork(params *chaincfg.Params, threads int) *ProofOfWork {
+	if threads <= 0 {
+		threads = runtime.NumCPU()
 	}
-	if targetBlockTime == 0 {
-		targetBlockTime = 10 * time.Second
-	}
-	
 	return &ProofOfWork{
-		difficulty:      difficulty,
-		targetBlockTime: targetBlockTime,
+		params:   params,
+		powLimit: params.PowLimit(),
+		threads:  threads,
+		maxNonce: math.MaxUint64,
 	}
 }
 
-// Mine attempts to find a valid nonce for the block.
-// We increment the nonce and compute the hash repeatedly until we find
-// a hash that satisfies the difficulty requirement (has the required
-// number of leading zeros). This is the core of the mining process.
-func (pow *ProofOfWork) Mine(block *core.Block) error {
-	fmt.Printf("Mining block %d with difficulty %d...\n", block.Index, pow.difficulty)
-	
-	startTime := time.Now()
-	target := pow.getTarget()
-	
-	var hashesComputed uint64
-	for {
-		block.SetHash()
-		
-		hashesComputed++
+var _ Engine = (*ProofOfWork)(nil)
 
-		if pow.isValidHash(block.Hash, target) {
-			duration := time.Since(startTime)
-			hashRate := float64(hashesComputed) / duration.Seconds()
-			fmt.Printf("Block %d mined! Hash: %s (took %v, %0.0f H/s)\n",
-				block.Index, block.Hash, duration, hashRate)
-			return nil
-		}
+// Threads returns the number of worker goroutines used for mining.
+func (pow *ProofOfWork) Threads() int {
+	return pow.threads
+}
 
-		block.Nonce++
+func (pow *ProofOfWork) Name() string {
+	return "pow"
+}
 
-		if hashesComputed%100000 == 0 {
-			fmt.Printf("Mining progress: %d hashes computed...\n", hashesComputed)
-		}
+// PrepareGenesis starts the chain at the network's genesis target.
+func (pow *ProofOfWork) PrepareGenesis(header *types.BlockHeader) {
+	header.Bits = pow.params.GenesisBits
+}
+
+// Prepare sets the header's target to the one required after its parent.
+func (pow *ProofOfWork) Prepare(chain ChainReader, header *types.BlockHeader) error {
+	parent := chain.GetHeader(header.PreviousHash)
+	if parent == nil {
+		return fmt.Errorf("unknown previous block %s", header.PreviousHash)
 	}
+	header.Bits = pow.CalcDifficulty(chain, parent)
+	return nil
 }
 
-// getTarget returns the target string (required prefix of zeros).
-// We build a string of zeros based on the difficulty level.
-func (pow *ProofOfWork) getTarget() string {
-	return strings.Repeat("0", pow.difficulty)
+// Seal mines the header. See Mine.
+func (pow *ProofOfWork) Seal(ctx context.Context, chain ChainReader, header *types.BlockHeader) error {
+	return pow.Mine(ctx, header)
 }
 
-// isValidHash checks if a hash meets the difficulty requirement.
-// Verify that the hash starts with the required number of leading zeros.
-func (pow *ProofOfWork) isValidHash(hash, target string) bool {
-	if len(hash) < len(target) {
-		return false
+// VerifyHeader checks that the header uses the target required after its
+// parent and that its hash is at or below that target.
+func (pow *ProofOfWork) VerifyHeader(chain ChainReader, header *types.BlockHeader) error {
+	parent := chain.GetHeader(header.PreviousHash)
+	if parent == nil {
+		return fmt.Errorf("unknown previous block %s", header.PreviousHash)
 	}
-	return hash[:len(target)] == target
-}
 
-// ValidateBlock verifies that a block has valid Proof-of-Work.
-// Check that the block's hash has the required number of leading zeros
-// and that the hash is correctly computed from the block data.
-func (pow *ProofOfWork) ValidateBlock(block *core.Block) error {
-	expectedHash := block.ComputeHash()
-	if block.Hash != expectedHash {
-		return fmt.Errorf("block hash is incorrect: expected %s, got %s", expectedHash, block.Hash)
+	if expected := pow.CalcDifficulty(chain, parent); header.Bits != expected {
+		return fmt.Errorf("incorrect target bits: expected %08x, got %08x", expected, header.Bits)
 	}
 
-	target := strings.Repeat("0", pow.difficulty)
-	if !pow.isValidHash(block.Hash, target) {
-		return fmt.Errorf("block hash does not meet difficulty requirement (need %d leading zeros)", pow.difficulty)
+	if !header.HasValidProofOfWork(pow.powLimit) {
+		return fmt.Errorf("block hash is above the target for bits %08x", header.Bits)
 	}
-	
 	return nil
 }
 
-// AdjustDifficulty dynamically adjusts the mining difficulty based on recent block times.
-// Increase difficulty if blocks are being mined too fast, and decrease it
-// if blocks are taking too long. This helps maintain a consistent block time.
-func (pow *ProofOfWork) AdjustDifficulty(recentBlocks []*core.Block) {
-	if len(recentBlocks) < 10 {
-		return // Need at least 10 blocks to adjust
-	}
-
-	var totalTime time.Duration
-	for i := 1; i < len(recentBlocks); i++ {
-		timeDiff := recentBlocks[i].Timestamp.Sub(recentBlocks[i-1].Timestamp)
-		totalTime += timeDiff
-	}
-	avgTime := totalTime / time.Duration(len(recentBlocks)-1)
-
-	if avgTime < pow.targetBlockTime/2 {
-		pow.difficulty++
-		fmt.Printf("Difficulty increased to %d (avg block time: %v)\n", pow.difficulty, avgTime)
-	} else if avgTime > pow.targetBlockTime*2 && pow.difficulty > 1 {
-		pow.difficulty--
-		fmt.Printf("Difficulty decreased to %d (avg block time: %v)\n", pow.difficulty, avgTime)
-	}
+// CalcDifficulty returns the compact target required for a block on top of parent.
+func (pow *ProofOfWork) CalcDifficulty(chain ChainReader, parent *types.BlockHeader) uint32 {
+	return calcNextRequiredBits(chain, parent, pow.params)
 }
 
+// BlockReward returns the subsidy for the block's height.
+func (pow *ProofOfWork) BlockReward(chain ChainReader, header *types.BlockHeader) uint64 {
+	return pow.params.Emission.Subsidy(header.Index)
+}
 
-func (pow *ProofOfWork) GetDifficulty() int {
-	return pow.difficulty
+// Work returns the expected number of hashes needed to mine the block.
+func (pow *ProofOfWork) Work(header *types.BlockHeader) *big.Int {
+	return types.CalcWork(header.Bits)
 }
 
-// SetDifficulty manually sets the mining difficulty.
-// for testing or manual adjustment.
-func (pow *ProofOfWork) SetDifficulty(difficulty int) {
-	if difficulty < 1 {
-		difficulty = 1
+// Mine attempts to find a valid nonce for the header.
+// The nonce space is split into one contiguous range per worker, and each
+// worker hashes the header with every nonce in its range until one of them
+// finds a hash at or below the block's target. Only the header is hashed,
+// and each worker encodes it once: an attempt just rewrites the nonce at the
+// end of the encoding. If every nonce fails, the timestamp is bumped to get
+// a fresh search space.
+// Mining stops with the context's error as soon as the context is cancelled,
+// for example because the tip changed and the block would be stale.
+func (pow *ProofOfWork) Mine(ctx context.Context, header *types.BlockHeader) error {
+	fmt.Printf("Mining block %d with target bits %08x on %d threads...\n", header.Index, header.Bits, pow.threads)
+	
+	startTime := time.Now()
+	target := pow.getTarget(header.Bits)
+	if target.Sign() <= 0 {
+		return fmt.Errorf("invalid target bits %08x", header.Bits)
+	}
+	
+	var hashesComputed atomic.Uint64
+	for {
+		if err := ctx.Err(); err != nil {
+			return err
+		}
+		
+		nonce, found, err := pow.search(ctx, *header, target, &hashesComputed)
+		if err != nil {
+			return err
+		}
+		
+		if found {
+			header.Nonce = nonce
+			
+			duration := time.Since(startTime)
+			hashRate := float64(hashesComputed.Load()) / duration.Seconds()
+			fmt.Printf("Block %d mined! Hash: %s (took %v, %0.0f H/s)\n",
+				header.Index, header.ComputeHash(), duration, hashRate)
+			return nil
+		}
+		
+		// Changing the timestamp changes every hash, so we can go again
+		timestamp := time.Now().UTC()
+		if !timestamp.After(header.Timestamp) {
+			timestamp = header.Timestamp.Add(time.Second)
+		}
+		header.Timestamp = timestamp
+		fmt.Printf("Nonce space exhausted for block %d, retrying with timestamp %s\n",
+			header.Index, timestamp.Format(time.RFC3339))
 	}
-	pow.difficulty = difficulty
 }
 
-// EstimateHashRate estimates the network hash rate based on a block.
-// Calculate this from the difficulty and the time it took to mine the block.
-func (pow *ProofOfWork) EstimateHashRate(block *core.Block, prevBlock *core.Block) float64 {
-	if prevBlock == nil {
-		return 0
+// search runs the workers over the whole nonce space for one header.
+// It returns the winning nonce, or found == false if no nonce works.
+func (pow *ProofOfWork) search(ctx context.Context, header types.BlockHeader, target *big.Int, hashesComputed *atomic.Uint64) (uint64, bool, error) {
+	ctx, cancel := context.WithCancel(ctx)
+	defer cancel()
+	
+	ranges := splitNonces(uint64(pow.threads), pow.maxNonce)
+	results := make(chan uint64, len(ranges))
+	var wg sync.WaitGroup
+	for _, r := range ranges {
+		first, last := r[0], r[1]
+		
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			if nonce, ok := pow.work(ctx, header.Serialize(), target, first, last, hashesComputed); ok {
+				results <- nonce
+				cancel()
+			}
+		}()
 	}
 	
-	timeDiff := block.Timestamp.Sub(prevBlock.Timestamp).Seconds()
-	if timeDiff == 0 {
-		return 0
+	done := make(chan struct{})
+	go func() {
+		wg.Wait()
+		close(done)
+	}()
+	
+	ticker := time.NewTicker(10 * time.Second)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-done:
+			select {
+			case nonce := <-results:
+				return nonce, true, nil
+			default:
+			}
+			if err := ctx.Err(); err != nil {
+				return 0, false, err
+			}
+			return 0, false, nil
+		case <-ticker.C:
+			fmt.Printf("Mining progress: %d hashes computed...\n", hashesComputed.Load())
+		}
+	}
+}
+
+// splitNonces splits the nonces from 0 to maxNonce into contiguous ranges
+// of first and last nonce, one per worker. Every worker needs a non-empty
+// range, so there may be fewer than threads; the last one also covers the
+// remainder.
+func splitNonces(threads, maxNonce uint64) [][2]uint64 {
+	if threads > maxNonce {
+		threads = max(maxNonce, 1)
 	}
+	rangeSize := maxNonce / threads
 	
-	// Approximate number of hashes needed: 16^difficulty
-	targetHashes := 1.0
-	for i := 0; i < pow.difficulty; i++ {
-		targetHashes *= 16
+	ranges := make([][2]uint64, threads)
+	for i := range ranges {
+		first := uint64(i) * rangeSize
+		last := first + rangeSize - 1
+		if i == len(ranges)-1 {
+			last = maxNonce
+		}
+		ranges[i] = [2]uint64{first, last}
 	}
+	return ranges
+}
+
+// work hashes the serialized header with every nonce from first to last.
+// The context is checked every few thousand hashes so cancellation is quick
+// without slowing the loop down.
+func (pow *ProofOfWork) work(ctx context.Context, header []byte, target *big.Int, first, last uint64, hashesComputed *atomic.Uint64) (uint64, bool) {
+	const checkInterval = 4096
+	hashNum := new(big.Int)
 	
-	hashRate := targetHashes / timeDiff
-	return hashRate
-}
\ No newline at end of file
+	var pending uint64
+	for nonce := first; ; nonce++ {
+		types.PutSerializedNonce(header, nonce)
+		hash := sha256.Sum256(header)
+		
+		if hashNum.SetBytes(hash[:]).Cmp(target) <= 0 {
+			hashesComputed.Add(pending + 1)
+			return nonce, true
+		}
+		
+		pending++
+		if pending == checkInterval {
+			hashesComputed.Add(pending)
+			pending = 0
+			if ctx.Err() != nil {
+				return 0, false
+			}
+		}
+		
+		if nonce == last {
+			hashesComputed.Add(pending)
+			return 0, false
+		}
+	}
+}
+
+// getTarget returns the 256-bit target encoded in the compact bits.
+func (pow *ProofOfWork) getTarget(bits uint32) *big.Int {
+	return types.CompactToBig(bits)
+}
@@ -0,0 +1,81 @@
+package consensus
+
+import (
+	"context"
+	"errors"
+	"math"
+	"math/big"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/OhMyDitzzy/vulcan/chaincfg"
+	"github.com/OhMyDitzzy/vulcan/types"
+)
+
+func TestSplitNonces(t *testing.T) {
+	tests := []struct {
+		threads, maxNonce uint64
+		want              int
+	}{
+		{1, math.MaxUint64, 1},
+		{8, math.MaxUint64, 8},
+		{7, 1000, 7},
+		{10, 3, 3},
+		{4, 1, 1},
+		{4, 0, 1},
+	}
+	for _, tt := range tests {
+		ranges := splitNonces(tt.threads, tt.maxNonce)
+		if len(ranges) != tt.want {
+			t.Fatalf("%d threads up to %d: got %d ranges, want %d", tt.threads, tt.maxNonce, len(ranges), tt.want)
+		}
+		// The ranges must cover every nonce exactly once, in order
+		var next uint64
+		for i, r := range ranges {
+			if r[0] != next || r[1] < r[0] {
+				t.Fatalf("%d threads up to %d: range %d is %d to %d, want it to start at %d", tt.threads, tt.maxNonce, i, r[0], r[1], next)
+			}
+			next = r[1] + 1
+		}
+		if ranges[len(ranges)-1][1] != tt.maxNonce {
+			t.Fatalf("%d threads up to %d: last range ends at %d", tt.threads, tt.maxNonce, ranges[len(ranges)-1][1])
+		}
+	}
+}
+
+func TestSearchTriesEveryNonceOnce(t *testing.T) {
+	pow := NewProofOfWork(&chaincfg.RegTestParams, 7)
+	pow.maxNonce = 1000
+	header := types.BlockHeader{Version: types.BlockVersion, Index: 1, Timestamp: time.Unix(1700000000, 0)}
+
+	// No hash is at or below a zero target
+	var hashes atomic.Uint64
+	if _, found, err := pow.search(context.Background(), header, big.NewInt(0), &hashes); found || err != nil {
+		t.Fatalf("search found %v (%v), want the nonces exhausted", found, err)
+	}
+	if hashes.Load() != pow.maxNonce+1 {
+		t.Fatalf("workers hashed %d times, want once per nonce, %d", hashes.Load(), pow.maxNonce+1)
+	}
+}
+
+func TestMineStopsWhenCancelled(t *testing.T) {
+	pow := NewProofOfWork(&chaincfg.RegTestParams, 4)
+	// A target no test run could find a hash for
+	header := &types.BlockHeader{Version: types.BlockVersion, Index: 1, Timestamp: time.Unix(1700000000, 0), Bits: 0x03000001}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	done := make(chan error)
+	go func() { done <- pow.Mine(ctx, header) }()
+
+	time.Sleep(50 * time.Millisecond)
+	cancel()
+	select {
+	case err := <-done:
+		if !errors.Is(err, context.Canceled) {
+			t.Fatalf("got %v, want context.Canceled", err)
+		}
+	case <-time.After(5 * time.Second):
+		t.Fatal("workers didn't stop after the context was cancelled")
+	}
+}
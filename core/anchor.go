@@ -0,0 +1,115 @@
+package core
+
+import (
+	"fmt"
+	"time"
+
+	"github.com/OhMyDitzzy/vulcan/script"
+	"github.com/OhMyDitzzy/vulcan/store"
+	"github.com/OhMyDitzzy/vulcan/types"
+)
+
+// Anchor is a data output on the main chain: proof that its data, such as
+// the hash of a document, existed when the block including it was made.
+type Anchor struct {
+	TxID      string    `json:"tx_id"`
+	Index     uint32    `json:"index"`
+	BlockHash string    `json:"block_hash"`
+	Height    uint64    `json:"height"`
+	Timestamp time.Time `json:"timestamp"`
+}
+
+// checkDataOutputs makes sure every data output of a transaction carries
+// its data the way script.DataScript puts it, within script.MaxDataSize.
+func checkDataOutputs(tx *types.Transaction) error {
+	for i, out := range tx.Outputs {
+		if !out.IsData() {
+			continue
+		}
+		if _, err := script.ExtractData(out.Script); err != nil {
+			return fmt.Errorf("output %d: %w", i, err)
+		}
+	}
+	return nil
+}
+
+// The anchor index maps the data of every data output on the main chain to
+// where it was anchored. It is part of the chainstate: it is written in the
+// same batch as the blocks that change it, so it always matches the UTXO set
+// and survives restarts without rescanning the chain.
+
+// Serialize returns the binary encoding of an anchor, as stored in the
+// anchor index.
+func (a *Anchor) Serialize() []byte {
+	e := types.NewEncoder()
+	e.WriteString(a.TxID)
+	e.WriteUint32(a.Index)
+	e.WriteString(a.BlockHash)
+	e.WriteUint64(a.Height)
+	e.WriteTime(a.Timestamp)
+	return e.Bytes()
+}
+
+// DeserializeAnchor decodes an anchor produced by Serialize.
+func DeserializeAnchor(data []byte) (*Anchor, error) {
+	d := types.NewDecoder(data)
+	a := &Anchor{
+		TxID:      d.ReadString(),
+		Index:     d.ReadUint32(),
+		BlockHash: d.ReadString(),
+		Height:    d.ReadUint64(),
+		Timestamp: d.ReadTime(),
+	}
+	if err := d.Finish(); err != nil {
+		return nil, fmt.Errorf("failed to decode anchor: %w", err)
+	}
+	return a, nil
+}
+
+// writeConnectAnchor adds the anchor of data output i of a transaction in a
+// block connected to the main chain to a batch.
+func writeConnectAnchor(batch *store.Batch, block *Block, tx *types.Transaction, i int) {
+	data, err := script.ExtractData(tx.Outputs[i].Script)
+	if err != nil {
+		return
+	}
+	anchor := Anchor{
+		TxID:      tx.ID,
+		Index:     uint32(i),
+		BlockHash: block.Hash,
+		Height:    block.Index,
+		Timestamp: block.Timestamp,
+	}
+	batch.PutAnchor(data, block.Index, tx.ID, uint32(i), anchor.Serialize())
+}
+
+// writeDisconnectAnchor adds the removal of the anchor written by
+// writeConnectAnchor to a batch.
+func writeDisconnectAnchor(batch *store.Batch, block *Block, tx *types.Transaction, i int) {
+	data, err := script.ExtractData(tx.Outputs[i].Script)
+	if err != nil {
+		return
+	}
+	batch.DeleteAnchor(data, block.Index, tx.ID, uint32(i))
+}
+
+// GetAnchors returns where data was anchored on the main chain, earliest
+// first, or nil if it never was.
+func (bc *Blockchain) GetAnchors(data []byte) ([]Anchor, error) {
+	bc.mu.RLock()
+	defer bc.mu.RUnlock()
+
+	var anchors []Anchor
+	err := bc.store.ForEachAnchor(data, func(value []byte) error {
+		anchor, err := DeserializeAnchor(value)
+		if err != nil {
+			return err
+		}
+		anchors = append(anchors, *anchor)
+		return nil
+	})
+	if err != nil {
+		return nil, fmt.Errorf("failed to load anchors: %w", err)
+	}
+	return anchors, nil
+}
@@ -0,0 +1,95 @@
+package core
+
+import (
+	"bytes"
+	"reflect"
+	"testing"
+	"time"
+
+	"github.com/OhMyDitzzy/vulcan/script"
+	"github.com/OhMyDitzzy/vulcan/types"
+	"github.com/OhMyDitzzy/vulcan/wallet"
+)
+
+func TestAnchorRoundTrip(t *testing.T) {
+	anchor := &Anchor{
+		TxID:      "aa11",
+		Index:     2,
+		BlockHash: "00ff",
+		Height:    1 << 33,
+		Timestamp: time.Unix(1700000000, 5).UTC(),
+	}
+	data := anchor.Serialize()
+
+	got, err := DeserializeAnchor(data)
+	if err != nil {
+		t.Fatalf("DeserializeAnchor failed: %v", err)
+	}
+	if !reflect.DeepEqual(got, anchor) {
+		t.Fatalf("got %+v, want %+v", got, anchor)
+	}
+
+	for n := 0; n < len(data); n++ {
+		if _, err := DeserializeAnchor(data[:n]); err == nil {
+			t.Errorf("decoding the first %d of %d bytes succeeded", n, len(data))
+		}
+	}
+	if _, err := DeserializeAnchor(append(bytes.Clone(data), 0)); err == nil {
+		t.Error("decoding with a trailing byte succeeded")
+	}
+}
+
+func TestAnchorsFollowTheMainChain(t *testing.T) {
+	n := newTestNode(t)
+	genesis := n.genesis()
+	alice, bob := newAddress(t), newAddress(t)
+	document := []byte("hash of a document")
+
+	lock, err := script.DataScript(document)
+	if err != nil {
+		t.Fatal(err)
+	}
+	coinbase := genesis.Transactions[0]
+	coins := []wallet.Coin{{OutPoint: types.OutPoint{TxID: coinbase.ID}, Amount: coinbase.Outputs[0].Amount}}
+	anchorTx, err := n.wallet.CreateDataTransaction(n.params.ChainID, coins, lock, 10)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	anchors := func() []Anchor {
+		t.Helper()
+		anchors, err := n.bc.GetAnchors(document)
+		if err != nil {
+			t.Fatal(err)
+		}
+		return anchors
+	}
+
+	a1 := n.mine(genesis, alice, anchorTx)
+	n.add(a1)
+	want := []Anchor{{TxID: anchorTx.ID, Index: 0, BlockHash: a1.Hash, Height: 1, Timestamp: a1.Timestamp}}
+	if got := anchors(); !reflect.DeepEqual(got, want) {
+		t.Fatalf("got anchors %+v, want %+v", got, want)
+	}
+	n.restart()
+	if got := anchors(); !reflect.DeepEqual(got, want) {
+		t.Fatalf("got anchors %+v after a restart, want %+v", got, want)
+	}
+
+	// A reorganization away from the block removes its anchor
+	b := n.branch(genesis, bob, 2)
+	n.add(b...)
+	if got := anchors(); len(got) != 0 {
+		t.Fatalf("got anchors %+v of a disconnected block", got)
+	}
+	n.restart()
+	if got := anchors(); len(got) != 0 {
+		t.Fatalf("got anchors %+v of a disconnected block after a restart", got)
+	}
+
+	// And reorganizing back restores it
+	n.add(n.branch(a1, alice, 2)...)
+	if got := anchors(); !reflect.DeepEqual(got, want) {
+		t.Fatalf("got anchors %+v after reconnecting the block, want %+v", got, want)
+	}
+}
@@ -1,9 +1,6 @@
 package core
 
 import (
-	"crypto/sha256"
-	"encoding/hex"
-	"encoding/json"
 	"fmt"
 	"time"
 	
@@ -13,49 +10,62 @@ import (
 // Block represents a single block in the blockchain.
 // Each block contains an index, timestamp, list of transactions,
 // and cryptographic links to the previous block through hashing.
-// We use Proof-of-Work consensus to ensure blocks are mined securely.
+// The consensus engine decides how blocks are sealed and rewarded.
+// The header fields are embedded from types.BlockHeader, so the hash and
+// proof-of-work only ever depend on the header.
 type Block struct {
-	Index        uint64         `json:"index"`         // Block height in the chain
-	Timestamp    time.Time      `json:"timestamp"`     // Block creation time
-	Transactions []*types.Transaction `json:"transactions"`  // List of transactions in this block
-	Nonce        uint64         `json:"nonce"`         // Proof-of-Work nonce
-	PreviousHash string         `json:"previous_hash"` // Hash of the previous block
-	MerkleRoot   string         `json:"merkle_root"`   // Merkle root of all transactions
-	Hash         string         `json:"hash"`          // Current block hash
-	Difficulty   int            `json:"difficulty"`    // Mining difficulty (leading zeros)
+	types.BlockHeader
+	Transactions []*types.Transaction `json:"transactions"` // List of transactions in this block
+	Hash         string               `json:"hash"`         // Current block hash
 }
 
 // NewBlock creates a new block with the given parameters.
 // Compute the Merkle root from the transactions to ensure
 // integrity and efficient verification of transaction inclusion.
-func NewBlock(index uint64, transactions []*types.Transaction, previousHash string, difficulty int) *Block {
+// The consensus fields are left for the engine's Prepare and Seal to fill in.
+func NewBlock(index uint64, transactions []*types.Transaction, previousHash string) *Block {
 	block := &Block{
-		Index:        index,
-		Timestamp:    time.Now().UTC(),
+		BlockHeader: types.BlockHeader{
+			Version:      types.BlockVersion,
+			Index:        index,
+			Timestamp:    time.Now().UTC(),
+			Nonce:        0,
+			PreviousHash: previousHash,
+		},
 		Transactions: transactions,
-		Nonce:        0,
-		PreviousHash: previousHash,
-		Difficulty:   difficulty,
 	}
 	block.MerkleRoot = block.ComputeMerkleRoot()
 	return block
 }
 
-// ComputeHash calculates the SHA256 hash of the block header.
-// Include all block fields in the hash to ensure tamper-proof linking.
-// The hash is computed over: index, timestamp, merkle root, previous hash,
-// nonce, and difficulty.
-func (b *Block) ComputeHash() string {
-	data := fmt.Sprintf("%d%s%s%s%d%d",
-		b.Index,
-		b.Timestamp.Format(time.RFC3339Nano),
-		b.MerkleRoot,
-		b.PreviousHash,
-		b.Nonce,
-		b.Difficulty,
-	)
-	hash := sha256.Sum256([]byte(data))
-	return hex.EncodeToString(hash[:])
+// Serialize returns the canonical binary encoding of the block,
+// the header followed by its transactions. This is what we store and
+// send to peers. The hash isn't included since it is derived from the header.
+func (b *Block) Serialize() []byte {
+	e := types.NewEncoder()
+	b.BlockHeader.Encode(e)
+	e.WriteVarInt(uint64(len(b.Transactions)))
+	for _, tx := range b.Transactions {
+		tx.Encode(e)
+	}
+	return e.Bytes()
+}
+
+// DeserializeBlock decodes a block produced by Serialize and recomputes its hash.
+func DeserializeBlock(data []byte) (*Block, error) {
+	d := types.NewDecoder(data)
+
+	b := &Block{BlockHeader: *types.DecodeBlockHeader(d)}
+	b.Transactions = make([]*types.Transaction, d.ReadCount())
+	for i := range b.Transactions {
+		b.Transactions[i] = types.DecodeTransaction(d)
+	}
+
+	if err := d.Finish(); err != nil {
+		return nil, fmt.Errorf("failed to decode block: %w", err)
+	}
+	b.SetHash()
+	return b, nil
 }
 
 // SetHash computes and sets the block hash.
@@ -68,22 +78,39 @@ func (b *Block) SetHash() {
 // Create a compact cryptographic commitment to all transactions,
 // which allows efficient verification of transaction inclusion.
 func (b *Block) ComputeMerkleRoot() string {
-	if len(b.Transactions) == 0 {
-		return ""
+	root, _ := BuildMerkleRoot(b.txIDs())
+	return root
+}
+
+// MerkleProof returns the proof that a transaction is included in the block,
+// or nil if it isn't.
+func (b *Block) MerkleProof(txID string) *MerkleProof {
+	txIDs := b.txIDs()
+	for i, id := range txIDs {
+		if id == txID {
+			return GenerateMerkleProof(txIDs, i)
+		}
 	}
-	
-	// Get transaction IDs
+	return nil
+}
+
+func (b *Block) txIDs() []string {
 	txIDs := make([]string, len(b.Transactions))
 	for i, tx := range b.Transactions {
 		txIDs[i] = tx.ID
 	}
-	
-	return BuildMerkleRoot(txIDs)
+	return txIDs
 }
 
 // Validate performs comprehensive validation on the block.
-// We check block structure, hash validity, Merkle root, and all transactions.
+// We check block structure, hash validity, Merkle root, coinbase placement
+// and all transactions. Checks that need the UTXO set (input existence,
+// ownership and signatures) happen when the block is connected.
 func (b *Block) Validate() error {
+	if b.Version != types.BlockVersion {
+		return fmt.Errorf("unsupported block version %d", b.Version)
+	}
+
 	if b.Index == 0 && b.PreviousHash != "0" {
 		return fmt.Errorf("genesis block must have previous hash of '0'")
 	}
@@ -96,43 +123,50 @@ func (b *Block) Validate() error {
 		return fmt.Errorf("block hash is invalid")
 	}
 	
-	expectedMerkleRoot := b.ComputeMerkleRoot()
+	expectedMerkleRoot, mutated := BuildMerkleRoot(b.txIDs())
+	if mutated {
+		return fmt.Errorf("merkle tree is mutated")
+	}
 	if b.MerkleRoot != expectedMerkleRoot {
 		return fmt.Errorf("merkle root mismatch: expected %s, got %s", expectedMerkleRoot, b.MerkleRoot)
 	}
 	
+	if len(b.Transactions) == 0 {
+		return fmt.Errorf("block has no transactions")
+	}
+	if !b.Transactions[0].IsCoinbase() {
+		return fmt.Errorf("first transaction must be the coinbase")
+	}
+	
+	seenTxs := make(map[string]bool, len(b.Transactions))
+	spent := make(map[types.OutPoint]bool)
 	for i, tx := range b.Transactions {
 		if err := tx.Validate(); err != nil {
 			return fmt.Errorf("transaction %d invalid: %w", i, err)
 		}
+		if i > 0 && tx.IsCoinbase() {
+			return fmt.Errorf("transaction %d is an extra coinbase", i)
+		}
+		
+		if seenTxs[tx.ID] {
+			return fmt.Errorf("transaction %d is a duplicate of %s", i, tx.ID)
+		}
+		seenTxs[tx.ID] = true
+		
+		if tx.IsCoinbase() {
+			continue
+		}
+		for _, in := range tx.Inputs {
+			if spent[in.PrevOut] {
+				return fmt.Errorf("transaction %d double-spends output %s", i, in.PrevOut)
+			}
+			spent[in.PrevOut] = true
+		}
 	}
 	
 	return nil
 }
 
-// HasValidProofOfWork checks if the block satisfies the PoW requirement.
-// Verify that the block hash has the required number of leading zeros
-// based on the difficulty level.
-func (b *Block) HasValidProofOfWork() bool {
-	requiredPrefix := ""
-	for i := 0; i < b.Difficulty; i++ {
-		requiredPrefix += "0"
-	}
-	return b.Hash[:b.Difficulty] == requiredPrefix
-}
-
-func (b *Block) ToJSON() ([]byte, error) {
-	return json.Marshal(b)
-}
-
-func BlockFromJSON(data []byte) (*Block, error) {
-	var block Block
-	if err := json.Unmarshal(data, &block); err != nil {
-		return nil, err
-	}
-	return &block, nil
-}
-
 // GetTransactionByID searches for a transaction in the block by its ID.
 // Return the transaction if found, nil otherwise.
 func (b *Block) GetTransactionByID(txID string) *types.Transaction {
@@ -144,6 +178,21 @@ func (b *Block) GetTransactionByID(txID string) *types.Transaction {
 	return nil
 }
 
+// sumFees is TotalFees with an overflow check, for validating untrusted blocks.
+func (b *Block) sumFees() (uint64, error) {
+	var total uint64
+	for _, tx := range b.Transactions {
+		if tx.IsCoinbase() {
+			continue
+		}
+		if total+tx.Fee < total {
+			return 0, fmt.Errorf("block fees overflow")
+		}
+		total += tx.Fee
+	}
+	return total, nil
+}
+
 func (b *Block) TotalFees() uint64 {
 	var total uint64
 	for _, tx := range b.Transactions {
@@ -154,10 +203,7 @@ func (b *Block) TotalFees() uint64 {
 	return total
 }
 
+// Size returns the size of the block's binary encoding in bytes.
 func (b *Block) Size() int {
-	data, err := b.ToJSON()
-	if err != nil {
-		return 0
-	}
-	return len(data)
+	return len(b.Serialize())
 }
\ No newline at end of file
@@ -1,88 +1,675 @@
 package core
 
 import (
+	"errors"
 	"fmt"
+	"log"
+	"sort"
 	"sync"
+	"time"
+
+	"github.com/OhMyDitzzy/vulcan/chaincfg"
+	"github.com/OhMyDitzzy/vulcan/consensus"
 	"github.com/OhMyDitzzy/vulcan/store"
+	"github.com/OhMyDitzzy/vulcan/txpool"
+	"github.com/OhMyDitzzy/vulcan/types"
 )
 
+// MaxFutureBlockTime is how far ahead of our clock a block timestamp may be.
+const MaxFutureBlockTime = 2 * time.Minute
+
+// Blockchain keeps a tree of every known block and tracks the main chain.
+// The main chain is the branch with the most cumulative work, as measured
+// by the consensus engine.
+// Blocks on other branches are stored as side chains, and when one of them
+// overtakes the main chain we reorganize onto it.
+// Once a block is finalized, it can't be reorganized away: blocks on
+// branches that don't contain it are rejected.
 type Blockchain struct {
-	blocks    []*Block
-	store     store.Store
-	utxoSet   *UTXOSet
-	mu        sync.RWMutex
-	height    uint64
+	params  *chaincfg.Params
+	blocks  []*Block              // Main chain, indexed by height
+	index   map[string]*blockNode // Every known block by hash, on any branch
+	tip     *blockNode
+	store   store.Store
+	utxoSet *UTXOSet
+	mempool *txpool.Mempool
+	engine  consensus.Engine
+	mu      sync.RWMutex
+	height  uint64
+
+	finalized  *blockNode      // Highest finalized checkpoint, or nil
+	tipChanged chan struct{}   // Closed and replaced whenever the tip changes
+	invalid    map[string]bool // Blocks that failed to connect, and their descendants
 }
 
-func NewBlockchain(store store.Store, utxoSet *UTXOSet) *Blockchain {
+// NewBlockchain creates a blockchain of the given network backed by the
+// given store. The mempool is kept in sync as blocks are connected and
+// disconnected; it may be nil when no transaction pool is running. Blocks
+// are verified with the given consensus engine.
+func NewBlockchain(params *chaincfg.Params, store store.Store, utxoSet *UTXOSet, mempool *txpool.Mempool, engine consensus.Engine) *Blockchain {
 	return &Blockchain{
+		params:  params,
 		blocks:  make([]*Block, 0),
+		index:   make(map[string]*blockNode),
 		store:   store,
 		utxoSet: utxoSet,
+		mempool: mempool,
+		engine:  engine,
+
+		tipChanged: make(chan struct{}),
+		invalid:    make(map[string]bool),
 	}
 }
 
+// Initialize creates the genesis block on an empty store, or loads the
+// block tree and chainstate from an existing one. An existing store must
+// hold the chain of the configured genesis block.
 func (bc *Blockchain) Initialize() error {
-	height, err := bc.store.GetHeight()
-	if err != nil || height == 0 {
+	data, err := bc.store.GetBlock(0)
+	if err != nil {
 		return bc.createGenesisBlock()
 	}
-	return bc.loadFromStore()
+	if err := bc.checkGenesis(data); err != nil {
+		return err
+	}
+	if err := bc.loadFromStore(); err != nil {
+		return err
+	}
+	if err := bc.loadFinalized(); err != nil {
+		return err
+	}
+	return bc.loadChainstate()
+}
+
+// checkGenesis makes sure the stored genesis block is the one our network
+// parameters and consensus engine produce. Otherwise the data directory
+// belongs to another chain, and we would follow it while believing we are
+// on ours.
+func (bc *Blockchain) checkGenesis(data []byte) error {
+	stored, err := DeserializeBlock(data)
+	if err != nil {
+		return fmt.Errorf("failed to deserialize genesis block: %w", err)
+	}
+	expected := NewGenesisBlock(bc.params, bc.engine)
+	if stored.Hash != expected.Hash {
+		return fmt.Errorf("data directory holds a different chain: stored genesis block is %s, configured genesis block is %s", stored.Hash, expected.Hash)
+	}
+	return nil
 }
 
 func (bc *Blockchain) createGenesisBlock() error {
-	genesis := NewGenesisBlock()
+	genesis := NewGenesisBlock(bc.params, bc.engine)
+	node := bc.newNode(genesis, nil)
 	bc.blocks = append(bc.blocks, genesis)
+	bc.index[node.hash] = node
+	bc.tip = node
 	bc.height = 0
-	
-	for _, tx := range genesis.Transactions {
-		bc.utxoSet.ApplyTransaction(tx)
-	}
-	
-	data, err := genesis.ToJSON()
+
+	medianTime := bc.medianTimeBefore(genesis)
+	undo, err := bc.utxoSet.ConnectBlock(genesis, medianTime)
 	if err != nil {
 		return err
 	}
-	return bc.store.SaveBlock(genesis.Index, genesis.Hash, data)
+
+	batch := store.NewBatch()
+	writeMainBlock(batch, genesis, undo, medianTime)
+	batch.SetHeight(0)
+	batch.SetBestBlock(genesis.Hash)
+	return bc.store.Write(batch)
 }
 
+// writeMainBlock adds a block connected to the main chain to a batch:
+// the block itself, its undo data and the chainstate changes it causes.
+func writeMainBlock(batch *store.Batch, block *Block, undo *BlockUndo, medianTime time.Time) {
+	batch.SaveBlock(block.Index, block.Hash, block.BlockHeader.Serialize(), block.Serialize(), undo.Serialize())
+	writeConnectBlock(batch, block, medianTime)
+}
+
+// AddBlock adds a block to the block tree.
+// A block extending the main chain is connected right away. A block on a
+// side chain is stored, and if its branch now has more work than the main
+// chain we reorganize onto it.
 func (bc *Blockchain) AddBlock(block *Block) error {
 	bc.mu.Lock()
 	defer bc.mu.Unlock()
-	
+
+	if _, exists := bc.index[block.Hash]; exists {
+		return fmt.Errorf("block %s already known", block.Hash)
+	}
+	if bc.invalid[block.Hash] || bc.invalid[block.PreviousHash] {
+		bc.invalid[block.Hash] = true
+		return fmt.Errorf("block %s is invalid or builds on an invalid block", block.Hash)
+	}
+	if parent := bc.index[block.PreviousHash]; parent != nil && !bc.extendsFinalized(parent) {
+		return fmt.Errorf("block %d conflicts with finalized block %d", block.Index, bc.finalized.height)
+	}
+
 	if err := bc.ValidateBlock(block); err != nil {
 		return fmt.Errorf("invalid block: %w", err)
 	}
-	
-	for _, tx := range block.Transactions {
-		if err := bc.utxoSet.ApplyTransaction(tx); err != nil {
-			return fmt.Errorf("failed to apply transaction: %w", err)
+
+	node := bc.newNode(block, bc.index[block.PreviousHash])
+	if node.parent == bc.tip {
+		return bc.connectBestBlock(node)
+	}
+
+	if err := bc.store.SaveSideBlock(block.Hash, block.BlockHeader.Serialize(), block.Serialize()); err != nil {
+		return err
+	}
+	bc.index[node.hash] = node
+
+	// Ties keep the branch we saw first
+	if node.chainWork.Cmp(bc.tip.chainWork) <= 0 {
+		log.Printf("Stored side-chain block %d (%s)", block.Index, block.Hash)
+		return nil
+	}
+	return bc.reorganize(node)
+}
+
+// ValidateHeader checks that a block header fits into the block tree,
+// without needing the block body.
+// Its parent must be known, its index must follow the parent's, its
+// consensus fields and seal must satisfy the engine, and its timestamp
+// must be after the median time past and not too far in the future.
+func (bc *Blockchain) ValidateHeader(header *types.BlockHeader) error {
+	parent := bc.index[header.PreviousHash]
+	if parent == nil {
+		return fmt.Errorf("unknown previous block %s", header.PreviousHash)
+	}
+
+	if header.Index != parent.height+1 {
+		return fmt.Errorf("invalid block index")
+	}
+
+	chain := bc.reader()
+	if err := bc.engine.VerifyHeader(chain, header); err != nil {
+		return err
+	}
+
+	if mtp := consensus.MedianTimePast(chain, &parent.block.BlockHeader); !header.Timestamp.After(mtp) {
+		return fmt.Errorf("block timestamp %s is not after median time past %s",
+			header.Timestamp.Format(time.RFC3339), mtp.Format(time.RFC3339))
+	}
+
+	if maxTime := time.Now().Add(MaxFutureBlockTime); header.Timestamp.After(maxTime) {
+		return fmt.Errorf("block timestamp %s is too far in the future", header.Timestamp.Format(time.RFC3339))
+	}
+
+	return nil
+}
+
+// ValidateBlock checks a block's header against the block tree and its
+// body against the header, including the reward its coinbase claims.
+// The coinbase may claim less than the block reward plus fees; whatever it
+// leaves out is never created.
+func (bc *Blockchain) ValidateBlock(block *Block) error {
+	if err := block.Validate(); err != nil {
+		return err
+	}
+	if err := bc.ValidateHeader(&block.BlockHeader); err != nil {
+		return err
+	}
+	for i, tx := range block.Transactions {
+		if err := bc.checkChainID(tx); err != nil {
+			return fmt.Errorf("transaction %d invalid: %w", i, err)
+		}
+		if err := checkDataOutputs(tx); err != nil {
+			return fmt.Errorf("transaction %d invalid: %w", i, err)
 		}
 	}
-	
-	bc.blocks = append(bc.blocks, block)
-	bc.height++
-	
-	data, err := block.ToJSON()
+
+	totalFees, err := block.sumFees()
 	if err != nil {
 		return err
 	}
-	return bc.store.SaveBlock(block.Index, block.Hash, data)
+	reward := bc.engine.BlockReward(bc.reader(), &block.BlockHeader)
+	if reward+totalFees < reward {
+		return fmt.Errorf("block reward overflows")
+	}
+	allowed := reward + totalFees
+	if paid := block.Transactions[0].OutputTotal(); paid > allowed {
+		return fmt.Errorf("coinbase pays %d, more than the block reward plus fees of %d", paid, allowed)
+	}
+	return nil
 }
 
-func (bc *Blockchain) ValidateBlock(block *Block) error {
-	if bc.height > 0 {
-		lastBlock := bc.blocks[len(bc.blocks)-1]
-		if block.PreviousHash != lastBlock.Hash {
-			return fmt.Errorf("previous hash mismatch")
+// newNode creates the block tree node for a block, weighted by the engine.
+func (bc *Blockchain) newNode(block *Block, parent *blockNode) *blockNode {
+	return newBlockNode(block, parent, bc.engine.Work(&block.BlockHeader))
+}
+
+// chainReader gives the consensus engine access to the block tree.
+// It doesn't lock, so it is only used while bc.mu is held.
+type chainReader struct {
+	bc *Blockchain
+}
+
+func (bc *Blockchain) reader() chainReader {
+	return chainReader{bc: bc}
+}
+
+func (r chainReader) GetHeader(hash string) *types.BlockHeader {
+	node := r.bc.index[hash]
+	if node == nil {
+		return nil
+	}
+	header := node.block.BlockHeader
+	return &header
+}
+
+// GetHeader returns the header of a block on any branch, or nil if it is unknown.
+// The blockchain can be passed to the consensus engine as its ChainReader.
+func (bc *Blockchain) GetHeader(hash string) *types.BlockHeader {
+	bc.mu.RLock()
+	defer bc.mu.RUnlock()
+	return bc.reader().GetHeader(hash)
+}
+
+// Params returns the parameters of the blockchain's network.
+func (bc *Blockchain) Params() *chaincfg.Params {
+	return bc.params
+}
+
+// TipChanged returns a channel that is closed the next time the main-chain
+// tip changes. Miners use it to abandon work on a block that became stale.
+// Take the channel before reading the tip so no change can be missed.
+func (bc *Blockchain) TipChanged() <-chan struct{} {
+	bc.mu.RLock()
+	defer bc.mu.RUnlock()
+	return bc.tipChanged
+}
+
+// notifyTipChanged wakes everyone waiting on TipChanged.
+// The caller must hold the write lock.
+func (bc *Blockchain) notifyTipChanged() {
+	close(bc.tipChanged)
+	bc.tipChanged = make(chan struct{})
+}
+
+// Stakes returns the stake locked by each address after the main-chain tip.
+// The blockchain can be passed to a Proof-of-Stake engine as its StakeReader.
+func (bc *Blockchain) Stakes() map[string]uint64 {
+	return bc.utxoSet.Stakes()
+}
+
+// verifyStake lets an engine that elects block producers by stake check a
+// block against the stakes after its parent. view must be the UTXO set
+// with the block's parent connected.
+func (bc *Blockchain) verifyStake(view *UTXOSet, block *Block) error {
+	verifier, ok := bc.engine.(consensus.StakeVerifier)
+	if !ok {
+		return nil
+	}
+	return verifier.VerifyStake(bc.reader(), &block.BlockHeader, view.Stakes())
+}
+
+// checkChainID makes sure a transaction was made for our chain. Signatures
+// commit to the chain ID, so a transaction signed for another network can't
+// be replayed here by changing it.
+func (bc *Blockchain) checkChainID(tx *types.Transaction) error {
+	if tx.ChainID != bc.params.ChainID {
+		return fmt.Errorf("transaction is for chain %d, not chain %d", tx.ChainID, bc.params.ChainID)
+	}
+	return nil
+}
+
+// Bounds on how far ahead of the next block a time locked transaction may
+// unlock for the mempool to hold it until then.
+const (
+	maxHoldBlocks = 1000
+	maxHoldTime   = 7 * 24 * time.Hour
+)
+
+// CheckTransaction validates a transaction for admission to the mempool.
+// It applies the same rules the transaction must pass inside the next
+// block, against the current main-chain UTXO set.
+// A transaction that is only held back by a time lock fails with an error
+// wrapping ErrNonFinal if it unlocks within maxHoldBlocks blocks and
+// maxHoldTime, so the mempool can hold it until then, and with another
+// error if it unlocks later.
+func (bc *Blockchain) CheckTransaction(tx *types.Transaction) error {
+	if tx.IsCoinbase() {
+		return fmt.Errorf("coinbase transactions are only valid in blocks")
+	}
+	if err := tx.Validate(); err != nil {
+		return err
+	}
+	if err := bc.checkChainID(tx); err != nil {
+		return err
+	}
+	if err := checkDataOutputs(tx); err != nil {
+		return err
+	}
+	bc.mu.RLock()
+	height := bc.height + 1
+	medianTime := consensus.MedianTimePast(bc.reader(), &bc.tip.block.BlockHeader)
+	bc.mu.RUnlock()
+
+	err := bc.utxoSet.ValidateTransaction(tx, height, medianTime)
+	if errors.Is(err, ErrNonFinal) && bc.utxoSet.ValidateTransaction(tx, height+maxHoldBlocks, medianTime.Add(maxHoldTime)) != nil {
+		return fmt.Errorf("time lock is too far in the future: %v", err)
+	}
+	return err
+}
+
+// medianTimeBefore returns the median time past of a block's parent, which
+// time locks of the block's transactions are compared with. The genesis
+// block has no parent and uses its own timestamp.
+// The caller must hold bc.mu.
+func (bc *Blockchain) medianTimeBefore(block *Block) time.Time {
+	parent := bc.reader().GetHeader(block.PreviousHash)
+	if parent == nil {
+		return block.Timestamp
+	}
+	return consensus.MedianTimePast(bc.reader(), parent)
+}
+
+// connectBestBlock connects a block that extends the current tip.
+// The block, its undo record and the chainstate changes are persisted in
+// one batch; if that fails the block is disconnected again so memory and
+// store stay consistent, and if even that fails the UTXO set is reloaded
+// from the store.
+func (bc *Blockchain) connectBestBlock(node *blockNode) error {
+	if err := bc.verifyStake(bc.utxoSet, node.block); err != nil {
+		return err
+	}
+	medianTime := bc.medianTimeBefore(node.block)
+	undo, err := bc.utxoSet.ConnectBlock(node.block, medianTime)
+	if err != nil {
+		return err
+	}
+
+	batch := store.NewBatch()
+	writeMainBlock(batch, node.block, undo, medianTime)
+	batch.SetHeight(node.height)
+	batch.SetBestBlock(node.hash)
+	if err := bc.store.Write(batch); err != nil {
+		if rollbackErr := bc.utxoSet.DisconnectBlock(node.block, undo); rollbackErr != nil {
+			// The UTXO set no longer matches the store, so reload it from there
+			bc.utxoSet.reset()
+			if reloadErr := bc.loadChainstate(); reloadErr != nil {
+				return fmt.Errorf("%v (rollback failed: %v; reloading chainstate failed: %v)", err, rollbackErr, reloadErr)
+			}
 		}
+		return err
 	}
-	
-	if block.Index != bc.height+1 {
-		return fmt.Errorf("invalid block index")
+
+	bc.index[node.hash] = node
+	bc.blocks = append(bc.blocks, node.block)
+	bc.tip = node
+	bc.height = node.height
+	bc.notifyTipChanged()
+
+	if bc.mempool != nil {
+		bc.mempool.RemoveForBlock(node.block.Transactions)
+	}
+	return nil
+}
+
+// loadUndo reads the undo record stored when a main-chain block was connected.
+func (bc *Blockchain) loadUndo(block *Block) (*BlockUndo, error) {
+	undoData, err := bc.store.GetUndo(block.Hash)
+	if err != nil {
+		return nil, fmt.Errorf("failed to load undo data for block %d: %w", block.Index, err)
+	}
+
+	undo, err := DeserializeBlockUndo(undoData)
+	if err != nil {
+		return nil, fmt.Errorf("failed to deserialize undo data for block %d: %w", block.Index, err)
+	}
+	return undo, nil
+}
+
+// reorganize switches the main chain to the branch ending at newTip.
+// Blocks of the old branch are disconnected with their undo data and the
+// blocks of the new branch are connected, all on a copy of the UTXO set.
+// The store, UTXO set and main chain are only updated once every block has
+// connected, so an invalid branch changes nothing. The store is then
+// updated in batches of bounded size, see writeReorganization.
+func (bc *Blockchain) reorganize(newTip *blockNode) error {
+	fork := findFork(bc.tip, newTip)
+	if fork == nil {
+		return fmt.Errorf("no common ancestor with block %s", newTip.hash)
+	}
+	if bc.finalized != nil && fork.height < bc.finalized.height {
+		return fmt.Errorf("reorganization to block %s would revert finalized block %d", newTip.hash, bc.finalized.height)
 	}
-	
-	return block.Validate()
+
+	var attach []*blockNode
+	for n := newTip; n != fork; n = n.parent {
+		attach = append(attach, n)
+	}
+	for i, j := 0, len(attach)-1; i < j; i, j = i+1, j-1 {
+		attach[i], attach[j] = attach[j], attach[i]
+	}
+	detach := bc.blocks[fork.height+1:]
+
+	view := bc.utxoSet.Clone()
+	var steps []reorgStep
+	for i := len(detach) - 1; i >= 0; i-- {
+		undo, err := bc.loadUndo(detach[i])
+		if err != nil {
+			return err
+		}
+		if err := view.DisconnectBlock(detach[i], undo); err != nil {
+			return fmt.Errorf("failed to disconnect block %d: %w", detach[i].Index, err)
+		}
+		steps = append(steps, reorgStep{block: detach[i], undo: undo, tip: bc.tip.ancestor(detach[i].Index - 1)})
+	}
+
+	for _, n := range attach {
+		err := bc.verifyStake(view, n.block)
+		medianTime := bc.medianTimeBefore(n.block)
+		var undo *BlockUndo
+		if err == nil {
+			undo, err = view.ConnectBlock(n.block, medianTime)
+		}
+		if err != nil {
+			return bc.invalidateBranch(n, err)
+		}
+		steps = append(steps, reorgStep{block: n.block, undo: undo, medianTime: medianTime, connect: true, tip: n})
+	}
+
+	if written, err := bc.writeReorganization(steps); err != nil {
+		if written == 0 {
+			return err
+		}
+		// The store already switched part of the way, so memory follows it
+		// to the last block written
+		reached := steps[written-1].tip
+		bc.setMainChain(reached)
+		bc.utxoSet.reset()
+		if reloadErr := bc.loadChainstate(); reloadErr != nil {
+			return fmt.Errorf("reorganization stopped at block %d (%s): %v (reloading chainstate failed: %v)", reached.height, reached.hash, err, reloadErr)
+		}
+		return fmt.Errorf("reorganization stopped at block %d (%s): %w", reached.height, reached.hash, err)
+	}
+
+	bc.utxoSet.replaceWith(view)
+	bc.setMainChain(newTip)
+
+	if bc.mempool != nil {
+		for _, n := range attach {
+			bc.mempool.RemoveForBlock(n.block.Transactions)
+		}
+		// Transactions only confirmed on the old branch go back to the mempool
+		medianTime := consensus.MedianTimePast(bc.reader(), &newTip.block.BlockHeader)
+		for _, block := range detach {
+			for _, tx := range block.Transactions {
+				if tx.IsCoinbase() {
+					continue
+				}
+				// The new branch may be too short for a time lock the old one passed
+				switch err := view.ValidateTransaction(tx, newTip.height+1, medianTime); {
+				case err == nil:
+					bc.mempool.AddTransaction(tx)
+				case errors.Is(err, ErrNonFinal):
+					bc.mempool.HoldTransaction(tx)
+				}
+			}
+		}
+	}
+
+	log.Printf("Chain reorganization: fork at %d, disconnected %d blocks, connected %d blocks, new tip %d (%s)",
+		fork.height, len(detach), len(attach), newTip.height, newTip.hash)
+	return nil
+}
+
+// reorgBatchOps and reorgBatchSize bound each batch written by
+// writeReorganization. They are variables so tests can make batches small.
+var (
+	reorgBatchOps  = store.MaxBatchOps
+	reorgBatchSize = store.MaxBatchSize
+)
+
+// reorgStep is a block disconnected from or connected to the main chain
+// during a reorganization, and the main-chain tip once it is.
+type reorgStep struct {
+	block      *Block
+	undo       *BlockUndo
+	medianTime time.Time
+	connect    bool
+	tip        *blockNode
+}
+
+// writeReorganization persists the steps of a reorganization. A deep
+// reorganization may be too large for one batch, so steps are written in
+// batches of at most reorgBatchOps operations and reorgBatchSize bytes,
+// each recording the tip its last step reached. The store is a valid chain
+// after every batch, and a node stopped halfway continues from there.
+// It returns how many steps were written.
+func (bc *Blockchain) writeReorganization(steps []reorgStep) (int, error) {
+	written := 0
+	batch := store.NewBatch()
+	for i, step := range steps {
+		if step.connect {
+			writeMainBlock(batch, step.block, step.undo, step.medianTime)
+		} else if err := writeDisconnectBlock(batch, step.block, step.undo); err != nil {
+			return written, err
+		}
+		if i < len(steps)-1 && batch.Len() < reorgBatchOps && batch.Size() < reorgBatchSize {
+			continue
+		}
+
+		batch.SetHeight(step.tip.height)
+		batch.SetBestBlock(step.tip.hash)
+		if err := bc.store.Write(batch); err != nil {
+			return written, err
+		}
+		written = i + 1
+		batch = store.NewBatch()
+	}
+	return written, nil
+}
+
+// setMainChain makes the branch ending at tip the main chain.
+// The UTXO set must already match it.
+func (bc *Blockchain) setMainChain(tip *blockNode) {
+	var branch []*Block
+	n := tip
+	for ; n.height >= uint64(len(bc.blocks)) || bc.blocks[n.height].Hash != n.hash; n = n.parent {
+		branch = append(branch, n.block)
+	}
+	mainChain := bc.blocks[:n.height+1 : n.height+1]
+	for i := len(branch) - 1; i >= 0; i-- {
+		mainChain = append(mainChain, branch[i])
+	}
+	bc.blocks = mainChain
+	bc.tip = tip
+	bc.height = tip.height
+	bc.notifyTipChanged()
+}
+
+// invalidateBranch handles a block that failed to connect during a
+// reorganization. The block and every block built on it, on any branch,
+// are removed from the block tree. They stay in the store, marked so they
+// aren't loaded again.
+func (bc *Blockchain) invalidateBranch(bad *blockNode, err error) error {
+	invalid := store.NewBatch()
+	for hash, n := range bc.index {
+		if n.ancestor(bad.height) == bad {
+			delete(bc.index, hash)
+			bc.invalid[hash] = true
+			invalid.MarkInvalid(hash)
+		}
+	}
+	if writeErr := bc.store.Write(invalid); writeErr != nil {
+		return fmt.Errorf("reorganization failed at block %d (%s): %v (marking the branch invalid failed: %v)", bad.height, bad.hash, err, writeErr)
+	}
+	return fmt.Errorf("reorganization failed at block %d (%s): %w", bad.height, bad.hash, err)
+}
+
+// extendsFinalized reports whether a node's branch contains the finalized
+// checkpoint, so blocks may be built on it.
+func (bc *Blockchain) extendsFinalized(node *blockNode) bool {
+	return bc.finalized == nil || node.ancestor(bc.finalized.height) == bc.finalized
+}
+
+// Finalize marks a block as final. Blocks on branches that don't contain it
+// are rejected from then on, so it can never be reorganized away. If the
+// block isn't on the main chain, we first reorganize onto the branch with
+// the most work that contains it.
+// Finalizing a block at or below the current checkpoint on the same branch
+// does nothing.
+func (bc *Blockchain) Finalize(hash string) error {
+	bc.mu.Lock()
+	defer bc.mu.Unlock()
+
+	node := bc.index[hash]
+	if node == nil {
+		return fmt.Errorf("unknown block %s", hash)
+	}
+	if bc.finalized != nil && node.height <= bc.finalized.height {
+		if bc.finalized.ancestor(node.height) == node {
+			return nil
+		}
+		return fmt.Errorf("block %d conflicts with finalized block %d", node.height, bc.finalized.height)
+	}
+	if !bc.extendsFinalized(node) {
+		return fmt.Errorf("block %d conflicts with finalized block %d", node.height, bc.finalized.height)
+	}
+
+	if bc.tip.ancestor(node.height) != node {
+		best := node
+		for _, n := range bc.index {
+			if n.chainWork.Cmp(best.chainWork) > 0 && n.ancestor(node.height) == node {
+				best = n
+			}
+		}
+		if err := bc.reorganize(best); err != nil {
+			return err
+		}
+	}
+
+	batch := store.NewBatch()
+	batch.SetFinalized(hash)
+	if err := bc.store.Write(batch); err != nil {
+		return err
+	}
+	bc.finalized = node
+
+	log.Printf("Finalized block %d (%s)", node.height, node.hash)
+	return nil
+}
+
+// GetFinalized returns the highest finalized block, or nil if no block has
+// been finalized yet.
+func (bc *Blockchain) GetFinalized() *Block {
+	bc.mu.RLock()
+	defer bc.mu.RUnlock()
+	if bc.finalized == nil {
+		return nil
+	}
+	return bc.finalized.block
+}
+
+// IsFinalized reports whether the block with the given hash is final: it is
+// the finalized checkpoint or one of its ancestors.
+func (bc *Blockchain) IsFinalized(hash string) bool {
+	bc.mu.RLock()
+	defer bc.mu.RUnlock()
+	node := bc.index[hash]
+	return node != nil && bc.finalized != nil && bc.finalized.ancestor(node.height) == node
 }
 
 func (bc *Blockchain) GetHeight() uint64 {
@@ -109,57 +696,166 @@ func (bc *Blockchain) GetBlock(index uint64) *Block {
 	return bc.blocks[index]
 }
 
+// GetBlockByHash returns a known block by hash, on the main chain or a side chain.
 func (bc *Blockchain) GetBlockByHash(hash string) *Block {
 	bc.mu.RLock()
 	defer bc.mu.RUnlock()
-	for _, block := range bc.blocks {
-		if block.Hash == hash {
-			return block
-		}
+	if node := bc.index[hash]; node != nil {
+		return node.block
 	}
 	return nil
 }
 
+// IsMainChain reports whether the block with the given hash is on the main chain.
+func (bc *Blockchain) IsMainChain(hash string) bool {
+	bc.mu.RLock()
+	defer bc.mu.RUnlock()
+	node := bc.index[hash]
+	return node != nil && node.height < uint64(len(bc.blocks)) && bc.blocks[node.height].Hash == hash
+}
+
 func (bc *Blockchain) GetBlocks(start, limit uint64) []*Block {
 	bc.mu.RLock()
 	defer bc.mu.RUnlock()
-	
+
 	end := start + limit
 	if end > uint64(len(bc.blocks)) {
 		end = uint64(len(bc.blocks))
 	}
-	
+
 	return bc.blocks[start:end]
 }
 
+// GetHeaders returns the headers of up to limit main-chain blocks from start.
+// This serves light clients and headers-first sync without copying block bodies.
+func (bc *Blockchain) GetHeaders(start, limit uint64) []*types.BlockHeader {
+	bc.mu.RLock()
+	defer bc.mu.RUnlock()
+
+	if start >= uint64(len(bc.blocks)) {
+		return nil
+	}
+	end := start + limit
+	if end > uint64(len(bc.blocks)) {
+		end = uint64(len(bc.blocks))
+	}
+
+	headers := make([]*types.BlockHeader, 0, end-start)
+	for _, block := range bc.blocks[start:end] {
+		header := block.BlockHeader
+		headers = append(headers, &header)
+	}
+	return headers
+}
+
 func (bc *Blockchain) loadFromStore() error {
 	bc.mu.Lock()
 	defer bc.mu.Unlock()
-	
+
 	height, err := bc.store.GetHeight()
 	if err != nil {
 		return err
 	}
-	
+
+	var parent *blockNode
 	for i := uint64(0); i <= height; i++ {
 		data, err := bc.store.GetBlock(i)
 		if err != nil {
 			return fmt.Errorf("failed to load block %d: %w", i, err)
 		}
-		
-		block, err := BlockFromJSON(data)
+
+		block, err := DeserializeBlock(data)
 		if err != nil {
 			return fmt.Errorf("failed to deserialize block %d: %w", i, err)
 		}
-		
+
+		node := bc.newNode(block, parent)
+		bc.index[node.hash] = node
 		bc.blocks = append(bc.blocks, block)
-		
-		// Apply transactions to UTXO set
-		for _, tx := range block.Transactions {
-			bc.utxoSet.ApplyTransaction(tx)
-		}
+		parent = node
 	}
-	
+
+	bc.tip = parent
 	bc.height = height
+
+	return bc.loadSideBlocks()
+}
+
+// loadFinalized restores the finalized checkpoint.
+// Reorganizations below it are refused, so it is always on the main chain.
+func (bc *Blockchain) loadFinalized() error {
+	hash, err := bc.store.GetFinalized()
+	if err != nil {
+		return err
+	}
+	if hash == "" {
+		return nil
+	}
+
+	node := bc.index[hash]
+	if node == nil || bc.tip.ancestor(node.height) != node {
+		return fmt.Errorf("finalized block %s is not on the main chain", hash)
+	}
+	bc.finalized = node
 	return nil
-}
\ No newline at end of file
+}
+
+// loadSideBlocks restores side-chain blocks into the block tree.
+// Blocks are attached in height order so parents are always known first;
+// blocks marked invalid, and blocks whose branch no longer connects to the
+// tree, are skipped.
+// Only headers are scanned to find them; block bodies are read for the
+// side-chain blocks that attach.
+func (bc *Blockchain) loadSideBlocks() error {
+	err := bc.store.ForEachInvalidBlock(func(hash string) error {
+		bc.invalid[hash] = true
+		return nil
+	})
+	if err != nil {
+		return fmt.Errorf("failed to load invalid blocks: %w", err)
+	}
+
+	var sideHeaders []*types.BlockHeader
+	err = bc.store.ForEachHeader(func(data []byte) error {
+		header, err := types.DeserializeBlockHeader(data)
+		if err != nil {
+			return err
+		}
+		if _, exists := bc.index[header.ComputeHash()]; !exists {
+			sideHeaders = append(sideHeaders, header)
+		}
+		return nil
+	})
+	if err != nil {
+		return fmt.Errorf("failed to load side-chain headers: %w", err)
+	}
+
+	sort.Slice(sideHeaders, func(i, j int) bool {
+		return sideHeaders[i].Index < sideHeaders[j].Index
+	})
+
+	for _, header := range sideHeaders {
+		hash := header.ComputeHash()
+		if bc.invalid[hash] || bc.invalid[header.PreviousHash] {
+			bc.invalid[hash] = true
+			continue
+		}
+		parent := bc.index[header.PreviousHash]
+		if parent == nil || header.Index != parent.height+1 {
+			continue
+		}
+
+		data, err := bc.store.GetBlockByHash(hash)
+		if err != nil {
+			return fmt.Errorf("failed to load side-chain block %d: %w", header.Index, err)
+		}
+		block, err := DeserializeBlock(data)
+		if err != nil {
+			return fmt.Errorf("failed to deserialize side-chain block %d: %w", header.Index, err)
+		}
+
+		node := bc.newNode(block, parent)
+		bc.index[node.hash] = node
+	}
+	return nil
+}
@@ -0,0 +1,504 @@
+package core
+
+import (
+	"context"
+	"errors"
+	"reflect"
+	"strings"
+	"testing"
+
+	"github.com/OhMyDitzzy/vulcan/chaincfg"
+	"github.com/OhMyDitzzy/vulcan/consensus"
+	"github.com/OhMyDitzzy/vulcan/store"
+	"github.com/OhMyDitzzy/vulcan/types"
+	"github.com/OhMyDitzzy/vulcan/wallet"
+)
+
+// testNode is a blockchain on a Badger store in a temporary directory,
+// on regtest with the genesis allocation paid to a key we hold.
+type testNode struct {
+	t      *testing.T
+	dir    string
+	params *chaincfg.Params
+	engine consensus.Engine
+	store  *store.BadgerStore
+	bc     *Blockchain
+	wallet *wallet.Wallet
+	mined  map[string]*types.BlockHeader // Blocks built by mine, added or not
+}
+
+// GetHeader looks blocks up in the chain, then among the blocks we built,
+// so blocks can be built on branches the chain hasn't seen yet.
+func (n *testNode) GetHeader(hash string) *types.BlockHeader {
+	if header := n.bc.GetHeader(hash); header != nil {
+		return header
+	}
+	return n.mined[hash]
+}
+
+func newTestNode(t *testing.T) *testNode {
+	t.Helper()
+	w := newWallet(t)
+
+	params := chaincfg.RegTestParams
+	params.GenesisAlloc = []chaincfg.Allocation{{Address: w.Address, Amount: 1000}}
+	params.Emission.GenesisAllocation = 1000
+	return startTestNode(t, &params, consensus.NewProofOfWork(&params, 1), w)
+}
+
+func startTestNode(t *testing.T, params *chaincfg.Params, engine consensus.Engine, w *wallet.Wallet) *testNode {
+	t.Helper()
+	n := &testNode{
+		t:      t,
+		dir:    t.TempDir(),
+		params: params,
+		engine: engine,
+		wallet: w,
+		mined:  make(map[string]*types.BlockHeader),
+	}
+	n.open()
+	t.Cleanup(func() { n.store.Close() })
+	return n
+}
+
+// peer returns another node on the same chain, with its own store.
+func (n *testNode) peer() *testNode {
+	return startTestNode(n.t, n.params, n.engine, n.wallet)
+}
+
+// open loads the blockchain from the node's store, as a node starting up.
+func (n *testNode) open() {
+	n.t.Helper()
+	db, err := store.NewBadgerStore(n.dir)
+	if err != nil {
+		n.t.Fatal(err)
+	}
+	n.store = db
+	n.bc = NewBlockchain(n.params, db, NewUTXOSet(n.params.CoinbaseMaturity), nil, n.engine)
+	if err := n.bc.Initialize(); err != nil {
+		n.t.Fatalf("Initialize failed: %v", err)
+	}
+}
+
+// restart closes the store and loads the blockchain from it again.
+func (n *testNode) restart() {
+	n.t.Helper()
+	if err := n.store.Close(); err != nil {
+		n.t.Fatal(err)
+	}
+	n.open()
+}
+
+// genesis returns the genesis block.
+func (n *testNode) genesis() *Block {
+	return n.bc.GetBlock(0)
+}
+
+// mine builds a sealed block on parent with the given transactions and a
+// coinbase paying the block reward and fees to miner. It doesn't add it.
+func (n *testNode) mine(parent *Block, miner string, txs ...*types.Transaction) *Block {
+	n.t.Helper()
+	block := NewBlock(parent.Index+1, nil, parent.Hash)
+	block.Timestamp = parent.Timestamp.Add(n.params.TargetBlockTime)
+	if err := n.engine.Prepare(n, &block.BlockHeader); err != nil {
+		n.t.Fatal(err)
+	}
+
+	var fees uint64
+	for _, tx := range txs {
+		fees += tx.Fee
+	}
+	coinbase := types.NewCoinbaseTransaction(n.params.ChainID, miner, n.engine.BlockReward(n, &block.BlockHeader)+fees)
+	block.Transactions = append([]*types.Transaction{coinbase}, txs...)
+	block.MerkleRoot = block.ComputeMerkleRoot()
+
+	if err := n.engine.Seal(context.Background(), n, &block.BlockHeader); err != nil {
+		n.t.Fatal(err)
+	}
+	block.SetHash()
+	n.mined[block.Hash] = &block.BlockHeader
+	return block
+}
+
+// add adds blocks, failing the test if any is rejected.
+func (n *testNode) add(blocks ...*Block) {
+	n.t.Helper()
+	for _, block := range blocks {
+		if err := n.bc.AddBlock(block); err != nil {
+			n.t.Fatalf("AddBlock(%d) failed: %v", block.Index, err)
+		}
+	}
+}
+
+// branch mines count empty blocks on parent, paying miner.
+func (n *testNode) branch(parent *Block, miner string, count int) []*Block {
+	n.t.Helper()
+	blocks := make([]*Block, count)
+	for i := range blocks {
+		blocks[i] = n.mine(parent, miner)
+		parent = blocks[i]
+	}
+	return blocks
+}
+
+// pay returns a transaction signed by the node's wallet, spending the
+// genesis allocation to pay amount to to.
+func (n *testNode) pay(to string, amount, fee uint64) *types.Transaction {
+	n.t.Helper()
+	coinbase := n.genesis().Transactions[0]
+	coins := []wallet.Coin{{OutPoint: types.OutPoint{TxID: coinbase.ID}, Amount: coinbase.Outputs[0].Amount}}
+	tx, err := n.wallet.CreateAndSignTransaction(n.params.ChainID, coins, to, amount, fee)
+	if err != nil {
+		n.t.Fatal(err)
+	}
+	return tx
+}
+
+// utxos returns a copy of the contents of the live UTXO set.
+func (n *testNode) utxos() map[string]map[uint32]UTXO {
+	set := n.bc.utxoSet
+	set.mu.RLock()
+	defer set.mu.RUnlock()
+
+	utxos := make(map[string]map[uint32]UTXO)
+	for txID, outputs := range set.utxos {
+		utxos[txID] = make(map[uint32]UTXO)
+		for index, utxo := range outputs {
+			utxos[txID][index] = *utxo
+		}
+	}
+	return utxos
+}
+
+func newWallet(t *testing.T) *wallet.Wallet {
+	t.Helper()
+	w, err := wallet.NewWallet()
+	if err != nil {
+		t.Fatal(err)
+	}
+	return w
+}
+
+func newAddress(t *testing.T) string {
+	t.Helper()
+	return newWallet(t).Address
+}
+
+func TestReorganize(t *testing.T) {
+	n := newTestNode(t)
+	genesis := n.genesis()
+	alice, bob := newAddress(t), newAddress(t)
+
+	// Compare against a node that only ever saw the winning branch
+	reference := n.peer()
+
+	payment := n.pay(bob, 300, 10)
+	a1 := n.mine(genesis, alice, payment)
+	a2 := n.mine(a1, alice)
+	n.add(a1, a2)
+	if n.bc.GetHeight() != 2 {
+		t.Fatalf("height is %d, want 2", n.bc.GetHeight())
+	}
+
+	b := n.branch(genesis, bob, 3)
+	n.add(b[0], b[1])
+	if n.bc.GetLatestBlock().Hash != a2.Hash {
+		t.Fatal("a branch with equal work replaced the main chain")
+	}
+	n.add(b[2])
+	if n.bc.GetLatestBlock().Hash != b[2].Hash {
+		t.Fatal("the branch with more work didn't become the main chain")
+	}
+	if n.bc.IsMainChain(a1.Hash) {
+		t.Fatal("a disconnected block is still on the main chain")
+	}
+	if n.bc.utxoSet.GetUTXO(payment.ID, 0) != nil {
+		t.Fatal("an output created on the old branch is still unspent")
+	}
+	if n.bc.utxoSet.GetUTXO(genesis.Transactions[0].ID, 0) == nil {
+		t.Fatal("an output spent on the old branch wasn't restored")
+	}
+
+	reference.add(b...)
+	if !reflect.DeepEqual(n.utxos(), reference.utxos()) {
+		t.Fatal("UTXO set after the reorganization differs from the branch's own")
+	}
+
+	// The chainstate written with the reorganization matches memory
+	want := n.utxos()
+	n.restart()
+	if n.bc.GetLatestBlock().Hash != b[2].Hash {
+		t.Fatal("restart lost the reorganization")
+	}
+	if !reflect.DeepEqual(n.utxos(), want) {
+		t.Fatal("stored chainstate differs from the UTXO set in memory")
+	}
+
+	// Side-chain blocks survive the restart, so the old branch can still win
+	a3 := n.mine(a2, alice)
+	a4 := n.mine(a3, alice)
+	n.add(a3, a4)
+	if n.bc.GetLatestBlock().Hash != a4.Hash {
+		t.Fatal("reorganizing back to the first branch failed")
+	}
+	if utxo := n.bc.utxoSet.GetUTXO(payment.ID, 0); utxo == nil || utxo.Amount != 300 {
+		t.Fatal("the payment on the first branch wasn't reconnected")
+	}
+	for _, block := range b {
+		if n.bc.utxoSet.GetUTXO(block.Transactions[0].ID, 0) != nil {
+			t.Fatal("a coinbase of the disconnected branch is still unspent")
+		}
+	}
+}
+
+func TestInvalidBranchIsMarked(t *testing.T) {
+	n := newTestNode(t)
+	genesis := n.genesis()
+	alice, bob := newAddress(t), newAddress(t)
+
+	main := n.branch(genesis, alice, 3)
+	n.add(main...)
+	want := n.utxos()
+
+	// The payment is valid on its own, but b2 spends it again
+	payment := n.pay(bob, 300, 10)
+	doubleSpend := n.pay(alice, 200, 10)
+	b1 := n.mine(genesis, bob, payment)
+	b2 := n.mine(b1, bob, doubleSpend)
+	b3 := n.mine(b2, bob)
+	c3 := n.mine(b2, alice)
+	n.add(b1, b2, b3, c3)
+
+	b4 := n.mine(b3, bob)
+	err := n.bc.AddBlock(b4)
+	if err == nil || !strings.Contains(err.Error(), "reorganization failed") {
+		t.Fatalf("got %v, want a failed reorganization", err)
+	}
+	if n.bc.GetLatestBlock().Hash != main[2].Hash {
+		t.Fatal("a failed reorganization moved the tip")
+	}
+	if !reflect.DeepEqual(n.utxos(), want) {
+		t.Fatal("a failed reorganization changed the UTXO set")
+	}
+
+	// A sibling branch built on the invalid block is invalid too
+	if n.bc.GetBlockByHash(c3.Hash) != nil {
+		t.Fatal("a block building on an invalid block is still in the block tree")
+	}
+	c4 := n.mine(c3, alice)
+	if err := n.bc.AddBlock(c4); err == nil || !strings.Contains(err.Error(), "invalid") {
+		t.Fatalf("got %v, want a block on the sibling branch rejected", err)
+	}
+
+	// The invalid blocks stay invalid across a restart, and so do their
+	// children; the valid part of the branch is kept
+	n.restart()
+	if n.bc.GetBlockByHash(b1.Hash) == nil {
+		t.Fatal("the valid side-chain block wasn't reloaded")
+	}
+	for _, block := range []*Block{b2, b3, b4, c3} {
+		if n.bc.GetBlockByHash(block.Hash) != nil {
+			t.Fatalf("invalid block %d was reloaded", block.Index)
+		}
+	}
+	b5 := n.mine(b4, bob)
+	if err := n.bc.AddBlock(b5); err == nil || !strings.Contains(err.Error(), "invalid") {
+		t.Fatalf("got %v, want a block building on an invalid block rejected", err)
+	}
+	if !reflect.DeepEqual(n.utxos(), want) {
+		t.Fatal("UTXO set changed across the restart")
+	}
+}
+
+// failingStore fails every write after the first writes.
+type failingStore struct {
+	store.Store
+	writes int
+}
+
+func (s *failingStore) Write(batch *store.Batch) error {
+	if s.writes == 0 {
+		return errors.New("disk full")
+	}
+	s.writes--
+	return s.Store.Write(batch)
+}
+
+func TestReorganizeInBatches(t *testing.T) {
+	// Write every disconnected and connected block in a batch of its own
+	ops := reorgBatchOps
+	reorgBatchOps = 1
+	t.Cleanup(func() { reorgBatchOps = ops })
+
+	n := newTestNode(t)
+	genesis := n.genesis()
+	alice, bob := newAddress(t), newAddress(t)
+	reference := n.peer()
+
+	a1 := n.mine(genesis, alice, n.pay(bob, 300, 10))
+	a2 := n.mine(a1, alice)
+	n.add(a1, a2)
+	b := n.branch(genesis, bob, 4)
+	n.add(b[0], b[1])
+
+	// Disconnecting a2 and a1 and connecting b1 are written, then the
+	// store fails: the chain stays at b1, as the store does
+	n.bc.store = &failingStore{Store: n.store, writes: 3}
+	err := n.bc.AddBlock(b[2])
+	if err == nil || !strings.Contains(err.Error(), "stopped at block 1") {
+		t.Fatalf("got %v, want the reorganization stopped at block 1", err)
+	}
+	if n.bc.GetLatestBlock().Hash != b[0].Hash || n.bc.IsMainChain(a1.Hash) {
+		t.Fatal("the main chain isn't the one written")
+	}
+	reference.add(b[0])
+	if !reflect.DeepEqual(n.utxos(), reference.utxos()) {
+		t.Fatal("UTXO set differs from the chain written")
+	}
+	n.restart()
+	if n.bc.GetLatestBlock().Hash != b[0].Hash || !reflect.DeepEqual(n.utxos(), reference.utxos()) {
+		t.Fatal("the stored chain differs from the one in memory")
+	}
+
+	// The rest of the branch connects once the store works again
+	n.add(b[3])
+	if n.bc.GetLatestBlock().Hash != b[3].Hash {
+		t.Fatal("the branch with more work didn't become the main chain")
+	}
+	reference.add(b[1:]...)
+	if !reflect.DeepEqual(n.utxos(), reference.utxos()) {
+		t.Fatal("UTXO set after the reorganization differs from the branch's own")
+	}
+	want := n.utxos()
+	n.restart()
+	if n.bc.GetLatestBlock().Hash != b[3].Hash || !reflect.DeepEqual(n.utxos(), want) {
+		t.Fatal("restart lost the reorganization")
+	}
+}
+
+func TestCoinbaseRewardIsCapped(t *testing.T) {
+	w := newWallet(t)
+	params := chaincfg.RegTestParams
+	params.GenesisAlloc = []chaincfg.Allocation{{Address: w.Address, Amount: 1000}}
+
+	// The subsidy halves every block, and the cap leaves 5 for block 3
+	params.Emission = chaincfg.Emission{GenesisAllocation: 1000, InitialSubsidy: 50, HalvingInterval: 1, MaxSupply: 1080}
+	n := startTestNode(t, &params, consensus.NewProofOfWork(&params, 1), w)
+	miner := newAddress(t)
+
+	// overpay returns block with its coinbase claiming one coin more
+	overpay := func(block *Block) *Block {
+		claimed := block.Transactions[0].OutputTotal()
+		block.Transactions[0] = types.NewCoinbaseTransaction(params.ChainID, miner, claimed+1)
+		block.MerkleRoot = block.ComputeMerkleRoot()
+		if err := n.engine.Seal(context.Background(), n, &block.BlockHeader); err != nil {
+			t.Fatal(err)
+		}
+		block.SetHash()
+		return block
+	}
+
+	tip := n.genesis()
+	for _, want := range []uint64{50, 25, 5, 0} {
+		block := n.mine(tip, miner)
+		if claimed := block.Transactions[0].OutputTotal(); claimed != want {
+			t.Fatalf("block %d claims %d, want %d", block.Index, claimed, want)
+		}
+		if err := n.bc.AddBlock(overpay(n.mine(tip, miner))); err == nil || !strings.Contains(err.Error(), "more than the block reward") {
+			t.Fatalf("got %v, want block %d claiming more than its reward rejected", err, block.Index)
+		}
+		n.add(block)
+		tip = block
+	}
+
+	if supply := n.bc.utxoSet.Supply(); supply != params.Emission.MaxSupply {
+		t.Fatalf("supply is %d, want the cap of %d", supply, params.Emission.MaxSupply)
+	}
+}
+
+func TestTransactionsOfOtherChainsAreRejected(t *testing.T) {
+	n := newTestNode(t)
+	genesis := n.genesis()
+	alice, bob := newAddress(t), newAddress(t)
+
+	coinbase := genesis.Transactions[0]
+	coins := []wallet.Coin{{OutPoint: types.OutPoint{TxID: coinbase.ID}, Amount: coinbase.Outputs[0].Amount}}
+	other, err := n.wallet.CreateAndSignTransaction(n.params.ChainID+1, coins, bob, 300, 10)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// Changing the chain ID of a transaction signed for another chain
+	// invalidates its signatures
+	replayed := *other
+	replayed.Inputs = append([]types.TxInput(nil), other.Inputs...)
+	replayed.ChainID = n.params.ChainID
+	replayed.ID = replayed.Hash()
+
+	tests := map[string]struct {
+		tx   *types.Transaction
+		want string
+	}{
+		"signed for another chain": {other, "is for chain"},
+		"replayed on this chain":   {&replayed, "invalid signature"},
+	}
+	for name, tt := range tests {
+		t.Run(name, func(t *testing.T) {
+			if err := n.bc.CheckTransaction(tt.tx); err == nil || !strings.Contains(err.Error(), tt.want) {
+				t.Fatalf("CheckTransaction: got %v, want an error containing %q", err, tt.want)
+			}
+			if err := n.bc.AddBlock(n.mine(genesis, alice, tt.tx)); err == nil || !strings.Contains(err.Error(), tt.want) {
+				t.Fatalf("AddBlock: got %v, want an error containing %q", err, tt.want)
+			}
+		})
+	}
+
+	// A coinbase for another chain is rejected too
+	block := n.mine(genesis, alice)
+	block.Transactions[0] = types.NewCoinbaseTransaction(n.params.ChainID+1, alice, block.Transactions[0].OutputTotal())
+	block.MerkleRoot = block.ComputeMerkleRoot()
+	if err := n.engine.Seal(context.Background(), n, &block.BlockHeader); err != nil {
+		t.Fatal(err)
+	}
+	block.SetHash()
+	if err := n.bc.ValidateBlock(block); err == nil || !strings.Contains(err.Error(), "is for chain") {
+		t.Fatalf("got %v, want a coinbase for another chain rejected", err)
+	}
+
+	if n.bc.GetHeight() != 0 || n.bc.utxoSet.GetUTXO(coinbase.ID, 0) == nil {
+		t.Fatal("a rejected transaction changed the chain")
+	}
+}
+
+func TestInitializeRejectsAnotherChain(t *testing.T) {
+	n := newTestNode(t)
+	n.add(n.branch(n.genesis(), newAddress(t), 2)...)
+
+	// The same network started from a genesis specification
+	spec := &chaincfg.Genesis{
+		Timestamp: n.params.GenesisTimestamp,
+		ChainID:   n.params.ChainID,
+		ExtraData: "another chain",
+		Alloc:     n.params.GenesisAlloc,
+	}
+	params, err := spec.Apply(n.params)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if err := n.store.Close(); err != nil {
+		t.Fatal(err)
+	}
+	db, err := store.NewBadgerStore(n.dir)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer db.Close()
+	bc := NewBlockchain(params, db, NewUTXOSet(params.CoinbaseMaturity), nil, consensus.NewProofOfWork(params, 1))
+	if err := bc.Initialize(); err == nil || !strings.Contains(err.Error(), "different chain") {
+		t.Fatalf("got %v, want a data directory of another chain refused", err)
+	}
+	if data, err := db.GetBlock(2); err != nil || data == nil {
+		t.Fatal("refusing the data directory changed it")
+	}
+}
@@ -0,0 +1,64 @@
+package core
+
+import "math/big"
+
+// blockNode is an entry in the block tree.
+// Every known block, whether it is on the main chain or a side chain, has a
+// node linking it to its parent. We keep the cumulative work of the branch
+// ending at each node so fork choice is a single comparison.
+type blockNode struct {
+	block     *Block
+	hash      string
+	parent    *blockNode
+	height    uint64
+	chainWork *big.Int // Total work from genesis up to and including this block
+}
+
+// newBlockNode creates the node for a block that adds work to its parent's branch.
+func newBlockNode(block *Block, parent *blockNode, work *big.Int) *blockNode {
+	chainWork := new(big.Int).Set(work)
+	if parent != nil {
+		chainWork.Add(chainWork, parent.chainWork)
+	}
+
+	return &blockNode{
+		block:     block,
+		hash:      block.Hash,
+		parent:    parent,
+		height:    block.Index,
+		chainWork: chainWork,
+	}
+}
+
+// ancestor returns the node's ancestor at the given height, or nil if the
+// height is above the node.
+func (node *blockNode) ancestor(height uint64) *blockNode {
+	if height > node.height {
+		return nil
+	}
+	n := node
+	for n != nil && n.height > height {
+		n = n.parent
+	}
+	return n
+}
+
+// findFork returns the last common ancestor of two nodes.
+// Walk the higher node back until both are at the same height, then walk
+// both back together until they meet.
+func findFork(a, b *blockNode) *blockNode {
+	for a != nil && b != nil && a.height > b.height {
+		a = a.parent
+	}
+	for a != nil && b != nil && b.height > a.height {
+		b = b.parent
+	}
+	for a != nil && b != nil && a != b {
+		a = a.parent
+		b = b.parent
+	}
+	if a != b {
+		return nil
+	}
+	return a
+}
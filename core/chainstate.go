@@ -0,0 +1,132 @@
+package core
+
+import (
+	"fmt"
+	"log"
+	"time"
+
+	"github.com/OhMyDitzzy/vulcan/store"
+)
+
+// The chainstate is the UTXO set persisted in the store, keyed by outpoint,
+// together with the anchor index of data outputs.
+// It is updated in the same batch as the blocks that change it, and a best
+// block marker records which block it corresponds to, so startup only needs
+// to load it instead of replaying the whole chain.
+
+// writeConnectBlock adds the UTXO changes of connecting a block to a batch.
+// Operations are written in transaction order, so an output created and
+// spent within the same block ends up deleted. medianTime is the median
+// time past of the block's parent.
+func writeConnectBlock(batch *store.Batch, block *Block, medianTime time.Time) {
+	for _, tx := range block.Transactions {
+		if !tx.IsCoinbase() {
+			for _, in := range tx.Inputs {
+				batch.DeleteUTXO(in.PrevOut.TxID, in.PrevOut.Index)
+			}
+		}
+
+		for i := range tx.Outputs {
+			if tx.Outputs[i].IsData() {
+				writeConnectAnchor(batch, block, tx, i)
+				continue
+			}
+			batch.PutUTXO(tx.ID, uint32(i), outputUTXO(tx, i, block.Index, medianTime).Serialize())
+		}
+	}
+}
+
+// writeDisconnectBlock adds the UTXO changes of disconnecting a block to a batch.
+// This mirrors UTXOSet.DisconnectBlock: transactions are reverted last to
+// first, deleting their outputs and restoring the outputs they spent.
+func writeDisconnectBlock(batch *store.Batch, block *Block, undo *BlockUndo) error {
+	spent := undo.Spent
+	for i := len(block.Transactions) - 1; i >= 0; i-- {
+		tx := block.Transactions[i]
+		for j := range tx.Outputs {
+			if tx.Outputs[j].IsData() {
+				writeDisconnectAnchor(batch, block, tx, j)
+				continue
+			}
+			batch.DeleteUTXO(tx.ID, uint32(j))
+		}
+
+		if tx.IsCoinbase() {
+			continue
+		}
+		if len(spent) < len(tx.Inputs) {
+			return fmt.Errorf("undo data is missing spent outputs for transaction %s", tx.ID)
+		}
+		for _, utxo := range spent[len(spent)-len(tx.Inputs):] {
+			batch.PutUTXO(utxo.TxID, utxo.Index, utxo.Serialize())
+		}
+		spent = spent[:len(spent)-len(tx.Inputs)]
+	}
+	return nil
+}
+
+// loadChainstate loads the stored UTXO set and brings it up to the main-chain tip.
+// If the best block marker is behind the tip, for example because the node
+// stopped between writing blocks and chainstate in an older version, the
+// missing blocks are replayed. If it isn't on the main chain at all, the
+// chainstate is rebuilt from genesis.
+func (bc *Blockchain) loadChainstate() error {
+	best, err := bc.store.GetBestBlock()
+	if err != nil {
+		return fmt.Errorf("failed to read chainstate best block: %w", err)
+	}
+
+	node := bc.index[best]
+	if node == nil || node.height > bc.height || bc.blocks[node.height].Hash != best {
+		if best != "" {
+			log.Printf("Chainstate best block %s is not on the main chain, rebuilding", best)
+		} else {
+			log.Println("No chainstate found, building it from the block store")
+		}
+		if err := bc.store.ClearChainstate(); err != nil {
+			return fmt.Errorf("failed to clear chainstate: %w", err)
+		}
+		bc.utxoSet.reset()
+		return bc.replayChainstate(0)
+	}
+
+	err = bc.store.ForEachUTXO(func(data []byte) error {
+		utxo, err := DeserializeUTXO(data)
+		if err != nil {
+			return err
+		}
+		bc.utxoSet.AddUTXO(utxo)
+		return nil
+	})
+	if err != nil {
+		return fmt.Errorf("failed to load chainstate: %w", err)
+	}
+
+	if node.height < bc.height {
+		log.Printf("Chainstate is at block %d but the chain is at %d, replaying missing blocks", node.height, bc.height)
+		return bc.replayChainstate(node.height + 1)
+	}
+	return nil
+}
+
+// replayChainstate connects main-chain blocks from the given height to the tip
+// and persists the chainstate after each one, so an interrupted replay
+// resumes where it stopped.
+func (bc *Blockchain) replayChainstate(from uint64) error {
+	for _, block := range bc.blocks[from:] {
+		medianTime := bc.medianTimeBefore(block)
+		undo, err := bc.utxoSet.ConnectBlock(block, medianTime)
+		if err != nil {
+			return fmt.Errorf("failed to replay block %d: %w", block.Index, err)
+		}
+
+		batch := store.NewBatch()
+		batch.PutUndo(block.Hash, undo.Serialize())
+		writeConnectBlock(batch, block, medianTime)
+		batch.SetBestBlock(block.Hash)
+		if err := bc.store.Write(batch); err != nil {
+			return fmt.Errorf("failed to write chainstate for block %d: %w", block.Index, err)
+		}
+	}
+	return nil
+}
@@ -1,27 +1,49 @@
 package core
 
 import ( 
-    "time"
-    
+    "github.com/OhMyDitzzy/vulcan/chaincfg"
+    "github.com/OhMyDitzzy/vulcan/consensus"
     "github.com/OhMyDitzzy/vulcan/types"
 )
 
-func NewGenesisBlock() *Block {
-	// Pre-funded address for testing
-	preFundedAddress := "04f8a1c2d3e4f5a6b7c8d9e0f1a2b3c4d5e6f7a8b9c0d1e2f3a4b5c6d7e8f9a0b1c2d3e4f5a6b7c8d9e0f1a2b3c4d5e6f7a8b9c0d1e2f3a4b5c6d7e8f9"
-	
-	// Create coinbase transaction
-	coinbase := types.NewCoinbaseTransaction(preFundedAddress, 1000000)
+// NewGenesisBlock creates the first block of a network's chain.
+// The consensus engine fills in its consensus fields, so chains run by
+// different engines, or differently configured ones, have different genesis
+// blocks and never share a block tree.
+func NewGenesisBlock(params *chaincfg.Params, engine consensus.Engine) *Block {
+	timestamp := params.GenesisTimestamp
 	
 	genesis := &Block{
-		Index:        0,
-		Timestamp:    time.Unix(1577836800, 0), // 2020-01-01
-		Transactions: []*types.Transaction{coinbase},
-		Nonce:        0,
-		PreviousHash: "0",
-		Difficulty:   1,
+		BlockHeader: types.BlockHeader{
+			Version:      types.BlockVersion,
+			Index:        0,
+			Timestamp:    timestamp,
+			Nonce:        0,
+			PreviousHash: "0",
+		},
+	}
+	
+	// Create coinbase transaction paying the genesis allocations. Every node
+	// must derive the same genesis hash to share a block tree, so the
+	// coinbase uses the genesis timestamp.
+	outputs := make([]types.TxOutput, len(params.GenesisAlloc))
+	for i, alloc := range params.GenesisAlloc {
+		outputs[i] = types.TxOutput{Amount: alloc.Amount, Address: alloc.Address}
+	}
+	coinbase := &types.Transaction{
+		Version: types.TxVersion,
+		ChainID: params.ChainID,
+		Inputs: []types.TxInput{
+			{PrevOut: types.OutPoint{Index: types.CoinbaseIndex}},
+		},
+		Outputs:   outputs,
+		Payload:   params.GenesisExtra,
+		Timestamp: timestamp,
 	}
+	coinbase.ID = coinbase.Hash()
+	genesis.Transactions = []*types.Transaction{coinbase}
 	
+	engine.PrepareGenesis(&genesis.BlockHeader)
 	genesis.MerkleRoot = genesis.ComputeMerkleRoot()
 	genesis.Hash = genesis.ComputeHash()
 	
@@ -5,116 +5,155 @@ import (
 	"encoding/hex"
 )
 
+// Domain separation prefixes of the Merkle tree. Leaves and inner nodes are
+// hashed with different prefixes, so a 64-byte pair of child hashes can't
+// be passed off as a leaf, or a leaf as an inner node.
+const (
+	merkleLeafPrefix = 0x00
+	merkleNodePrefix = 0x01
+)
+
 // BuildMerkleRoot constructs a Merkle tree from transaction IDs and returns the root hash.
-// we recursively hash pairs of hashes until we reach a single root.
-// If the number of hashes is odd, we duplicate the last hash to make it even.
-// This provides an efficient way to verify transaction inclusion in a block.
-func BuildMerkleRoot(txIDs []string) string {
+// Leaves are the SHA256 of the leaf prefix and the raw 32-byte ID, and each
+// inner node is the SHA256 of the node prefix and its two children. On a
+// level with an odd number of hashes, the last one is promoted to the next
+// level unchanged instead of being paired with a copy of itself, so no two
+// different transaction lists share a root.
+//
+// mutated reports a list no block may commit to: an ID that isn't a 32-byte
+// hex hash, or one that appears more than once.
+func BuildMerkleRoot(txIDs []string) (root string, mutated bool) {
 	if len(txIDs) == 0 {
-		return ""
+		return "", false
 	}
-	
-	leaves := make([]string, len(txIDs))
-	for i, txID := range txIDs {
-		leaves[i] = txID
+
+	level, mutated := merkleLeaves(txIDs)
+	for len(level) > 1 {
+		level = merkleLevel(level)
 	}
-	
-	return buildMerkleTree(leaves)
+	return hex.EncodeToString(level[0]), mutated
 }
 
-// buildMerkleTree recursively builds the Merkle tree.
-// Start with the leaf nodes (transaction hashes) and combine them
-// pairwise until we have a single root hash.
-func buildMerkleTree(hashes []string) string {
-	if len(hashes) == 1 {
-		return hashes[0]
-	}
-	
-	// If odd number of hashes, duplicate the last one
-	if len(hashes)%2 != 0 {
-		hashes = append(hashes, hashes[len(hashes)-1])
+// merkleLeaves hashes the transaction IDs into the leaves of the tree.
+func merkleLeaves(txIDs []string) ([][]byte, bool) {
+	mutated := false
+	seen := make(map[string]bool, len(txIDs))
+	leaves := make([][]byte, len(txIDs))
+	for i, txID := range txIDs {
+		id, err := hex.DecodeString(txID)
+		if err != nil || len(id) != sha256.Size || seen[txID] {
+			mutated = true
+		}
+		seen[txID] = true
+		leaves[i] = hashMerkleLeaf(id)
 	}
-	
-	var newLevel []string
+	return leaves, mutated
+}
+
+// merkleLevel hashes one level of the tree into the next, promoting an odd
+// last hash unchanged.
+func merkleLevel(hashes [][]byte) [][]byte {
+	next := make([][]byte, 0, (len(hashes)+1)/2)
 	for i := 0; i < len(hashes); i += 2 {
-		combined := combineHashes(hashes[i], hashes[i+1])
-		newLevel = append(newLevel, combined)
+		if i+1 == len(hashes) {
+			next = append(next, hashes[i])
+			continue
+		}
+		next = append(next, hashMerkleNode(hashes[i], hashes[i+1]))
 	}
-	
-	return buildMerkleTree(newLevel)
+	return next
 }
 
-// combineHashes concatenates two hashes and returns their SHA256 hash.
-// Build parent nodes in the Merkle tree from child nodes.
-func combineHashes(hash1, hash2 string) string {
-	combined := hash1 + hash2
-	hash := sha256.Sum256([]byte(combined))
-	return hex.EncodeToString(hash[:])
+func hashMerkleLeaf(id []byte) []byte {
+	hash := sha256.Sum256(append([]byte{merkleLeafPrefix}, id...))
+	return hash[:]
+}
+
+func hashMerkleNode(left, right []byte) []byte {
+	data := make([]byte, 0, 1+len(left)+len(right))
+	data = append(data, merkleNodePrefix)
+	data = append(data, left...)
+	data = append(data, right...)
+	hash := sha256.Sum256(data)
+	return hash[:]
+}
+
+// MerkleProof proves that a transaction is included in a block, given only
+// the Merkle root from the block's header.
+//
+// To verify it, hash the leaf of the transaction ID, then walk up the tree
+// while the level has more than one hash: if Index is odd, hash the next
+// sibling on the left; if Index+1 < Count, hash it on the right; otherwise
+// the hash is promoted without one. Then halve Index and set Count to
+// (Count+1)/2. The proof is valid if every sibling was used and the result
+// is the Merkle root.
+type MerkleProof struct {
+	Index    uint64   `json:"index"`    // Position of the transaction in the block
+	Count    uint64   `json:"count"`    // Number of transactions in the block
+	Siblings []string `json:"siblings"` // Hex sibling hashes, from the leaf level up
 }
 
 // VerifyTransactionInclusion verifies that a transaction is included in a block
 // using the Merkle proof. This allows efficient verification without needing
 // all transactions in the block.
-func VerifyTransactionInclusion(txID string, merkleRoot string, proof []string, index int) bool {
-	currentHash := txID
-	
-	for i, siblingHash := range proof {
-		// Determine if we should concatenate on left or right based on index
-		// We use bit manipulation to determine position in the tree
-		if (index>>i)&1 == 0 {
-			// Transaction is on the left
-			currentHash = combineHashes(currentHash, siblingHash)
-		} else {
-			// Transaction is on the right
-			currentHash = combineHashes(siblingHash, currentHash)
+func VerifyTransactionInclusion(txID string, merkleRoot string, proof *MerkleProof) bool {
+	if proof == nil || proof.Index >= proof.Count {
+		return false
+	}
+	id, err := hex.DecodeString(txID)
+	if err != nil || len(id) != sha256.Size {
+		return false
+	}
+
+	hash := hashMerkleLeaf(id)
+	index, count := proof.Index, proof.Count
+	siblings := proof.Siblings
+	for count > 1 {
+		if index%2 == 1 || index+1 < count {
+			if len(siblings) == 0 {
+				return false
+			}
+			sibling, err := hex.DecodeString(siblings[0])
+			if err != nil || len(sibling) != sha256.Size {
+				return false
+			}
+			siblings = siblings[1:]
+
+			if index%2 == 1 {
+				hash = hashMerkleNode(sibling, hash)
+			} else {
+				hash = hashMerkleNode(hash, sibling)
+			}
 		}
+		index /= 2
+		count = (count + 1) / 2
 	}
-	
-	return currentHash == merkleRoot
+
+	return len(siblings) == 0 && hex.EncodeToString(hash) == merkleRoot
 }
 
 // GenerateMerkleProof generates a Merkle proof for a transaction at the given index.
 // The proof consists of the sibling hashes needed to reconstruct the path
 // from the transaction to the root. We return this proof so that a light client
 // can verify transaction inclusion without downloading the entire block.
-func GenerateMerkleProof(txIDs []string, index int) []string {
+func GenerateMerkleProof(txIDs []string, index int) *MerkleProof {
 	if index < 0 || index >= len(txIDs) {
 		return nil
 	}
-	
-	var proof []string
-	leaves := make([]string, len(txIDs))
-	copy(leaves, txIDs)
-	
-	currentIndex := index
-	currentLevel := leaves
-	
-	for len(currentLevel) > 1 {
-		// If odd number, duplicate last element
-		if len(currentLevel)%2 != 0 {
-			currentLevel = append(currentLevel, currentLevel[len(currentLevel)-1])
-		}
-		
-		var siblingIndex int
-		if currentIndex%2 == 0 {
-			siblingIndex = currentIndex + 1
-		} else {
-			siblingIndex = currentIndex - 1
-		}
-		
-		if siblingIndex < len(currentLevel) {
-			proof = append(proof, currentLevel[siblingIndex])
-		}
-		
-		var nextLevel []string
-		for i := 0; i < len(currentLevel); i += 2 {
-			combined := combineHashes(currentLevel[i], currentLevel[i+1])
-			nextLevel = append(nextLevel, combined)
+
+	proof := &MerkleProof{
+		Index:    uint64(index),
+		Count:    uint64(len(txIDs)),
+		Siblings: []string{},
+	}
+	level, _ := merkleLeaves(txIDs)
+	for len(level) > 1 {
+		sibling := index ^ 1
+		if sibling < len(level) {
+			proof.Siblings = append(proof.Siblings, hex.EncodeToString(level[sibling]))
 		}
-		
-		currentLevel = nextLevel
-		currentIndex = currentIndex / 2
+		level = merkleLevel(level)
+		index /= 2
 	}
-	
 	return proof
-}
\ No newline at end of file
+}
@@ -0,0 +1,157 @@
+package core
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"testing"
+)
+
+func testTxIDs(n int) []string {
+	ids := make([]string, n)
+	for i := range ids {
+		hash := sha256.Sum256([]byte(fmt.Sprintf("tx %d", i)))
+		ids[i] = hex.EncodeToString(hash[:])
+	}
+	return ids
+}
+
+func leaf(t *testing.T, txID string) []byte {
+	t.Helper()
+	id, err := hex.DecodeString(txID)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return hashMerkleLeaf(id)
+}
+
+func TestBuildMerkleRootShape(t *testing.T) {
+	ids := testTxIDs(5)
+	a, b, c, d, e := leaf(t, ids[0]), leaf(t, ids[1]), leaf(t, ids[2]), leaf(t, ids[3]), leaf(t, ids[4])
+
+	tests := []struct {
+		name string
+		ids  []string
+		want []byte
+	}{
+		{"one", ids[:1], a},
+		{"two", ids[:2], hashMerkleNode(a, b)},
+		// The odd leaf is promoted, not paired with itself
+		{"three", ids[:3], hashMerkleNode(hashMerkleNode(a, b), c)},
+		{"four", ids[:4], hashMerkleNode(hashMerkleNode(a, b), hashMerkleNode(c, d))},
+		{"five", ids[:5], hashMerkleNode(hashMerkleNode(hashMerkleNode(a, b), hashMerkleNode(c, d)), e)},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			root, mutated := BuildMerkleRoot(tt.ids)
+			if mutated {
+				t.Fatal("distinct IDs reported as mutated")
+			}
+			if root != hex.EncodeToString(tt.want) {
+				t.Fatalf("got root %s, want %x", root, tt.want)
+			}
+		})
+	}
+
+	if root, _ := BuildMerkleRoot(nil); root != "" {
+		t.Fatalf("empty list has root %s", root)
+	}
+}
+
+func TestBuildMerkleRootMutation(t *testing.T) {
+	ids := testTxIDs(3)
+
+	tests := []struct {
+		name string
+		ids  []string
+	}{
+		{"duplicated last", append(ids[:3:3], ids[2])},
+		{"duplicated first", []string{ids[0], ids[0]}},
+		{"duplicated apart", []string{ids[0], ids[1], ids[0]}},
+		{"not hex", []string{ids[0], "zz"}},
+		{"short ID", []string{ids[0], "abcd"}},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if _, mutated := BuildMerkleRoot(tt.ids); !mutated {
+				t.Fatal("mutated list not reported")
+			}
+		})
+	}
+
+	// Duplicating the odd leaf doesn't give the root of the original list,
+	// unlike with Bitcoin's Merkle tree
+	root, _ := BuildMerkleRoot(ids)
+	duplicated, _ := BuildMerkleRoot(append(ids[:3:3], ids[2]))
+	if root == duplicated {
+		t.Fatal("duplicating the odd leaf kept the root")
+	}
+}
+
+func TestBuildMerkleRootDomainSeparation(t *testing.T) {
+	ids := testTxIDs(2)
+	root, _ := BuildMerkleRoot(ids)
+
+	// An inner node can't be passed off as a leaf
+	node := hashMerkleNode(leaf(t, ids[0]), leaf(t, ids[1]))
+	if single, _ := BuildMerkleRoot([]string{hex.EncodeToString(node)}); single == root {
+		t.Fatal("inner node hashes to the same root as a leaf")
+	}
+}
+
+func TestMerkleProofs(t *testing.T) {
+	for n := 1; n <= 9; n++ {
+		ids := testTxIDs(n)
+		root, _ := BuildMerkleRoot(ids)
+
+		for i := range ids {
+			proof := GenerateMerkleProof(ids, i)
+			if !VerifyTransactionInclusion(ids[i], root, proof) {
+				t.Errorf("proof of transaction %d of %d rejected", i, n)
+			}
+
+			for j := range ids {
+				if j != i && VerifyTransactionInclusion(ids[j], root, proof) {
+					t.Errorf("proof of transaction %d of %d accepted for transaction %d", i, n, j)
+				}
+			}
+		}
+	}
+
+	if GenerateMerkleProof(testTxIDs(3), 3) != nil {
+		t.Error("proof generated for an index past the end")
+	}
+}
+
+func TestMerkleProofTampering(t *testing.T) {
+	ids := testTxIDs(5)
+	root, _ := BuildMerkleRoot(ids)
+
+	tests := map[string]func(p *MerkleProof){
+		"index":          func(p *MerkleProof) { p.Index = 1 },
+		"index past end": func(p *MerkleProof) { p.Index = p.Count },
+		"count":          func(p *MerkleProof) { p.Count = 4 },
+		"extra sibling":  func(p *MerkleProof) { p.Siblings = append(p.Siblings, p.Siblings[0]) },
+		"missing sibling": func(p *MerkleProof) {
+			p.Siblings = p.Siblings[:len(p.Siblings)-1]
+		},
+		"changed sibling": func(p *MerkleProof) { p.Siblings[0] = ids[4] },
+		"invalid sibling": func(p *MerkleProof) { p.Siblings[0] = "zz" },
+	}
+
+	for name, tamper := range tests {
+		t.Run(name, func(t *testing.T) {
+			proof := GenerateMerkleProof(ids, 2)
+			tamper(proof)
+			if VerifyTransactionInclusion(ids[2], root, proof) {
+				t.Fatal("tampered proof accepted")
+			}
+		})
+	}
+
+	if VerifyTransactionInclusion(ids[2], root, nil) {
+		t.Fatal("missing proof accepted")
+	}
+}
@@ -0,0 +1,35 @@
+package core
+
+import (
+	"fmt"
+
+	"github.com/OhMyDitzzy/vulcan/types"
+)
+
+// BlockUndo records the UTXOs a block consumed, in the order they were spent.
+// We store one alongside every main-chain block so the block can later be
+// disconnected and the UTXO set restored exactly to its pre-block state.
+type BlockUndo struct {
+	Spent []*UTXO `json:"spent"`
+}
+
+func (u *BlockUndo) Serialize() []byte {
+	e := types.NewEncoder()
+	e.WriteVarInt(uint64(len(u.Spent)))
+	for _, utxo := range u.Spent {
+		utxo.encode(e)
+	}
+	return e.Bytes()
+}
+
+func DeserializeBlockUndo(data []byte) (*BlockUndo, error) {
+	d := types.NewDecoder(data)
+	undo := &BlockUndo{Spent: make([]*UTXO, d.ReadCount())}
+	for i := range undo.Spent {
+		undo.Spent[i] = decodeUTXO(d)
+	}
+	if err := d.Finish(); err != nil {
+		return nil, fmt.Errorf("failed to decode undo data: %w", err)
+	}
+	return undo, nil
+}
@@ -0,0 +1,168 @@
+package core
+
+import (
+	"bytes"
+	"reflect"
+	"strings"
+	"testing"
+	"time"
+)
+
+func testUTXOs() map[string]*UTXO {
+	medianTime := time.Unix(1700000000, 5).UTC()
+	return map[string]*UTXO{
+		"plain": {
+			TxID: "aa11", Index: 1, Amount: 50, Address: "04beef",
+			Height: 7, MedianTime: medianTime,
+		},
+		"coinbase": {
+			TxID: "bb22", Amount: 5000, Address: "04beef",
+			Height: 8, MedianTime: medianTime, Coinbase: true,
+		},
+		"staked": {
+			TxID: "cc33", Index: 2, Amount: 100, Address: "04abcd",
+			Height: 9, MedianTime: medianTime, Staked: true,
+		},
+		"unbonding": {
+			TxID: "dd44", Amount: 100, Address: "04abcd",
+			Height: 10, MedianTime: medianTime, UnlockHeight: 110,
+		},
+		"script": {
+			TxID: "ee55", Index: 3, Amount: 20, Address: "51hash", Script: []byte{0x51},
+			Height: 11, MedianTime: medianTime,
+		},
+	}
+}
+
+func TestUTXORoundTrip(t *testing.T) {
+	for name, utxo := range testUTXOs() {
+		t.Run(name, func(t *testing.T) {
+			data := utxo.Serialize()
+
+			got, err := DeserializeUTXO(data)
+			if err != nil {
+				t.Fatalf("DeserializeUTXO failed: %v", err)
+			}
+			if !reflect.DeepEqual(got, utxo) {
+				t.Fatalf("got %+v, want %+v", got, utxo)
+			}
+
+			for n := 0; n < len(data); n++ {
+				if _, err := DeserializeUTXO(data[:n]); err == nil {
+					t.Errorf("decoding the first %d of %d bytes succeeded", n, len(data))
+				}
+			}
+			if _, err := DeserializeUTXO(append(bytes.Clone(data), 0)); err == nil {
+				t.Error("decoding with a trailing byte succeeded")
+			}
+		})
+	}
+}
+
+func TestUTXORejectsUnknownFlags(t *testing.T) {
+	data := testUTXOs()["plain"].Serialize()
+	// The flags byte is followed by the 8-byte unlock height
+	data[len(data)-9] = 0x80
+	if _, err := DeserializeUTXO(data); err == nil {
+		t.Fatal("decoding a utxo with unknown flags succeeded")
+	}
+}
+
+func TestBlockUndoRoundTrip(t *testing.T) {
+	utxos := testUTXOs()
+
+	tests := []struct {
+		name string
+		undo *BlockUndo
+	}{
+		{"empty", &BlockUndo{Spent: []*UTXO{}}},
+		{"one", &BlockUndo{Spent: []*UTXO{utxos["plain"]}}},
+		{"several", &BlockUndo{Spent: []*UTXO{utxos["staked"], utxos["script"], utxos["unbonding"]}}},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			data := tt.undo.Serialize()
+
+			got, err := DeserializeBlockUndo(data)
+			if err != nil {
+				t.Fatalf("DeserializeBlockUndo failed: %v", err)
+			}
+			if !reflect.DeepEqual(got, tt.undo) {
+				t.Fatalf("got %+v, want %+v", got, tt.undo)
+			}
+
+			for n := 0; n < len(data); n++ {
+				if _, err := DeserializeBlockUndo(data[:n]); err == nil {
+					t.Errorf("decoding the first %d of %d bytes succeeded", n, len(data))
+				}
+			}
+			if _, err := DeserializeBlockUndo(append(bytes.Clone(data), 0)); err == nil {
+				t.Error("decoding with a trailing byte succeeded")
+			}
+		})
+	}
+}
+
+func TestConnectDisconnectBlock(t *testing.T) {
+	n := newTestNode(t)
+	genesis := n.genesis()
+	alice, bob := newAddress(t), newAddress(t)
+
+	set := n.bc.utxoSet.Clone()
+	before := set.Clone()
+
+	payment := n.pay(bob, 300, 10)
+	block := n.mine(genesis, alice, payment)
+	undo, err := set.ConnectBlock(block, time.Time{})
+	if err != nil {
+		t.Fatalf("ConnectBlock failed: %v", err)
+	}
+	if len(undo.Spent) != 1 || undo.Spent[0].TxID != genesis.Transactions[0].ID {
+		t.Fatalf("undo data records %d spent outputs, want the genesis allocation", len(undo.Spent))
+	}
+	if set.GetBalance(bob) != 300 {
+		t.Fatalf("bob's balance is %d, want 300", set.GetBalance(bob))
+	}
+
+	// Undo data survives being stored
+	stored, err := DeserializeBlockUndo(undo.Serialize())
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := set.DisconnectBlock(block, stored); err != nil {
+		t.Fatalf("DisconnectBlock failed: %v", err)
+	}
+	if !reflect.DeepEqual(set.utxos, before.utxos) || !reflect.DeepEqual(set.stakes, before.stakes) {
+		t.Fatal("disconnecting the block didn't restore the UTXO set")
+	}
+
+	// A block repeating a transaction whose outputs are unspent is rejected,
+	// so disconnecting the first block still restores the set
+	if _, err := set.ConnectBlock(block, time.Time{}); err != nil {
+		t.Fatal(err)
+	}
+	connected := set.Clone()
+	repeat := n.mine(block, alice)
+	repeat.Transactions[0] = block.Transactions[0]
+	if _, err := set.ConnectBlock(repeat, time.Time{}); err == nil || !strings.Contains(err.Error(), "already exists") {
+		t.Fatalf("got %v, want a repeated coinbase rejected", err)
+	}
+	if !reflect.DeepEqual(set.utxos, connected.utxos) {
+		t.Fatal("a rejected block changed the UTXO set")
+	}
+	if err := set.DisconnectBlock(block, stored); err != nil {
+		t.Fatalf("DisconnectBlock failed: %v", err)
+	}
+	if !reflect.DeepEqual(set.utxos, before.utxos) || !reflect.DeepEqual(set.stakes, before.stakes) {
+		t.Fatal("disconnecting the block didn't restore the UTXO set")
+	}
+
+	// Disconnecting with missing undo data fails
+	if _, err := set.ConnectBlock(block, time.Time{}); err != nil {
+		t.Fatal(err)
+	}
+	if err := set.DisconnectBlock(block, &BlockUndo{}); err == nil {
+		t.Fatal("disconnecting without undo data succeeded")
+	}
+}
@@ -1,11 +1,22 @@
 package core
 
 import (
-	"encoding/json"
+	"errors"
 	"fmt"
+	"sort"
 	"sync"
+	"time"
 
+	"github.com/OhMyDitzzy/vulcan/consensus"
+	"github.com/OhMyDitzzy/vulcan/script"
 	"github.com/OhMyDitzzy/vulcan/types"
+	"github.com/OhMyDitzzy/vulcan/wallet"
+)
+
+// UTXO flags, as stored in the chainstate.
+const (
+	utxoStaked   uint8 = 1 << 0
+	utxoCoinbase uint8 = 1 << 1
 )
 
 // UTXO represents an unspent transaction output.
@@ -13,67 +24,155 @@ import (
 // and creates new UTXOs as outputs. We track all unspent outputs to
 // determine account balances and validate new transactions.
 type UTXO struct {
-	TxID    string `json:"tx_id"`    // Transaction ID that created this UTXO
-	Address string `json:"address"`  // Owner's address
-	Amount  uint64 `json:"amount"`   // Amount in this UTXO
-	Index   int    `json:"index"`    // Output index in the transaction
+	TxID         string    `json:"tx_id"`                   // Transaction ID that created this UTXO
+	Address      string    `json:"address"`                 // Owner's address
+	Script       []byte    `json:"script,omitempty"`        // Locking script, if not locked to a public key
+	Amount       uint64    `json:"amount"`                  // Amount in this UTXO
+	Index        uint32    `json:"index"`                   // Output index in the transaction
+	Height       uint64    `json:"height"`                  // Height of the block that created this UTXO
+	MedianTime   time.Time `json:"median_time"`             // Median time past of that block's parent, for relative time locks
+	Coinbase     bool      `json:"coinbase,omitempty"`      // Created by a coinbase, only spendable once mature
+	Staked       bool      `json:"staked,omitempty"`        // Locked as stake, only spendable by unstaking or slashing
+	UnlockHeight uint64    `json:"unlock_height,omitempty"` // Unstaked coins can't be spent before this height
+}
+
+// Mature reports whether the UTXO may be spent in a block at the given
+// height, given the coinbase maturity. Only coinbase outputs are ever immature,
+// except those of the genesis block, which no reorganization can remove.
+func (u *UTXO) Mature(height, maturity uint64) bool {
+	return !u.Coinbase || u.Height == 0 || height >= u.Height+maturity
+}
+
+// Slashable reports whether the UTXO can be slashed in a block at the given
+// height for an offense in the block at evidenceIndex: it is stake that was
+// already bonded at evidenceIndex, or unstaked coins still in the unbonding
+// period.
+func (u *UTXO) Slashable(height, evidenceIndex uint64) bool {
+	if u.Staked {
+		return u.Height <= evidenceIndex
+	}
+	return u.UnlockHeight > height
 }
 
+// OutPoint returns the outpoint that references this UTXO.
+func (u *UTXO) OutPoint() types.OutPoint {
+	return types.OutPoint{TxID: u.TxID, Index: u.Index}
+}
+
+// Serialize returns the binary encoding the chainstate stores the UTXO in.
+func (u *UTXO) Serialize() []byte {
+	e := types.NewEncoder()
+	u.encode(e)
+	return e.Bytes()
+}
+
+func (u *UTXO) encode(e *types.Encoder) {
+	e.WriteString(u.TxID)
+	e.WriteUint32(u.Index)
+	e.WriteUint64(u.Amount)
+	e.WriteString(u.Address)
+	e.WriteBytes(u.Script)
+	e.WriteUint64(u.Height)
+	e.WriteTime(u.MedianTime)
+	var flags uint8
+	if u.Staked {
+		flags |= utxoStaked
+	}
+	if u.Coinbase {
+		flags |= utxoCoinbase
+	}
+	e.WriteUint8(flags)
+	e.WriteUint64(u.UnlockHeight)
+}
+
+// DeserializeUTXO decodes a UTXO produced by Serialize.
+func DeserializeUTXO(data []byte) (*UTXO, error) {
+	d := types.NewDecoder(data)
+	utxo := decodeUTXO(d)
+	if err := d.Finish(); err != nil {
+		return nil, fmt.Errorf("failed to decode utxo: %w", err)
+	}
+	return utxo, nil
+}
+
+func decodeUTXO(d *types.Decoder) *UTXO {
+	utxo := &UTXO{
+		TxID:    d.ReadString(),
+		Index:   d.ReadUint32(),
+		Amount:  d.ReadUint64(),
+		Address: d.ReadString(),
+		Script:  d.ReadBytes(),
+		Height:  d.ReadUint64(),
+	}
+	utxo.MedianTime = d.ReadTime()
+	flags := d.ReadUint8()
+	if flags&^(utxoStaked|utxoCoinbase) != 0 {
+		d.Fail("invalid utxo flags %#x", flags)
+	}
+	utxo.Staked = flags&utxoStaked != 0
+	utxo.Coinbase = flags&utxoCoinbase != 0
+	utxo.UnlockHeight = d.ReadUint64()
+	return utxo
+}
+
+// ErrNonFinal is returned for a transaction that is valid except that its
+// lock time, or the relative lock time of one of its inputs, hasn't passed yet.
+var ErrNonFinal = errors.New("transaction is not final")
+
 // UTXOSet manages the set of all unspent transaction outputs.
 // Maintain an in-memory map for fast lookups and provide methods
 // to add, remove, and query UTXOs. This is the core of our state management.
 type UTXOSet struct {
-	utxos map[string]map[int]*UTXO // map[txID]map[outputIndex]UTXO
-	mu    sync.RWMutex
+	utxos    map[string]map[uint32]*UTXO // map[txID]map[outputIndex]UTXO
+	stakes   map[string]uint64           // Total staked by each address
+	maturity uint64                      // Blocks before a coinbase output can be spent
+	mu       sync.RWMutex
 }
 
-func NewUTXOSet() *UTXOSet {
+// NewUTXOSet creates an empty UTXO set whose coinbase outputs can be spent
+// once they are coinbaseMaturity blocks deep.
+func NewUTXOSet(coinbaseMaturity uint64) *UTXOSet {
 	return &UTXOSet{
-		utxos: make(map[string]map[int]*UTXO),
+		utxos:    make(map[string]map[uint32]*UTXO),
+		stakes:   make(map[string]uint64),
+		maturity: coinbaseMaturity,
 	}
 }
 
+// CoinbaseMaturity returns the number of blocks a coinbase output must be
+// buried under before it can be spent.
+func (us *UTXOSet) CoinbaseMaturity() uint64 {
+	return us.maturity
+}
+
 // AddUTXO adds a new unspent output to the set.
 // when processing confirmed transactions to track new outputs.
 func (us *UTXOSet) AddUTXO(utxo *UTXO) {
 	us.mu.Lock()
 	defer us.mu.Unlock()
-	
-	if us.utxos[utxo.TxID] == nil {
-		us.utxos[utxo.TxID] = make(map[int]*UTXO)
-	}
-	us.utxos[utxo.TxID][utxo.Index] = utxo
+	us.addUTXO(utxo)
 }
 
 // RemoveUTXO removes a spent output from the set.
 // when a transaction consumes an existing UTXO as input.
-func (us *UTXOSet) RemoveUTXO(txID string, index int) {
+func (us *UTXOSet) RemoveUTXO(txID string, index uint32) {
 	us.mu.Lock()
 	defer us.mu.Unlock()
-	
-	if us.utxos[txID] != nil {
-		delete(us.utxos[txID], index)
-		if len(us.utxos[txID]) == 0 {
-			delete(us.utxos, txID)
-		}
-	}
+	us.removeUTXO(txID, index)
 }
 
 // GetUTXO retrieves a specific UTXO.
 // Return nil if the UTXO doesn't exist or has been spent.
-func (us *UTXOSet) GetUTXO(txID string, index int) *UTXO {
+func (us *UTXOSet) GetUTXO(txID string, index uint32) *UTXO {
 	us.mu.RLock()
 	defer us.mu.RUnlock()
-	
-	if us.utxos[txID] != nil {
-		return us.utxos[txID][index]
-	}
-	return nil
+	return us.getUTXO(txID, index)
 }
 
 // GetUTXOsForAddress returns all UTXOs owned by an address.
 // Calculate an address's balance and select inputs
-// for new transactions.
+// for new transactions. The result is sorted by outpoint so that
+// coin selection is deterministic.
 func (us *UTXOSet) GetUTXOsForAddress(address string) []*UTXO {
 	us.mu.RLock()
 	defer us.mu.RUnlock()
@@ -86,11 +185,38 @@ func (us *UTXOSet) GetUTXOsForAddress(address string) []*UTXO {
 			}
 		}
 	}
+
+	sort.Slice(utxos, func(i, j int) bool {
+		if utxos[i].TxID != utxos[j].TxID {
+			return utxos[i].TxID < utxos[j].TxID
+		}
+		return utxos[i].Index < utxos[j].Index
+	})
 	return utxos
 }
 
+// GetStake returns the amount an address has staked.
+func (us *UTXOSet) GetStake(address string) uint64 {
+	us.mu.RLock()
+	defer us.mu.RUnlock()
+	return us.stakes[address]
+}
+
+// Stakes returns the amount staked by every address with stake.
+// This is the stake distribution Proof-of-Stake elects proposers from.
+func (us *UTXOSet) Stakes() map[string]uint64 {
+	us.mu.RLock()
+	defer us.mu.RUnlock()
+
+	stakes := make(map[string]uint64, len(us.stakes))
+	for address, stake := range us.stakes {
+		stakes[address] = stake
+	}
+	return stakes
+}
+
 // GetBalance calculates the total balance for an address.
-// Sum up all UTXOs owned by the address.
+// Sum up all UTXOs owned by the address, including stake.
 func (us *UTXOSet) GetBalance(address string) uint64 {
 	utxos := us.GetUTXOsForAddress(address)
 	var balance uint64
@@ -100,163 +226,369 @@ func (us *UTXOSet) GetBalance(address string) uint64 {
 	return balance
 }
 
-// ApplyTransaction updates the UTXO set based on a transaction.
-// Remove spent inputs and add new outputs. This is called when
-// a block is added to the chain to update the state.
-func (us *UTXOSet) ApplyTransaction(tx *types.Transaction) error {
-	// We use a simple model where
-	// the transaction specifies from/to/amount directly. In a full UTXO
-	// implementation, 
-	// TODO: we would have explicit inputs and outputs.
-	
-	if tx.IsCoinbase() {
-		us.AddUTXO(&UTXO{
-			TxID:    tx.ID,
-			Address: tx.To,
-			Amount:  tx.Amount,
-			Index:   0,
-		})
-		return nil
+// GetImmatureBalance returns the part of an address's balance in coinbase
+// outputs that can't be spent yet in a block at the given height.
+func (us *UTXOSet) GetImmatureBalance(address string, height uint64) uint64 {
+	var immature uint64
+	for _, utxo := range us.GetUTXOsForAddress(address) {
+		if !utxo.Mature(height, us.maturity) {
+			immature += utxo.Amount
+		}
 	}
-	
-	senderUTXOs := us.GetUTXOsForAddress(tx.From)
-	if len(senderUTXOs) == 0 {
-		return fmt.Errorf("sender has no UTXOs")
+	return immature
+}
+
+// ApplyTransaction updates the UTXO set based on a transaction included in
+// a block at the given height, whose parent has the given median time past.
+// Remove the outputs referenced by the inputs and add new outputs, except
+// data outputs, which can never be spent.
+func (us *UTXOSet) ApplyTransaction(tx *types.Transaction, height uint64, medianTime time.Time) error {
+	us.mu.Lock()
+	defer us.mu.Unlock()
+	_, err := us.applyTransaction(tx, height, medianTime)
+	return err
+}
+
+// applyTransaction implements ApplyTransaction and returns copies of the
+// UTXOs the transaction spent; the caller must hold the lock.
+func (us *UTXOSet) applyTransaction(tx *types.Transaction, height uint64, medianTime time.Time) ([]*UTXO, error) {
+	if err := us.validateTransaction(tx, height, medianTime); err != nil {
+		return nil, err
 	}
 
-	totalNeeded := tx.Total()
-	var totalAvailable uint64
-	var utxosToSpend []*UTXO
-	
-	for _, utxo := range senderUTXOs {
-		utxosToSpend = append(utxosToSpend, utxo)
-		totalAvailable += utxo.Amount
-		if totalAvailable >= totalNeeded {
-			break
+	var spent []*UTXO
+	if !tx.IsCoinbase() {
+		for _, in := range tx.Inputs {
+			utxoCopy := *us.getUTXO(in.PrevOut.TxID, in.PrevOut.Index)
+			spent = append(spent, &utxoCopy)
+			us.removeUTXO(in.PrevOut.TxID, in.PrevOut.Index)
 		}
 	}
-	
-	if totalAvailable < totalNeeded {
-		return fmt.Errorf("insufficient balance: have %d, need %d", totalAvailable, totalNeeded)
+
+	for i := range tx.Outputs {
+		if tx.Outputs[i].IsData() {
+			continue
+		}
+		us.addUTXO(outputUTXO(tx, i, height, medianTime))
 	}
-	
-	for _, utxo := range utxosToSpend {
-		us.RemoveUTXO(utxo.TxID, utxo.Index)
+
+	return spent, nil
+}
+
+// outputUTXO returns the UTXO created by output index of a transaction
+// included in a block at the given height, whose parent has the given
+// median time past.
+// The outputs of a coinbase must mature before they are spent, the first
+// output of a stake transaction is stake, and the outputs of an unstake
+// transaction are locked for the unbonding period.
+func outputUTXO(tx *types.Transaction, index int, height uint64, medianTime time.Time) *UTXO {
+	out := tx.Outputs[index]
+	utxo := &UTXO{
+		TxID:       tx.ID,
+		Address:    out.Address,
+		Script:     out.Script,
+		Amount:     out.Amount,
+		Index:      uint32(index),
+		Height:     height,
+		MedianTime: medianTime,
+		Coinbase:   tx.IsCoinbase(),
 	}
 
-	us.AddUTXO(&UTXO{
-		TxID:    tx.ID,
-		Address: tx.To,
-		Amount:  tx.Amount,
-		Index:   0,
-	})
-	
-	change := totalAvailable - totalNeeded
-	if change > 0 {
-		us.AddUTXO(&UTXO{
-			TxID:    tx.ID,
-			Address: tx.From,
-			Amount:  change,
-			Index:   1,
-		})
-	}
-		
-	return nil
+	switch tx.Type {
+	case types.TxStake:
+		utxo.Staked = index == 0
+	case types.TxUnstake:
+		utxo.UnlockHeight = height + consensus.UnbondingPeriod
+	}
+	return utxo
 }
 
-// Update processes a new block and updates the UTXO set.
-// This should be called after a block is added to the blockchain.
-func (us *UTXOSet) Update(block *Block) error {
-	for _, tx := range block.Transactions {
-		if err := us.ApplyTransaction(tx); err != nil {
-			return fmt.Errorf("failed to apply transaction %s: %v", tx.ID, err)
+// ConnectBlock applies every transaction in a block and returns the undo
+// record of the UTXOs it spent. This is called when a block is added to the
+// main chain, with the median time past of its parent. If any transaction
+// fails, the ones already applied are rolled back so the set is left unchanged.
+func (us *UTXOSet) ConnectBlock(block *Block, medianTime time.Time) (*BlockUndo, error) {
+	us.mu.Lock()
+	defer us.mu.Unlock()
+
+	undo := &BlockUndo{}
+	for i, tx := range block.Transactions {
+		spent, err := us.applyTransaction(tx, block.Index, medianTime)
+		if err != nil {
+			if rollbackErr := us.disconnectTransactions(block.Transactions[:i], undo); rollbackErr != nil {
+				return nil, fmt.Errorf("failed to apply transaction %s: %v (rollback failed: %v)", tx.ID, err, rollbackErr)
+			}
+			return nil, fmt.Errorf("failed to apply transaction %s: %w", tx.ID, err)
 		}
+		undo.Spent = append(undo.Spent, spent...)
 	}
-	return nil
+	return undo, nil
 }
 
-// Rebuild reconstructs the UTXO set from the entire blockchain.
-// This is useful for syncing or recovering from corruption.
-func (us *UTXOSet) Rebuild(blockchain *Blockchain) error {
+// DisconnectBlock reverts a block using its undo record.
+// Transactions are reverted last to first, so outputs created and spent
+// within the same block are handled correctly, and the UTXO set ends up
+// exactly as it was before the block was connected.
+func (us *UTXOSet) DisconnectBlock(block *Block, undo *BlockUndo) error {
 	us.mu.Lock()
 	defer us.mu.Unlock()
-	
-	us.utxos = make(map[string]map[int]*UTXO)
-	
-	height := blockchain.GetHeight()
-	for i := uint64(0); i <= height; i++ {
-		block := blockchain.GetBlock(i)
-		if block == nil {
-			continue
-		}
-		
-		// Process all transactions in the block
-		for _, tx := range block.Transactions {
-			// Unlock before calling ApplyTransaction to avoid deadlock
-			us.mu.Unlock()
-			if err := us.ApplyTransaction(tx); err != nil {
-				us.mu.Lock()
-				return fmt.Errorf("failed to apply transaction %s in block %d: %v", tx.ID, i, err)
+	return us.disconnectTransactions(block.Transactions, undo)
+}
+
+func (us *UTXOSet) disconnectTransactions(txs []*types.Transaction, undo *BlockUndo) error {
+	spent := undo.Spent
+	for i := len(txs) - 1; i >= 0; i-- {
+		tx := txs[i]
+
+		var restore []*UTXO
+		if !tx.IsCoinbase() {
+			if len(spent) < len(tx.Inputs) {
+				return fmt.Errorf("undo data is missing spent outputs for transaction %s", tx.ID)
 			}
-			us.mu.Lock()
+			restore = spent[len(spent)-len(tx.Inputs):]
+			spent = spent[:len(spent)-len(tx.Inputs)]
+		}
+
+		if err := us.revertTransaction(tx, restore); err != nil {
+			return err
 		}
 	}
-	
+
+	if len(spent) != 0 {
+		return fmt.Errorf("undo data has %d unexpected spent outputs", len(spent))
+	}
 	return nil
 }
 
 // RevertTransaction reverts the effects of a transaction on the UTXO set.
-// We use this when reorganizing the chain or handling forks.
-func (us *UTXOSet) RevertTransaction(tx *types.Transaction) error {
-	us.RemoveUTXO(tx.ID, 0)
-	us.RemoveUTXO(tx.ID, 1) // Change output
-	
-	// TODO: we would need to restore the spent UTXOs
-	// This requires storing the original UTXOs somewhere
-	
-	return nil
+// Remove the outputs it created and restore the UTXOs it spent, which must
+// be given in input order. We use this when reorganizing the chain or
+// handling forks.
+func (us *UTXOSet) RevertTransaction(tx *types.Transaction, spent []*UTXO) error {
+	us.mu.Lock()
+	defer us.mu.Unlock()
+	return us.revertTransaction(tx, spent)
 }
 
-// ValidateTransaction checks if a transaction can be applied to the current UTXO set.
-// Verify that the sender has sufficient balance and that all referenced
-// UTXOs exist and are unspent.
-func (us *UTXOSet) ValidateTransaction(tx *types.Transaction) error {
-	if tx.IsCoinbase() {
-		return nil
+func (us *UTXOSet) revertTransaction(tx *types.Transaction, spent []*UTXO) error {
+	if !tx.IsCoinbase() && len(spent) != len(tx.Inputs) {
+		return fmt.Errorf("transaction %s has %d inputs but %d spent outputs were given", tx.ID, len(tx.Inputs), len(spent))
 	}
-	
-	balance := us.GetBalance(tx.From)
-	totalNeeded := tx.Total()
-	
-	if balance < totalNeeded {
-		return fmt.Errorf("insufficient balance: have %d, need %d", balance, totalNeeded)
+	for i, in := range tx.Inputs {
+		if !tx.IsCoinbase() && spent[i].OutPoint() != in.PrevOut {
+			return fmt.Errorf("spent output %s does not match input %d of transaction %s", spent[i].OutPoint(), i, tx.ID)
+		}
 	}
-	
+
+	for i := range tx.Outputs {
+		if !tx.Outputs[i].IsData() && us.getUTXO(tx.ID, uint32(i)) == nil {
+			return fmt.Errorf("output %s:%d is missing from the UTXO set", tx.ID, i)
+		}
+	}
+	for i := range tx.Outputs {
+		us.removeUTXO(tx.ID, uint32(i))
+	}
+
+	for _, utxo := range spent {
+		utxoCopy := *utxo
+		us.addUTXO(&utxoCopy)
+	}
+
 	return nil
 }
 
-func (us *UTXOSet) Serialize() ([]byte, error) {
+// ValidateTransaction checks if a transaction can be applied to the current
+// UTXO set in a block at the given height, whose parent has the given
+// median time past.
+// None of its outputs may already exist in the set. Verify that every
+// referenced UTXO exists and is unspent, that it is owned by the key
+// spending it, that every input signature is valid, and that the inputs cover the outputs plus fee. Outputs locked by a script must
+// instead be unlocked by the input's script. Coinbase outputs can only be spent
+// once mature, stake only by unstaking or slashing, and unstaked coins only
+// once they are unlocked.
+// The lock time of the transaction and the relative lock times of its inputs
+// must have passed too; if nothing else is wrong, the error wraps ErrNonFinal.
+// Blocks are connected through this check, so it is enforced for every
+// block regardless of where it came from.
+func (us *UTXOSet) ValidateTransaction(tx *types.Transaction, height uint64, medianTime time.Time) error {
 	us.mu.RLock()
 	defer us.mu.RUnlock()
-	
-	return json.Marshal(us.utxos)
+
+	return us.validateTransaction(tx, height, medianTime)
 }
 
-func (us *UTXOSet) Deserialize(data []byte) error {
-	us.mu.Lock()
-	defer us.mu.Unlock()
-	
-	return json.Unmarshal(data, &us.utxos)
+// validateTransaction implements ValidateTransaction; the caller must hold the lock.
+func (us *UTXOSet) validateTransaction(tx *types.Transaction, height uint64, medianTime time.Time) error {
+	// Transactions with the same ID, such as two coinbases paying the same
+	// amount to the same address, would otherwise overwrite each other's
+	// outputs, and disconnecting one would remove both
+	for i := range tx.Outputs {
+		if !tx.Outputs[i].IsData() && us.getUTXO(tx.ID, uint32(i)) != nil {
+			return fmt.Errorf("output %s:%d already exists", tx.ID, i)
+		}
+	}
+
+	if tx.IsCoinbase() {
+		return nil
+	}
+
+	// Time locks are reported last, so ErrNonFinal means nothing else is wrong
+	var lockErr error
+	if !tx.IsFinal(height, medianTime) {
+		lockErr = fmt.Errorf("%w: locked until %s", ErrNonFinal, describeLockTime(int64(tx.LockTime)))
+	}
+
+	// A slash transaction spends the stake of whoever its evidence convicts
+	var offender string
+	var evidenceIndex uint64
+	if tx.Type == types.TxSlash {
+		var err error
+		offender, evidenceIndex, err = consensus.VerifyEquivocation(tx.Payload, tx.ChainID)
+		if err != nil {
+			return err
+		}
+		if evidenceIndex >= height {
+			return fmt.Errorf("evidence from block %d is not below block %d", evidenceIndex, height)
+		}
+		if evidenceIndex+consensus.UnbondingPeriod < height {
+			return fmt.Errorf("evidence from block %d is too old", evidenceIndex)
+		}
+	}
+
+	var totalIn uint64
+	for i, in := range tx.Inputs {
+		utxo := us.getUTXO(in.PrevOut.TxID, in.PrevOut.Index)
+		if utxo == nil {
+			return fmt.Errorf("input %d: output %s does not exist or is already spent", i, in.PrevOut)
+		}
+		if !utxo.Mature(height, us.maturity) {
+			return fmt.Errorf("input %d: coinbase output %s is immature until block %d", i, in.PrevOut, utxo.Height+us.maturity)
+		}
+		if lockErr == nil {
+			lockErr = checkSequence(in.Sequence, utxo, height, medianTime)
+			if lockErr != nil {
+				lockErr = fmt.Errorf("input %d: %w", i, lockErr)
+			}
+		}
+
+		switch tx.Type {
+		case types.TxSlash:
+			if utxo.Address != offender {
+				return fmt.Errorf("input %d: output %s is not owned by the offender", i, in.PrevOut)
+			}
+			if !utxo.Slashable(height, evidenceIndex) {
+				return fmt.Errorf("input %d: output %s was not stake bonded at block %d", i, in.PrevOut, evidenceIndex)
+			}
+		case types.TxUnstake:
+			if !utxo.Staked {
+				return fmt.Errorf("input %d: output %s is not stake", i, in.PrevOut)
+			}
+		default:
+			if utxo.Staked {
+				return fmt.Errorf("input %d: output %s is stake and must be unstaked first", i, in.PrevOut)
+			}
+			if utxo.UnlockHeight > height {
+				return fmt.Errorf("input %d: output %s is locked until block %d", i, in.PrevOut, utxo.UnlockHeight)
+			}
+		}
+
+		// An output paid to the address of a script is locked by the
+		// script the input reveals, if it hashes to that address
+		lock, unlock := utxo.Script, in.Script
+		if len(lock) == 0 && len(unlock) > 0 {
+			redeem, rest, err := script.SplitRedeemScript(unlock)
+			if err != nil {
+				return fmt.Errorf("input %d: %w", i, err)
+			}
+			if types.ScriptAddress(redeem) != utxo.Address {
+				return fmt.Errorf("input %d: revealed script does not match the address of output %s", i, in.PrevOut)
+			}
+			lock, unlock = redeem, rest
+		}
+
+		if len(lock) > 0 {
+			if len(in.Script) == 0 {
+				return fmt.Errorf("input %d: output %s is locked by a script", i, in.PrevOut)
+			}
+			if err := script.Verify(unlock, lock, tx, i); err != nil {
+				return fmt.Errorf("input %d: %w", i, err)
+			}
+		} else if tx.Type != types.TxSlash && utxo.Address != in.PubKey {
+			return fmt.Errorf("input %d: output %s is not owned by the spending key", i, in.PrevOut)
+		}
+
+		if totalIn+utxo.Amount < totalIn {
+			return fmt.Errorf("input amounts overflow")
+		}
+		totalIn += utxo.Amount
+	}
+
+	totalNeeded := tx.OutputTotal() + tx.Fee
+	if totalNeeded < tx.Fee {
+		return fmt.Errorf("output amounts overflow")
+	}
+
+	// The evidence authorizes a slash instead of signatures, and
+	// everything it doesn't pay to the reporter is burned
+	if tx.Type == types.TxSlash {
+		if maxReward := totalIn / consensus.SlashRewardDivisor; totalNeeded > maxReward {
+			return fmt.Errorf("slash pays out %d, more than the %d reward for the slashed stake", totalNeeded, maxReward)
+		}
+		return lockErr
+	}
+
+	if totalIn != totalNeeded {
+		return fmt.Errorf("input total %d does not match outputs plus fee %d", totalIn, totalNeeded)
+	}
+
+	valid, err := wallet.VerifyTransactionSignature(tx)
+	if err != nil {
+		return fmt.Errorf("invalid signature: %w", err)
+	}
+	if !valid {
+		return fmt.Errorf("invalid signature")
+	}
+
+	return lockErr
+}
+
+// checkSequence checks the relative lock time of an input spending utxo,
+// in a block at the given height whose parent has the given median time past.
+func checkSequence(sequence uint32, utxo *UTXO, height uint64, medianTime time.Time) error {
+	value := uint64(sequence & types.SequenceMask)
+	if sequence&types.SequenceTimeFlag != 0 {
+		unlockTime := utxo.MedianTime.Add(time.Duration(value) * types.SequenceGranularity)
+		if medianTime.Before(unlockTime) {
+			return fmt.Errorf("%w: output %s is locked until %s", ErrNonFinal, utxo.OutPoint(), describeLockTime(unlockTime.Unix()))
+		}
+		return nil
+	}
+	if height < utxo.Height+value {
+		return fmt.Errorf("%w: output %s is locked until block %d", ErrNonFinal, utxo.OutPoint(), utxo.Height+value)
+	}
+	return nil
 }
 
+// describeLockTime formats an absolute lock time: a block height below
+// types.LockTimeThreshold, and a Unix time otherwise.
+func describeLockTime(lockTime int64) string {
+	if lockTime < types.LockTimeThreshold {
+		return fmt.Sprintf("block %d", lockTime)
+	}
+	return time.Unix(lockTime, 0).UTC().Format(time.RFC3339)
+}
 
+// Clone returns a deep copy of the UTXO set, which can be changed without affecting the original.
 func (us *UTXOSet) Clone() *UTXOSet {
 	us.mu.RLock()
 	defer us.mu.RUnlock()
 	
-	clone := NewUTXOSet()
+	clone := NewUTXOSet(us.maturity)
+	for address, stake := range us.stakes {
+		clone.stakes[address] = stake
+	}
 	for txID, outputs := range us.utxos {
-		clone.utxos[txID] = make(map[int]*UTXO)
+		clone.utxos[txID] = make(map[uint32]*UTXO, len(outputs))
 		for index, utxo := range outputs {
 			utxoCopy := *utxo
 			clone.utxos[txID][index] = &utxoCopy
@@ -265,6 +597,39 @@ func (us *UTXOSet) Clone() *UTXOSet {
 	return clone
 }
 
+// reset empties the set before the chainstate is rebuilt.
+func (us *UTXOSet) reset() {
+	us.mu.Lock()
+	defer us.mu.Unlock()
+	us.utxos = make(map[string]map[uint32]*UTXO)
+	us.stakes = make(map[string]uint64)
+}
+
+// replaceWith swaps in the contents of another set. Blocks and
+// reorganizations are applied to a clone and committed with this so a
+// failure half way through never leaves the live set partially updated.
+func (us *UTXOSet) replaceWith(other *UTXOSet) {
+	us.mu.Lock()
+	defer us.mu.Unlock()
+	us.utxos = other.utxos
+	us.stakes = other.stakes
+}
+
+// Supply returns the total amount of all unspent outputs, which is every
+// coin in circulation.
+func (us *UTXOSet) Supply() uint64 {
+	us.mu.RLock()
+	defer us.mu.RUnlock()
+
+	var supply uint64
+	for _, outputs := range us.utxos {
+		for _, utxo := range outputs {
+			supply += utxo.Amount
+		}
+	}
+	return supply
+}
+
 func (us *UTXOSet) Count() int {
 	us.mu.RLock()
 	defer us.mu.RUnlock()
@@ -274,4 +639,36 @@ func (us *UTXOSet) Count() int {
 		count += len(outputs)
 	}
 	return count
-}
\ No newline at end of file
+}
+
+func (us *UTXOSet) addUTXO(utxo *UTXO) {
+	if us.utxos[utxo.TxID] == nil {
+		us.utxos[utxo.TxID] = make(map[uint32]*UTXO)
+	}
+	us.utxos[utxo.TxID][utxo.Index] = utxo
+	if utxo.Staked {
+		us.stakes[utxo.Address] += utxo.Amount
+	}
+}
+
+func (us *UTXOSet) removeUTXO(txID string, index uint32) {
+	if us.utxos[txID] != nil {
+		if utxo := us.utxos[txID][index]; utxo != nil && utxo.Staked {
+			us.stakes[utxo.Address] -= utxo.Amount
+			if us.stakes[utxo.Address] == 0 {
+				delete(us.stakes, utxo.Address)
+			}
+		}
+		delete(us.utxos[txID], index)
+		if len(us.utxos[txID]) == 0 {
+			delete(us.utxos, txID)
+		}
+	}
+}
+
+func (us *UTXOSet) getUTXO(txID string, index uint32) *UTXO {
+	if us.utxos[txID] != nil {
+		return us.utxos[txID][index]
+	}
+	return nil
+}
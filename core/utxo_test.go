@@ -0,0 +1,156 @@
+package core
+
+import (
+	"errors"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/OhMyDitzzy/vulcan/chaincfg"
+	"github.com/OhMyDitzzy/vulcan/consensus"
+	"github.com/OhMyDitzzy/vulcan/types"
+	"github.com/OhMyDitzzy/vulcan/wallet"
+)
+
+func TestCheckSequence(t *testing.T) {
+	created := time.Unix(1700000000, 0)
+	utxo := &UTXO{TxID: "aa11", Height: 10, MedianTime: created}
+	interval := types.SequenceGranularity
+
+	tests := []struct {
+		name       string
+		sequence   uint32
+		height     uint64
+		medianTime time.Time
+		final      bool
+	}{
+		{"no lock", 0, 10, created, true},
+		{"blocks not reached", 5, 14, created, false},
+		{"blocks reached", 5, 15, created, true},
+		{"most blocks", types.SequenceMask, 10 + types.SequenceMask - 1, created, false},
+		{"time not reached", types.SequenceTimeFlag | 2, 1 << 40, created.Add(2*interval - time.Second), false},
+		{"time reached", types.SequenceTimeFlag | 2, 0, created.Add(2 * interval), true},
+		{"no time lock", types.SequenceTimeFlag, 0, created, true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			err := checkSequence(tt.sequence, utxo, tt.height, tt.medianTime)
+			if tt.final && err != nil {
+				t.Fatalf("checkSequence failed: %v", err)
+			}
+			if !tt.final && !errors.Is(err, ErrNonFinal) {
+				t.Fatalf("got %v, want ErrNonFinal", err)
+			}
+		})
+	}
+}
+
+func TestTimeLockedTransactionsAreHeld(t *testing.T) {
+	n := newTestNode(t)
+	genesis := n.genesis()
+	alice, bob := newAddress(t), newAddress(t)
+
+	// lock returns a payment with the given time locks
+	lock := func(lockTime, sequence uint32) *types.Transaction {
+		t.Helper()
+		tx := n.pay(bob, 300, 10)
+		tx.LockTime = lockTime
+		tx.Inputs[0].Sequence = sequence
+		if err := n.wallet.SignTransaction(tx); err != nil {
+			t.Fatal(err)
+		}
+		return tx
+	}
+	unlocksAt2 := lock(2, 0)
+	relative := lock(0, 2)
+	unlocksLater := lock(0, types.SequenceTimeFlag|1)
+
+	// Transactions unlocking soon are held, those unlocking too far ahead rejected
+	for name, tx := range map[string]*types.Transaction{"lock time": unlocksAt2, "relative": relative, "relative time": unlocksLater} {
+		if err := n.bc.CheckTransaction(tx); !errors.Is(err, ErrNonFinal) {
+			t.Fatalf("%s: got %v, want ErrNonFinal", name, err)
+		}
+	}
+	tooFar := map[string]*types.Transaction{
+		"lock time":           lock(2+maxHoldBlocks, 0),
+		"relative":            lock(0, 2+maxHoldBlocks),
+		"lock time as a time": lock(uint32(genesis.Timestamp.Add(maxHoldTime+time.Hour).Unix()), 0),
+	}
+	for name, tx := range tooFar {
+		if err := n.bc.CheckTransaction(tx); err == nil || errors.Is(err, ErrNonFinal) || !strings.Contains(err.Error(), "too far") {
+			t.Fatalf("%s: got %v, want the time lock rejected as too far ahead", name, err)
+		}
+	}
+
+	// A block can't include a transaction before it unlocks
+	early := n.mine(genesis, alice, unlocksAt2)
+	if err := n.bc.AddBlock(early); !errors.Is(err, ErrNonFinal) {
+		t.Fatalf("got %v, want a block with a locked transaction rejected", err)
+	}
+
+	// Once the next block reaches the lock, the transactions are released
+	a1 := n.mine(genesis, alice)
+	n.add(a1)
+	for _, tx := range []*types.Transaction{unlocksAt2, relative} {
+		if err := n.bc.CheckTransaction(tx); err != nil {
+			t.Fatalf("unlocked transaction rejected: %v", err)
+		}
+	}
+	n.add(n.mine(a1, alice, relative))
+	if n.bc.utxoSet.GetUTXO(relative.ID, 0) == nil {
+		t.Fatal("the unlocked transaction wasn't connected")
+	}
+}
+
+func TestCoinbaseMaturity(t *testing.T) {
+	w := newWallet(t)
+	params := chaincfg.RegTestParams
+	params.GenesisAlloc = []chaincfg.Allocation{{Address: w.Address, Amount: 1000}}
+	params.Emission.GenesisAllocation = 1000
+	params.CoinbaseMaturity = 3
+	n := startTestNode(t, &params, consensus.NewProofOfWork(&params, 1), w)
+	miner := newWallet(t)
+
+	a1 := n.mine(n.genesis(), miner.Address)
+	a2 := n.mine(a1, miner.Address)
+	n.add(a1, a2)
+	reward := a1.Transactions[0].Outputs[0].Amount
+
+	// The genesis allocation is never immature
+	if immature := n.bc.utxoSet.GetImmatureBalance(w.Address, 1); immature != 0 {
+		t.Fatalf("genesis allocation has %d immature coins", immature)
+	}
+	if got, want := n.bc.utxoSet.GetImmatureBalance(miner.Address, 3), 2*reward; got != want {
+		t.Fatalf("got %d immature coins at block 3, want %d", got, want)
+	}
+	if got := n.bc.utxoSet.GetImmatureBalance(miner.Address, 4); got != reward {
+		t.Fatalf("got %d immature coins at block 4, want %d", got, reward)
+	}
+	if got := n.bc.utxoSet.GetImmatureBalance(miner.Address, 5); got != 0 {
+		t.Fatalf("got %d immature coins at block 5, want none", got)
+	}
+
+	coins := []wallet.Coin{{OutPoint: types.OutPoint{TxID: a1.Transactions[0].ID}, Amount: reward}}
+	spend, err := miner.CreateAndSignTransaction(params.ChainID, coins, newAddress(t), reward-1, 1)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// The coinbase of block 1 can't be spent in block 3, only from block 4 on
+	if err := n.bc.CheckTransaction(spend); err == nil || !strings.Contains(err.Error(), "immature until block 4") {
+		t.Fatalf("got %v, want a spend of an immature coinbase rejected", err)
+	}
+	if err := n.bc.AddBlock(n.mine(a2, miner.Address, spend)); err == nil || !strings.Contains(err.Error(), "immature") {
+		t.Fatalf("got %v, want a block spending an immature coinbase rejected", err)
+	}
+
+	a3 := n.mine(a2, miner.Address)
+	n.add(a3)
+	if err := n.bc.CheckTransaction(spend); err != nil {
+		t.Fatalf("spend of a mature coinbase rejected: %v", err)
+	}
+	n.add(n.mine(a3, miner.Address, spend))
+	if n.bc.utxoSet.GetUTXO(spend.ID, 0) == nil {
+		t.Fatal("the spend of a mature coinbase wasn't connected")
+	}
+}
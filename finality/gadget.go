@@ -0,0 +1,326 @@
+// Package finality lets a fixed set of validators make blocks irreversible.
+//
+// Longest-chain fork choice never makes a block final: a branch with more
+// work can always replace it. On top of the consensus engine, validators
+// vote on checkpoint blocks, every CheckpointInterval blocks on the main
+// chain. Votes are gossiped to every node, and once two thirds of the
+// validators voted for the same checkpoint, each node finalizes it and
+// refuses to reorganize below it from then on.
+package finality
+
+import (
+	"context"
+	"crypto/ecdsa"
+	"errors"
+	"fmt"
+	"log"
+	"sort"
+	"sync"
+
+	"github.com/OhMyDitzzy/vulcan/core"
+	"github.com/OhMyDitzzy/vulcan/wallet"
+)
+
+// DefaultCheckpointInterval is the number of blocks between checkpoints
+// when none is configured.
+const DefaultCheckpointInterval = 10
+
+// maxFutureCheckpoints bounds how far above our tip votes are accepted, so
+// a validator can't make us hold votes for arbitrarily many heights.
+const maxFutureCheckpoints = 64
+
+var (
+	// ErrKnownVote is returned when adding a vote we already have.
+	ErrKnownVote = errors.New("vote already known")
+
+	// ErrStaleVote is returned when adding a vote for a checkpoint at or
+	// below the finalized one, which can no longer change anything.
+	ErrStaleVote = errors.New("vote for a checkpoint below the finalized block")
+)
+
+// Gadget collects checkpoint votes and finalizes checkpoints that reach a
+// quorum. If it is given the key of a validator, it also votes for every
+// checkpoint that makes it onto our main chain.
+//
+// A validator votes at most once per checkpoint height. Two votes from the
+// same validator for different blocks at the same height are rejected, so
+// two conflicting checkpoints can only both reach a quorum if a third of
+// the validators sign both.
+type Gadget struct {
+	blockchain *core.Blockchain
+	validators map[string]bool
+	interval   uint64
+	key        *ecdsa.PrivateKey // Our validator key, or nil if we don't vote
+	address    string            // Address of key
+
+	votes     map[uint64]map[string]*Vote // Unfinalized votes by height and validator
+	lastVoted uint64                      // Height of the last checkpoint we voted for
+	cancel    context.CancelFunc          // Stops the loop run by Start
+	mu        sync.Mutex
+}
+
+// Tally lists the validators that voted for a checkpoint.
+type Tally struct {
+	Height     uint64   `json:"height"`
+	Hash       string   `json:"hash"`
+	Validators []string `json:"validators"`
+}
+
+// NewGadget creates a finality gadget for the given validators, with a
+// checkpoint every interval blocks. If key is not nil, it must belong to
+// one of the validators, and the gadget votes with it.
+func NewGadget(bc *core.Blockchain, validators []string, interval uint64, key *ecdsa.PrivateKey) (*Gadget, error) {
+	if len(validators) == 0 {
+		return nil, fmt.Errorf("at least one validator is required")
+	}
+	if interval == 0 {
+		return nil, fmt.Errorf("checkpoint interval must be positive")
+	}
+
+	g := &Gadget{
+		blockchain: bc,
+		validators: make(map[string]bool),
+		interval:   interval,
+		key:        key,
+		votes:      make(map[uint64]map[string]*Vote),
+	}
+	for _, validator := range validators {
+		if _, err := wallet.AddressToPublicKey(validator); err != nil {
+			return nil, fmt.Errorf("invalid validator %s: %w", validator, err)
+		}
+		g.validators[validator] = true
+	}
+	if key != nil {
+		g.address = wallet.PublicKeyToAddress(&key.PublicKey)
+		if !g.validators[g.address] {
+			return nil, fmt.Errorf("key of %s is not a validator", g.address)
+		}
+	}
+
+	// We don't remember our votes across restarts, so never vote for a
+	// checkpoint that was already on the chain: we may have voted for a
+	// different block at its height before.
+	height := bc.GetHeight()
+	g.lastVoted = height - height%interval
+	return g, nil
+}
+
+// Interval returns the number of blocks between checkpoints.
+func (g *Gadget) Interval() uint64 {
+	return g.interval
+}
+
+// Address returns the address we vote as, or "" if we don't.
+func (g *Gadget) Address() string {
+	return g.address
+}
+
+// Validators returns the sorted validator addresses.
+func (g *Gadget) Validators() []string {
+	validators := make([]string, 0, len(g.validators))
+	for validator := range g.validators {
+		validators = append(validators, validator)
+	}
+	sort.Strings(validators)
+	return validators
+}
+
+// Quorum returns the number of votes that finalize a checkpoint: two
+// thirds of the validators, rounded up.
+func (g *Gadget) Quorum() int {
+	return (2*len(g.validators) + 2) / 3
+}
+
+// Pending returns the votes for checkpoints that aren't finalized yet,
+// ordered by height and hash.
+func (g *Gadget) Pending() []Tally {
+	g.mu.Lock()
+	defer g.mu.Unlock()
+
+	var tallies []Tally
+	for height := range g.votes {
+		tallies = append(tallies, g.tally(height)...)
+	}
+	sort.Slice(tallies, func(i, j int) bool {
+		if tallies[i].Height != tallies[j].Height {
+			return tallies[i].Height < tallies[j].Height
+		}
+		return tallies[i].Hash < tallies[j].Hash
+	})
+	return tallies
+}
+
+// AddVote checks a vote and records it, finalizing its checkpoint if the
+// vote completes a quorum. It returns ErrKnownVote or ErrStaleVote for votes
+// that add nothing, which must not be relayed.
+// A vote for a block we don't know yet is kept until the block arrives.
+func (g *Gadget) AddVote(vote *Vote) error {
+	g.mu.Lock()
+	defer g.mu.Unlock()
+	return g.addVote(vote)
+}
+
+func (g *Gadget) addVote(vote *Vote) error {
+	if chainID := g.blockchain.Params().ChainID; vote.ChainID != chainID {
+		return fmt.Errorf("vote is for chain %d, not %d", vote.ChainID, chainID)
+	}
+	if !g.validators[vote.Validator] {
+		return fmt.Errorf("%s is not a validator", vote.Validator)
+	}
+	if vote.Height == 0 || vote.Height%g.interval != 0 {
+		return fmt.Errorf("height %d is not a checkpoint", vote.Height)
+	}
+	if finalized := g.blockchain.GetFinalized(); finalized != nil && vote.Height <= finalized.Index {
+		return ErrStaleVote
+	}
+	if vote.Height > g.blockchain.GetHeight()+maxFutureCheckpoints*g.interval {
+		return fmt.Errorf("vote for height %d is too far ahead of our chain", vote.Height)
+	}
+
+	if block := g.blockchain.GetBlockByHash(vote.Hash); block != nil && block.Index != vote.Height {
+		return fmt.Errorf("block %s is at height %d, not %d", vote.Hash, block.Index, vote.Height)
+	}
+
+	existing := g.votes[vote.Height][vote.Validator]
+	if existing != nil && existing.Hash == vote.Hash {
+		return ErrKnownVote
+	}
+	if err := vote.Verify(); err != nil {
+		return err
+	}
+	if existing != nil {
+		return fmt.Errorf("validator %s already voted for block %s at height %d", vote.Validator, existing.Hash, vote.Height)
+	}
+
+	if g.votes[vote.Height] == nil {
+		g.votes[vote.Height] = make(map[string]*Vote)
+	}
+	g.votes[vote.Height][vote.Validator] = vote
+	g.tryFinalize(vote.Height)
+	return nil
+}
+
+// tally counts the votes for each block at a checkpoint height.
+func (g *Gadget) tally(height uint64) []Tally {
+	byHash := make(map[string][]string)
+	for validator, vote := range g.votes[height] {
+		byHash[vote.Hash] = append(byHash[vote.Hash], validator)
+	}
+
+	tallies := make([]Tally, 0, len(byHash))
+	for hash, validators := range byHash {
+		sort.Strings(validators)
+		tallies = append(tallies, Tally{Height: height, Hash: hash, Validators: validators})
+	}
+	return tallies
+}
+
+// tryFinalize finalizes the checkpoint at a height if a block there has a
+// quorum of votes and is known, and forgets the votes it makes stale.
+// Votes for a block that turns out not to be at their height finalize
+// nothing.
+func (g *Gadget) tryFinalize(height uint64) {
+	for _, tally := range g.tally(height) {
+		if len(tally.Validators) < g.Quorum() {
+			continue
+		}
+		block := g.blockchain.GetBlockByHash(tally.Hash)
+		if block == nil {
+			return
+		}
+		if block.Index != height {
+			log.Printf("Not finalizing block %s: it is at height %d, not %d", tally.Hash, block.Index, height)
+			continue
+		}
+		if err := g.blockchain.Finalize(tally.Hash); err != nil {
+			log.Printf("Failed to finalize block %d (%s): %v", height, tally.Hash, err)
+			return
+		}
+
+		for h := range g.votes {
+			if h <= height {
+				delete(g.votes, h)
+			}
+		}
+		return
+	}
+}
+
+// Start finalizes and votes for checkpoints as the chain grows, until Stop
+// is called. Our own votes are passed to broadcast to be gossiped to peers.
+func (g *Gadget) Start(broadcast func(*Vote)) {
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	g.mu.Lock()
+	g.cancel = cancel
+	g.mu.Unlock()
+
+	for {
+		tipChanged := g.blockchain.TipChanged()
+		if vote := g.update(); vote != nil {
+			broadcast(vote)
+		}
+
+		select {
+		case <-ctx.Done():
+			return
+		case <-tipChanged:
+		}
+	}
+}
+
+// Stop stops the loop run by Start.
+func (g *Gadget) Stop() {
+	g.mu.Lock()
+	defer g.mu.Unlock()
+	if g.cancel != nil {
+		g.cancel()
+	}
+}
+
+// update finalizes checkpoints whose blocks arrived after their votes, and
+// votes for the latest checkpoint on the main chain if we haven't yet.
+// It returns our new vote, if any.
+func (g *Gadget) update() *Vote {
+	g.mu.Lock()
+	defer g.mu.Unlock()
+
+	heights := make([]uint64, 0, len(g.votes))
+	for height := range g.votes {
+		heights = append(heights, height)
+	}
+	sort.Slice(heights, func(i, j int) bool { return heights[i] > heights[j] })
+	for _, height := range heights {
+		g.tryFinalize(height)
+	}
+
+	if g.key == nil {
+		return nil
+	}
+	tip := g.blockchain.GetHeight()
+	height := tip - tip%g.interval
+	if height == 0 || height <= g.lastVoted {
+		return nil
+	}
+	if finalized := g.blockchain.GetFinalized(); finalized != nil && height <= finalized.Index {
+		return nil
+	}
+	checkpoint := g.blockchain.GetBlock(height)
+	if checkpoint == nil {
+		return nil
+	}
+
+	vote, err := NewVote(g.blockchain.Params().ChainID, height, checkpoint.Hash, g.key)
+	if err != nil {
+		log.Printf("Failed to vote for block %d: %v", height, err)
+		return nil
+	}
+	g.lastVoted = height
+	if err := g.addVote(vote); err != nil {
+		log.Printf("Failed to add our vote for block %d: %v", height, err)
+		return nil
+	}
+	log.Printf("Voted to finalize block %d (%s)", height, checkpoint.Hash)
+	return vote
+}
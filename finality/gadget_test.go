@@ -0,0 +1,150 @@
+package finality
+
+import (
+	"context"
+	"errors"
+	"strings"
+	"testing"
+
+	"github.com/OhMyDitzzy/vulcan/chaincfg"
+	"github.com/OhMyDitzzy/vulcan/consensus"
+	"github.com/OhMyDitzzy/vulcan/core"
+	"github.com/OhMyDitzzy/vulcan/store"
+	"github.com/OhMyDitzzy/vulcan/types"
+	"github.com/OhMyDitzzy/vulcan/wallet"
+)
+
+// newTestChain returns a regtest blockchain in a temporary directory with
+// empty blocks up to height.
+func newTestChain(t *testing.T, height int) *core.Blockchain {
+	t.Helper()
+	db, err := store.NewBadgerStore(t.TempDir())
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { db.Close() })
+
+	params := &chaincfg.RegTestParams
+	engine := consensus.NewProofOfWork(params, 1)
+	bc := core.NewBlockchain(params, db, core.NewUTXOSet(params.CoinbaseMaturity), nil, engine)
+	if err := bc.Initialize(); err != nil {
+		t.Fatal(err)
+	}
+
+	miner := newWallet(t).Address
+	for i := 0; i < height; i++ {
+		parent := bc.GetLatestBlock()
+		block := core.NewBlock(parent.Index+1, nil, parent.Hash)
+		block.Timestamp = parent.Timestamp.Add(params.TargetBlockTime)
+		if err := engine.Prepare(bc, &block.BlockHeader); err != nil {
+			t.Fatal(err)
+		}
+		reward := engine.BlockReward(bc, &block.BlockHeader)
+		block.Transactions = []*types.Transaction{types.NewCoinbaseTransaction(params.ChainID, miner, reward)}
+		block.MerkleRoot = block.ComputeMerkleRoot()
+		if err := engine.Seal(context.Background(), bc, &block.BlockHeader); err != nil {
+			t.Fatal(err)
+		}
+		block.SetHash()
+		if err := bc.AddBlock(block); err != nil {
+			t.Fatalf("AddBlock(%d) failed: %v", block.Index, err)
+		}
+	}
+	return bc
+}
+
+func TestGadgetRejectsVotes(t *testing.T) {
+	bc := newTestChain(t, 4)
+	validators := []*wallet.Wallet{newWallet(t), newWallet(t), newWallet(t)}
+	g, err := NewGadget(bc, []string{validators[0].Address, validators[1].Address, validators[2].Address}, 2, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	chainID := bc.Params().ChainID
+	checkpoint := bc.GetBlock(2)
+
+	vote := func(w *wallet.Wallet, chainID uint32, height uint64, hash string) *Vote {
+		v, err := NewVote(chainID, height, hash, w.PrivateKey)
+		if err != nil {
+			t.Fatal(err)
+		}
+		return v
+	}
+	forged := vote(validators[0], chainID, 2, checkpoint.Hash)
+	forged.Hash = bc.GetBlock(4).Hash
+
+	tests := []struct {
+		name string
+		vote *Vote
+		want string
+	}{
+		{"other network", vote(validators[0], chainID+1, 2, checkpoint.Hash), "vote is for chain"},
+		{"not a validator", vote(newWallet(t), chainID, 2, checkpoint.Hash), "not a validator"},
+		{"not a checkpoint", vote(validators[0], chainID, 3, bc.GetBlock(3).Hash), "not a checkpoint"},
+		{"block at another height", vote(validators[0], chainID, 4, checkpoint.Hash), "at height 2, not 4"},
+		{"too far ahead", vote(validators[0], chainID, 4+2*(maxFutureCheckpoints+1), "ff"), "too far ahead"},
+		{"invalid signature", forged, ""},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			err := g.AddVote(tt.vote)
+			if err == nil || !strings.Contains(err.Error(), tt.want) {
+				t.Fatalf("got %v, want an error containing %q", err, tt.want)
+			}
+		})
+	}
+	if len(g.Pending()) != 0 {
+		t.Fatal("a rejected vote was kept")
+	}
+}
+
+func TestGadgetFinalizes(t *testing.T) {
+	bc := newTestChain(t, 4)
+	validators := []*wallet.Wallet{newWallet(t), newWallet(t), newWallet(t)}
+	g, err := NewGadget(bc, []string{validators[0].Address, validators[1].Address, validators[2].Address}, 2, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	chainID := bc.Params().ChainID
+	checkpoint := bc.GetBlock(4)
+
+	vote := func(w *wallet.Wallet, height uint64, hash string) *Vote {
+		v, err := NewVote(chainID, height, hash, w.PrivateKey)
+		if err != nil {
+			t.Fatal(err)
+		}
+		return v
+	}
+
+	first := vote(validators[0], 4, checkpoint.Hash)
+	if err := g.AddVote(first); err != nil {
+		t.Fatal(err)
+	}
+	if err := g.AddVote(first); !errors.Is(err, ErrKnownVote) {
+		t.Fatalf("got %v, want ErrKnownVote", err)
+	}
+	if err := g.AddVote(vote(validators[0], 4, "ff")); err == nil || !strings.Contains(err.Error(), "already voted") {
+		t.Fatalf("got %v, want a conflicting vote rejected", err)
+	}
+	if bc.GetFinalized() != nil {
+		t.Fatal("one of three votes finalized a checkpoint")
+	}
+
+	// A vote for an unknown block is kept, but doesn't count for the checkpoint
+	if err := g.AddVote(vote(validators[1], 4, "ff")); err != nil {
+		t.Fatal(err)
+	}
+	if err := g.AddVote(vote(validators[2], 4, checkpoint.Hash)); err != nil {
+		t.Fatal(err)
+	}
+	if finalized := bc.GetFinalized(); finalized == nil || finalized.Hash != checkpoint.Hash {
+		t.Fatal("two of three votes didn't finalize the checkpoint")
+	}
+
+	if err := g.AddVote(vote(validators[1], 2, bc.GetBlock(2).Hash)); !errors.Is(err, ErrStaleVote) {
+		t.Fatalf("got %v, want ErrStaleVote", err)
+	}
+	if len(g.Pending()) != 0 {
+		t.Fatal("votes for the finalized checkpoint are still pending")
+	}
+}
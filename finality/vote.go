@@ -0,0 +1,91 @@
+package finality
+
+import (
+	"crypto/ecdsa"
+	"crypto/sha256"
+	"fmt"
+
+	"github.com/OhMyDitzzy/vulcan/types"
+	"github.com/OhMyDitzzy/vulcan/wallet"
+)
+
+// Vote is a validator's signed vote to finalize a checkpoint block.
+type Vote struct {
+	ChainID   uint32 `json:"chain_id"`  // Chain the checkpoint is on
+	Height    uint64 `json:"height"`    // Checkpoint height
+	Hash      string `json:"hash"`      // Hash of the checkpoint block
+	Validator string `json:"validator"` // Address of the voting validator
+	Signature string `json:"signature"` // Validator's signature over SigningHash
+}
+
+// NewVote creates a vote for a checkpoint of the chain with the given ID,
+// signed with key.
+func NewVote(chainID uint32, height uint64, hash string, key *ecdsa.PrivateKey) (*Vote, error) {
+	vote := &Vote{
+		ChainID:   chainID,
+		Height:    height,
+		Hash:      hash,
+		Validator: wallet.PublicKeyToAddress(&key.PublicKey),
+	}
+	signature, err := wallet.Sign(vote.SigningHash(), key)
+	if err != nil {
+		return nil, fmt.Errorf("failed to sign vote: %w", err)
+	}
+	vote.Signature = signature
+	return vote, nil
+}
+
+// SigningHash returns the hash of the checkpoint a vote is for, which is
+// what the validator signs. It commits to the chain ID, so a vote can't be
+// replayed on another network the validator also votes on.
+func (v *Vote) SigningHash() []byte {
+	e := types.NewEncoder()
+	e.WriteUint32(v.ChainID)
+	e.WriteUint64(v.Height)
+	e.WriteString(v.Hash)
+	hash := sha256.Sum256(e.Bytes())
+	return hash[:]
+}
+
+// Verify checks the vote's signature against its validator's address.
+func (v *Vote) Verify() error {
+	pubKey, err := wallet.AddressToPublicKey(v.Validator)
+	if err != nil {
+		return fmt.Errorf("invalid validator: %w", err)
+	}
+	valid, err := wallet.Verify(v.SigningHash(), v.Signature, pubKey)
+	if err != nil {
+		return fmt.Errorf("invalid vote signature: %w", err)
+	}
+	if !valid {
+		return fmt.Errorf("vote signature verification failed")
+	}
+	return nil
+}
+
+// Serialize returns the canonical binary encoding of the vote.
+func (v *Vote) Serialize() []byte {
+	e := types.NewEncoder()
+	e.WriteUint32(v.ChainID)
+	e.WriteUint64(v.Height)
+	e.WriteString(v.Hash)
+	e.WriteString(v.Validator)
+	e.WriteString(v.Signature)
+	return e.Bytes()
+}
+
+// DeserializeVote decodes a vote produced by Serialize.
+func DeserializeVote(data []byte) (*Vote, error) {
+	d := types.NewDecoder(data)
+	v := &Vote{
+		ChainID:   d.ReadUint32(),
+		Height:    d.ReadUint64(),
+		Hash:      d.ReadString(),
+		Validator: d.ReadString(),
+		Signature: d.ReadString(),
+	}
+	if err := d.Finish(); err != nil {
+		return nil, fmt.Errorf("failed to decode vote: %w", err)
+	}
+	return v, nil
+}
@@ -0,0 +1,62 @@
+package finality
+
+import (
+	"bytes"
+	"reflect"
+	"testing"
+
+	"github.com/OhMyDitzzy/vulcan/wallet"
+)
+
+func newWallet(t *testing.T) *wallet.Wallet {
+	t.Helper()
+	w, err := wallet.NewWallet()
+	if err != nil {
+		t.Fatal(err)
+	}
+	return w
+}
+
+func TestVoteRoundTrip(t *testing.T) {
+	w := newWallet(t)
+
+	tests := []struct {
+		name    string
+		chainID uint32
+		height  uint64
+		hash    string
+	}{
+		{"first checkpoint", 1, 10, "00ab"},
+		{"high checkpoint", 42, 1 << 40, "ffee"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			vote, err := NewVote(tt.chainID, tt.height, tt.hash, w.PrivateKey)
+			if err != nil {
+				t.Fatalf("NewVote failed: %v", err)
+			}
+			data := vote.Serialize()
+
+			got, err := DeserializeVote(data)
+			if err != nil {
+				t.Fatalf("DeserializeVote failed: %v", err)
+			}
+			if !reflect.DeepEqual(got, vote) {
+				t.Fatalf("got %+v, want %+v", got, vote)
+			}
+			if err := got.Verify(); err != nil {
+				t.Fatalf("decoded vote doesn't verify: %v", err)
+			}
+
+			for n := 0; n < len(data); n++ {
+				if _, err := DeserializeVote(data[:n]); err == nil {
+					t.Errorf("decoding the first %d of %d bytes succeeded", n, len(data))
+				}
+			}
+			if _, err := DeserializeVote(append(bytes.Clone(data), 0)); err == nil {
+				t.Error("decoding with a trailing byte succeeded")
+			}
+		})
+	}
+}
@@ -1,6 +1,8 @@
 package miner
 
 import (
+	"context"
+	"errors"
 	"log"
 	"sync"
 	"time"
@@ -10,49 +12,70 @@ import (
 	"github.com/OhMyDitzzy/vulcan/txpool"
 )
 
+// ErrStaleTip is returned when mining is abandoned because another block
+// became the chain tip while we were still looking for a nonce.
+var ErrStaleTip = errors.New("chain tip changed while mining")
+
+// maxBlockTransactions is the most mempool transactions a mined block includes.
+const maxBlockTransactions = 100
+
 type Miner struct {
 	blockchain *core.Blockchain
 	mempool    *txpool.Mempool
-	pow        *consensus.ProofOfWork
+	engine     consensus.Engine
 	utxoSet    *core.UTXOSet
 	mining     bool
+	cancel     context.CancelFunc // Stops the block being mined by Start
 	mu         sync.Mutex
 }
 
-func NewMiner(bc *core.Blockchain, mp *txpool.Mempool, pow *consensus.ProofOfWork, utxo *core.UTXOSet) *Miner {
+func NewMiner(bc *core.Blockchain, mp *txpool.Mempool, engine consensus.Engine, utxo *core.UTXOSet) *Miner {
 	return &Miner{
 		blockchain: bc,
 		mempool:    mp,
-		pow:        pow,
+		engine:     engine,
 		utxoSet:    utxo,
 	}
 }
 
 func (m *Miner) Start(minerAddress string) {
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	
 	m.mu.Lock()
 	m.mining = true
+	m.cancel = cancel
 	m.mu.Unlock()
 	
 	log.Println("Miner started, waiting for transactions...")
 	
 	for m.IsMining() {
 		if m.mempool.Size() == 0 {
-			time.Sleep(5 * time.Second)
+			sleep(ctx, 5*time.Second)
 			continue
 		}
 		
-		if err := m.MineBlock(minerAddress); err != nil {
+		err := m.MineBlock(ctx, minerAddress)
+		if errors.Is(err, ErrStaleTip) {
+			log.Println("Chain tip changed, mining on the new tip")
+			continue
+		}
+		if err != nil && ctx.Err() == nil {
 			log.Printf("Mining failed: %v", err)
 		}
 		
-		time.Sleep(1 * time.Second)
+		sleep(ctx, 1*time.Second)
 	}
 }
 
+// Stop stops the mining loop, abandoning the block currently being mined.
 func (m *Miner) Stop() {
 	m.mu.Lock()
+	defer m.mu.Unlock()
 	m.mining = false
-	m.mu.Unlock()
+	if m.cancel != nil {
+		m.cancel()
+	}
 }
 
 func (m *Miner) IsMining() bool {
@@ -61,44 +84,84 @@ func (m *Miner) IsMining() bool {
 	return m.mining
 }
 
-func (m *Miner) MineBlock(minerAddress string) error {
-	txs := m.mempool.GetTransactions(100)
+// MineBlock produces a block on the current tip and adds it to the chain.
+// The consensus engine prepares the header, decides the block reward and
+// seals the block.
+// It gives up with the context's error if ctx is cancelled, and with
+// ErrStaleTip as soon as another block becomes the tip.
+func (m *Miner) MineBlock(ctx context.Context, minerAddress string) error {
+	// Take the notification channel first so a new tip can't slip in unseen
+	tipChanged := m.blockchain.TipChanged()
+	lastBlock := m.blockchain.GetLatestBlock()
+	
+	// Skip pending transactions whose inputs were spent since they were
+	// accepted, and keep those that are still time locked for later blocks
+	var txs []*types.Transaction
+	for _, tx := range m.mempool.GetTransactions(m.mempool.Size()) {
+		if len(txs) == maxBlockTransactions {
+			break
+		}
+		err := m.blockchain.CheckTransaction(tx)
+		if errors.Is(err, core.ErrNonFinal) {
+			continue
+		}
+		if err != nil {
+			log.Printf("Dropping transaction %s from mempool: %v", tx.ID, err)
+			m.mempool.RemoveTransaction(tx.ID)
+			continue
+		}
+		txs = append(txs, tx)
+	}
+	
+	newBlock := core.NewBlock(lastBlock.Index+1, nil, lastBlock.Hash)
+	if err := m.engine.Prepare(m.blockchain, &newBlock.BlockHeader); err != nil {
+		return err
+	}
 	
-	blockReward := uint64(50)
+	blockReward := m.engine.BlockReward(m.blockchain, &newBlock.BlockHeader)
 	totalFees := uint64(0)
 	for _, tx := range txs {
 		totalFees += tx.Fee
 	}
 	
-	coinbase := types.NewCoinbaseTransaction(minerAddress, blockReward+totalFees)
-	allTxs := append([]*types.Transaction{coinbase}, txs...)
-	
-	lastBlock := m.blockchain.GetLatestBlock()
-	newBlock := core.NewBlock(
-		m.blockchain.GetHeight()+1,
-		allTxs,
-		lastBlock.Hash,
-		m.pow.GetDifficulty(),
-	)
+	coinbase := types.NewCoinbaseTransaction(m.blockchain.Params().ChainID, minerAddress, blockReward+totalFees)
+	newBlock.Transactions = append([]*types.Transaction{coinbase}, txs...)
+	newBlock.MerkleRoot = newBlock.ComputeMerkleRoot()
 
-	if err := m.pow.Mine(newBlock); err != nil {
-		return err
+	ctx, cancel := context.WithCancel(ctx)
+	defer cancel()
+	go func() {
+		select {
+		case <-tipChanged:
+			cancel()
+		case <-ctx.Done():
+		}
+	}()
+
+	if err := m.engine.Seal(ctx, m.blockchain, &newBlock.BlockHeader); err != nil {
+		select {
+		case <-tipChanged:
+			return ErrStaleTip
+		default:
+			return err
+		}
 	}
+	newBlock.SetHash()
 
+	// AddBlock applies the block's transactions to the UTXO set
+	// and removes them from the mempool
 	if err := m.blockchain.AddBlock(newBlock); err != nil {
 		return err
 	}
 	
-	if err := m.utxoSet.Update(newBlock); err != nil {
-		log.Printf("Warning: Failed to update UTXO set: %v", err)
-		// We shouldn't return err here
-		// UTXO will be synced on next restart
-	}
-
-	for _, tx := range txs {
-		m.mempool.RemoveTransaction(tx.ID)
-	}
-	
 	log.Printf("Block %d mined successfully! Hash: %s", newBlock.Index, newBlock.Hash)
 	return nil
-}
\ No newline at end of file
+}
+
+// sleep waits for the given duration or until ctx is cancelled.
+func sleep(ctx context.Context, d time.Duration) {
+	select {
+	case <-ctx.Done():
+	case <-time.After(d):
+	}
+}
@@ -0,0 +1,69 @@
+package miner
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/OhMyDitzzy/vulcan/chaincfg"
+	"github.com/OhMyDitzzy/vulcan/consensus"
+	"github.com/OhMyDitzzy/vulcan/core"
+	"github.com/OhMyDitzzy/vulcan/store"
+	"github.com/OhMyDitzzy/vulcan/txpool"
+	"github.com/OhMyDitzzy/vulcan/types"
+)
+
+// stuckEngine is a Proof-of-Work engine that never finds a nonce: sealing
+// hashes against a target no test run reaches until the context is done.
+type stuckEngine struct {
+	*consensus.ProofOfWork
+	sealing chan struct{} // Closed once sealing started
+}
+
+func (e *stuckEngine) Seal(ctx context.Context, chain consensus.ChainReader, header *types.BlockHeader) error {
+	close(e.sealing)
+	hard := *header
+	hard.Bits = 0x03000001
+	return e.Mine(ctx, &hard)
+}
+
+func TestMineBlockStopsWhenTipChanges(t *testing.T) {
+	db, err := store.NewBadgerStore(t.TempDir())
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer db.Close()
+
+	params := &chaincfg.RegTestParams
+	pow := consensus.NewProofOfWork(params, 2)
+	utxoSet := core.NewUTXOSet(params.CoinbaseMaturity)
+	mempool := txpool.NewMempool()
+	bc := core.NewBlockchain(params, db, utxoSet, mempool, pow)
+	if err := bc.Initialize(); err != nil {
+		t.Fatal(err)
+	}
+
+	stuck := &stuckEngine{ProofOfWork: pow, sealing: make(chan struct{})}
+	done := make(chan error)
+	go func() {
+		done <- NewMiner(bc, mempool, stuck, utxoSet).MineBlock(context.Background(), "04beef")
+	}()
+
+	// Another miner finds a block first
+	<-stuck.sealing
+	if err := NewMiner(bc, mempool, pow, utxoSet).MineBlock(context.Background(), "04beef"); err != nil {
+		t.Fatal(err)
+	}
+	select {
+	case err := <-done:
+		if !errors.Is(err, ErrStaleTip) {
+			t.Fatalf("got %v, want ErrStaleTip", err)
+		}
+	case <-time.After(5 * time.Second):
+		t.Fatal("mining didn't stop when the tip changed")
+	}
+	if bc.GetHeight() != 1 {
+		t.Fatalf("height is %d, want 1", bc.GetHeight())
+	}
+}
@@ -2,37 +2,47 @@ package p2p
 
 import (
 	"bufio"
-	"encoding/json"
+	"errors"
 	"fmt"
+	"io"
 	"log"
 	"net"
 	"sync"
+	"github.com/OhMyDitzzy/vulcan/chaincfg"
+	"github.com/OhMyDitzzy/vulcan/consensus"
 	"github.com/OhMyDitzzy/vulcan/core"
+	"github.com/OhMyDitzzy/vulcan/finality"
 	"github.com/OhMyDitzzy/vulcan/types"
 	"github.com/OhMyDitzzy/vulcan/txpool"
 )
 
 type Node struct {
+	params     *chaincfg.Params
 	port       int
 	peers      []*Peer
 	blockchain *core.Blockchain
+	engine     consensus.Engine
 	mempool    *txpool.Mempool
+	finality   *finality.Gadget // nil when finality is disabled
 	listener   net.Listener
 	mu         sync.RWMutex
 	running    bool
 }
 
-func NewNode(port int, bc *core.Blockchain, mp *txpool.Mempool, bootstrapPeers []string) *Node {
+func NewNode(params *chaincfg.Params, port int, bc *core.Blockchain, mp *txpool.Mempool, engine consensus.Engine, gadget *finality.Gadget, bootstrapPeers []string) *Node {
 	node := &Node{
+		params:     params,
 		port:       port,
 		blockchain: bc,
+		engine:     engine,
 		mempool:    mp,
+		finality:   gadget,
 		peers:      make([]*Peer, 0),
 	}
 	
 	// Connect to bootstrap peers
 	for _, addr := range bootstrapPeers {
-		peer := NewPeer(addr)
+		peer := NewPeer(addr, params.Net)
 		if err := peer.Connect(); err != nil {
 			log.Printf("Failed to connect to peer %s: %v", addr, err)
 		} else {
@@ -83,39 +93,77 @@ func (n *Node) acceptConnections() {
 
 func (n *Node) handleConnection(conn net.Conn) {
 	defer conn.Close()
-	scanner := bufio.NewScanner(conn)
+	reader := bufio.NewReader(conn)
 	
-	for scanner.Scan() {
-		var msg Message
-		if err := json.Unmarshal(scanner.Bytes(), &msg); err != nil {
-			log.Printf("Failed to parse message: %v", err)
-			continue
+	for {
+		msg, err := readMessage(reader, n.params.Net)
+		if err != nil {
+			if err != io.EOF {
+				log.Printf("Dropping connection from %s: %v", conn.RemoteAddr(), err)
+			}
+			return
 		}
 		
-		n.handleMessage(&msg)
+		n.handleMessage(msg)
 	}
 }
 
 func (n *Node) handleMessage(msg *Message) {
+	// Only relay what we accepted, otherwise peers echo messages forever
 	switch msg.Type {
-	case "new_transaction":
-		var tx types.Transaction
-		if err := json.Unmarshal(msg.Data, &tx); err == nil {
-			n.mempool.AddTransaction(&tx)
-			n.BroadcastTransaction(&tx)
+	case MsgTransaction:
+		tx, err := types.DeserializeTransaction(msg.Data)
+		if err != nil {
+			log.Printf("Failed to parse transaction: %v", err)
+			return
+		}
+		err = n.blockchain.CheckTransaction(tx)
+		switch {
+		case err == nil:
+			err = n.mempool.AddTransaction(tx)
+		case errors.Is(err, core.ErrNonFinal):
+			err = n.mempool.HoldTransaction(tx)
+		}
+		if err == nil {
+			n.BroadcastTransaction(tx)
+		}
+	case MsgBlock:
+		block, err := core.DeserializeBlock(msg.Data)
+		if err != nil {
+			log.Printf("Failed to parse block: %v", err)
+			return
+		}
+		// Check the seal before taking the chain lock, so peers can't make
+		// us do full validation work for blocks nobody could have produced
+		if err := n.engine.VerifyHeader(n.blockchain, &block.BlockHeader); err != nil {
+			log.Printf("Rejected block %d (%s): %v", block.Index, block.Hash, err)
+			return
+		}
+		if err := n.blockchain.AddBlock(block); err != nil {
+			log.Printf("Rejected block %d (%s): %v", block.Index, block.Hash, err)
+			return
 		}
-	case "new_block":
-		var block core.Block
-		if err := json.Unmarshal(msg.Data, &block); err == nil {
-			n.blockchain.AddBlock(&block)
-			n.BroadcastBlock(&block)
+		n.BroadcastBlock(block)
+	case MsgVote:
+		if n.finality == nil {
+			return
 		}
+		vote, err := finality.DeserializeVote(msg.Data)
+		if err != nil {
+			log.Printf("Failed to parse vote: %v", err)
+			return
+		}
+		if err := n.finality.AddVote(vote); err != nil {
+			return
+		}
+		n.BroadcastVote(vote)
+	default:
+		log.Printf("Ignoring message of type %s", msg.Type)
 	}
 }
 
 func (n *Node) BroadcastTransaction(tx *types.Transaction) {
-	data, _ := json.Marshal(tx)
-	msg := &Message{Type: "new_transaction", Data: data}
+	msg := &Message{Type: MsgTransaction, Data: tx.Serialize()}
 	
 	for _, peer := range n.peers {
 		peer.SendMessage(msg)
@@ -123,8 +171,15 @@ func (n *Node) BroadcastTransaction(tx *types.Transaction) {
 }
 
 func (n *Node) BroadcastBlock(block *core.Block) {
-	data, _ := json.Marshal(block)
-	msg := &Message{Type: "new_block", Data: data}
+	msg := &Message{Type: MsgBlock, Data: block.Serialize()}
+	
+	for _, peer := range n.peers {
+		peer.SendMessage(msg)
+	}
+}
+
+func (n *Node) BroadcastVote(vote *finality.Vote) {
+	msg := &Message{Type: MsgVote, Data: vote.Serialize()}
 	
 	for _, peer := range n.peers {
 		peer.SendMessage(msg)
@@ -143,7 +198,7 @@ func (n *Node) GetPeers() []string {
 }
 
 func (n *Node) AddPeer(address string) error {
-	peer := NewPeer(address)
+	peer := NewPeer(address, n.params.Net)
 	if err := peer.Connect(); err != nil {
 		return err
 	}
@@ -0,0 +1,82 @@
+package p2p
+
+import (
+	"encoding/binary"
+	"fmt"
+	"io"
+)
+
+// MaxMessageSize bounds the payload of a single message, so a peer can't
+// make us allocate arbitrary amounts of memory with a forged length.
+const MaxMessageSize = 4 * 1024 * 1024
+
+// MessageType identifies what a message's payload contains.
+type MessageType uint8
+
+const (
+	MsgTransaction MessageType = 1 // Payload is a serialized transaction
+	MsgBlock       MessageType = 2 // Payload is a serialized block
+	MsgVote        MessageType = 3 // Payload is a serialized finality vote
+)
+
+func (t MessageType) String() string {
+	switch t {
+	case MsgTransaction:
+		return "transaction"
+	case MsgBlock:
+		return "block"
+	case MsgVote:
+		return "vote"
+	default:
+		return fmt.Sprintf("unknown(%d)", uint8(t))
+	}
+}
+
+// Message is a single message exchanged with a peer.
+// On the wire it is framed as the four-byte big-endian network magic, a
+// one-byte type, a four-byte big-endian payload length and the payload,
+// which uses the canonical binary encoding.
+type Message struct {
+	Type MessageType
+	Data []byte
+}
+
+// headerSize is the size of a message frame without the payload.
+const headerSize = 9
+
+func writeMessage(w io.Writer, net uint32, msg *Message) error {
+	if len(msg.Data) > MaxMessageSize {
+		return fmt.Errorf("message too large: %d bytes", len(msg.Data))
+	}
+
+	frame := make([]byte, headerSize, headerSize+len(msg.Data))
+	binary.BigEndian.PutUint32(frame[0:4], net)
+	frame[4] = byte(msg.Type)
+	binary.BigEndian.PutUint32(frame[5:9], uint32(len(msg.Data)))
+	frame = append(frame, msg.Data...)
+
+	_, err := w.Write(frame)
+	return err
+}
+
+// readMessage reads the next message, failing if it is for another network.
+func readMessage(r io.Reader, net uint32) (*Message, error) {
+	var header [headerSize]byte
+	if _, err := io.ReadFull(r, header[:]); err != nil {
+		return nil, err
+	}
+
+	if magic := binary.BigEndian.Uint32(header[0:4]); magic != net {
+		return nil, fmt.Errorf("message for another network (magic %08x)", magic)
+	}
+	length := binary.BigEndian.Uint32(header[5:9])
+	if length > MaxMessageSize {
+		return nil, fmt.Errorf("message too large: %d bytes", length)
+	}
+
+	data := make([]byte, length)
+	if _, err := io.ReadFull(r, data); err != nil {
+		return nil, err
+	}
+	return &Message{Type: MessageType(header[4]), Data: data}, nil
+}
@@ -0,0 +1,76 @@
+package p2p
+
+import (
+	"bytes"
+	"reflect"
+	"testing"
+)
+
+const testNet = 0x74657374
+
+func TestMessageRoundTrip(t *testing.T) {
+	tests := []struct {
+		name string
+		msg  *Message
+	}{
+		{"empty", &Message{Type: MsgTransaction, Data: []byte{}}},
+		{"block", &Message{Type: MsgBlock, Data: []byte("block")}},
+		{"vote", &Message{Type: MsgVote, Data: bytes.Repeat([]byte{7}, 1000)}},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var buf bytes.Buffer
+			if err := writeMessage(&buf, testNet, tt.msg); err != nil {
+				t.Fatalf("writeMessage failed: %v", err)
+			}
+			frame := buf.Bytes()
+
+			got, err := readMessage(bytes.NewReader(frame), testNet)
+			if err != nil {
+				t.Fatalf("readMessage failed: %v", err)
+			}
+			if !reflect.DeepEqual(got, tt.msg) {
+				t.Fatalf("got %+v, want %+v", got, tt.msg)
+			}
+
+			for n := 0; n < len(frame); n++ {
+				if _, err := readMessage(bytes.NewReader(frame[:n]), testNet); err == nil {
+					t.Errorf("reading the first %d of %d bytes succeeded", n, len(frame))
+				}
+			}
+
+			// Messages follow each other on a stream, so trailing bytes
+			// belong to the next message and must be left unread
+			r := bytes.NewReader(append(bytes.Clone(frame), 0xff))
+			if _, err := readMessage(r, testNet); err != nil {
+				t.Fatalf("readMessage failed: %v", err)
+			}
+			if r.Len() != 1 {
+				t.Fatalf("%d bytes left unread, want 1", r.Len())
+			}
+		})
+	}
+}
+
+func TestReadMessageRejectsOtherNetworks(t *testing.T) {
+	var buf bytes.Buffer
+	if err := writeMessage(&buf, testNet, &Message{Type: MsgBlock, Data: []byte{1}}); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := readMessage(&buf, testNet+1); err == nil {
+		t.Fatal("reading a message for another network succeeded")
+	}
+}
+
+func TestMessageSizeLimit(t *testing.T) {
+	msg := &Message{Type: MsgBlock, Data: make([]byte, MaxMessageSize+1)}
+	if err := writeMessage(&bytes.Buffer{}, testNet, msg); err == nil {
+		t.Fatal("writing an oversized message succeeded")
+	}
+
+	frame := []byte{0x74, 0x65, 0x73, 0x74, byte(MsgBlock), 0xff, 0xff, 0xff, 0xff}
+	if _, err := readMessage(bytes.NewReader(frame), testNet); err == nil {
+		t.Fatal("reading an oversized message succeeded")
+	}
+}
@@ -1,7 +1,6 @@
 package p2p
 
 import (
-	"encoding/json"
 	"fmt"
 	"net"
 	"sync"
@@ -9,12 +8,13 @@ import (
 
 type Peer struct {
 	Address string
+	net     uint32 // Network magic of our messages
 	conn    net.Conn
 	mu      sync.Mutex
 }
 
-func NewPeer(address string) *Peer {
-	return &Peer{Address: address}
+func NewPeer(address string, net uint32) *Peer {
+	return &Peer{Address: address, net: net}
 }
 
 func (p *Peer) Connect() error {
@@ -34,13 +34,7 @@ func (p *Peer) SendMessage(msg *Message) error {
 		return fmt.Errorf("not connected")
 	}
 	
-	data, err := json.Marshal(msg)
-	if err != nil {
-		return err
-	}
-	
-	_, err = p.conn.Write(append(data, '\n'))
-	return err
+	return writeMessage(p.conn, p.net, msg)
 }
 
 func (p *Peer) Close() error {
@@ -48,9 +42,4 @@ func (p *Peer) Close() error {
 		return p.conn.Close()
 	}
 	return nil
-}
-
-type Message struct {
-	Type string          `json:"type"`
-	Data json.RawMessage `json:"data"`
 }
\ No newline at end of file
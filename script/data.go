@@ -0,0 +1,37 @@
+package script
+
+import "fmt"
+
+// MaxDataSize is the most data a data output carries: enough for a hash of
+// a document and some context, without turning the chain into file storage.
+const MaxDataSize = 80
+
+// DataScript returns the locking script of a data output carrying data:
+//
+//	OP_RETURN <data>
+//
+// The script fails as soon as it runs, so the output can never be spent.
+func DataScript(data []byte) ([]byte, error) {
+	if len(data) == 0 || len(data) > MaxDataSize {
+		return nil, fmt.Errorf("data output carries 1 to %d bytes, got %d", MaxDataSize, len(data))
+	}
+	return NewBuilder().AddOp(OP_RETURN).AddData(data).Script(), nil
+}
+
+// ExtractData returns the data carried by the locking script of a data
+// output, and fails unless the script is one DataScript builds.
+func ExtractData(lock []byte) ([]byte, error) {
+	instructions, err := Parse(lock)
+	if err != nil {
+		return nil, err
+	}
+	if len(instructions) != 2 || instructions[0].Op != OP_RETURN || !isPush(instructions[1].Op) {
+		return nil, fmt.Errorf("data output must push its data after OP_RETURN")
+	}
+
+	data := PushedData(instructions[1])
+	if len(data) == 0 || len(data) > MaxDataSize {
+		return nil, fmt.Errorf("data output carries 1 to %d bytes, got %d", MaxDataSize, len(data))
+	}
+	return data, nil
+}
@@ -0,0 +1,420 @@
+package script
+
+import (
+	"bytes"
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+
+	"github.com/OhMyDitzzy/vulcan/types"
+	"github.com/OhMyDitzzy/vulcan/wallet"
+)
+
+// Evaluation limits. Every executed opcode costs one unit and every
+// signature check SigCheckCost, so the work a single input can cause is
+// bounded no matter how its scripts are written.
+const (
+	MaxCost        = 1000 // Cost budget of verifying one input
+	SigCheckCost   = 50   // Cost of a signature check
+	MaxStackSize   = 100  // Maximum number of stack elements
+	MaxElementSize = 520  // Maximum size of a stack element
+)
+
+// Verify checks that an unlocking script satisfies a locking script, for
+// input inputIndex of tx. The unlocking script may only push data. The
+// locking script then runs on the stack it leaves, and must leave exactly
+// one element, which must be true.
+//
+// Signature checks verify signatures over tx.DataToSign(inputIndex), which
+// doesn't cover unlocking scripts, so signatures can be put into them
+// after signing.
+func Verify(unlock, lock []byte, tx *types.Transaction, inputIndex int) error {
+	if len(unlock) > types.MaxScriptSize || len(lock) > types.MaxScriptSize {
+		return fmt.Errorf("script exceeds %d bytes", types.MaxScriptSize)
+	}
+	if !IsPushOnly(unlock) {
+		return fmt.Errorf("unlocking script must only push data")
+	}
+
+	vm := &engine{tx: tx, inputIndex: inputIndex}
+	if err := vm.run(unlock); err != nil {
+		return fmt.Errorf("unlocking script failed: %w", err)
+	}
+	if err := vm.run(lock); err != nil {
+		return fmt.Errorf("locking script failed: %w", err)
+	}
+
+	if len(vm.stack) != 1 {
+		return fmt.Errorf("script left %d stack elements, expected 1", len(vm.stack))
+	}
+	if !asBool(vm.stack[0]) {
+		return fmt.Errorf("script evaluated to false")
+	}
+	return nil
+}
+
+// engine is the state of a script evaluation.
+type engine struct {
+	tx         *types.Transaction
+	inputIndex int
+
+	stack [][]byte
+	cond  []bool // Whether each enclosing IF branch is being executed
+	cost  int
+}
+
+// executing reports whether the current branch is executed.
+func (vm *engine) executing() bool {
+	for _, c := range vm.cond {
+		if !c {
+			return false
+		}
+	}
+	return true
+}
+
+func (vm *engine) run(script []byte) error {
+	instructions, err := Parse(script)
+	if err != nil {
+		return err
+	}
+	vm.cond = nil
+
+	for _, in := range instructions {
+		if err := vm.charge(1); err != nil {
+			return err
+		}
+		if err := vm.step(in); err != nil {
+			return fmt.Errorf("%s: %w", opName(in), err)
+		}
+		if len(vm.stack) > MaxStackSize {
+			return fmt.Errorf("stack exceeds %d elements", MaxStackSize)
+		}
+	}
+
+	if len(vm.cond) != 0 {
+		return fmt.Errorf("unbalanced conditional")
+	}
+	return nil
+}
+
+func opName(in Instruction) string {
+	if in.Data != nil && in.Op <= OP_PUSHDATA2 {
+		return fmt.Sprintf("push of %d bytes", len(in.Data))
+	}
+	return opcodeNames[in.Op]
+}
+
+func (vm *engine) charge(cost int) error {
+	vm.cost += cost
+	if vm.cost > MaxCost {
+		return fmt.Errorf("script exceeds the cost limit of %d", MaxCost)
+	}
+	return nil
+}
+
+// step executes one instruction.
+func (vm *engine) step(in Instruction) error {
+	// Conditionals are tracked even in branches that aren't executed
+	switch in.Op {
+	case OP_IF, OP_NOTIF:
+		branch := false
+		if vm.executing() {
+			top, err := vm.pop()
+			if err != nil {
+				return err
+			}
+			branch = asBool(top) == (in.Op == OP_IF)
+		}
+		vm.cond = append(vm.cond, branch)
+		return nil
+	case OP_ELSE:
+		if len(vm.cond) == 0 {
+			return fmt.Errorf("no matching OP_IF")
+		}
+		vm.cond[len(vm.cond)-1] = !vm.cond[len(vm.cond)-1]
+		return nil
+	case OP_ENDIF:
+		if len(vm.cond) == 0 {
+			return fmt.Errorf("no matching OP_IF")
+		}
+		vm.cond = vm.cond[:len(vm.cond)-1]
+		return nil
+	}
+	if !vm.executing() {
+		return nil
+	}
+
+	switch {
+	case in.Op == OP_0:
+		return vm.push(nil)
+	case in.Op == OP_1NEGATE:
+		return vm.push(encodeNum(-1))
+	case isSmallInt(in.Op):
+		return vm.push(encodeNum(int64(in.Op - OP_1 + 1)))
+	case in.Op <= OP_PUSHDATA2:
+		return vm.push(in.Data)
+	}
+
+	switch in.Op {
+	case OP_NOP:
+		return nil
+	case OP_VERIFY:
+		return vm.verify()
+	case OP_RETURN:
+		return fmt.Errorf("output is unspendable")
+
+	case OP_DROP:
+		_, err := vm.pop()
+		return err
+	case OP_DUP:
+		top, err := vm.peek(0)
+		if err != nil {
+			return err
+		}
+		return vm.push(top)
+	case OP_SWAP:
+		a, err := vm.pop()
+		if err != nil {
+			return err
+		}
+		b, err := vm.pop()
+		if err != nil {
+			return err
+		}
+		vm.stack = append(vm.stack, a, b)
+		return nil
+	case OP_SIZE:
+		top, err := vm.peek(0)
+		if err != nil {
+			return err
+		}
+		return vm.push(encodeNum(int64(len(top))))
+
+	case OP_EQUAL, OP_EQUALVERIFY:
+		a, err := vm.pop()
+		if err != nil {
+			return err
+		}
+		b, err := vm.pop()
+		if err != nil {
+			return err
+		}
+		vm.pushBool(bytes.Equal(a, b))
+		if in.Op == OP_EQUALVERIFY {
+			return vm.verify()
+		}
+		return nil
+
+	case OP_NUMEQUAL, OP_NUMEQUALVERIFY, OP_LESSTHAN, OP_GREATERTHAN, OP_LESSTHANOREQUAL, OP_GREATERTHANOREQUAL:
+		b, err := vm.popNum()
+		if err != nil {
+			return err
+		}
+		a, err := vm.popNum()
+		if err != nil {
+			return err
+		}
+		switch in.Op {
+		case OP_NUMEQUAL:
+			vm.pushBool(a == b)
+		case OP_NUMEQUALVERIFY:
+			vm.pushBool(a == b)
+			return vm.verify()
+		case OP_LESSTHAN:
+			vm.pushBool(a < b)
+		case OP_GREATERTHAN:
+			vm.pushBool(a > b)
+		case OP_LESSTHANOREQUAL:
+			vm.pushBool(a <= b)
+		case OP_GREATERTHANOREQUAL:
+			vm.pushBool(a >= b)
+		}
+		return nil
+
+	case OP_SHA256:
+		top, err := vm.pop()
+		if err != nil {
+			return err
+		}
+		hash := sha256.Sum256(top)
+		return vm.push(hash[:])
+
+	case OP_CHECKSIG, OP_CHECKSIGVERIFY:
+		if err := vm.charge(SigCheckCost); err != nil {
+			return err
+		}
+		pubKey, err := vm.pop()
+		if err != nil {
+			return err
+		}
+		sig, err := vm.pop()
+		if err != nil {
+			return err
+		}
+		vm.pushBool(vm.checkSig(sig, pubKey))
+		if in.Op == OP_CHECKSIGVERIFY {
+			return vm.verify()
+		}
+		return nil
+
+	case OP_CHECKMULTISIG, OP_CHECKMULTISIGVERIFY:
+		valid, err := vm.checkMultisig()
+		if err != nil {
+			return err
+		}
+		vm.pushBool(valid)
+		if in.Op == OP_CHECKMULTISIGVERIFY {
+			return vm.verify()
+		}
+		return nil
+
+	case OP_CHECKLOCKTIMEVERIFY:
+		return vm.checkLockTime()
+	}
+
+	return fmt.Errorf("invalid opcode")
+}
+
+// checkSig reports whether sig is a valid signature of the input by the
+// uncompressed public key pubKey. Malformed keys and signatures are
+// treated as invalid signatures, so a script can check for failure.
+func (vm *engine) checkSig(sig, pubKey []byte) bool {
+	if len(sig) == 0 {
+		return false
+	}
+	key, err := wallet.AddressToPublicKey(hex.EncodeToString(pubKey))
+	if err != nil {
+		return false
+	}
+	valid, err := wallet.Verify(vm.tx.DataToSign(vm.inputIndex), hex.EncodeToString(sig), key)
+	return err == nil && valid
+}
+
+// checkMultisig pops n, n public keys, m and m signatures, and reports
+// whether each signature is valid for a different key. Signatures must be
+// in the same order as the keys they sign for, so every key is checked at
+// most once; each key is charged as a signature check.
+func (vm *engine) checkMultisig() (bool, error) {
+	n, err := vm.popNum()
+	if err != nil {
+		return false, err
+	}
+	if n < 0 || n > MaxMultisigKeys {
+		return false, fmt.Errorf("%d keys, at most %d are allowed", n, MaxMultisigKeys)
+	}
+	if err := vm.charge(int(n) * SigCheckCost); err != nil {
+		return false, err
+	}
+	pubKeys := make([][]byte, n)
+	for i := n - 1; i >= 0; i-- {
+		if pubKeys[i], err = vm.pop(); err != nil {
+			return false, err
+		}
+	}
+
+	m, err := vm.popNum()
+	if err != nil {
+		return false, err
+	}
+	if m < 0 || m > n {
+		return false, fmt.Errorf("%d signatures required of %d keys", m, n)
+	}
+	sigs := make([][]byte, m)
+	for i := m - 1; i >= 0; i-- {
+		if sigs[i], err = vm.pop(); err != nil {
+			return false, err
+		}
+	}
+
+	for _, pubKey := range pubKeys {
+		if len(sigs) == 0 {
+			break
+		}
+		if vm.checkSig(sigs[0], pubKey) {
+			sigs = sigs[1:]
+		}
+	}
+	return len(sigs) == 0, nil
+}
+
+// checkLockTime fails unless the transaction's lock time is at least the
+// lock time on top of the stack, and of the same kind: both block heights,
+// or both Unix times (see types.LockTimeThreshold). Blocks only include
+// transactions whose lock time has passed, so the output can't be spent
+// before the stack's lock time either. Like in Bitcoin, the lock time is
+// left on the stack.
+func (vm *engine) checkLockTime() error {
+	top, err := vm.peek(0)
+	if err != nil {
+		return err
+	}
+	lockTime, err := decodeNum(top)
+	if err != nil {
+		return err
+	}
+	if lockTime < 0 {
+		return fmt.Errorf("negative lock time")
+	}
+
+	txLockTime := int64(vm.tx.LockTime)
+	if (lockTime < types.LockTimeThreshold) != (txLockTime < types.LockTimeThreshold) {
+		return fmt.Errorf("transaction lock time %d is not of the same kind as %d", txLockTime, lockTime)
+	}
+	if txLockTime < lockTime {
+		return fmt.Errorf("transaction lock time %d is before %d", txLockTime, lockTime)
+	}
+	return nil
+}
+
+func (vm *engine) push(data []byte) error {
+	if len(data) > MaxElementSize {
+		return fmt.Errorf("element of %d bytes exceeds %d", len(data), MaxElementSize)
+	}
+	vm.stack = append(vm.stack, data)
+	return nil
+}
+
+func (vm *engine) pushBool(b bool) {
+	if b {
+		vm.stack = append(vm.stack, []byte{1})
+	} else {
+		vm.stack = append(vm.stack, nil)
+	}
+}
+
+func (vm *engine) peek(depth int) ([]byte, error) {
+	if depth >= len(vm.stack) {
+		return nil, fmt.Errorf("stack underflow")
+	}
+	return vm.stack[len(vm.stack)-1-depth], nil
+}
+
+func (vm *engine) pop() ([]byte, error) {
+	top, err := vm.peek(0)
+	if err != nil {
+		return nil, err
+	}
+	vm.stack = vm.stack[:len(vm.stack)-1]
+	return top, nil
+}
+
+func (vm *engine) popNum() (int64, error) {
+	top, err := vm.pop()
+	if err != nil {
+		return 0, err
+	}
+	return decodeNum(top)
+}
+
+// verify pops the top element and fails unless it is true.
+func (vm *engine) verify() error {
+	top, err := vm.pop()
+	if err != nil {
+		return err
+	}
+	if !asBool(top) {
+		return fmt.Errorf("verification failed")
+	}
+	return nil
+}
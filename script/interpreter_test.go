@@ -0,0 +1,207 @@
+package script
+
+import (
+	"bytes"
+	"crypto/ecdsa"
+	"crypto/sha256"
+	"encoding/hex"
+	"strings"
+	"testing"
+
+	"github.com/OhMyDitzzy/vulcan/types"
+	"github.com/OhMyDitzzy/vulcan/wallet"
+)
+
+// testTx returns a transaction with one input to verify scripts against.
+func testTx(lockTime uint32) *types.Transaction {
+	tx := types.NewTransaction(1, "", []types.OutPoint{{TxID: "aa11"}}, []types.TxOutput{{Amount: 10, Address: "04beef"}}, 1)
+	tx.LockTime = lockTime
+	return tx
+}
+
+func newKey(t *testing.T) *ecdsa.PrivateKey {
+	t.Helper()
+	key, err := wallet.GenerateKeyPair()
+	if err != nil {
+		t.Fatal(err)
+	}
+	return key
+}
+
+func pubKeyBytes(key *ecdsa.PrivateKey) []byte {
+	data, _ := hex.DecodeString(wallet.PublicKeyToAddress(&key.PublicKey))
+	return data
+}
+
+// signInput signs input i of tx with key, as a signature check expects.
+func signInput(t *testing.T, key *ecdsa.PrivateKey, tx *types.Transaction, i int) []byte {
+	t.Helper()
+	sigHex, err := wallet.Sign(tx.DataToSign(i), key)
+	if err != nil {
+		t.Fatal(err)
+	}
+	sig, _ := hex.DecodeString(sigHex)
+	return sig
+}
+
+func mustAssemble(t *testing.T, text string) []byte {
+	t.Helper()
+	script, err := Assemble(text)
+	if err != nil {
+		t.Fatalf("Assemble(%q) failed: %v", text, err)
+	}
+	return script
+}
+
+func TestVerify(t *testing.T) {
+	preimage := []byte("secret")
+	hash := sha256.Sum256(preimage)
+	hashLock := "OP_SHA256 " + hex.EncodeToString(hash[:]) + " OP_EQUAL"
+
+	tests := []struct {
+		name     string
+		unlock   string
+		lock     string
+		lockTime uint32
+		wantErr  string // Empty if the scripts must succeed
+	}{
+		{name: "true", unlock: "", lock: "OP_1"},
+		{name: "false", unlock: "", lock: "OP_0", wantErr: "false"},
+		{name: "extra element", unlock: "OP_1", lock: "OP_1", wantErr: "2 stack elements"},
+		{name: "empty stack", unlock: "", lock: "", wantErr: "0 stack elements"},
+		{name: "hash lock", unlock: hex.EncodeToString(preimage), lock: hashLock},
+		{name: "wrong preimage", unlock: "00ff", lock: hashLock, wantErr: "false"},
+		{name: "less than", unlock: "OP_2 OP_3", lock: "OP_LESSTHAN"},
+		{name: "swap", unlock: "OP_2 OP_3", lock: "OP_SWAP OP_LESSTHAN", wantErr: "false"},
+		{name: "greater than", unlock: "OP_3 OP_2", lock: "OP_GREATERTHAN"},
+		{name: "numeric equality", unlock: "OP_16", lock: "10 OP_NUMEQUAL"},
+		{name: "size", unlock: "aabbcc", lock: "OP_SIZE OP_3 OP_NUMEQUALVERIFY OP_DROP OP_1"},
+		{name: "if branch", unlock: "OP_1", lock: "OP_IF OP_1 OP_ELSE OP_0 OP_ENDIF"},
+		{name: "else branch", unlock: "OP_0", lock: "OP_IF OP_0 OP_ELSE OP_1 OP_ENDIF"},
+		{name: "notif", unlock: "OP_0", lock: "OP_NOTIF OP_1 OP_ENDIF"},
+		{name: "skipped failure", unlock: "OP_0", lock: "OP_IF OP_RETURN OP_ENDIF OP_1"},
+		{name: "nested skip", unlock: "OP_0", lock: "OP_IF OP_1 OP_IF OP_RETURN OP_ENDIF OP_ENDIF OP_1"},
+		{name: "unbalanced if", unlock: "OP_1", lock: "OP_IF OP_1", wantErr: "unbalanced"},
+		{name: "stray else", unlock: "", lock: "OP_ELSE OP_1", wantErr: "no matching OP_IF"},
+		{name: "return", unlock: "", lock: "OP_RETURN", wantErr: "unspendable"},
+		{name: "underflow", unlock: "", lock: "OP_DROP OP_1", wantErr: "underflow"},
+		{name: "verify failure", unlock: "OP_0", lock: "OP_VERIFY OP_1", wantErr: "verification failed"},
+		{name: "not push only", unlock: "OP_1 OP_DROP", lock: "OP_1", wantErr: "only push data"},
+		{name: "non-minimal number", unlock: "0100", lock: "OP_1 OP_NUMEQUAL", wantErr: "minimally"},
+		{name: "height lock", unlock: "", lock: "64 OP_CHECKLOCKTIMEVERIFY", lockTime: 100},
+		{name: "height lock too early", unlock: "", lock: "64 OP_CHECKLOCKTIMEVERIFY", lockTime: 99, wantErr: "before"},
+		{name: "time lock against height", unlock: "", lock: "0065cd1d OP_CHECKLOCKTIMEVERIFY", lockTime: 100, wantErr: "same kind"},
+		{name: "negative lock time", unlock: "", lock: "OP_1NEGATE OP_CHECKLOCKTIMEVERIFY", lockTime: 100, wantErr: "negative"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			unlock, lock := mustAssemble(t, tt.unlock), mustAssemble(t, tt.lock)
+			err := Verify(unlock, lock, testTx(tt.lockTime), 0)
+			switch {
+			case tt.wantErr == "" && err != nil:
+				t.Fatalf("Verify failed: %v", err)
+			case tt.wantErr != "" && err == nil:
+				t.Fatalf("Verify succeeded, want an error containing %q", tt.wantErr)
+			case tt.wantErr != "" && !strings.Contains(err.Error(), tt.wantErr):
+				t.Fatalf("got error %q, want one containing %q", err, tt.wantErr)
+			}
+		})
+	}
+}
+
+func TestVerifyCheckSig(t *testing.T) {
+	key, other := newKey(t), newKey(t)
+	tx := testTx(0)
+	lock := NewBuilder().AddData(pubKeyBytes(key)).AddOp(OP_CHECKSIG).Script()
+
+	sig := signInput(t, key, tx, 0)
+	if err := Verify(NewBuilder().AddData(sig).Script(), lock, tx, 0); err != nil {
+		t.Fatalf("valid signature rejected: %v", err)
+	}
+
+	tests := map[string][]byte{
+		"other key":   signInput(t, other, tx, 0),
+		"other input": signInput(t, key, tx, 1),
+		"empty":       nil,
+		"malformed":   {0x30, 0x01},
+	}
+	for name, sig := range tests {
+		t.Run(name, func(t *testing.T) {
+			if err := Verify(NewBuilder().AddData(sig).Script(), lock, tx, 0); err == nil {
+				t.Fatal("invalid signature accepted")
+			}
+		})
+	}
+
+	// Changing the transaction invalidates the signature
+	changed := testTx(0)
+	changed.Outputs[0].Amount++
+	if err := Verify(NewBuilder().AddData(sig).Script(), lock, changed, 0); err == nil {
+		t.Fatal("signature of another transaction accepted")
+	}
+}
+
+func TestVerifyCostLimit(t *testing.T) {
+	// Every executed opcode costs one unit
+	unlock := []byte{OP_1}
+	withinLimit := bytes.Repeat([]byte{OP_NOP}, MaxCost-1)
+	if err := Verify(unlock, withinLimit, testTx(0), 0); err != nil {
+		t.Fatalf("script costing exactly %d rejected: %v", MaxCost, err)
+	}
+	overLimit := bytes.Repeat([]byte{OP_NOP}, MaxCost)
+	if err := Verify(unlock, overLimit, testTx(0), 0); err == nil || !strings.Contains(err.Error(), "cost limit") {
+		t.Fatalf("got %v, want a cost limit error", err)
+	}
+
+	// Signature checks cost SigCheckCost each, even when they fail
+	checks := func(n int) []byte {
+		b := NewBuilder()
+		for i := 0; i < n; i++ {
+			b.AddOp(OP_0).AddOp(OP_0).AddOp(OP_CHECKSIG).AddOp(OP_DROP)
+		}
+		return b.AddOp(OP_1).Script()
+	}
+	perCheck := 4 + SigCheckCost
+	if err := Verify(nil, checks(MaxCost/perCheck), testTx(0), 0); err != nil {
+		t.Fatalf("%d signature checks rejected: %v", MaxCost/perCheck, err)
+	}
+	if err := Verify(nil, checks(MaxCost/perCheck+1), testTx(0), 0); err == nil || !strings.Contains(err.Error(), "cost limit") {
+		t.Fatalf("got %v, want a cost limit error", err)
+	}
+
+	// Multisig checks are charged per key, before any signature is checked
+	b := NewBuilder()
+	for i := 0; i < 3; i++ {
+		b.AddOp(OP_0).AddOp(OP_0)
+		for k := 0; k < MaxMultisigKeys; k++ {
+			b.AddOp(OP_0)
+		}
+		b.AddInt(MaxMultisigKeys).AddOp(OP_CHECKMULTISIG).AddOp(OP_DROP)
+	}
+	b.AddOp(OP_1)
+	if err := Verify(nil, b.Script(), testTx(0), 0); err == nil || !strings.Contains(err.Error(), "cost limit") {
+		t.Fatalf("got %v, want a cost limit error", err)
+	}
+}
+
+func TestVerifyStackLimits(t *testing.T) {
+	full := bytes.Repeat([]byte{OP_1}, MaxStackSize)
+	drops := append(bytes.Repeat([]byte{OP_DROP}, MaxStackSize-1), OP_1, OP_NUMEQUAL)
+	if err := Verify(full, drops, testTx(0), 0); err != nil {
+		t.Fatalf("%d stack elements rejected: %v", MaxStackSize, err)
+	}
+	if err := Verify(append(full, OP_1), drops, testTx(0), 0); err == nil || !strings.Contains(err.Error(), "stack exceeds") {
+		t.Fatalf("got %v, want a stack size error", err)
+	}
+
+	large := NewBuilder().AddData(make([]byte, MaxElementSize+1)).Script()
+	if err := Verify(large, []byte{OP_DROP, OP_1}, testTx(0), 0); err == nil || !strings.Contains(err.Error(), "exceeds") {
+		t.Fatalf("got %v, want an element size error", err)
+	}
+
+	oversized := bytes.Repeat([]byte{OP_NOP}, types.MaxScriptSize+1)
+	if err := Verify(nil, oversized, testTx(0), 0); err == nil || !strings.Contains(err.Error(), "exceeds") {
+		t.Fatalf("got %v, want a script size error", err)
+	}
+}
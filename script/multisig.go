@@ -0,0 +1,120 @@
+package script
+
+import (
+	"encoding/hex"
+	"fmt"
+	"sort"
+
+	"github.com/OhMyDitzzy/vulcan/types"
+	"github.com/OhMyDitzzy/vulcan/wallet"
+)
+
+// MaxMultisigKeys is the most keys OP_CHECKMULTISIG checks. An input
+// spending a multisig address carries a signature per required key and the
+// script with every key, and with up to 7 keys that always fits in
+// types.MaxScriptSize.
+const MaxMultisigKeys = 7
+
+// MultisigScript returns the script that requires signatures by threshold
+// of the given public keys:
+//
+//	<threshold> <pubkey>... <n> OP_CHECKMULTISIG
+//
+// The keys are sorted first, so the same keys and threshold always give the
+// same script, and with it the same address.
+func MultisigScript(threshold int, pubKeys []string) ([]byte, error) {
+	if len(pubKeys) == 0 || len(pubKeys) > MaxMultisigKeys {
+		return nil, fmt.Errorf("multisig needs 1 to %d keys, got %d", MaxMultisigKeys, len(pubKeys))
+	}
+	if threshold < 1 || threshold > len(pubKeys) {
+		return nil, fmt.Errorf("threshold must be between 1 and %d, got %d", len(pubKeys), threshold)
+	}
+
+	sorted := append([]string(nil), pubKeys...)
+	sort.Strings(sorted)
+
+	b := NewBuilder().AddInt(int64(threshold))
+	for i, pubKey := range sorted {
+		if i > 0 && pubKey == sorted[i-1] {
+			return nil, fmt.Errorf("duplicate key %s", pubKey)
+		}
+		if _, err := wallet.AddressToPublicKey(pubKey); err != nil {
+			return nil, fmt.Errorf("invalid key %s: %w", pubKey, err)
+		}
+		data, _ := hex.DecodeString(pubKey)
+		b.AddData(data)
+	}
+	b.AddInt(int64(len(sorted))).AddOp(OP_CHECKMULTISIG)
+	return b.Script(), nil
+}
+
+// MultisigAddress returns the address of the funds locked by threshold of
+// the given public keys: the address of their MultisigScript.
+func MultisigAddress(threshold int, pubKeys []string) (string, error) {
+	script, err := MultisigScript(threshold, pubKeys)
+	if err != nil {
+		return "", err
+	}
+	return types.ScriptAddress(script), nil
+}
+
+// ParseMultisig returns the threshold and public keys of a script built by
+// MultisigScript.
+func ParseMultisig(script []byte) (threshold int, pubKeys []string, err error) {
+	instructions, err := Parse(script)
+	if err != nil {
+		return 0, nil, err
+	}
+	if len(instructions) < 4 || instructions[len(instructions)-1].Op != OP_CHECKMULTISIG {
+		return 0, nil, fmt.Errorf("not a multisig script")
+	}
+
+	for _, in := range instructions[1 : len(instructions)-2] {
+		pubKeys = append(pubKeys, hex.EncodeToString(in.Data))
+	}
+	m, n := instructions[0].Op, instructions[len(instructions)-2].Op
+	if !isSmallInt(m) || !isSmallInt(n) || int(n-OP_1+1) != len(pubKeys) {
+		return 0, nil, fmt.Errorf("not a multisig script")
+	}
+	threshold = int(m - OP_1 + 1)
+
+	rebuilt, err := MultisigScript(threshold, pubKeys)
+	if err != nil || string(rebuilt) != string(script) {
+		return 0, nil, fmt.Errorf("not a multisig script")
+	}
+	return threshold, pubKeys, nil
+}
+
+// MultisigUnlock returns the unlocking script that spends an input of a
+// multisig address, given the multisig script and the signatures collected
+// from co-signers for that input, keyed by public key. It uses the
+// signatures of the first threshold keys that signed, in key order, and
+// fails if fewer co-signers signed.
+func MultisigUnlock(script []byte, signatures map[string]string) ([]byte, error) {
+	threshold, pubKeys, err := ParseMultisig(script)
+	if err != nil {
+		return nil, err
+	}
+
+	b := NewBuilder()
+	count := 0
+	for _, pubKey := range pubKeys {
+		if count == threshold {
+			break
+		}
+		sigHex, ok := signatures[pubKey]
+		if !ok || sigHex == "" {
+			continue
+		}
+		sig, err := hex.DecodeString(sigHex)
+		if err != nil {
+			return nil, fmt.Errorf("invalid signature of %s: %w", pubKey, err)
+		}
+		b.AddData(sig)
+		count++
+	}
+	if count < threshold {
+		return nil, fmt.Errorf("have %d of %d required signatures", count, threshold)
+	}
+	return b.AddData(script).Script(), nil
+}
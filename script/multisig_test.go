@@ -0,0 +1,178 @@
+package script
+
+import (
+	"crypto/ecdsa"
+	"encoding/hex"
+	"fmt"
+	"reflect"
+	"sort"
+	"strings"
+	"testing"
+
+	"github.com/OhMyDitzzy/vulcan/types"
+)
+
+// testKeys returns n keys and their public keys in hex, sorted as in a
+// multisig script.
+func testKeys(t *testing.T, n int) ([]*ecdsa.PrivateKey, []string) {
+	t.Helper()
+	keys := make([]*ecdsa.PrivateKey, n)
+	for i := range keys {
+		keys[i] = newKey(t)
+	}
+	sort.Slice(keys, func(i, j int) bool {
+		return hex.EncodeToString(pubKeyBytes(keys[i])) < hex.EncodeToString(pubKeyBytes(keys[j]))
+	})
+
+	pubKeys := make([]string, n)
+	for i, key := range keys {
+		pubKeys[i] = hex.EncodeToString(pubKeyBytes(key))
+	}
+	return keys, pubKeys
+}
+
+func TestMultisigScript(t *testing.T) {
+	_, pubKeys := testKeys(t, MaxMultisigKeys+1)
+
+	script, err := MultisigScript(2, pubKeys[:3])
+	if err != nil {
+		t.Fatal(err)
+	}
+	reversed := []string{pubKeys[2], pubKeys[1], pubKeys[0]}
+	if other, err := MultisigScript(2, reversed); err != nil || string(other) != string(script) {
+		t.Fatalf("keys in another order give another script (%v)", err)
+	}
+	a, _ := MultisigAddress(2, pubKeys[:3])
+	b, _ := MultisigAddress(2, reversed)
+	if a != b || a != types.ScriptAddress(script) {
+		t.Fatal("multisig address isn't the address of its script")
+	}
+
+	tests := []struct {
+		name      string
+		threshold int
+		pubKeys   []string
+		want      string
+	}{
+		{"no keys", 1, nil, "1 to 7 keys"},
+		{"too many keys", 1, pubKeys, "1 to 7 keys"},
+		{"zero threshold", 0, pubKeys[:3], "threshold"},
+		{"threshold above keys", 4, pubKeys[:3], "threshold"},
+		{"duplicate key", 2, []string{pubKeys[0], pubKeys[1], pubKeys[0]}, "duplicate"},
+		{"invalid key", 1, []string{pubKeys[0], "04beef"}, "invalid key"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			_, err := MultisigScript(tt.threshold, tt.pubKeys)
+			if err == nil || !strings.Contains(err.Error(), tt.want) {
+				t.Fatalf("got %v, want an error containing %q", err, tt.want)
+			}
+		})
+	}
+}
+
+func TestParseMultisig(t *testing.T) {
+	_, pubKeys := testKeys(t, MaxMultisigKeys)
+
+	for n := 1; n <= MaxMultisigKeys; n++ {
+		for threshold := 1; threshold <= n; threshold++ {
+			script, err := MultisigScript(threshold, pubKeys[:n])
+			if err != nil {
+				t.Fatal(err)
+			}
+			gotThreshold, gotKeys, err := ParseMultisig(script)
+			if err != nil {
+				t.Fatalf("ParseMultisig of %d of %d failed: %v", threshold, n, err)
+			}
+			if gotThreshold != threshold || !reflect.DeepEqual(gotKeys, pubKeys[:n]) {
+				t.Fatalf("got %d of %d keys, want %d of %d", gotThreshold, len(gotKeys), threshold, n)
+			}
+		}
+	}
+
+	key := func(i int) string { return pubKeys[i] }
+	tests := map[string]string{
+		"unsorted keys":        "OP_2 " + key(1) + " " + key(0) + " OP_2 OP_CHECKMULTISIG",
+		"duplicate keys":       "OP_1 " + key(0) + " " + key(0) + " OP_2 OP_CHECKMULTISIG",
+		"wrong key count":      "OP_1 " + key(0) + " " + key(1) + " OP_3 OP_CHECKMULTISIG",
+		"threshold above keys": "OP_3 " + key(0) + " " + key(1) + " OP_2 OP_CHECKMULTISIG",
+		"zero threshold":       "OP_0 " + key(0) + " " + key(1) + " OP_2 OP_CHECKMULTISIG",
+		"invalid key":          "OP_1 04beef OP_1 OP_CHECKMULTISIG",
+		"verify variant":       "OP_1 " + key(0) + " OP_1 OP_CHECKMULTISIGVERIFY",
+		"trailing opcode":      "OP_1 " + key(0) + " OP_1 OP_CHECKMULTISIG OP_1",
+		"pay to public key":    key(0) + " OP_CHECKSIG",
+	}
+	for name, text := range tests {
+		t.Run(name, func(t *testing.T) {
+			if _, _, err := ParseMultisig(mustAssemble(t, text)); err == nil {
+				t.Fatal("ParseMultisig succeeded")
+			}
+		})
+	}
+}
+
+func TestMultisigSpend(t *testing.T) {
+	keys, pubKeys := testKeys(t, 3)
+	lock, err := MultisigScript(2, pubKeys)
+	if err != nil {
+		t.Fatal(err)
+	}
+	tx := testTx(0)
+	sign := func(i int) string { return hex.EncodeToString(signInput(t, keys[i], tx, 0)) }
+
+	// spend verifies an unlocking script as a node does for an input paid
+	// to the multisig address
+	spend := func(unlock []byte) error {
+		redeem, rest, err := SplitRedeemScript(unlock)
+		if err != nil {
+			return err
+		}
+		if types.ScriptAddress(redeem) != types.ScriptAddress(lock) {
+			return fmt.Errorf("unlocking script reveals another script")
+		}
+		return Verify(rest, redeem, tx, 0)
+	}
+
+	for _, signers := range [][]int{{0, 1}, {0, 2}, {1, 2}, {0, 1, 2}} {
+		signatures := make(map[string]string)
+		for _, i := range signers {
+			signatures[pubKeys[i]] = sign(i)
+		}
+		unlock, err := MultisigUnlock(lock, signatures)
+		if err != nil {
+			t.Fatalf("MultisigUnlock with signers %v failed: %v", signers, err)
+		}
+		if err := spend(unlock); err != nil {
+			t.Fatalf("spend signed by %v rejected: %v", signers, err)
+		}
+	}
+
+	if _, err := MultisigUnlock(lock, map[string]string{pubKeys[1]: sign(1), pubKeys[2]: ""}); err == nil {
+		t.Fatal("MultisigUnlock with one of two signatures succeeded")
+	}
+
+	other := newKey(t)
+	otherTx := testTx(1)
+	unlockWith := func(sigs ...[]byte) []byte {
+		b := NewBuilder()
+		for _, sig := range sigs {
+			b.AddData(sig)
+		}
+		return b.AddData(lock).Script()
+	}
+	tests := map[string][]byte{
+		"signatures out of key order": unlockWith(signInput(t, keys[1], tx, 0), signInput(t, keys[0], tx, 0)),
+		"same signature twice":        unlockWith(signInput(t, keys[0], tx, 0), signInput(t, keys[0], tx, 0)),
+		"one signature":               unlockWith(signInput(t, keys[0], tx, 0)),
+		"key not in the script":       unlockWith(signInput(t, keys[0], tx, 0), signInput(t, other, tx, 0)),
+		"signature of another tx":     unlockWith(signInput(t, keys[0], tx, 0), signInput(t, keys[1], otherTx, 0)),
+		"empty signature":             unlockWith(signInput(t, keys[0], tx, 0), nil),
+	}
+	for name, unlock := range tests {
+		t.Run(name, func(t *testing.T) {
+			if err := spend(unlock); err == nil {
+				t.Fatal("spend accepted")
+			}
+		})
+	}
+}
@@ -0,0 +1,100 @@
+package script
+
+import "fmt"
+
+// Opcodes. Values match Bitcoin script where the opcodes exist there;
+// every other value is invalid.
+const (
+	OP_0         byte = 0x00 // Push an empty element, which is false
+	OP_PUSHDATA1 byte = 0x4c // Push the next n bytes, with n in the next byte
+	OP_PUSHDATA2 byte = 0x4d // Push the next n bytes, with n in the next two bytes (little-endian)
+	OP_1NEGATE   byte = 0x4f // Push -1
+	OP_1         byte = 0x51 // Push 1, which is true; OP_2 to OP_16 follow
+	OP_16        byte = 0x60 // Push 16
+
+	OP_NOP    byte = 0x61
+	OP_IF     byte = 0x63
+	OP_NOTIF  byte = 0x64
+	OP_ELSE   byte = 0x67
+	OP_ENDIF  byte = 0x68
+	OP_VERIFY byte = 0x69
+	OP_RETURN byte = 0x6a
+
+	OP_DROP byte = 0x75
+	OP_DUP  byte = 0x76
+	OP_SWAP byte = 0x7c
+	OP_SIZE byte = 0x82
+
+	OP_EQUAL              byte = 0x87
+	OP_EQUALVERIFY        byte = 0x88
+	OP_NUMEQUAL           byte = 0x9c
+	OP_NUMEQUALVERIFY     byte = 0x9d
+	OP_LESSTHAN           byte = 0x9f
+	OP_GREATERTHAN        byte = 0xa0
+	OP_LESSTHANOREQUAL    byte = 0xa1
+	OP_GREATERTHANOREQUAL byte = 0xa2
+
+	OP_SHA256 byte = 0xa8
+
+	OP_CHECKSIG            byte = 0xac
+	OP_CHECKSIGVERIFY      byte = 0xad
+	OP_CHECKMULTISIG       byte = 0xae
+	OP_CHECKMULTISIGVERIFY byte = 0xaf
+
+	OP_CHECKLOCKTIMEVERIFY byte = 0xb1
+)
+
+// opcodeNames names every valid opcode other than data pushes.
+var opcodeNames = map[byte]string{
+	OP_0:         "OP_0",
+	OP_PUSHDATA1: "OP_PUSHDATA1",
+	OP_PUSHDATA2: "OP_PUSHDATA2",
+	OP_1NEGATE:   "OP_1NEGATE",
+
+	OP_NOP:    "OP_NOP",
+	OP_IF:     "OP_IF",
+	OP_NOTIF:  "OP_NOTIF",
+	OP_ELSE:   "OP_ELSE",
+	OP_ENDIF:  "OP_ENDIF",
+	OP_VERIFY: "OP_VERIFY",
+	OP_RETURN: "OP_RETURN",
+
+	OP_DROP: "OP_DROP",
+	OP_DUP:  "OP_DUP",
+	OP_SWAP: "OP_SWAP",
+	OP_SIZE: "OP_SIZE",
+
+	OP_EQUAL:              "OP_EQUAL",
+	OP_EQUALVERIFY:        "OP_EQUALVERIFY",
+	OP_NUMEQUAL:           "OP_NUMEQUAL",
+	OP_NUMEQUALVERIFY:     "OP_NUMEQUALVERIFY",
+	OP_LESSTHAN:           "OP_LESSTHAN",
+	OP_GREATERTHAN:        "OP_GREATERTHAN",
+	OP_LESSTHANOREQUAL:    "OP_LESSTHANOREQUAL",
+	OP_GREATERTHANOREQUAL: "OP_GREATERTHANOREQUAL",
+
+	OP_SHA256: "OP_SHA256",
+
+	OP_CHECKSIG:            "OP_CHECKSIG",
+	OP_CHECKSIGVERIFY:      "OP_CHECKSIGVERIFY",
+	OP_CHECKMULTISIG:       "OP_CHECKMULTISIG",
+	OP_CHECKMULTISIGVERIFY: "OP_CHECKMULTISIGVERIFY",
+
+	OP_CHECKLOCKTIMEVERIFY: "OP_CHECKLOCKTIMEVERIFY",
+}
+
+func init() {
+	for n := 1; n <= 16; n++ {
+		opcodeNames[OP_1+byte(n-1)] = fmt.Sprintf("OP_%d", n)
+	}
+}
+
+// isSmallInt reports whether op pushes a number from 1 to 16.
+func isSmallInt(op byte) bool {
+	return op >= OP_1 && op <= OP_16
+}
+
+// isPush reports whether op only pushes data.
+func isPush(op byte) bool {
+	return op <= OP_PUSHDATA2 || op == OP_1NEGATE || isSmallInt(op)
+}
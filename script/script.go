@@ -0,0 +1,311 @@
+// Package script implements the scripts that lock and unlock outputs.
+//
+// A script is a small program for a stack machine, modeled on Bitcoin
+// script. An output locked by a script can be spent by an input whose
+// unlocking script, which may only push data, leaves a stack on which the
+// locking script succeeds. The opcode set is deliberately small: data
+// pushes, conditionals, a few stack operations, comparisons, SHA256,
+// signature checks, including M-of-N multisignature checks, and lock time
+// checks. Scripts have no loops, and every evaluation is bounded by MaxCost.
+//
+// An output either carries its locking script, or only pays to the address
+// of a script, which the input spending it must reveal as the last push of
+// its unlocking script (see SplitRedeemScript). Multisig addresses work the
+// second way, so paying to one takes no more than paying to a public key.
+//
+// A data output carries data in a locking script starting with OP_RETURN,
+// which fails when it runs, so the output can never be spent (see DataScript).
+package script
+
+import (
+	"encoding/binary"
+	"encoding/hex"
+	"fmt"
+	"strings"
+)
+
+// Instruction is a parsed script instruction: an opcode and, for data
+// pushes, the data it pushes.
+type Instruction struct {
+	Op   byte
+	Data []byte
+}
+
+// Parse splits a script into instructions. It fails on invalid opcodes,
+// truncated pushes and pushes that don't use the shortest encoding, so
+// every script has exactly one encoding.
+func Parse(script []byte) ([]Instruction, error) {
+	var instructions []Instruction
+	for pc := 0; pc < len(script); {
+		op := script[pc]
+		pc++
+
+		var size int
+		switch {
+		case op > OP_0 && op < OP_PUSHDATA1:
+			size = int(op)
+		case op == OP_PUSHDATA1:
+			if pc+1 > len(script) {
+				return nil, fmt.Errorf("truncated OP_PUSHDATA1")
+			}
+			size = int(script[pc])
+			pc++
+		case op == OP_PUSHDATA2:
+			if pc+2 > len(script) {
+				return nil, fmt.Errorf("truncated OP_PUSHDATA2")
+			}
+			size = int(binary.LittleEndian.Uint16(script[pc:]))
+			pc += 2
+		default:
+			if _, ok := opcodeNames[op]; !ok {
+				return nil, fmt.Errorf("invalid opcode %#02x", op)
+			}
+			instructions = append(instructions, Instruction{Op: op})
+			continue
+		}
+
+		if pc+size > len(script) {
+			return nil, fmt.Errorf("push of %d bytes exceeds the script", size)
+		}
+		data := script[pc : pc+size]
+		pc += size
+		if pushOp(data) != op {
+			return nil, fmt.Errorf("push of %d bytes does not use the shortest encoding", size)
+		}
+		instructions = append(instructions, Instruction{Op: op, Data: data})
+	}
+	return instructions, nil
+}
+
+// pushOp returns the opcode that pushes data in its shortest encoding, or
+// a small number opcode if data is one. Pushes are only ever encoded this
+// way, so data can't be pushed in several ways.
+func pushOp(data []byte) byte {
+	switch {
+	case len(data) == 0:
+		return OP_0
+	case len(data) == 1 && data[0] >= 1 && data[0] <= 16:
+		return OP_1 + data[0] - 1
+	case len(data) == 1 && data[0] == 0x81:
+		return OP_1NEGATE
+	case len(data) < int(OP_PUSHDATA1):
+		return byte(len(data))
+	case len(data) <= 0xff:
+		return OP_PUSHDATA1
+	default:
+		return OP_PUSHDATA2
+	}
+}
+
+// IsPushOnly reports whether a script only pushes data, as unlocking
+// scripts must.
+func IsPushOnly(script []byte) bool {
+	instructions, err := Parse(script)
+	if err != nil {
+		return false
+	}
+	for _, in := range instructions {
+		if !isPush(in.Op) {
+			return false
+		}
+	}
+	return true
+}
+
+// SplitRedeemScript splits the unlocking script of an input spending an
+// output paid to a script's address into the script, which the unlocking
+// script pushes last, and the unlocking script for it that comes before.
+func SplitRedeemScript(unlock []byte) (redeem, rest []byte, err error) {
+	if !IsPushOnly(unlock) {
+		return nil, nil, fmt.Errorf("unlocking script must only push data")
+	}
+	instructions, _ := Parse(unlock)
+	if len(instructions) == 0 {
+		return nil, nil, fmt.Errorf("unlocking script does not reveal a script")
+	}
+
+	b := NewBuilder()
+	for _, in := range instructions[:len(instructions)-1] {
+		b.AddData(PushedData(in))
+	}
+	return PushedData(instructions[len(instructions)-1]), b.Script(), nil
+}
+
+// PushedData returns the data a push instruction pushes. Small numbers are
+// pushed by opcodes without data, so their value is decoded from the opcode.
+func PushedData(in Instruction) []byte {
+	switch {
+	case in.Op == OP_1NEGATE:
+		return encodeNum(-1)
+	case isSmallInt(in.Op):
+		return encodeNum(int64(in.Op - OP_1 + 1))
+	}
+	return in.Data
+}
+
+// Builder builds a script, always using the shortest encoding for data.
+type Builder struct {
+	script []byte
+}
+
+// NewBuilder creates an empty script builder.
+func NewBuilder() *Builder {
+	return &Builder{}
+}
+
+// AddOp appends an opcode.
+func (b *Builder) AddOp(op byte) *Builder {
+	b.script = append(b.script, op)
+	return b
+}
+
+// AddData appends a push of data.
+func (b *Builder) AddData(data []byte) *Builder {
+	op := pushOp(data)
+	switch {
+	case op == OP_0 || op == OP_1NEGATE || isSmallInt(op):
+		return b.AddOp(op)
+	case op == OP_PUSHDATA1:
+		b.script = append(b.script, op, byte(len(data)))
+	case op == OP_PUSHDATA2:
+		b.script = append(b.script, op)
+		b.script = binary.LittleEndian.AppendUint16(b.script, uint16(len(data)))
+	default:
+		b.script = append(b.script, op)
+	}
+	b.script = append(b.script, data...)
+	return b
+}
+
+// AddInt appends a push of a number.
+func (b *Builder) AddInt(n int64) *Builder {
+	return b.AddData(encodeNum(n))
+}
+
+// Script returns the built script.
+func (b *Builder) Script() []byte {
+	return b.script
+}
+
+// Disassemble returns the text form of a script: opcode names, and data
+// pushes as hex. Assemble turns it back into the script.
+func Disassemble(script []byte) (string, error) {
+	instructions, err := Parse(script)
+	if err != nil {
+		return "", err
+	}
+	tokens := make([]string, len(instructions))
+	for i, in := range instructions {
+		if in.Data != nil && in.Op <= OP_PUSHDATA2 {
+			tokens[i] = hex.EncodeToString(in.Data)
+		} else {
+			tokens[i] = opcodeNames[in.Op]
+		}
+	}
+	return strings.Join(tokens, " "), nil
+}
+
+// Assemble parses the text form of a script, as produced by Disassemble.
+// Tokens are opcode names or hex data to push.
+func Assemble(text string) ([]byte, error) {
+	b := NewBuilder()
+	for _, token := range strings.Fields(text) {
+		if op, ok := opcodeByName(token); ok {
+			b.AddOp(op)
+			continue
+		}
+		data, err := hex.DecodeString(token)
+		if err != nil {
+			return nil, fmt.Errorf("unknown token %q", token)
+		}
+		b.AddData(data)
+	}
+
+	script := b.Script()
+	if _, err := Parse(script); err != nil {
+		return nil, err
+	}
+	return script, nil
+}
+
+// opcodeByName returns the opcode with the given name. Push opcodes that
+// need data can't be written by name.
+func opcodeByName(name string) (byte, bool) {
+	for op, opName := range opcodeNames {
+		if opName == name && op != OP_PUSHDATA1 && op != OP_PUSHDATA2 {
+			return op, true
+		}
+	}
+	return 0, false
+}
+
+// MaxNumSize is the size limit of the numbers scripts compute with, which
+// is enough for any block height or Unix time lock.
+const MaxNumSize = 5
+
+// encodeNum encodes a number the way scripts store it: little-endian
+// sign-magnitude with the sign in the top bit of the last byte, and zero
+// as the empty element.
+func encodeNum(n int64) []byte {
+	if n == 0 {
+		return nil
+	}
+
+	negative := n < 0
+	abs := uint64(n)
+	if negative {
+		abs = uint64(-n)
+	}
+
+	var data []byte
+	for abs > 0 {
+		data = append(data, byte(abs))
+		abs >>= 8
+	}
+	if data[len(data)-1]&0x80 != 0 {
+		if negative {
+			data = append(data, 0x80)
+		} else {
+			data = append(data, 0)
+		}
+	} else if negative {
+		data[len(data)-1] |= 0x80
+	}
+	return data
+}
+
+// decodeNum decodes a number encoded by encodeNum. Numbers must be at most
+// MaxNumSize bytes long and minimally encoded.
+func decodeNum(data []byte) (int64, error) {
+	if len(data) > MaxNumSize {
+		return 0, fmt.Errorf("number is %d bytes, at most %d are allowed", len(data), MaxNumSize)
+	}
+	if len(data) == 0 {
+		return 0, nil
+	}
+	last := data[len(data)-1]
+	if last&0x7f == 0 && (len(data) == 1 || data[len(data)-2]&0x80 == 0) {
+		return 0, fmt.Errorf("number is not minimally encoded")
+	}
+
+	var n int64
+	for i, b := range data {
+		n |= int64(b) << (8 * i)
+	}
+	if last&0x80 != 0 {
+		n &^= int64(0x80) << (8 * (len(data) - 1))
+		return -n, nil
+	}
+	return n, nil
+}
+
+// asBool interprets a stack element as a boolean: it is false if every
+// byte is zero, allowing a sign bit on the last byte for negative zero.
+func asBool(data []byte) bool {
+	for i, b := range data {
+		if b != 0 {
+			return i != len(data)-1 || b != 0x80
+		}
+	}
+	return false
+}
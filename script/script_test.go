@@ -0,0 +1,168 @@
+package script
+
+import (
+	"bytes"
+	"testing"
+)
+
+func TestParseRejectsNonCanonicalScripts(t *testing.T) {
+	tests := []struct {
+		name   string
+		script []byte
+	}{
+		{"invalid opcode", []byte{0xff}},
+		{"truncated push", []byte{0x03, 0x01, 0x02}},
+		{"truncated OP_PUSHDATA1", []byte{OP_PUSHDATA1}},
+		{"truncated OP_PUSHDATA2", []byte{OP_PUSHDATA2, 0x01}},
+		{"small number as data", []byte{0x01, 0x05}},
+		{"negative one as data", []byte{0x01, 0x81}},
+		{"short data with OP_PUSHDATA1", []byte{OP_PUSHDATA1, 0x02, 0xaa, 0xbb}},
+		{"short data with OP_PUSHDATA2", append([]byte{OP_PUSHDATA2, 0x50, 0x00}, make([]byte, 0x50)...)},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if _, err := Parse(tt.script); err == nil {
+				t.Fatal("Parse succeeded")
+			}
+		})
+	}
+}
+
+func TestBuilderUsesShortestPush(t *testing.T) {
+	tests := []struct {
+		name string
+		data []byte
+		want []byte
+	}{
+		{"empty", nil, []byte{OP_0}},
+		{"one", []byte{1}, []byte{OP_1}},
+		{"sixteen", []byte{16}, []byte{OP_16}},
+		{"negative one", []byte{0x81}, []byte{OP_1NEGATE}},
+		{"seventeen", []byte{17}, []byte{0x01, 17}},
+		{"75 bytes", make([]byte, 75), append([]byte{75}, make([]byte, 75)...)},
+		{"76 bytes", make([]byte, 76), append([]byte{OP_PUSHDATA1, 76}, make([]byte, 76)...)},
+		{"256 bytes", make([]byte, 256), append([]byte{OP_PUSHDATA2, 0x00, 0x01}, make([]byte, 256)...)},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			script := NewBuilder().AddData(tt.data).Script()
+			if !bytes.Equal(script, tt.want) {
+				t.Fatalf("got %x, want %x", script, tt.want)
+			}
+
+			instructions, err := Parse(script)
+			if err != nil {
+				t.Fatalf("Parse failed: %v", err)
+			}
+			if len(instructions) != 1 {
+				t.Fatalf("got %d instructions, want 1", len(instructions))
+			}
+			if got := PushedData(instructions[0]); !bytes.Equal(got, tt.data) {
+				t.Fatalf("pushed %x, want %x", got, tt.data)
+			}
+		})
+	}
+}
+
+func TestAssembleRoundTrip(t *testing.T) {
+	tests := []string{
+		"OP_DUP OP_SHA256 00ff OP_EQUALVERIFY OP_1",
+		"OP_IF OP_2 OP_ELSE OP_1NEGATE OP_ENDIF",
+		"OP_0 OP_16 OP_CHECKLOCKTIMEVERIFY OP_DROP",
+	}
+
+	for _, text := range tests {
+		t.Run(text, func(t *testing.T) {
+			script, err := Assemble(text)
+			if err != nil {
+				t.Fatalf("Assemble failed: %v", err)
+			}
+			got, err := Disassemble(script)
+			if err != nil {
+				t.Fatalf("Disassemble failed: %v", err)
+			}
+			if got != text {
+				t.Fatalf("got %q, want %q", got, text)
+			}
+		})
+	}
+
+	if _, err := Assemble("OP_PUSHDATA1"); err == nil {
+		t.Error("assembling a push opcode without data succeeded")
+	}
+	if _, err := Assemble("OP_NOPE"); err == nil {
+		t.Error("assembling an unknown token succeeded")
+	}
+}
+
+func TestNumEncoding(t *testing.T) {
+	tests := []struct {
+		n    int64
+		want []byte
+	}{
+		{0, nil},
+		{1, []byte{0x01}},
+		{-1, []byte{0x81}},
+		{127, []byte{0x7f}},
+		{128, []byte{0x80, 0x00}},
+		{-128, []byte{0x80, 0x80}},
+		{255, []byte{0xff, 0x00}},
+		{256, []byte{0x00, 0x01}},
+		{1<<31 - 1, []byte{0xff, 0xff, 0xff, 0x7f}},
+		{1 << 32, []byte{0x00, 0x00, 0x00, 0x00, 0x01}},
+	}
+
+	for _, tt := range tests {
+		data := encodeNum(tt.n)
+		if !bytes.Equal(data, tt.want) {
+			t.Errorf("encodeNum(%d) = %x, want %x", tt.n, data, tt.want)
+			continue
+		}
+		n, err := decodeNum(data)
+		if err != nil || n != tt.n {
+			t.Errorf("decodeNum(%x) = %d, %v, want %d", data, n, err, tt.n)
+		}
+	}
+}
+
+func TestDecodeNumRejects(t *testing.T) {
+	tests := []struct {
+		name string
+		data []byte
+	}{
+		{"negative zero", []byte{0x80}},
+		{"padded zero", []byte{0x00}},
+		{"padded one", []byte{0x01, 0x00}},
+		{"too long", []byte{0x01, 0x02, 0x03, 0x04, 0x05, 0x06}},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if _, err := decodeNum(tt.data); err == nil {
+				t.Fatal("decodeNum succeeded")
+			}
+		})
+	}
+}
+
+func TestAsBool(t *testing.T) {
+	tests := []struct {
+		data []byte
+		want bool
+	}{
+		{nil, false},
+		{[]byte{0x00}, false},
+		{[]byte{0x00, 0x80}, false},
+		{[]byte{0x80}, false},
+		{[]byte{0x01}, true},
+		{[]byte{0x80, 0x00}, true},
+	}
+
+	for _, tt := range tests {
+		if got := asBool(tt.data); got != tt.want {
+			t.Errorf("asBool(%x) = %v, want %v", tt.data, got, tt.want)
+		}
+	}
+}
@@ -1,20 +1,178 @@
 package store
 
 import (
-	"encoding/json"
+	"encoding/binary"
 	"fmt"
 	"github.com/dgraph-io/badger/v3"
 )
 
+// formatVersion identifies the layout and encoding of the stored data.
+// It is bumped whenever stored records change in an incompatible way, so we
+// refuse to open an old data directory instead of misreading it.
+const formatVersion uint32 = 9
+
 // Store provides persistence layer without knowing about domain types
 type Store interface {
-	SaveBlock(index uint64, hash string, data []byte) error
+	Write(batch *Batch) error
+	SaveSideBlock(hash string, header []byte, data []byte) error
 	GetBlock(index uint64) ([]byte, error)
 	GetBlockByHash(hash string) ([]byte, error)
+	GetHeader(hash string) ([]byte, error)
+	ForEachHeader(fn func(data []byte) error) error
+	ForEachInvalidBlock(fn func(hash string) error) error
+	GetUndo(hash string) ([]byte, error)
 	GetHeight() (uint64, error)
+	GetBestBlock() (string, error)
+	GetFinalized() (string, error)
+	GetGenesis() ([]byte, error)
+	ForEachUTXO(fn func(data []byte) error) error
+	ForEachAnchor(data []byte, fn func(anchor []byte) error) error
+	ClearChainstate() error
 	Close() error
 }
 
+// Batch collects writes that are committed atomically by Store.Write.
+// We use it to persist a block, its undo data and the chainstate changes
+// it causes together, so the UTXO set on disk can never disagree with the
+// blocks it was built from. Later operations on the same key win.
+type Batch struct {
+	ops  []batchOp
+	size int
+}
+
+type batchOp struct {
+	key    []byte
+	value  []byte
+	delete bool
+}
+
+func NewBatch() *Batch {
+	return &Batch{}
+}
+
+// A Batch larger than these limits may be too big for BadgerStore.Write to
+// commit in one transaction. Both are well below what Badger accepts with
+// its default options, so callers writing a lot, like a deep
+// reorganization, can split their writes into batches of this size.
+const (
+	MaxBatchOps  = 10000
+	MaxBatchSize = 4 << 20
+)
+
+// Len returns the number of operations in the batch.
+func (b *Batch) Len() int {
+	return len(b.ops)
+}
+
+// Size returns the number of key and value bytes the batch writes.
+func (b *Batch) Size() int {
+	return b.size
+}
+
+// SaveBlock stores a main-chain block at the given index together with
+// its header and undo data.
+func (b *Batch) SaveBlock(index uint64, hash string, header []byte, data []byte, undo []byte) {
+	b.set(blockIndexKey(index), data)
+	b.set(blockHashKey(hash), data)
+	b.set(headerKey(hash), header)
+	b.PutUndo(hash, undo)
+}
+
+// PutUndo stores the undo data of a block.
+func (b *Batch) PutUndo(hash string, undo []byte) {
+	b.set(undoKey(hash), undo)
+}
+
+// SetHeight moves the main-chain height marker.
+// Index entries above the height are left behind but are never read.
+func (b *Batch) SetHeight(height uint64) {
+	b.set([]byte("blockchain:height"), binary.BigEndian.AppendUint64(nil, height))
+}
+
+// SetBestBlock records the block the stored UTXO set corresponds to.
+func (b *Batch) SetBestBlock(hash string) {
+	b.set([]byte("chainstate:best"), []byte(hash))
+}
+
+// SetFinalized records the highest finalized checkpoint.
+func (b *Batch) SetFinalized(hash string) {
+	b.set([]byte("chain:finalized"), []byte(hash))
+}
+
+// SetGenesis records the genesis specification the data directory was
+// initialized with.
+func (b *Batch) SetGenesis(spec []byte) {
+	b.set([]byte("chain:genesis"), spec)
+}
+
+// MarkInvalid records that a stored side-chain block failed to connect, so
+// it isn't loaded into the block tree again.
+func (b *Batch) MarkInvalid(hash string) {
+	b.set(invalidKey(hash), []byte(hash))
+}
+
+func (b *Batch) PutUTXO(txID string, index uint32, data []byte) {
+	b.set(utxoKey(txID, index), data)
+}
+
+func (b *Batch) DeleteUTXO(txID string, index uint32) {
+	b.delete(utxoKey(txID, index))
+}
+
+// PutAnchor records that a data output of a main-chain transaction carries
+// data. Anchors of the same data are kept in height order.
+func (b *Batch) PutAnchor(data []byte, height uint64, txID string, index uint32, anchor []byte) {
+	b.set(anchorKey(data, height, txID, index), anchor)
+}
+
+// DeleteAnchor removes an anchor recorded by PutAnchor.
+func (b *Batch) DeleteAnchor(data []byte, height uint64, txID string, index uint32) {
+	b.delete(anchorKey(data, height, txID, index))
+}
+
+func (b *Batch) set(key, value []byte) {
+	b.ops = append(b.ops, batchOp{key: key, value: value})
+	b.size += len(key) + len(value)
+}
+
+func (b *Batch) delete(key []byte) {
+	b.ops = append(b.ops, batchOp{key: key, delete: true})
+	b.size += len(key)
+}
+
+func blockIndexKey(index uint64) []byte {
+	return []byte(fmt.Sprintf("block:index:%d", index))
+}
+
+func blockHashKey(hash string) []byte {
+	return []byte(fmt.Sprintf("block:hash:%s", hash))
+}
+
+func headerKey(hash string) []byte {
+	return []byte(fmt.Sprintf("header:%s", hash))
+}
+
+func undoKey(hash string) []byte {
+	return []byte(fmt.Sprintf("undo:%s", hash))
+}
+
+func invalidKey(hash string) []byte {
+	return []byte(fmt.Sprintf("invalid:%s", hash))
+}
+
+func utxoKey(txID string, index uint32) []byte {
+	return []byte(fmt.Sprintf("utxo:%s:%d", txID, index))
+}
+
+func anchorPrefix(data []byte) []byte {
+	return []byte(fmt.Sprintf("anchor:%x:", data))
+}
+
+// anchorKey pads the height so keys of the same data sort by height.
+func anchorKey(data []byte, height uint64, txID string, index uint32) []byte {
+	return append(anchorPrefix(data), fmt.Sprintf("%020d:%s:%d", height, txID, index)...)
+}
+
 type BadgerStore struct {
 	db *badger.DB
 }
@@ -22,61 +180,106 @@ type BadgerStore struct {
 func NewBadgerStore(path string) (*BadgerStore, error) {
 	opts := badger.DefaultOptions(path)
 	opts.Logger = nil // Suppress logs
-	
+
 	db, err := badger.Open(opts)
 	if err != nil {
 		return nil, err
 	}
-	
-	return &BadgerStore{db: db}, nil
+
+	bs := &BadgerStore{db: db}
+	if err := bs.checkVersion(); err != nil {
+		db.Close()
+		return nil, err
+	}
+	return bs, nil
 }
 
-func (bs *BadgerStore) SaveBlock(index uint64, hash string, data []byte) error {
+// checkVersion makes sure the data directory uses the current format,
+// stamping new databases with it.
+func (bs *BadgerStore) checkVersion() error {
 	return bs.db.Update(func(txn *badger.Txn) error {
-		indexKey := []byte(fmt.Sprintf("block:index:%d", index))
-		if err := txn.Set(indexKey, data); err != nil {
-			return err
+		item, err := txn.Get([]byte("store:version"))
+		if err == badger.ErrKeyNotFound {
+			_, err := txn.Get([]byte("blockchain:height"))
+			if err == nil {
+				return fmt.Errorf("data directory was created by an older version, remove it to resync")
+			}
+			if err != badger.ErrKeyNotFound {
+				return err
+			}
+			return txn.Set([]byte("store:version"), binary.BigEndian.AppendUint32(nil, formatVersion))
 		}
-
-		hashKey := []byte(fmt.Sprintf("block:hash:%s", hash))
-		if err := txn.Set(hashKey, data); err != nil {
+		if err != nil {
 			return err
 		}
 
-		heightKey := []byte("blockchain:height")
-		heightData, _ := json.Marshal(index)
-		return txn.Set(heightKey, heightData)
+		return item.Value(func(val []byte) error {
+			if len(val) != 4 || binary.BigEndian.Uint32(val) != formatVersion {
+				return fmt.Errorf("data directory uses an unsupported store format")
+			}
+			return nil
+		})
 	})
 }
 
-func (bs *BadgerStore) GetBlock(index uint64) ([]byte, error) {
-	var data []byte
-	err := bs.db.View(func(txn *badger.Txn) error {
-		key := []byte(fmt.Sprintf("block:index:%d", index))
-		item, err := txn.Get(key)
-		if err != nil {
-			return err
+// Write commits every operation in the batch in a single transaction.
+func (bs *BadgerStore) Write(batch *Batch) error {
+	return bs.db.Update(func(txn *badger.Txn) error {
+		for _, op := range batch.ops {
+			if op.delete {
+				if err := txn.Delete(op.key); err != nil {
+					return err
+				}
+				continue
+			}
+			if err := txn.Set(op.key, op.value); err != nil {
+				return err
+			}
 		}
-		
-		data, err = item.ValueCopy(nil)
-		return err
+		return nil
 	})
-	return data, err
 }
 
-func (bs *BadgerStore) GetBlockByHash(hash string) ([]byte, error) {
-	var data []byte
-	err := bs.db.View(func(txn *badger.Txn) error {
-		key := []byte(fmt.Sprintf("block:hash:%s", hash))
-		item, err := txn.Get(key)
-		if err != nil {
+// SaveSideBlock stores a block that is not part of the main chain, and its header.
+// It can only be looked up by hash until a reorganization makes it main.
+func (bs *BadgerStore) SaveSideBlock(hash string, header []byte, data []byte) error {
+	return bs.db.Update(func(txn *badger.Txn) error {
+		if err := txn.Set(headerKey(hash), header); err != nil {
 			return err
 		}
-		
-		data, err = item.ValueCopy(nil)
-		return err
+		return txn.Set(blockHashKey(hash), data)
 	})
-	return data, err
+}
+
+func (bs *BadgerStore) GetBlock(index uint64) ([]byte, error) {
+	return bs.get(blockIndexKey(index))
+}
+
+func (bs *BadgerStore) GetBlockByHash(hash string) ([]byte, error) {
+	return bs.get(blockHashKey(hash))
+}
+
+// GetHeader returns the header of a block on any branch.
+// Headers are stored separately so they can be read without the block body.
+func (bs *BadgerStore) GetHeader(hash string) ([]byte, error) {
+	return bs.get(headerKey(hash))
+}
+
+// ForEachHeader calls fn with the header of every stored block, on any branch.
+func (bs *BadgerStore) ForEachHeader(fn func(data []byte) error) error {
+	return bs.forEach([]byte("header:"), fn)
+}
+
+// ForEachInvalidBlock calls fn with the hash of every block marked invalid.
+func (bs *BadgerStore) ForEachInvalidBlock(fn func(hash string) error) error {
+	return bs.forEach([]byte("invalid:"), func(data []byte) error {
+		return fn(string(data))
+	})
+}
+
+// GetUndo returns the undo data saved when the block was connected.
+func (bs *BadgerStore) GetUndo(hash string) ([]byte, error) {
+	return bs.get(undoKey(hash))
 }
 
 func (bs *BadgerStore) GetHeight() (uint64, error) {
@@ -90,14 +293,101 @@ func (bs *BadgerStore) GetHeight() (uint64, error) {
 		if err != nil {
 			return err
 		}
-		
+
 		return item.Value(func(val []byte) error {
-			return json.Unmarshal(val, &height)
+			if len(val) != 8 {
+				return fmt.Errorf("invalid height record")
+			}
+			height = binary.BigEndian.Uint64(val)
+			return nil
 		})
 	})
 	return height, err
 }
 
+// GetBestBlock returns the hash of the block the stored UTXO set corresponds to,
+// or an empty string if no chainstate has been written yet.
+func (bs *BadgerStore) GetBestBlock() (string, error) {
+	data, err := bs.get([]byte("chainstate:best"))
+	if err == badger.ErrKeyNotFound {
+		return "", nil
+	}
+	return string(data), err
+}
+
+// GetFinalized returns the hash of the highest finalized checkpoint,
+// or an empty string if no block has been finalized yet.
+func (bs *BadgerStore) GetFinalized() (string, error) {
+	data, err := bs.get([]byte("chain:finalized"))
+	if err == badger.ErrKeyNotFound {
+		return "", nil
+	}
+	return string(data), err
+}
+
+// GetGenesis returns the genesis specification the data directory was
+// initialized with, or nil if it uses its network's genesis block.
+func (bs *BadgerStore) GetGenesis() ([]byte, error) {
+	data, err := bs.get([]byte("chain:genesis"))
+	if err == badger.ErrKeyNotFound {
+		return nil, nil
+	}
+	return data, err
+}
+
+// ForEachUTXO calls fn with every stored unspent output.
+func (bs *BadgerStore) ForEachUTXO(fn func(data []byte) error) error {
+	return bs.forEach([]byte("utxo:"), fn)
+}
+
+// ForEachAnchor calls fn with every stored anchor of data, lowest first.
+func (bs *BadgerStore) ForEachAnchor(data []byte, fn func(anchor []byte) error) error {
+	return bs.forEach(anchorPrefix(data), fn)
+}
+
+// ClearChainstate deletes the stored UTXO set, anchor index and best block
+// marker so the chainstate can be rebuilt from the blocks.
+func (bs *BadgerStore) ClearChainstate() error {
+	if err := bs.db.DropPrefix([]byte("utxo:"), []byte("anchor:")); err != nil {
+		return err
+	}
+	return bs.db.Update(func(txn *badger.Txn) error {
+		return txn.Delete([]byte("chainstate:best"))
+	})
+}
+
 func (bs *BadgerStore) Close() error {
 	return bs.db.Close()
-}
\ No newline at end of file
+}
+
+func (bs *BadgerStore) get(key []byte) ([]byte, error) {
+	var data []byte
+	err := bs.db.View(func(txn *badger.Txn) error {
+		item, err := txn.Get(key)
+		if err != nil {
+			return err
+		}
+
+		data, err = item.ValueCopy(nil)
+		return err
+	})
+	return data, err
+}
+
+func (bs *BadgerStore) forEach(prefix []byte, fn func(data []byte) error) error {
+	return bs.db.View(func(txn *badger.Txn) error {
+		it := txn.NewIterator(badger.DefaultIteratorOptions)
+		defer it.Close()
+
+		for it.Seek(prefix); it.ValidForPrefix(prefix); it.Next() {
+			data, err := it.Item().ValueCopy(nil)
+			if err != nil {
+				return err
+			}
+			if err := fn(data); err != nil {
+				return err
+			}
+		}
+		return nil
+	})
+}
@@ -0,0 +1,163 @@
+// Package swap implements hash time-locked contracts (HTLCs) and the atomic
+// swaps built from them.
+//
+// An HTLC locks coins so that the recipient can claim them by revealing the
+// preimage of a hash, and from a lock time on, the sender can take them
+// back instead. An atomic swap between two chains uses an HTLC with the
+// same hash on each: whoever chose the secret claims the coins on one chain
+// and so reveals it, which lets the other party claim the coins on the
+// other chain. If either party walks away, both get their coins back once
+// the lock times pass.
+package swap
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+
+	"github.com/OhMyDitzzy/vulcan/script"
+	"github.com/OhMyDitzzy/vulcan/types"
+	"github.com/OhMyDitzzy/vulcan/wallet"
+)
+
+// HTLC is the contract of a hash time-locked output.
+type HTLC struct {
+	Hash      [sha256.Size]byte // SHA256 of the secret that claims the coins
+	Recipient string            // Public key that may claim the coins with the secret
+	Sender    string            // Public key that funded the contract and may take the coins back after LockTime
+	LockTime  uint32            // Block height, or Unix time, from which the coins can be refunded
+}
+
+// Script returns the locking script of the HTLC:
+//
+//	OP_IF
+//	    OP_SHA256 <hash> OP_EQUALVERIFY <recipient>
+//	OP_ELSE
+//	    <lock time> OP_CHECKLOCKTIMEVERIFY OP_DROP <sender>
+//	OP_ENDIF
+//	OP_CHECKSIG
+func (h *HTLC) Script() ([]byte, error) {
+	if h.LockTime == 0 {
+		return nil, fmt.Errorf("lock time is required")
+	}
+	recipient, err := hex.DecodeString(h.Recipient)
+	if err != nil || !isPublicKey(h.Recipient) {
+		return nil, fmt.Errorf("invalid recipient key %s", h.Recipient)
+	}
+	sender, err := hex.DecodeString(h.Sender)
+	if err != nil || !isPublicKey(h.Sender) {
+		return nil, fmt.Errorf("invalid sender key %s", h.Sender)
+	}
+
+	return script.NewBuilder().
+		AddOp(script.OP_IF).
+		AddOp(script.OP_SHA256).AddData(h.Hash[:]).AddOp(script.OP_EQUALVERIFY).AddData(recipient).
+		AddOp(script.OP_ELSE).
+		AddInt(int64(h.LockTime)).AddOp(script.OP_CHECKLOCKTIMEVERIFY).AddOp(script.OP_DROP).AddData(sender).
+		AddOp(script.OP_ENDIF).
+		AddOp(script.OP_CHECKSIG).
+		Script(), nil
+}
+
+// Address returns the address that funds the HTLC: the address of its
+// script. Paying to it takes no more than paying to a public key, and each
+// party can check that the other funded the agreed contract by computing
+// the address themselves.
+func (h *HTLC) Address() (string, error) {
+	lock, err := h.Script()
+	if err != nil {
+		return "", err
+	}
+	return types.ScriptAddress(lock), nil
+}
+
+func isPublicKey(address string) bool {
+	_, err := wallet.AddressToPublicKey(address)
+	return err == nil
+}
+
+// Claim creates a transaction in which the recipient claims coins of the
+// HTLC with the secret, paying all of them minus the fee to the given
+// address.
+func (h *HTLC) Claim(w *wallet.Wallet, chainID uint32, coins []wallet.Coin, secret []byte, to string, fee uint64) (*types.Transaction, error) {
+	if w.Address != h.Recipient {
+		return nil, fmt.Errorf("wallet is not the recipient of the contract")
+	}
+	if sha256.Sum256(secret) != h.Hash {
+		return nil, fmt.Errorf("secret does not match the contract's hash")
+	}
+	return h.spend(w, chainID, coins, to, fee, 0, func(sig []byte) *script.Builder {
+		return script.NewBuilder().AddData(sig).AddData(secret).AddInt(1)
+	})
+}
+
+// Refund creates a transaction in which the sender takes coins of the
+// HTLC back, paying all of them minus the fee to the given address. Its
+// lock time is the contract's, so no block includes it before then.
+func (h *HTLC) Refund(w *wallet.Wallet, chainID uint32, coins []wallet.Coin, to string, fee uint64) (*types.Transaction, error) {
+	if w.Address != h.Sender {
+		return nil, fmt.Errorf("wallet is not the sender of the contract")
+	}
+	return h.spend(w, chainID, coins, to, fee, h.LockTime, func(sig []byte) *script.Builder {
+		return script.NewBuilder().AddData(sig).AddInt(0)
+	})
+}
+
+// spend creates a transaction spending every coin of the HTLC, unlocking
+// each input with the data unlock pushes for the wallet's signature,
+// followed by the contract's script.
+func (h *HTLC) spend(w *wallet.Wallet, chainID uint32, coins []wallet.Coin, to string, fee uint64, lockTime uint32, unlock func(sig []byte) *script.Builder) (*types.Transaction, error) {
+	lock, err := h.Script()
+	if err != nil {
+		return nil, err
+	}
+
+	var total uint64
+	prevOuts := make([]types.OutPoint, len(coins))
+	for i, coin := range coins {
+		prevOuts[i] = coin.OutPoint
+		total += coin.Amount
+	}
+	if total <= fee {
+		return nil, fmt.Errorf("contract holds %d, which does not cover the fee of %d", total, fee)
+	}
+
+	tx := types.NewTransaction(chainID, "", prevOuts, []types.TxOutput{{Amount: total - fee, Address: to}}, fee)
+	tx.LockTime = lockTime
+	for i := range tx.Inputs {
+		sigHex, err := wallet.Sign(tx.DataToSign(i), w.PrivateKey)
+		if err != nil {
+			return nil, fmt.Errorf("failed to sign input %d: %w", i, err)
+		}
+		sig, _ := hex.DecodeString(sigHex)
+		tx.SetScript(i, unlock(sig).AddData(lock).Script())
+	}
+	return tx, nil
+}
+
+// ExtractSecret returns the secret revealed by a transaction that claims
+// coins of the HTLC, which the other party of a swap needs to claim theirs.
+func (h *HTLC) ExtractSecret(tx *types.Transaction) ([]byte, error) {
+	lock, err := h.Script()
+	if err != nil {
+		return nil, err
+	}
+
+	for _, in := range tx.Inputs {
+		redeem, rest, err := script.SplitRedeemScript(in.Script)
+		if err != nil || string(redeem) != string(lock) {
+			continue
+		}
+		instructions, err := script.Parse(rest)
+		if err != nil || len(instructions) != 3 {
+			continue
+		}
+		// A secret of a small number is pushed by an opcode without data
+		secret := script.PushedData(instructions[1])
+		if sha256.Sum256(secret) != h.Hash {
+			return nil, fmt.Errorf("transaction reveals a secret that does not match the contract's hash")
+		}
+		return secret, nil
+	}
+	return nil, fmt.Errorf("transaction does not reveal the secret")
+}
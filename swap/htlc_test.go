@@ -0,0 +1,216 @@
+package swap
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"strings"
+	"testing"
+
+	"github.com/OhMyDitzzy/vulcan/script"
+	"github.com/OhMyDitzzy/vulcan/types"
+	"github.com/OhMyDitzzy/vulcan/wallet"
+)
+
+const testChainID = 1
+
+func newWallet(t *testing.T) *wallet.Wallet {
+	t.Helper()
+	w, err := wallet.NewWallet()
+	if err != nil {
+		t.Fatal(err)
+	}
+	return w
+}
+
+// testHTLC returns a contract locked by the secret, and its parties.
+func testHTLC(t *testing.T, secret []byte) (h *HTLC, recipient, sender *wallet.Wallet) {
+	t.Helper()
+	recipient, sender = newWallet(t), newWallet(t)
+	h = &HTLC{
+		Hash:      sha256.Sum256(secret),
+		Recipient: recipient.Address,
+		Sender:    sender.Address,
+		LockTime:  500,
+	}
+	return h, recipient, sender
+}
+
+// testCoins returns coins paid to the contract's address.
+func testCoins(amounts ...uint64) []wallet.Coin {
+	coins := make([]wallet.Coin, len(amounts))
+	for i, amount := range amounts {
+		coins[i] = wallet.Coin{OutPoint: types.OutPoint{TxID: "aa11", Index: uint32(i)}, Amount: amount}
+	}
+	return coins
+}
+
+// verify checks every input of tx as a node does for inputs spending
+// outputs paid to the contract's address.
+func verify(h *HTLC, tx *types.Transaction) error {
+	address, err := h.Address()
+	if err != nil {
+		return err
+	}
+	for i, in := range tx.Inputs {
+		redeem, rest, err := script.SplitRedeemScript(in.Script)
+		if err != nil {
+			return err
+		}
+		if types.ScriptAddress(redeem) != address {
+			return fmt.Errorf("revealed script does not match the contract's address")
+		}
+		if err := script.Verify(rest, redeem, tx, i); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func TestHTLCScriptRejects(t *testing.T) {
+	h, _, _ := testHTLC(t, []byte("secret"))
+	tests := map[string]func(h HTLC) HTLC{
+		"no lock time":      func(h HTLC) HTLC { h.LockTime = 0; return h },
+		"invalid recipient": func(h HTLC) HTLC { h.Recipient = "04beef"; return h },
+		"invalid sender":    func(h HTLC) HTLC { h.Sender = "zz"; return h },
+	}
+	for name, change := range tests {
+		t.Run(name, func(t *testing.T) {
+			contract := change(*h)
+			if _, err := contract.Address(); err == nil {
+				t.Fatal("Address succeeded")
+			}
+		})
+	}
+}
+
+func TestHTLCClaim(t *testing.T) {
+	secret := []byte("correct horse battery staple")
+	h, recipient, sender := testHTLC(t, secret)
+	coins := testCoins(60, 40)
+
+	tx, err := h.Claim(recipient, testChainID, coins, secret, recipient.Address, 5)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(tx.Outputs) != 1 || tx.Outputs[0].Amount != 95 || tx.LockTime != 0 {
+		t.Fatalf("claim pays %+v with lock time %d, want 95 without a lock time", tx.Outputs, tx.LockTime)
+	}
+	if tx.ID != tx.Hash() {
+		t.Fatal("claim's ID isn't its hash")
+	}
+	if err := verify(h, tx); err != nil {
+		t.Fatalf("claim rejected: %v", err)
+	}
+
+	if _, err := h.Claim(sender, testChainID, coins, secret, sender.Address, 5); err == nil {
+		t.Fatal("the sender claimed the coins")
+	}
+	if _, err := h.Claim(recipient, testChainID, coins, []byte("wrong"), recipient.Address, 5); err == nil {
+		t.Fatal("a wrong secret claimed the coins")
+	}
+	if _, err := h.Claim(recipient, testChainID, coins, secret, recipient.Address, 100); err == nil {
+		t.Fatal("a claim paid all the coins as fee")
+	}
+
+	// The recipient's signature is needed, not just the secret
+	forged, _ := h.Claim(recipient, testChainID, coins[:1], secret, sender.Address, 5)
+	stolen := types.NewTransaction(testChainID, "", []types.OutPoint{coins[0].OutPoint}, []types.TxOutput{{Amount: 55, Address: sender.Address}}, 5)
+	stolen.SetScript(0, forged.Inputs[0].Script)
+	if err := verify(h, stolen); err == nil {
+		t.Fatal("a claim's unlocking script spent the coins in another transaction")
+	}
+}
+
+func TestHTLCRefund(t *testing.T) {
+	h, recipient, sender := testHTLC(t, []byte("secret"))
+	coins := testCoins(100)
+
+	tx, err := h.Refund(sender, testChainID, coins, sender.Address, 5)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if tx.LockTime != h.LockTime {
+		t.Fatalf("refund has lock time %d, want the contract's %d", tx.LockTime, h.LockTime)
+	}
+	if err := verify(h, tx); err != nil {
+		t.Fatalf("refund rejected: %v", err)
+	}
+
+	if _, err := h.Refund(recipient, testChainID, coins, recipient.Address, 5); err == nil {
+		t.Fatal("the recipient refunded the coins")
+	}
+
+	// A refund signed before the lock time fails the lock time check
+	early := types.NewTransaction(testChainID, "", []types.OutPoint{coins[0].OutPoint}, []types.TxOutput{{Amount: 95, Address: sender.Address}}, 5)
+	early.LockTime = h.LockTime - 1
+	sigHex, _ := wallet.Sign(early.DataToSign(0), sender.PrivateKey)
+	sig, _ := hex.DecodeString(sigHex)
+	lock, _ := h.Script()
+	early.SetScript(0, script.NewBuilder().AddData(sig).AddInt(0).AddData(lock).Script())
+	if err := verify(h, early); err == nil || !strings.Contains(err.Error(), "lock time") {
+		t.Fatalf("got %v, want a refund before the lock time rejected", err)
+	}
+}
+
+func TestExtractSecret(t *testing.T) {
+	// Secrets of one byte from 1 to 16, and 0x81, are pushed by opcodes
+	// without data, as is an empty secret
+	secrets := map[string][]byte{
+		"text":  []byte("correct horse battery staple"),
+		"empty": {},
+		"0x00":  {0x00},
+		"0x81":  {0x81},
+		"0x82":  {0x82},
+		"long":  make([]byte, 80),
+	}
+	for b := byte(1); b <= 16; b++ {
+		secrets["0x"+hex.EncodeToString([]byte{b})] = []byte{b}
+	}
+
+	for name, secret := range secrets {
+		t.Run(name, func(t *testing.T) {
+			h, recipient, _ := testHTLC(t, secret)
+			tx, err := h.Claim(recipient, testChainID, testCoins(100), secret, recipient.Address, 5)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if err := verify(h, tx); err != nil {
+				t.Fatalf("claim rejected: %v", err)
+			}
+			got, err := h.ExtractSecret(tx)
+			if err != nil {
+				t.Fatalf("ExtractSecret failed: %v", err)
+			}
+			if sha256.Sum256(got) != h.Hash || len(got) != len(secret) {
+				t.Fatalf("extracted secret %x, want %x", got, secret)
+			}
+		})
+	}
+}
+
+func TestExtractSecretRejects(t *testing.T) {
+	secret := []byte("secret")
+	h, recipient, sender := testHTLC(t, secret)
+	other, otherRecipient, _ := testHTLC(t, secret)
+
+	refund, _ := h.Refund(sender, testChainID, testCoins(100), sender.Address, 5)
+	if _, err := h.ExtractSecret(refund); err == nil || !strings.Contains(err.Error(), "does not reveal") {
+		t.Fatalf("got %v, want a refund revealing no secret", err)
+	}
+
+	claimOfOther, _ := other.Claim(otherRecipient, testChainID, testCoins(100), secret, otherRecipient.Address, 5)
+	if _, err := h.ExtractSecret(claimOfOther); err == nil || !strings.Contains(err.Error(), "does not reveal") {
+		t.Fatalf("got %v, want a claim of another contract ignored", err)
+	}
+
+	// An unlocking script pushing a wrong secret for the contract
+	claim, _ := h.Claim(recipient, testChainID, testCoins(100), secret, recipient.Address, 5)
+	redeem, rest, _ := script.SplitRedeemScript(claim.Inputs[0].Script)
+	instructions, _ := script.Parse(rest)
+	wrong := script.NewBuilder().AddData(script.PushedData(instructions[0])).AddData([]byte("wrong")).AddInt(1).AddData(redeem).Script()
+	claim.SetScript(0, wrong)
+	if _, err := h.ExtractSecret(claim); err == nil || !strings.Contains(err.Error(), "does not match") {
+		t.Fatalf("got %v, want a wrong secret rejected", err)
+	}
+}
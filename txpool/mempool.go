@@ -9,57 +9,129 @@ import (
 
 type Mempool struct {
 	transactions map[string]*types.Transaction
+	spent        map[types.OutPoint]string // outpoint -> ID of the pending tx spending it
+	held         map[string]bool           // IDs of transactions accepted while time locked
 	mu           sync.RWMutex
 }
 
 func NewMempool() *Mempool {
 	return &Mempool{
 		transactions: make(map[string]*types.Transaction),
+		spent:        make(map[types.OutPoint]string),
+		held:         make(map[string]bool),
 	}
 }
 
+// AddTransaction adds a transaction that is valid in the next block.
+// It replaces held transactions spending the same outputs: a time locked
+// transaction doesn't keep others from spending its inputs first.
 func (mp *Mempool) AddTransaction(tx *types.Transaction) error {
 	mp.mu.Lock()
 	defer mp.mu.Unlock()
-	
+
 	// Check if already exists
 	if _, exists := mp.transactions[tx.ID]; exists {
 		return fmt.Errorf("transaction already in mempool")
 	}
-	
-	for _, existingTx := range mp.transactions {
-		if existingTx.From == tx.From && existingTx.ID != tx.ID {
-			// TODO: check UTXO conflicts
+
+	// Reject transactions that spend an output another pending tx already spends
+	for _, in := range tx.Inputs {
+		if spender, exists := mp.spent[in.PrevOut]; exists && !mp.held[spender] {
+			return fmt.Errorf("output %s already spent by pending transaction %s", in.PrevOut, spender)
 		}
 	}
-	
-	mp.transactions[tx.ID] = tx
+	for _, in := range tx.Inputs {
+		if spender, exists := mp.spent[in.PrevOut]; exists {
+			mp.removeTransaction(spender)
+		}
+	}
+
+	mp.addTransaction(tx)
+	return nil
+}
+
+// HoldTransaction adds a transaction that is valid except for a time lock,
+// to be mined once it unlocks. Held transactions are returned by
+// GetTransactions like any other, so miners must skip them while locked.
+func (mp *Mempool) HoldTransaction(tx *types.Transaction) error {
+	mp.mu.Lock()
+	defer mp.mu.Unlock()
+
+	if _, exists := mp.transactions[tx.ID]; exists {
+		return fmt.Errorf("transaction already in mempool")
+	}
+	for _, in := range tx.Inputs {
+		if spender, exists := mp.spent[in.PrevOut]; exists {
+			return fmt.Errorf("output %s already spent by pending transaction %s", in.PrevOut, spender)
+		}
+	}
+
+	mp.addTransaction(tx)
+	mp.held[tx.ID] = true
 	return nil
 }
 
+func (mp *Mempool) addTransaction(tx *types.Transaction) {
+	mp.transactions[tx.ID] = tx
+	for _, in := range tx.Inputs {
+		mp.spent[in.PrevOut] = tx.ID
+	}
+}
+
 func (mp *Mempool) RemoveTransaction(txID string) {
 	mp.mu.Lock()
 	defer mp.mu.Unlock()
+	mp.removeTransaction(txID)
+}
+
+// RemoveForBlock drops the transactions included in a connected block along
+// with any pending transactions that spend the same outputs.
+func (mp *Mempool) RemoveForBlock(txs []*types.Transaction) {
+	mp.mu.Lock()
+	defer mp.mu.Unlock()
+
+	for _, tx := range txs {
+		mp.removeTransaction(tx.ID)
+		for _, in := range tx.Inputs {
+			if spender, exists := mp.spent[in.PrevOut]; exists {
+				mp.removeTransaction(spender)
+			}
+		}
+	}
+}
+
+func (mp *Mempool) removeTransaction(txID string) {
+	tx, exists := mp.transactions[txID]
+	if !exists {
+		return
+	}
+	for _, in := range tx.Inputs {
+		delete(mp.spent, in.PrevOut)
+	}
 	delete(mp.transactions, txID)
+	delete(mp.held, txID)
 }
 
 func (mp *Mempool) GetTransactions(limit int) []*types.Transaction {
 	mp.mu.RLock()
 	defer mp.mu.RUnlock()
-	
+
 	txs := make([]*types.Transaction, 0, len(mp.transactions))
 	for _, tx := range mp.transactions {
 		txs = append(txs, tx)
 	}
-	
+
 	sort.Slice(txs, func(i, j int) bool {
-		return txs[i].Fee > txs[j].Fee
+		if txs[i].Fee != txs[j].Fee {
+			return txs[i].Fee > txs[j].Fee
+		}
+		return txs[i].ID < txs[j].ID
 	})
-	
+
 	if len(txs) > limit {
 		txs = txs[:limit]
 	}
-	
+
 	return txs
 }
 
@@ -69,6 +141,14 @@ func (mp *Mempool) GetTransaction(txID string) *types.Transaction {
 	return mp.transactions[txID]
 }
 
+// IsSpent reports whether a pending transaction already spends the outpoint.
+func (mp *Mempool) IsSpent(outPoint types.OutPoint) bool {
+	mp.mu.RLock()
+	defer mp.mu.RUnlock()
+	_, exists := mp.spent[outPoint]
+	return exists
+}
+
 func (mp *Mempool) Size() int {
 	mp.mu.RLock()
 	defer mp.mu.RUnlock()
@@ -79,4 +159,6 @@ func (mp *Mempool) Clear() {
 	mp.mu.Lock()
 	defer mp.mu.Unlock()
 	mp.transactions = make(map[string]*types.Transaction)
-}
\ No newline at end of file
+	mp.spent = make(map[types.OutPoint]string)
+	mp.held = make(map[string]bool)
+}
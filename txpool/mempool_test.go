@@ -0,0 +1,64 @@
+package txpool
+
+import (
+	"testing"
+
+	"github.com/OhMyDitzzy/vulcan/types"
+)
+
+// testTx returns a transaction spending the given outpoints, its ID
+// differing with amount.
+func testTx(amount uint64, prevOuts ...types.OutPoint) *types.Transaction {
+	tx := types.NewTransaction(1, "04beef", prevOuts, []types.TxOutput{{Amount: amount, Address: "04beef"}}, 1)
+	tx.ID = tx.Hash()
+	return tx
+}
+
+func TestHeldTransactions(t *testing.T) {
+	mp := NewMempool()
+	a := types.OutPoint{TxID: "aa11"}
+	b := types.OutPoint{TxID: "bb22"}
+
+	held := testTx(1, a, b)
+	if err := mp.HoldTransaction(held); err != nil {
+		t.Fatal(err)
+	}
+	if err := mp.HoldTransaction(held); err == nil {
+		t.Fatal("holding a transaction twice succeeded")
+	}
+	if err := mp.HoldTransaction(testTx(2, a)); err == nil {
+		t.Fatal("held a second transaction spending the same output")
+	}
+	if mp.GetTransaction(held.ID) == nil || !mp.IsSpent(b) {
+		t.Fatal("the held transaction isn't pending")
+	}
+
+	// A transaction valid now replaces the held one, freeing all its inputs
+	spend := testTx(3, a)
+	if err := mp.AddTransaction(spend); err != nil {
+		t.Fatalf("AddTransaction failed: %v", err)
+	}
+	if mp.GetTransaction(held.ID) != nil || mp.IsSpent(b) {
+		t.Fatal("the replaced transaction is still pending")
+	}
+
+	// But isn't itself replaced, by a held transaction or one valid now
+	if err := mp.HoldTransaction(testTx(4, a)); err == nil {
+		t.Fatal("a held transaction replaced a pending one")
+	}
+	if err := mp.AddTransaction(testTx(5, a)); err == nil {
+		t.Fatal("a transaction replaced a pending one")
+	}
+
+	// Held transactions are mined like any other once they unlock
+	if err := mp.HoldTransaction(testTx(6, b)); err != nil {
+		t.Fatal(err)
+	}
+	if txs := mp.GetTransactions(10); len(txs) != 2 {
+		t.Fatalf("got %d pending transactions, want 2", len(txs))
+	}
+	mp.RemoveForBlock(mp.GetTransactions(10))
+	if mp.Size() != 0 || mp.IsSpent(a) || mp.IsSpent(b) {
+		t.Fatal("mined transactions are still pending")
+	}
+}
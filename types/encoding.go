@@ -0,0 +1,180 @@
+package types
+
+import (
+	"encoding/binary"
+	"fmt"
+	"time"
+)
+
+// Blocks, transactions and everything derived from them are hashed, stored
+// and sent to peers in a canonical binary encoding: fixed-width integers are
+// little-endian, counts and lengths are minimal unsigned varints, and strings
+// are length-prefixed. Every value has exactly one encoding, so two different
+// transactions can never serialize (and hash) to the same bytes. JSON is only
+// used to present data through the API.
+
+// Encoder appends values to a byte slice in the canonical encoding.
+type Encoder struct {
+	buf []byte
+}
+
+func NewEncoder() *Encoder {
+	return &Encoder{}
+}
+
+func (e *Encoder) WriteUint8(v uint8) {
+	e.buf = append(e.buf, v)
+}
+
+func (e *Encoder) WriteUint32(v uint32) {
+	e.buf = binary.LittleEndian.AppendUint32(e.buf, v)
+}
+
+func (e *Encoder) WriteUint64(v uint64) {
+	e.buf = binary.LittleEndian.AppendUint64(e.buf, v)
+}
+
+// WriteVarInt writes a count or length as an unsigned varint.
+func (e *Encoder) WriteVarInt(v uint64) {
+	e.buf = binary.AppendUvarint(e.buf, v)
+}
+
+// WriteBytes writes a length-prefixed byte string.
+func (e *Encoder) WriteBytes(data []byte) {
+	e.WriteVarInt(uint64(len(data)))
+	e.buf = append(e.buf, data...)
+}
+
+// WriteString writes a length-prefixed string.
+func (e *Encoder) WriteString(s string) {
+	e.WriteVarInt(uint64(len(s)))
+	e.buf = append(e.buf, s...)
+}
+
+// WriteTime writes a timestamp as nanoseconds since the Unix epoch,
+// so the encoding doesn't depend on the time zone it was created in.
+func (e *Encoder) WriteTime(t time.Time) {
+	e.WriteUint64(uint64(t.UnixNano()))
+}
+
+// Bytes returns the encoded data.
+func (e *Encoder) Bytes() []byte {
+	return e.buf
+}
+
+// Decoder reads values written by an Encoder.
+// The first error is kept and every later read returns a zero value, so
+// callers can decode a whole structure and check Err once at the end.
+type Decoder struct {
+	data []byte
+	err  error
+}
+
+func NewDecoder(data []byte) *Decoder {
+	return &Decoder{data: data}
+}
+
+// Err returns the first error encountered while decoding.
+func (d *Decoder) Err() error {
+	return d.err
+}
+
+// Finish returns the first decoding error, or an error if any data is left over.
+func (d *Decoder) Finish() error {
+	if d.err == nil && len(d.data) > 0 {
+		d.err = fmt.Errorf("%d unexpected trailing bytes", len(d.data))
+	}
+	return d.err
+}
+
+// Fail records a decoding error, for checks made by the caller such as
+// unsupported versions. Only the first error is kept.
+func (d *Decoder) Fail(format string, args ...interface{}) {
+	if d.err == nil {
+		d.err = fmt.Errorf(format, args...)
+	}
+}
+
+func (d *Decoder) next(n int) []byte {
+	if d.err != nil {
+		return nil
+	}
+	if len(d.data) < n {
+		d.Fail("unexpected end of data")
+		return nil
+	}
+	b := d.data[:n]
+	d.data = d.data[n:]
+	return b
+}
+
+func (d *Decoder) ReadUint8() uint8 {
+	b := d.next(1)
+	if b == nil {
+		return 0
+	}
+	return b[0]
+}
+
+func (d *Decoder) ReadUint32() uint32 {
+	b := d.next(4)
+	if b == nil {
+		return 0
+	}
+	return binary.LittleEndian.Uint32(b)
+}
+
+func (d *Decoder) ReadUint64() uint64 {
+	b := d.next(8)
+	if b == nil {
+		return 0
+	}
+	return binary.LittleEndian.Uint64(b)
+}
+
+// ReadVarInt reads an unsigned varint, rejecting non-minimal encodings.
+func (d *Decoder) ReadVarInt() uint64 {
+	if d.err != nil {
+		return 0
+	}
+	v, n := binary.Uvarint(d.data)
+	if n <= 0 {
+		d.Fail("invalid varint")
+		return 0
+	}
+	if n != len(binary.AppendUvarint(nil, v)) {
+		d.Fail("non-canonical varint")
+		return 0
+	}
+	d.data = d.data[n:]
+	return v
+}
+
+// ReadCount reads the number of elements in a list.
+// Every element takes at least one byte, so a count larger than the
+// remaining data is rejected before anything is allocated for it.
+func (d *Decoder) ReadCount() int {
+	n := d.ReadVarInt()
+	if n > uint64(len(d.data)) {
+		d.Fail("count %d exceeds remaining data", n)
+		return 0
+	}
+	return int(n)
+}
+
+func (d *Decoder) ReadBytes() []byte {
+	n := d.ReadCount()
+	b := d.next(n)
+	if b == nil {
+		return nil
+	}
+	return append([]byte(nil), b...)
+}
+
+func (d *Decoder) ReadString() string {
+	return string(d.ReadBytes())
+}
+
+func (d *Decoder) ReadTime() time.Time {
+	return time.Unix(0, int64(d.ReadUint64())).UTC()
+}
@@ -0,0 +1,141 @@
+package types
+
+import (
+	"bytes"
+	"reflect"
+	"testing"
+	"time"
+)
+
+func TestEncodingRoundTrip(t *testing.T) {
+	timestamp := time.Unix(1700000000, 123456789).UTC()
+
+	tests := []struct {
+		name   string
+		encode func(e *Encoder)
+		decode func(d *Decoder) interface{}
+		want   interface{}
+	}{
+		{
+			name:   "uint8",
+			encode: func(e *Encoder) { e.WriteUint8(0xab) },
+			decode: func(d *Decoder) interface{} { return d.ReadUint8() },
+			want:   uint8(0xab),
+		},
+		{
+			name:   "uint32",
+			encode: func(e *Encoder) { e.WriteUint32(0xdeadbeef) },
+			decode: func(d *Decoder) interface{} { return d.ReadUint32() },
+			want:   uint32(0xdeadbeef),
+		},
+		{
+			name:   "uint64",
+			encode: func(e *Encoder) { e.WriteUint64(1<<63 + 5) },
+			decode: func(d *Decoder) interface{} { return d.ReadUint64() },
+			want:   uint64(1<<63 + 5),
+		},
+		{
+			name:   "small varint",
+			encode: func(e *Encoder) { e.WriteVarInt(127) },
+			decode: func(d *Decoder) interface{} { return d.ReadVarInt() },
+			want:   uint64(127),
+		},
+		{
+			name:   "large varint",
+			encode: func(e *Encoder) { e.WriteVarInt(1 << 40) },
+			decode: func(d *Decoder) interface{} { return d.ReadVarInt() },
+			want:   uint64(1 << 40),
+		},
+		{
+			name:   "bytes",
+			encode: func(e *Encoder) { e.WriteBytes([]byte{1, 2, 3}) },
+			decode: func(d *Decoder) interface{} { return d.ReadBytes() },
+			want:   []byte{1, 2, 3},
+		},
+		{
+			name:   "string",
+			encode: func(e *Encoder) { e.WriteString("vulcan") },
+			decode: func(d *Decoder) interface{} { return d.ReadString() },
+			want:   "vulcan",
+		},
+		{
+			name:   "time",
+			encode: func(e *Encoder) { e.WriteTime(timestamp) },
+			decode: func(d *Decoder) interface{} { return d.ReadTime() },
+			want:   timestamp,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			e := NewEncoder()
+			tt.encode(e)
+			data := e.Bytes()
+
+			d := NewDecoder(data)
+			got := tt.decode(d)
+			if err := d.Finish(); err != nil {
+				t.Fatalf("decoding failed: %v", err)
+			}
+			if !reflect.DeepEqual(got, tt.want) {
+				t.Fatalf("got %v, want %v", got, tt.want)
+			}
+
+			for n := 0; n < len(data); n++ {
+				d := NewDecoder(data[:n])
+				tt.decode(d)
+				if d.Finish() == nil {
+					t.Errorf("decoding the first %d of %d bytes succeeded", n, len(data))
+				}
+			}
+
+			d = NewDecoder(append(bytes.Clone(data), 0))
+			tt.decode(d)
+			if d.Finish() == nil {
+				t.Error("decoding with a trailing byte succeeded")
+			}
+		})
+	}
+}
+
+func TestDecoderRejects(t *testing.T) {
+	tests := []struct {
+		name   string
+		data   []byte
+		decode func(d *Decoder)
+	}{
+		{"non-canonical varint", []byte{0x80, 0x00}, func(d *Decoder) { d.ReadVarInt() }},
+		{"unterminated varint", []byte{0x80}, func(d *Decoder) { d.ReadVarInt() }},
+		{"count beyond data", []byte{0x05, 0x01}, func(d *Decoder) { d.ReadCount() }},
+		{"bytes beyond data", []byte{0x03, 0x01, 0x02}, func(d *Decoder) { d.ReadBytes() }},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			d := NewDecoder(tt.data)
+			tt.decode(d)
+			if d.Err() == nil {
+				t.Fatal("decoding succeeded")
+			}
+		})
+	}
+}
+
+func TestDecoderKeepsFirstError(t *testing.T) {
+	d := NewDecoder([]byte{0x01})
+	if v := d.ReadUint32(); v != 0 {
+		t.Fatalf("truncated read returned %d", v)
+	}
+	first := d.Err()
+	if first == nil {
+		t.Fatal("truncated read succeeded")
+	}
+
+	d.Fail("later error")
+	if v := d.ReadUint8(); v != 0 {
+		t.Fatalf("read after an error returned %d", v)
+	}
+	if d.Finish() != first {
+		t.Fatalf("got error %v, want the first one, %v", d.Finish(), first)
+	}
+}
@@ -0,0 +1,116 @@
+package types
+
+import (
+	"crypto/sha256"
+	"encoding/binary"
+	"encoding/hex"
+	"fmt"
+	"math/big"
+	"time"
+)
+
+// BlockVersion is the current block header format version.
+const BlockVersion uint32 = 1
+
+// BlockHeader holds the fields of a block that its hash commits to.
+// Transactions are committed to through the merkle root, so a header can be
+// stored, hashed, sent to peers and checked for proof-of-work without the
+// block body. Light clients and headers-first sync only need the headers.
+type BlockHeader struct {
+	Version      uint32    `json:"version"`         // Block format version
+	Index        uint64    `json:"index"`           // Block height in the chain
+	Timestamp    time.Time `json:"timestamp"`       // Block creation time
+	PreviousHash string    `json:"previous_hash"`   // Hash of the previous block
+	MerkleRoot   string    `json:"merkle_root"`     // Merkle root of all transactions
+	Bits         uint32    `json:"bits"`            // Difficulty: the compact Proof-of-Work target, or the engine's block weight
+	Extra        []byte    `json:"extra,omitempty"` // Engine-specific data, such as signer votes
+	Seal         []byte    `json:"seal,omitempty"`  // Engine-specific seal, such as the block signer's signature
+	Nonce        uint64    `json:"nonce"`           // Proof-of-Work nonce
+}
+
+// ComputeHash calculates the SHA256 hash of the header's canonical encoding.
+func (h *BlockHeader) ComputeHash() string {
+	hash := sha256.Sum256(h.Serialize())
+	return hex.EncodeToString(hash[:])
+}
+
+// SealHash returns the hash of the header without its seal, which is what
+// engines that seal blocks with a signature sign.
+func (h *BlockHeader) SealHash() []byte {
+	e := NewEncoder()
+	h.encode(e, false)
+	hash := sha256.Sum256(e.Bytes())
+	return hash[:]
+}
+
+// HasValidProofOfWork checks that the header's hash is at or below its target
+// and that the target is no easier than powLimit.
+func (h *BlockHeader) HasValidProofOfWork(powLimit *big.Int) bool {
+	return HashMeetsTarget(h.ComputeHash(), h.Bits, powLimit)
+}
+
+// Serialize returns the canonical binary encoding of the header.
+// The nonce is encoded last, so miners can encode the header once and
+// only rewrite the final NonceSize bytes for every attempt.
+func (h *BlockHeader) Serialize() []byte {
+	e := NewEncoder()
+	h.Encode(e)
+	return e.Bytes()
+}
+
+// NonceSize is the number of bytes the nonce takes at the end of a serialized header.
+const NonceSize = 8
+
+// PutSerializedNonce overwrites the nonce of a header produced by Serialize.
+func PutSerializedNonce(data []byte, nonce uint64) {
+	binary.LittleEndian.PutUint64(data[len(data)-NonceSize:], nonce)
+}
+
+// Encode writes the header to an encoder, for embedding it in larger structures.
+func (h *BlockHeader) Encode(e *Encoder) {
+	h.encode(e, true)
+}
+
+func (h *BlockHeader) encode(e *Encoder, withSeal bool) {
+	e.WriteUint32(h.Version)
+	e.WriteUint64(h.Index)
+	e.WriteTime(h.Timestamp)
+	e.WriteString(h.PreviousHash)
+	e.WriteString(h.MerkleRoot)
+	e.WriteUint32(h.Bits)
+	e.WriteBytes(h.Extra)
+	if withSeal {
+		e.WriteBytes(h.Seal)
+	}
+	e.WriteUint64(h.Nonce)
+}
+
+// DeserializeBlockHeader decodes a header produced by Serialize.
+func DeserializeBlockHeader(data []byte) (*BlockHeader, error) {
+	d := NewDecoder(data)
+	h := DecodeBlockHeader(d)
+	if err := d.Finish(); err != nil {
+		return nil, fmt.Errorf("failed to decode block header: %w", err)
+	}
+	return h, nil
+}
+
+// DecodeBlockHeader reads a header written by Encode.
+// Errors are reported through the decoder.
+func DecodeBlockHeader(d *Decoder) *BlockHeader {
+	h := &BlockHeader{Version: d.ReadUint32()}
+	if d.Err() == nil && h.Version != BlockVersion {
+		d.Fail("unsupported block version %d", h.Version)
+		return h
+	}
+
+	h.Index = d.ReadUint64()
+	h.Timestamp = d.ReadTime()
+	h.PreviousHash = d.ReadString()
+	h.MerkleRoot = d.ReadString()
+	h.Bits = d.ReadUint32()
+	h.Extra = d.ReadBytes()
+	h.Seal = d.ReadBytes()
+	h.Nonce = d.ReadUint64()
+	return h
+}
@@ -0,0 +1,98 @@
+package types
+
+import (
+	"bytes"
+	"reflect"
+	"testing"
+	"time"
+)
+
+func TestBlockHeaderRoundTrip(t *testing.T) {
+	timestamp := time.Unix(1700000000, 987654321).UTC()
+
+	tests := []struct {
+		name   string
+		header *BlockHeader
+	}{
+		{
+			name: "proof of work",
+			header: &BlockHeader{
+				Version:      BlockVersion,
+				Index:        12,
+				Timestamp:    timestamp,
+				PreviousHash: "00ff",
+				MerkleRoot:   "abcd",
+				Bits:         0x1f00ffff,
+				Nonce:        123456789,
+			},
+		},
+		{
+			name: "sealed",
+			header: &BlockHeader{
+				Version:      BlockVersion,
+				Index:        1 << 40,
+				Timestamp:    timestamp,
+				PreviousHash: "00ff",
+				MerkleRoot:   "abcd",
+				Bits:         2,
+				Extra:        []byte("votes"),
+				Seal:         []byte("signature"),
+			},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			data := tt.header.Serialize()
+
+			got, err := DeserializeBlockHeader(data)
+			if err != nil {
+				t.Fatalf("DeserializeBlockHeader failed: %v", err)
+			}
+			if !reflect.DeepEqual(got, tt.header) {
+				t.Fatalf("got %+v, want %+v", got, tt.header)
+			}
+
+			for n := 0; n < len(data); n++ {
+				if _, err := DeserializeBlockHeader(data[:n]); err == nil {
+					t.Errorf("decoding the first %d of %d bytes succeeded", n, len(data))
+				}
+			}
+			if _, err := DeserializeBlockHeader(append(bytes.Clone(data), 0)); err == nil {
+				t.Error("decoding with a trailing byte succeeded")
+			}
+		})
+	}
+}
+
+func TestBlockHeaderRejectsUnknownVersion(t *testing.T) {
+	h := &BlockHeader{Version: BlockVersion + 1}
+	if _, err := DeserializeBlockHeader(h.Serialize()); err == nil {
+		t.Fatal("decoding a header of an unknown version succeeded")
+	}
+}
+
+func TestSealHashExcludesSeal(t *testing.T) {
+	h := &BlockHeader{Version: BlockVersion, Index: 1, Extra: []byte{1}}
+	before := h.SealHash()
+
+	h.Seal = []byte("signature")
+	if !bytes.Equal(h.SealHash(), before) {
+		t.Fatal("seal hash changed with the seal")
+	}
+	h.Extra = []byte{2}
+	if bytes.Equal(h.SealHash(), before) {
+		t.Fatal("seal hash didn't change with the extra data")
+	}
+}
+
+func TestPutSerializedNonce(t *testing.T) {
+	h := &BlockHeader{Version: BlockVersion, Index: 3, Seal: []byte{9}}
+	data := h.Serialize()
+
+	PutSerializedNonce(data, 77)
+	h.Nonce = 77
+	if !bytes.Equal(data, h.Serialize()) {
+		t.Fatal("patched encoding differs from the encoding with the nonce")
+	}
+}
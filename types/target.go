@@ -0,0 +1,105 @@
+package types
+
+import (
+	"encoding/hex"
+	"math/big"
+)
+
+// Proof-of-work targets are 256-bit numbers: a block is valid when its hash,
+// read as a big-endian integer, is at or below the target. Blocks carry the
+// target in a compact 32-bit form ("bits"), the same encoding Bitcoin uses:
+// the high byte is the length of the number in bytes and the low 23 bits are
+// its most significant digits. Bit 23 is a sign bit and must not be set.
+
+// oneLsh256 is 2^256, used to turn targets into an amount of work.
+var oneLsh256 = new(big.Int).Lsh(big.NewInt(1), 256)
+
+// CompactToBig converts a compact target to the full 256-bit number.
+func CompactToBig(compact uint32) *big.Int {
+	mantissa := compact & 0x007fffff
+	isNegative := compact&0x00800000 != 0
+	exponent := uint(compact >> 24)
+
+	var bn *big.Int
+	if exponent <= 3 {
+		mantissa >>= 8 * (3 - exponent)
+		bn = big.NewInt(int64(mantissa))
+	} else {
+		bn = big.NewInt(int64(mantissa))
+		bn.Lsh(bn, 8*(exponent-3))
+	}
+
+	if isNegative {
+		bn = bn.Neg(bn)
+	}
+	return bn
+}
+
+// BigToCompact converts a 256-bit target to its compact form.
+// Precision below the 3 most significant bytes is lost, so converting back
+// rounds the target down.
+func BigToCompact(n *big.Int) uint32 {
+	if n.Sign() == 0 {
+		return 0
+	}
+
+	var mantissa uint32
+	exponent := uint(len(n.Bytes()))
+	if exponent <= 3 {
+		mantissa = uint32(n.Bits()[0])
+		mantissa <<= 8 * (3 - exponent)
+	} else {
+		tn := new(big.Int).Set(n)
+		mantissa = uint32(tn.Rsh(tn, 8*(exponent-3)).Bits()[0])
+	}
+
+	// Keep the sign bit clear by moving a byte into the exponent
+	if mantissa&0x00800000 != 0 {
+		mantissa >>= 8
+		exponent++
+	}
+
+	compact := uint32(exponent<<24) | mantissa
+	if n.Sign() < 0 {
+		compact |= 0x00800000
+	}
+	return compact
+}
+
+// CalcWork returns the expected number of hashes needed to find a block
+// with the given compact target: 2^256 / (target + 1).
+// Fork choice compares the sum of this over each branch.
+func CalcWork(bits uint32) *big.Int {
+	target := CompactToBig(bits)
+	if target.Sign() <= 0 {
+		return big.NewInt(0)
+	}
+
+	denominator := new(big.Int).Add(target, big.NewInt(1))
+	return new(big.Int).Div(oneLsh256, denominator)
+}
+
+// HashToBig interprets a hex-encoded hash as a big-endian 256-bit number.
+// It returns nil if the hash isn't valid hex.
+func HashToBig(hash string) *big.Int {
+	data, err := hex.DecodeString(hash)
+	if err != nil {
+		return nil
+	}
+	return new(big.Int).SetBytes(data)
+}
+
+// HashMeetsTarget reports whether a hex-encoded hash is at or below the
+// target encoded in bits, and that target is in the range (0, powLimit].
+func HashMeetsTarget(hash string, bits uint32, powLimit *big.Int) bool {
+	target := CompactToBig(bits)
+	if target.Sign() <= 0 || target.Cmp(powLimit) > 0 {
+		return false
+	}
+
+	hashNum := HashToBig(hash)
+	if hashNum == nil {
+		return false
+	}
+	return hashNum.Cmp(target) <= 0
+}
@@ -0,0 +1,118 @@
+package types
+
+import (
+	"math/big"
+	"strings"
+	"testing"
+)
+
+func hexBig(t *testing.T, s string) *big.Int {
+	t.Helper()
+	n, ok := new(big.Int).SetString(s, 16)
+	if !ok {
+		t.Fatalf("invalid hex number %q", s)
+	}
+	return n
+}
+
+func TestCompactRoundTrip(t *testing.T) {
+	tests := []struct {
+		compact uint32
+		target  string
+	}{
+		{0x1d00ffff, "ffff" + strings.Repeat("0", 52)},
+		{0x1f00ffff, "ffff" + strings.Repeat("0", 56)},
+		{0x207fffff, "7fffff" + strings.Repeat("0", 58)},
+		{0x1b0404cb, "404cb" + strings.Repeat("0", 48)},
+		{0x03123456, "123456"},
+		{0x02008000, "80"},
+		{0x01010000, "1"},
+		{0x04123456, "12345600"},
+	}
+
+	for _, tt := range tests {
+		target := hexBig(t, tt.target)
+		if got := CompactToBig(tt.compact); got.Cmp(target) != 0 {
+			t.Errorf("CompactToBig(%08x) = %x, want %x", tt.compact, got, target)
+		}
+		if got := BigToCompact(target); got != tt.compact {
+			t.Errorf("BigToCompact(%x) = %08x, want %08x", target, got, tt.compact)
+		}
+	}
+}
+
+func TestBigToCompactRoundsDown(t *testing.T) {
+	// Only the 3 most significant bytes are kept
+	target := hexBig(t, "123456789a")
+	compact := BigToCompact(target)
+	if compact != 0x05123456 {
+		t.Fatalf("BigToCompact(%x) = %08x, want 05123456", target, compact)
+	}
+	if rounded := CompactToBig(compact); rounded.Cmp(target) > 0 {
+		t.Fatalf("round trip raised the target from %x to %x", target, rounded)
+	}
+}
+
+func TestCompactSign(t *testing.T) {
+	if n := CompactToBig(0x04923456); n.Sign() >= 0 {
+		t.Fatalf("CompactToBig(04923456) = %x, want a negative number", n)
+	}
+	if compact := BigToCompact(big.NewInt(-0x123456)); compact != 0x03923456 {
+		t.Fatalf("BigToCompact(-123456) = %08x, want 03923456", compact)
+	}
+	if compact := BigToCompact(big.NewInt(0)); compact != 0 {
+		t.Fatalf("BigToCompact(0) = %08x, want 0", compact)
+	}
+}
+
+func TestCalcWork(t *testing.T) {
+	tests := []struct {
+		bits uint32
+		want string
+	}{
+		{0x1d00ffff, "100010001"},
+		{0x207fffff, "2"},
+		{0x1f00ffff, "10001"},
+		{0x00000000, "0"},
+		{0x04923456, "0"}, // Negative targets add no work
+	}
+
+	for _, tt := range tests {
+		if got := CalcWork(tt.bits); got.Cmp(hexBig(t, tt.want)) != 0 {
+			t.Errorf("CalcWork(%08x) = %x, want %s", tt.bits, got, tt.want)
+		}
+	}
+
+	if CalcWork(0x1d00ffff).Cmp(CalcWork(0x1f00ffff)) <= 0 {
+		t.Error("a lower target doesn't take more work")
+	}
+}
+
+func TestHashMeetsTarget(t *testing.T) {
+	powLimit := CompactToBig(0x1f00ffff)
+	atTarget := "0000ffff" + strings.Repeat("0", 56)
+	aboveTarget := "00010000" + strings.Repeat("0", 56)
+
+	tests := []struct {
+		name string
+		hash string
+		bits uint32
+		want bool
+	}{
+		{"at target", atTarget, 0x1f00ffff, true},
+		{"above target", aboveTarget, 0x1f00ffff, false},
+		{"zero hash", strings.Repeat("0", 64), 0x1f00ffff, true},
+		{"target above limit", atTarget, 0x2000ffff, false},
+		{"zero target", strings.Repeat("0", 64), 0, false},
+		{"negative target", atTarget, 0x1f80ffff, false},
+		{"invalid hash", "zz", 0x1f00ffff, false},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := HashMeetsTarget(tt.hash, tt.bits, powLimit); got != tt.want {
+				t.Fatalf("got %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
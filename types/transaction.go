@@ -8,105 +8,458 @@ import (
 	"time"
 )
 
-// Transaction represents a blockchain transaction with ECDSA signature.
+// TxVersion is the current transaction format version.
+// It is the first field of the encoding, so the layout can change later
+// without making old transactions ambiguous.
+const TxVersion uint32 = 1
+
+// TxType distinguishes transactions that move coins from those that lock
+// them as stake, release them again or slash a misbehaving staker.
+type TxType uint8
+
+const (
+	// TxTransfer spends outputs and pays new ones. This is the default type.
+	TxTransfer TxType = iota
+
+	// TxStake locks coins as stake. Its first output is the stake and must
+	// pay the staker spending the inputs; other outputs are change.
+	TxStake
+
+	// TxUnstake releases stake outputs back to the staker. Its outputs
+	// can't be spent until the unbonding period is over.
+	TxUnstake
+
+	// TxSlash destroys the stake of a staker who signed two blocks for the
+	// same slot. The payload is the proof, the inputs are the staker's stake
+	// and need no signatures, and the reporter may be paid a share of it.
+	TxSlash
+)
+
+func (t TxType) String() string {
+	switch t {
+	case TxTransfer:
+		return "transfer"
+	case TxStake:
+		return "stake"
+	case TxUnstake:
+		return "unstake"
+	case TxSlash:
+		return "slash"
+	default:
+		return fmt.Sprintf("TxType(%d)", uint8(t))
+	}
+}
+
+// CoinbaseIndex is the output index used by the null outpoint that
+// coinbase inputs reference, since they don't spend any previous output.
+const CoinbaseIndex = ^uint32(0)
+
+// MaxCoinbasePayload is the size limit of the free data a coinbase may
+// carry in its payload, such as the genesis block's extra data.
+const MaxCoinbasePayload = 100
+
+// OutPoint identifies a single output of a previous transaction.
+// Inputs reference the outputs they spend by (transaction ID, output index)
+// so every node consumes exactly the same UTXOs for the same transaction.
+type OutPoint struct {
+	TxID  string `json:"tx_id"` // ID of the transaction that created the output
+	Index uint32 `json:"index"` // Position of the output in that transaction
+}
+
+// IsNull returns true if the outpoint is the null outpoint used by coinbase inputs.
+func (op OutPoint) IsNull() bool {
+	return op.TxID == "" && op.Index == CoinbaseIndex
+}
+
+func (op OutPoint) String() string {
+	return fmt.Sprintf("%s:%d", op.TxID, op.Index)
+}
+
+// MaxScriptSize is the size limit of locking and unlocking scripts.
+const MaxScriptSize = 1000
+
+// LockTimeThreshold separates the two kinds of lock times: values below it
+// are block heights, values at or above it are Unix timestamps.
+const LockTimeThreshold = 500000000
+
+// Relative lock times of inputs, in TxInput.Sequence. The low 16 bits are
+// the number of blocks the spent output must be confirmed for before the
+// input is valid, or with SequenceTimeFlag set, the number of
+// SequenceGranularity intervals of median time past. No other bits may be set.
+const (
+	SequenceTimeFlag    = 1 << 22
+	SequenceMask        = 0xffff
+	SequenceGranularity = 512 * time.Second
+)
+
+// TxInput spends a previous output.
+// The public key must match the address the referenced output is locked to,
+// and the signature must be made by the matching private key over DataToSign.
+// An output locked by a script is spent with an unlocking script instead,
+// which leaves the public key and signature empty.
+type TxInput struct {
+	PrevOut   OutPoint `json:"prev_out"`           // Output being spent
+	PubKey    string   `json:"pub_key"`            // Spender's public key (hex)
+	Signature string   `json:"signature"`          // ECDSA signature (hex)
+	Script    []byte   `json:"script,omitempty"`   // Unlocking script of a script output
+	Sequence  uint32   `json:"sequence,omitempty"` // Relative lock time, 0 if none
+}
+
+// OpReturn is the script opcode OP_RETURN, which fails whenever it runs.
+const OpReturn = 0x6a
+
+// TxOutput assigns an amount to a recipient.
+// Each output becomes a new UTXO once the transaction is confirmed.
+// An output with a locking script can only be spent by satisfying the
+// script, and its address is the script's ScriptAddress.
+// A data output instead carries data in a locking script starting with
+// OP_RETURN. It has no address or amount, can provably never be spent, and
+// so never becomes a UTXO.
+type TxOutput struct {
+	Amount  uint64 `json:"amount"`           // Amount locked in this output
+	Address string `json:"address"`          // Recipient's public key (hex), or script address
+	Script  []byte `json:"script,omitempty"` // Locking script, if not locked to a public key
+}
+
+// IsData reports whether the output is a data output.
+func (out *TxOutput) IsData() bool {
+	return len(out.Script) > 0 && out.Script[0] == OpReturn
+}
+
+// ScriptAddress returns the address of outputs locked by a script: the hex
+// SHA256 of the script. It is half as long as a public key address, so the
+// two can't be confused.
+func ScriptAddress(script []byte) string {
+	hash := sha256.Sum256(script)
+	return hex.EncodeToString(hash[:])
+}
+
+// Transaction represents a blockchain transaction with ECDSA signatures.
 // In our implementation, we use a UTXO model where transactions consume
-// inputs and create outputs. Each transaction must be properly signed
-// by the sender's private key to be considered valid.
+// explicitly referenced inputs and create new outputs. The sum of the
+// inputs must equal the sum of the outputs plus the fee, and every input
+// must be signed by the owner of the output it spends.
 type Transaction struct {
-	ID        string    `json:"id"`         // SHA256 hash of transaction data
-	From      string    `json:"from"`       // Sender's public key (hex)
-	To        string    `json:"to"`         // Recipient's public key (hex)
-	Amount    uint64    `json:"amount"`     // Amount to transfer
-	Fee       uint64    `json:"fee"`        // Mining fee
-	Signature string    `json:"signature"`  // ECDSA signature (hex)
-	Timestamp time.Time `json:"timestamp"`  // Transaction creation time
-}
-
-// NewTransaction creates a new unsigned transaction.
-// We must call Sign() on this transaction before broadcasting it
-// to ensure authenticity and prevent tampering.
-func NewTransaction(from, to string, amount, fee uint64) *Transaction {
+	ID        string     `json:"id"`                  // SHA256 hash of transaction data
+	Version   uint32     `json:"version"`             // Transaction format version
+	ChainID   uint32     `json:"chain_id"`            // Chain the transaction is valid on
+	Type      TxType     `json:"type"`                // Transfer, stake, unstake or slash
+	Inputs    []TxInput  `json:"inputs"`              // Outputs consumed by this transaction
+	Outputs   []TxOutput `json:"outputs"`             // Outputs created by this transaction
+	Payload   []byte     `json:"payload,omitempty"`   // Type-specific data, such as slashing evidence or coinbase data
+	Fee       uint64     `json:"fee"`                 // Mining fee
+	Timestamp time.Time  `json:"timestamp"`           // Transaction creation time
+	LockTime  uint32     `json:"lock_time,omitempty"` // First block height or median time past the transaction is valid at, 0 if none
+}
+
+// NewTransaction creates a new unsigned transaction for the given chain
+// spending the given outpoints.
+// The public key of every input is set to the spender so that
+// the signature hash commits to it. We must call Sign() on this transaction
+// before broadcasting it to ensure authenticity and prevent tampering.
+func NewTransaction(chainID uint32, spender string, prevOuts []OutPoint, outputs []TxOutput, fee uint64) *Transaction {
+	inputs := make([]TxInput, len(prevOuts))
+	for i, prevOut := range prevOuts {
+		inputs[i] = TxInput{PrevOut: prevOut, PubKey: spender}
+	}
+
 	return &Transaction{
-		From:      from,
-		To:        to,
-		Amount:    amount,
+		Version:   TxVersion,
+		ChainID:   chainID,
+		Inputs:    inputs,
+		Outputs:   outputs,
 		Fee:       fee,
 		Timestamp: time.Now().UTC(),
 	}
 }
 
+// NewSlashTransaction creates a transaction that slashes the stake outputs
+// spent by prevOuts, proven by the given equivocation evidence. The inputs
+// carry no public keys or signatures, since the evidence authorizes them.
+func NewSlashTransaction(chainID uint32, prevOuts []OutPoint, evidence []byte, outputs []TxOutput, fee uint64) *Transaction {
+	inputs := make([]TxInput, len(prevOuts))
+	for i, prevOut := range prevOuts {
+		inputs[i] = TxInput{PrevOut: prevOut}
+	}
+
+	tx := &Transaction{
+		Version:   TxVersion,
+		ChainID:   chainID,
+		Type:      TxSlash,
+		Inputs:    inputs,
+		Outputs:   outputs,
+		Payload:   evidence,
+		Fee:       fee,
+		Timestamp: time.Now().UTC(),
+	}
+	tx.ID = tx.Hash()
+	return tx
+}
+
 // Hash computes the SHA256 hash of the transaction.
-// Calculate the hash over all transaction fields except the ID itself
-// to create a unique identifier for this transaction.
+// Calculate the hash over the canonical encoding of every field except
+// the ID itself to create a unique identifier for this transaction.
 func (tx *Transaction) Hash() string {
-	data := fmt.Sprintf("%s%s%d%d%s%s",
-		tx.From,
-		tx.To,
-		tx.Amount,
-		tx.Fee,
-		tx.Signature,
-		tx.Timestamp.Format(time.RFC3339Nano),
-	)
-	hash := sha256.Sum256([]byte(data))
+	hash := sha256.Sum256(tx.Serialize())
 	return hex.EncodeToString(hash[:])
 }
 
-// DataToSign returns the data that should be signed by the sender.
-// Include all transaction fields except the signature itself
-// to prevent signature malleability attacks.
-func (tx *Transaction) DataToSign() []byte {
-	data := fmt.Sprintf("%s%s%d%d%s",
-		tx.From,
-		tx.To,
-		tx.Amount,
-		tx.Fee,
-		tx.Timestamp.Format(time.RFC3339Nano),
-	)
-	hash := sha256.Sum256([]byte(data))
+// DataToSign returns the data that should be signed for the input at inputIndex.
+// Include every outpoint, public key and output but none of the signatures
+// to prevent signature malleability attacks. The input index is committed
+// so a signature for one input can't be reused for another, and the version
+// and chain ID so it can't be reused on another network.
+func (tx *Transaction) DataToSign(inputIndex int) []byte {
+	e := NewEncoder()
+	e.WriteUint32(tx.Version)
+	e.WriteUint32(tx.ChainID)
+	e.WriteUint32(uint32(inputIndex))
+	tx.encodeBody(e, false)
+
+	hash := sha256.Sum256(e.Bytes())
 	return hash[:]
 }
 
-// SetSignature sets the signature and computes the transaction ID.
-// must call this after signing to finalize the transaction.
-func (tx *Transaction) SetSignature(signature string) {
-	tx.Signature = signature
+// Serialize returns the canonical binary encoding of the transaction.
+// The ID isn't included since it is the hash of this encoding.
+func (tx *Transaction) Serialize() []byte {
+	e := NewEncoder()
+	tx.Encode(e)
+	return e.Bytes()
+}
+
+// Encode writes the transaction to an encoder, for embedding it in larger structures.
+func (tx *Transaction) Encode(e *Encoder) {
+	e.WriteUint32(tx.Version)
+	e.WriteUint32(tx.ChainID)
+	tx.encodeBody(e, true)
+}
+
+func (tx *Transaction) encodeBody(e *Encoder, withSignatures bool) {
+	e.WriteUint8(uint8(tx.Type))
+	e.WriteVarInt(uint64(len(tx.Inputs)))
+	for _, in := range tx.Inputs {
+		e.WriteString(in.PrevOut.TxID)
+		e.WriteUint32(in.PrevOut.Index)
+		e.WriteUint32(in.Sequence)
+		e.WriteString(in.PubKey)
+		if withSignatures {
+			e.WriteString(in.Signature)
+			e.WriteBytes(in.Script)
+		}
+	}
+
+	e.WriteVarInt(uint64(len(tx.Outputs)))
+	for _, out := range tx.Outputs {
+		e.WriteUint64(out.Amount)
+		e.WriteString(out.Address)
+		e.WriteBytes(out.Script)
+	}
+
+	e.WriteBytes(tx.Payload)
+	e.WriteUint64(tx.Fee)
+	e.WriteTime(tx.Timestamp)
+	e.WriteUint32(tx.LockTime)
+}
+
+// DeserializeTransaction decodes a transaction produced by Serialize.
+func DeserializeTransaction(data []byte) (*Transaction, error) {
+	d := NewDecoder(data)
+	tx := DecodeTransaction(d)
+	if err := d.Finish(); err != nil {
+		return nil, fmt.Errorf("failed to decode transaction: %w", err)
+	}
+	return tx, nil
+}
+
+// DecodeTransaction reads a transaction written by Encode.
+// Errors are reported through the decoder. The ID is recomputed from the
+// decoded fields, so it always matches them.
+func DecodeTransaction(d *Decoder) *Transaction {
+	tx := &Transaction{Version: d.ReadUint32()}
+	if d.Err() == nil && tx.Version != TxVersion {
+		d.Fail("unsupported transaction version %d", tx.Version)
+		return tx
+	}
+
+	tx.ChainID = d.ReadUint32()
+	tx.Type = TxType(d.ReadUint8())
+	tx.Inputs = make([]TxInput, d.ReadCount())
+	for i := range tx.Inputs {
+		tx.Inputs[i].PrevOut.TxID = d.ReadString()
+		tx.Inputs[i].PrevOut.Index = d.ReadUint32()
+		tx.Inputs[i].Sequence = d.ReadUint32()
+		tx.Inputs[i].PubKey = d.ReadString()
+		tx.Inputs[i].Signature = d.ReadString()
+		tx.Inputs[i].Script = d.ReadBytes()
+	}
+
+	tx.Outputs = make([]TxOutput, d.ReadCount())
+	for i := range tx.Outputs {
+		tx.Outputs[i].Amount = d.ReadUint64()
+		tx.Outputs[i].Address = d.ReadString()
+		tx.Outputs[i].Script = d.ReadBytes()
+	}
+
+	tx.Payload = d.ReadBytes()
+	tx.Fee = d.ReadUint64()
+	tx.Timestamp = d.ReadTime()
+	tx.LockTime = d.ReadUint32()
+	if d.Err() == nil {
+		tx.ID = tx.Hash()
+	}
+	return tx
+}
+
+// SetSignature sets the signature of an input and recomputes the transaction ID.
+// must call this for every input after signing to finalize the transaction.
+func (tx *Transaction) SetSignature(inputIndex int, signature string) {
+	tx.Inputs[inputIndex].Signature = signature
+	tx.ID = tx.Hash()
+}
+
+// SetScript sets the unlocking script of an input that spends a
+// script-locked output, and recomputes the transaction ID.
+func (tx *Transaction) SetScript(inputIndex int, script []byte) {
+	tx.Inputs[inputIndex].Script = script
 	tx.ID = tx.Hash()
 }
 
 // Validate performs basic validation on the transaction.
 // check that all required fields are present and have valid values.
+// Checks that need the UTXO set (input existence, ownership, amounts)
+// are done by UTXOSet.ValidateTransaction.
 func (tx *Transaction) Validate() error {
-	if tx.IsCoinbase() {
-		if tx.To == "" {
-			return fmt.Errorf("to address is required")
-		}
-		if tx.Amount == 0 {
-			return fmt.Errorf("amount must be greater than zero")
-		}
-		if tx.ID == "" {
-			return fmt.Errorf("transaction ID must be set")
+	if tx.Version != TxVersion {
+		return fmt.Errorf("unsupported transaction version %d", tx.Version)
+	}
+	if tx.Type > TxSlash {
+		return fmt.Errorf("unsupported transaction type %d", tx.Type)
+	}
+	if tx.Type == TxSlash {
+		if len(tx.Payload) == 0 {
+			return fmt.Errorf("slash transaction must carry evidence")
 		}
-		if tx.ID != tx.Hash() {
-			return fmt.Errorf("transaction ID mismatch")
+	} else if tx.IsCoinbase() {
+		if len(tx.Payload) > MaxCoinbasePayload {
+			return fmt.Errorf("coinbase payload is %d bytes, at most %d are allowed", len(tx.Payload), MaxCoinbasePayload)
 		}
-		return nil
+	} else if len(tx.Payload) > 0 {
+		return fmt.Errorf("%s transaction must not have a payload", tx.Type)
 	}
-	
-	if tx.From == "" {
-		return fmt.Errorf("from address is required")
+
+	// Once the supply is capped, a coinbase of a block without fees has
+	// nothing to pay
+	if len(tx.Outputs) == 0 && !tx.IsCoinbase() {
+		return fmt.Errorf("transaction must have at least one output")
 	}
-	if tx.To == "" {
-		return fmt.Errorf("to address is required")
+
+	var total uint64
+	dataOutputs := 0
+	for i, out := range tx.Outputs {
+		if out.IsData() {
+			if tx.Type != TxTransfer {
+				return fmt.Errorf("output %d: %s transactions can't carry data", i, tx.Type)
+			}
+			if out.Address != "" || out.Amount != 0 {
+				return fmt.Errorf("output %d: data output must have no address or amount", i)
+			}
+			dataOutputs++
+			if dataOutputs > 1 {
+				return fmt.Errorf("transaction must have at most one data output")
+			}
+			continue
+		}
+		if out.Address == "" {
+			return fmt.Errorf("output %d: address is required", i)
+		}
+		if len(out.Script) > MaxScriptSize {
+			return fmt.Errorf("output %d: script is %d bytes, at most %d are allowed", i, len(out.Script), MaxScriptSize)
+		}
+		if len(out.Script) > 0 && out.Address != ScriptAddress(out.Script) {
+			return fmt.Errorf("output %d: address does not match its script", i)
+		}
+		if out.Amount == 0 {
+			return fmt.Errorf("output %d: amount must be greater than zero", i)
+		}
+		if total+out.Amount < total {
+			return fmt.Errorf("output amounts overflow")
+		}
+		total += out.Amount
 	}
-	if tx.Amount == 0 {
-		return fmt.Errorf("amount must be greater than zero")
+
+	if tx.IsCoinbase() && tx.Type != TxTransfer {
+		return fmt.Errorf("coinbase must be a transfer")
 	}
-	if tx.Fee == 0 {
-		return fmt.Errorf("fee must be greater than zero")
+	if tx.IsCoinbase() && (tx.LockTime != 0 || tx.Inputs[0].Sequence != 0) {
+		return fmt.Errorf("coinbase must not be time locked")
 	}
-	if tx.Signature == "" {
-		return fmt.Errorf("transaction must be signed")
+
+	if !tx.IsCoinbase() {
+		if len(tx.Inputs) == 0 {
+			return fmt.Errorf("transaction must have at least one input")
+		}
+		if tx.Fee == 0 {
+			return fmt.Errorf("fee must be greater than zero")
+		}
+
+		seen := make(map[OutPoint]bool, len(tx.Inputs))
+		for i, in := range tx.Inputs {
+			if in.PrevOut.IsNull() {
+				return fmt.Errorf("input %d: null outpoint in non-coinbase transaction", i)
+			}
+			if seen[in.PrevOut] {
+				return fmt.Errorf("input %d: duplicate outpoint %s", i, in.PrevOut)
+			}
+			seen[in.PrevOut] = true
+			if in.Sequence&^(SequenceTimeFlag|SequenceMask) != 0 {
+				return fmt.Errorf("input %d: invalid sequence %#x", i, in.Sequence)
+			}
+
+			if tx.Type == TxSlash {
+				if in.PubKey != "" || in.Signature != "" || len(in.Script) > 0 {
+					return fmt.Errorf("input %d: slash inputs must not be signed", i)
+				}
+				continue
+			}
+			if len(in.Script) > 0 {
+				if tx.Type != TxTransfer {
+					return fmt.Errorf("input %d: %s inputs must be signed by the staker", i, tx.Type)
+				}
+				if in.PubKey != "" || in.Signature != "" {
+					return fmt.Errorf("input %d: an input with an unlocking script has no public key or signature", i)
+				}
+				if len(in.Script) > MaxScriptSize {
+					return fmt.Errorf("input %d: script is %d bytes, at most %d are allowed", i, len(in.Script), MaxScriptSize)
+				}
+				continue
+			}
+			if in.PubKey == "" {
+				return fmt.Errorf("input %d: public key is required", i)
+			}
+			if in.Signature == "" {
+				return fmt.Errorf("input %d: must be signed", i)
+			}
+			if tx.Type != TxTransfer && in.PubKey != tx.Inputs[0].PubKey {
+				return fmt.Errorf("input %d: all inputs of a %s transaction must belong to the staker", i, tx.Type)
+			}
+		}
+
+		// Stake is locked to the staker, and released stake returns to it
+		switch tx.Type {
+		case TxStake:
+			if tx.Outputs[0].Address != tx.Inputs[0].PubKey {
+				return fmt.Errorf("stake output must pay the staker")
+			}
+		case TxUnstake:
+			for i, out := range tx.Outputs {
+				if out.Address != tx.Inputs[0].PubKey {
+					return fmt.Errorf("output %d: unstaked coins must return to the staker", i)
+				}
+			}
+		}
 	}
+
 	if tx.ID == "" {
 		return fmt.Errorf("transaction ID must be set")
 	}
@@ -116,17 +469,35 @@ func (tx *Transaction) Validate() error {
 	return nil
 }
 
+// IsFinal reports whether the transaction's lock time allows it in a block
+// at the given height, whose parent has the given median time past.
+func (tx *Transaction) IsFinal(height uint64, medianTime time.Time) bool {
+	switch {
+	case tx.LockTime == 0:
+		return true
+	case tx.LockTime < LockTimeThreshold:
+		return height >= uint64(tx.LockTime)
+	default:
+		return medianTime.Unix() >= int64(tx.LockTime)
+	}
+}
+
 // IsCoinbase returns true if this is a coinbase transaction.
-// In our blockchain, coinbase transactions have empty "from" field
-// and are used to reward miners for creating new blocks.
+// In our blockchain, coinbase transactions have a single input that
+// references the null outpoint and are used to reward miners for
+// creating new blocks.
 func (tx *Transaction) IsCoinbase() bool {
-	return tx.From == "" && tx.Signature == "coinbase"
+	return len(tx.Inputs) == 1 && tx.Inputs[0].PrevOut.IsNull()
 }
 
-// Total returns the total amount including fee.
-// calculate the total deduction from the sender's balance.
-func (tx *Transaction) Total() uint64 {
-	return tx.Amount + tx.Fee
+// OutputTotal returns the sum of all output amounts.
+// The inputs of a valid transaction add up to OutputTotal() + Fee.
+func (tx *Transaction) OutputTotal() uint64 {
+	var total uint64
+	for _, out := range tx.Outputs {
+		total += out.Amount
+	}
+	return total
 }
 
 func (tx *Transaction) ToJSON() ([]byte, error) {
@@ -143,16 +514,21 @@ func FromJSON(data []byte) (*Transaction, error) {
 
 // NewCoinbaseTransaction creates a new coinbase transaction for mining rewards.
 // reward the miner who successfully mines a block.
-// The coinbase transaction doesn't have a sender and uses a special signature.
-func NewCoinbaseTransaction(to string, amount uint64) *Transaction {
+// The coinbase transaction spends the null outpoint and pays a single output,
+// or none if amount is zero.
+func NewCoinbaseTransaction(chainID uint32, to string, amount uint64) *Transaction {
 	tx := &Transaction{
-		From:      "",
-		To:        to,
-		Amount:    amount,
-		Fee:       45,
-		Signature: "coinbase",
+		Version: TxVersion,
+		ChainID: chainID,
+		Inputs: []TxInput{
+			{PrevOut: OutPoint{Index: CoinbaseIndex}},
+		},
+		Outputs:   []TxOutput{},
 		Timestamp: time.Now().UTC(),
 	}
+	if amount > 0 {
+		tx.Outputs = append(tx.Outputs, TxOutput{Amount: amount, Address: to})
+	}
 	tx.ID = tx.Hash()
 	return tx
-}
\ No newline at end of file
+}
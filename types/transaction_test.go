@@ -0,0 +1,193 @@
+package types
+
+import (
+	"bytes"
+	"reflect"
+	"testing"
+	"time"
+)
+
+func testTransactions() map[string]*Transaction {
+	timestamp := time.Unix(1700000000, 42).UTC()
+	prevOut := OutPoint{TxID: "aa11", Index: 3}
+
+	txs := map[string]*Transaction{
+		"transfer": {
+			Version: TxVersion,
+			ChainID: 1,
+			Inputs: []TxInput{
+				{PrevOut: prevOut, PubKey: "04abcd", Signature: "3045ff", Sequence: 10},
+				{PrevOut: OutPoint{TxID: "bb22"}, PubKey: "04abcd", Signature: "3046ee"},
+			},
+			Outputs: []TxOutput{
+				{Amount: 50, Address: "04beef"},
+				{Amount: 7, Address: "04abcd"},
+			},
+			Fee:       3,
+			Timestamp: timestamp,
+			LockTime:  LockTimeThreshold + 1,
+		},
+		"script": {
+			Version: TxVersion,
+			ChainID: 2,
+			Inputs: []TxInput{
+				{PrevOut: prevOut, Script: []byte{0x01, 0x02, 0x51}},
+			},
+			Outputs: []TxOutput{
+				{Amount: 10, Address: ScriptAddress([]byte{0x51}), Script: []byte{0x51}},
+				{Script: []byte{OpReturn, 0x02, 0xca, 0xfe}},
+			},
+			Fee:       1,
+			Timestamp: timestamp,
+		},
+		"slash": {
+			Version: TxVersion,
+			ChainID: 3,
+			Type:    TxSlash,
+			Inputs: []TxInput{
+				{PrevOut: prevOut},
+			},
+			Outputs: []TxOutput{
+				{Amount: 4, Address: "04beef"},
+			},
+			Payload:   []byte("evidence"),
+			Timestamp: timestamp,
+		},
+		"coinbase": {
+			Version: TxVersion,
+			ChainID: 4,
+			Inputs: []TxInput{
+				{PrevOut: OutPoint{Index: CoinbaseIndex}},
+			},
+			Outputs: []TxOutput{
+				{Amount: 5000, Address: "04beef"},
+			},
+			Payload:   []byte("genesis"),
+			Timestamp: timestamp,
+		},
+		"coinbase without outputs": {
+			Version: TxVersion,
+			ChainID: 4,
+			Inputs: []TxInput{
+				{PrevOut: OutPoint{Index: CoinbaseIndex}},
+			},
+			Outputs:   []TxOutput{},
+			Timestamp: timestamp,
+		},
+	}
+	for _, tx := range txs {
+		tx.ID = tx.Hash()
+	}
+	return txs
+}
+
+func TestTransactionRoundTrip(t *testing.T) {
+	for name, tx := range testTransactions() {
+		t.Run(name, func(t *testing.T) {
+			data := tx.Serialize()
+
+			got, err := DeserializeTransaction(data)
+			if err != nil {
+				t.Fatalf("DeserializeTransaction failed: %v", err)
+			}
+			if !reflect.DeepEqual(got, tx) {
+				t.Fatalf("got %+v, want %+v", got, tx)
+			}
+
+			for n := 0; n < len(data); n++ {
+				if _, err := DeserializeTransaction(data[:n]); err == nil {
+					t.Errorf("decoding the first %d of %d bytes succeeded", n, len(data))
+				}
+			}
+			if _, err := DeserializeTransaction(append(bytes.Clone(data), 0)); err == nil {
+				t.Error("decoding with a trailing byte succeeded")
+			}
+		})
+	}
+}
+
+func TestTransactionRejectsUnknownVersion(t *testing.T) {
+	tx := testTransactions()["transfer"]
+	tx.Version = TxVersion + 1
+	if _, err := DeserializeTransaction(tx.Serialize()); err == nil {
+		t.Fatal("decoding a transaction of an unknown version succeeded")
+	}
+}
+
+func TestTransactionHashCommitsToEveryField(t *testing.T) {
+	changes := map[string]func(tx *Transaction){
+		"chain ID":  func(tx *Transaction) { tx.ChainID++ },
+		"type":      func(tx *Transaction) { tx.Type = TxStake },
+		"outpoint":  func(tx *Transaction) { tx.Inputs[0].PrevOut.Index++ },
+		"sequence":  func(tx *Transaction) { tx.Inputs[0].Sequence++ },
+		"signature": func(tx *Transaction) { tx.Inputs[0].Signature = "3045fe" },
+		"amount":    func(tx *Transaction) { tx.Outputs[0].Amount++ },
+		"address":   func(tx *Transaction) { tx.Outputs[0].Address = "04dead" },
+		"payload":   func(tx *Transaction) { tx.Payload = []byte{1} },
+		"fee":       func(tx *Transaction) { tx.Fee++ },
+		"timestamp": func(tx *Transaction) { tx.Timestamp = tx.Timestamp.Add(time.Nanosecond) },
+		"lock time": func(tx *Transaction) { tx.LockTime++ },
+	}
+
+	for name, change := range changes {
+		t.Run(name, func(t *testing.T) {
+			tx := testTransactions()["transfer"]
+			change(tx)
+			if tx.Hash() == tx.ID {
+				t.Fatal("hash didn't change")
+			}
+		})
+	}
+}
+
+func TestDataToSignExcludesSignatures(t *testing.T) {
+	tx := testTransactions()["transfer"]
+	before := tx.DataToSign(0)
+
+	tx.SetSignature(0, "3045aa")
+	if !bytes.Equal(tx.DataToSign(0), before) {
+		t.Fatal("signature hash changed with the signature")
+	}
+	if bytes.Equal(tx.DataToSign(1), before) {
+		t.Fatal("inputs share a signature hash")
+	}
+	if tx.ID != tx.Hash() {
+		t.Fatal("SetSignature didn't recompute the ID")
+	}
+}
+
+func TestIsFinal(t *testing.T) {
+	medianTime := time.Unix(1700000000, 0)
+	tests := []struct {
+		name     string
+		lockTime uint32
+		height   uint64
+		want     bool
+	}{
+		{"no lock time", 0, 0, true},
+		{"height not reached", 10, 9, false},
+		{"height reached", 10, 10, true},
+		{"highest height", LockTimeThreshold - 1, LockTimeThreshold - 2, false},
+		{"time not reached", 1700000001, 1 << 40, false},
+		{"time reached", 1700000000, 0, true},
+		{"lowest time", LockTimeThreshold, 0, true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			tx := &Transaction{LockTime: tt.lockTime}
+			if got := tx.IsFinal(tt.height, medianTime); got != tt.want {
+				t.Fatalf("IsFinal(%d, %d) = %v, want %v", tt.height, medianTime.Unix(), got, tt.want)
+			}
+		})
+	}
+}
+
+func TestDataToSignCommitsToChainID(t *testing.T) {
+	tx := testTransactions()["transfer"]
+	before := tx.DataToSign(0)
+
+	tx.ChainID++
+	if bytes.Equal(tx.DataToSign(0), before) {
+		t.Fatal("signature hash is the same on another chain")
+	}
+}
@@ -2,6 +2,7 @@ import axios from 'axios';
 import {
   Block,
   Transaction,
+  MerkleProof,
   Wallet,
   BalanceResponse,
   HealthResponse,
@@ -40,7 +41,7 @@ export const getBlock = async (hash: string): Promise<Block> => {
   return response.data;
 };
 
-export const getTransaction = async (txid: string): Promise<{ transaction: Transaction; status: string; block?: string; block_index?: number }> => {
+export const getTransaction = async (txid: string): Promise<{ transaction: Transaction; status: string; block?: string; block_index?: number; merkle_root?: string; proof?: MerkleProof }> => {
   const response = await api.get(`/blockchain/tx/${txid}`);
   return response.data;
 };
@@ -53,7 +53,7 @@ const BlockExplorer: React.FC = () => {
               <div><span className="font-bold">Previous Hash:</span> <code className="text-xs">{selectedBlock.previous_hash}</code></div>
               <div><span className="font-bold">Merkle Root:</span> <code className="text-xs">{selectedBlock.merkle_root}</code></div>
               <div><span className="font-bold">Nonce:</span> {selectedBlock.nonce}</div>
-              <div><span className="font-bold">Difficulty:</span> {selectedBlock.difficulty}</div>
+              <div><span className="font-bold">Target Bits:</span> <code className="text-xs">{selectedBlock.bits.toString(16).padStart(8, '0')}</code></div>
               <div><span className="font-bold">Timestamp:</span> {new Date(selectedBlock.timestamp).toLocaleString()}</div>
               <div><span className="font-bold">Transactions:</span> {selectedBlock.transactions.length}</div>
             </div>
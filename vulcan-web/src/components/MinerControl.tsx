@@ -166,11 +166,11 @@ const MinerControl: React.FC = () => {
         <ul className="text-sm space-y-2 text-gray-700">
           <li className="flex items-start gap-2">
             <span className="text-blue-600 font-bold">•</span>
-            <span>Mining difficulty determines how many leading zeros the block hash must have</span>
+            <span>The block hash must be at or below a 256-bit target, which retargets every block to hold a 10 second block time</span>
           </li>
           <li className="flex items-start gap-2">
             <span className="text-blue-600 font-bold">•</span>
-            <span>Higher difficulty means longer mining times but greater security</span>
+            <span>A lower target means longer mining times but greater security</span>
           </li>
           <li className="flex items-start gap-2">
             <span className="text-blue-600 font-bold">•</span>
@@ -49,9 +49,23 @@ const TransactionExplorer: React.FC = () => {
           <div className="space-y-3">
             <div><span className="font-bold">ID:</span> <code className="text-xs">{transaction.id}</code></div>
             <div><span className="font-bold">Status:</span> <span className={status === 'confirmed' ? 'text-green-600' : 'text-orange-600'}>{status}</span></div>
-            <div><span className="font-bold">From:</span> <code className="text-xs">{formatAddress(transaction.from)}</code></div>
-            <div><span className="font-bold">To:</span> <code className="text-xs">{formatAddress(transaction.to)}</code></div>
-            <div><span className="font-bold">Amount:</span> {transaction.amount}</div>
+            <div>
+              <span className="font-bold">Inputs:</span>
+              {transaction.inputs.map((input, i) => (
+                <div key={i} className="ml-4">
+                  <code className="text-xs">{formatAddress(input.prev_out.tx_id)}:{input.prev_out.index}</code>
+                  {input.pub_key && <span> from <code className="text-xs">{formatAddress(input.pub_key)}</code></span>}
+                </div>
+              ))}
+            </div>
+            <div>
+              <span className="font-bold">Outputs:</span>
+              {transaction.outputs.map((output, i) => (
+                <div key={i} className="ml-4">
+                  {output.amount} to <code className="text-xs">{formatAddress(output.address)}</code>
+                </div>
+              ))}
+            </div>
             <div><span className="font-bold">Fee:</span> {transaction.fee}</div>
             <div><span className="font-bold">Timestamp:</span> {new Date(transaction.timestamp).toLocaleString()}</div>
           </div>
@@ -1,6 +1,6 @@
 import React, { useState } from 'react';
 import { createWallet, getBalance, signTransaction as signTxAPI, broadcastTransaction } from '../api/client';
-import { generateKeyPair, signTransaction, isValidAddress, formatAddress } from '../crypto/wallet';
+import { generateKeyPair, isValidAddress, formatAddress } from '../crypto/wallet';
 import { Wallet, TransactionPayload } from '../types';
 
 const WalletManager: React.FC = () => {
@@ -41,7 +41,8 @@ const WalletManager: React.FC = () => {
   const handleSendTransaction = async () => {
     if (!wallet) return;
     try {
-      const signedTx = signTransaction(txForm, wallet.private_key);
+      // The node selects the UTXOs to spend, so signing happens server-side
+      const signedTx = await signTxAPI({ private_key: wallet.private_key, transaction: txForm });
     
       await broadcastTransaction(signedTx);
       alert('Transaction broadcast successfully!');
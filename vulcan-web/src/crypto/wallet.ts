@@ -1,6 +1,5 @@
 import * as elliptic from 'elliptic';
 import CryptoJS from 'crypto-js';
-import { Transaction, TransactionPayload } from '../types';
 
 const ec = new elliptic.ec('secp256k1');
 
@@ -23,38 +22,6 @@ export const signData = (data: string, privateKeyHex: string): string => {
   return signature.toDER('hex');
 };
 
-export const createTransactionData = (tx: TransactionPayload, timestamp: string): string => {
-  return `${tx.from}${tx.to}${tx.amount}${tx.fee}${timestamp}`;
-};
-
-export const signTransaction = (
-  tx: TransactionPayload,
-  privateKeyHex: string
-): Transaction => {
-  const timestamp = new Date().toISOString();
-  
-  const dataToSign = createTransactionData(tx, timestamp);
-
-  const hash = CryptoJS.SHA256(dataToSign).toString();
-  
-  const signature = signData(hash, privateKeyHex);
-  
-  const signedTx: Transaction = {
-    id: '',
-    from: tx.from,
-    to: tx.to,
-    amount: tx.amount,
-    fee: tx.fee,
-    signature: signature,
-    timestamp: timestamp
-  };
-  
-  const txData = `${signedTx.from}${signedTx.to}${signedTx.amount}${signedTx.fee}${signedTx.signature}${signedTx.timestamp}`;
-  signedTx.id = CryptoJS.SHA256(txData).toString();
-  
-  return signedTx;
-};
-
 export const verifyKeyPair = (privateKeyHex: string, address: string): boolean => {
   try {
     const keyPair = ec.keyFromPrivate(privateKeyHex, 'hex');
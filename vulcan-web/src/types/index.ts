@@ -1,16 +1,45 @@
 // Type definitions matching backend structures
 
+export interface OutPoint {
+  tx_id: string;
+  index: number;
+}
+
+export interface TxInput {
+  prev_out: OutPoint;
+  pub_key: string;
+  signature: string;
+  script?: string;
+  sequence?: number;
+}
+
+export interface TxOutput {
+  amount: number;
+  address: string;
+  script?: string;
+}
+
 export interface Transaction {
   id: string;
-  from: string;
-  to: string;
-  amount: number;
+  version: number;
+  chain_id: number;
+  type: number;
+  inputs: TxInput[];
+  outputs: TxOutput[];
+  payload?: string;
   fee: number;
-  signature: string;
   timestamp: string;
+  lock_time?: number;
+}
+
+export interface MerkleProof {
+  index: number;
+  count: number;
+  siblings: string[];
 }
 
 export interface Block {
+  version: number;
   index: number;
   timestamp: string;
   transactions: Transaction[];
@@ -18,7 +47,10 @@ export interface Block {
   previous_hash: string;
   merkle_root: string;
   hash: string;
-  difficulty: number;
+  bits: number;
+  extra?: string;
+  seal?: string;
+  finality?: 'finalized' | 'unfinalized' | 'side_chain';
 }
 
 export interface UTXO {
@@ -26,6 +58,12 @@ export interface UTXO {
   address: string;
   amount: number;
   index: number;
+  height: number;
+  median_time: string;
+  coinbase?: boolean;
+  staked?: boolean;
+  unlock_height?: number;
+  script?: string;
 }
 
 export interface Wallet {
@@ -36,21 +74,42 @@ export interface Wallet {
 export interface BalanceResponse {
   address: string;
   balance: number;
+  mature: number;
+  immature: number;
+  staked: number;
   utxos: UTXO[];
 }
 
+export interface SupplyResponse {
+  height: number;
+  circulating: number;
+  staked: number;
+  issued: number;
+  burned: number;
+  max_supply: number;
+  next_subsidy: number;
+  halving_interval: number;
+}
+
 export interface HealthResponse {
   status: string;
+  network: string;
+  chain_id: number;
   height: number;
   mempool: number;
   peers: number;
 }
 
 export interface TransactionPayload {
+  chain_id?: number;
+  type?: 'transfer' | 'stake' | 'unstake';
   from: string;
-  to: string;
+  to?: string;
+  script?: string;
   amount: number;
   fee: number;
+  lock_time?: number;
+  sequence?: number;
 }
 
 export interface SignTransactionRequest {
@@ -58,8 +117,29 @@ export interface SignTransactionRequest {
   transaction: TransactionPayload;
 }
 
+export interface AnchorRequest {
+  private_key: string;
+  chain_id?: number;
+  data: string;
+  fee: number;
+}
+
+export interface Anchor {
+  tx_id: string;
+  index: number;
+  block_hash: string;
+  height: number;
+  timestamp: string;
+}
+
+export interface AnchorsResponse {
+  data: string;
+  anchors: Anchor[];
+}
+
 export interface MineRequest {
   miner_address: string;
+  count?: number;
 }
 
 export interface AddPeerRequest {
@@ -1,6 +1,7 @@
 package wallet
 
 import (
+	"bytes"
 	"crypto/ecdsa"
 	"crypto/rand"
 	"encoding/hex"
@@ -54,9 +55,12 @@ func PrivateKeyFromHex(hexKey string) (*ecdsa.PrivateKey, error) {
 // In our keys, the address is simply the uncompressed public key
 // encoded as a hex string. This makes address derivation straightforward.
 func PublicKeyToAddress(pubKey *ecdsa.PublicKey) string {
-	// Serialize public key in uncompressed form (0x04 + X + Y)
-	pubKeyBytes := append([]byte{0x04}, pubKey.X.Bytes()...)
-	pubKeyBytes = append(pubKeyBytes, pubKey.Y.Bytes()...)
+	// Serialize public key in uncompressed form (0x04 + X + Y), with both
+	// coordinates padded to 32 bytes
+	pubKeyBytes := make([]byte, 65)
+	pubKeyBytes[0] = 0x04
+	pubKey.X.FillBytes(pubKeyBytes[1:33])
+	pubKey.Y.FillBytes(pubKeyBytes[33:])
 	return hex.EncodeToString(pubKeyBytes)
 }
 
@@ -143,6 +147,22 @@ func Verify(data []byte, signature string, pubKey *ecdsa.PublicKey) (bool, error
 	return valid, nil
 }
 
+// IsCanonicalSignature reports whether a signature is encoded the way Sign
+// encodes it: strict DER, with S in the lower half of the curve order.
+// Negating S gives a second signature that Verify accepts too, so wherever
+// the bytes of a signature matter, only the canonical one must be accepted.
+func IsCanonicalSignature(signature string) bool {
+	sigBytes, err := hex.DecodeString(signature)
+	if err != nil {
+		return false
+	}
+	sig, err := btcecdsa.ParseDERSignature(sigBytes)
+	if err != nil {
+		return false
+	}
+	return bytes.Equal(sig.Serialize(), sigBytes)
+}
+
 // GenerateRandomBytes generates cryptographically secure random bytes.
 // nonce generation and other cryptographic operations.
 func GenerateRandomBytes(n int) ([]byte, error) {
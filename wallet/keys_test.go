@@ -0,0 +1,37 @@
+package wallet
+
+import "testing"
+
+func TestAddressPadsCoordinates(t *testing.T) {
+	// About one key in 128 has a coordinate with a leading zero byte
+	found := 0
+	for i := 0; found < 2 && i < 100000; i++ {
+		key, err := GenerateKeyPair()
+		if err != nil {
+			t.Fatal(err)
+		}
+		address := PublicKeyToAddress(&key.PublicKey)
+		if len(address) != 130 {
+			t.Fatalf("address is %d hex digits, want 130", len(address))
+		}
+		if key.X.BitLen() > 248 && key.Y.BitLen() > 248 {
+			continue
+		}
+		found++
+
+		pubKey, err := AddressToPublicKey(address)
+		if err != nil {
+			t.Fatalf("address of a key with a short coordinate rejected: %v", err)
+		}
+		if pubKey.X.Cmp(key.X) != 0 || pubKey.Y.Cmp(key.Y) != 0 {
+			t.Fatal("address decodes to another key")
+		}
+		sig, _ := Sign(make([]byte, 32), key)
+		if valid, err := Verify(make([]byte, 32), sig, pubKey); err != nil || !valid {
+			t.Fatalf("signature doesn't verify against the address (%v)", err)
+		}
+	}
+	if found < 2 {
+		t.Fatal("no key with a short coordinate found")
+	}
+}
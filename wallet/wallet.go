@@ -53,52 +53,62 @@ func FromPrivateKey(privKeyHex string) (*Wallet, error) {
 }
 
 // SignTransaction signs a transaction with the wallet's private key.
-// Compute the transaction hash and sign it, then set the signature
-// on the transaction object. This proves that the wallet owner authorized
-// the transaction.
+// Compute the signature hash of every input and sign it, then set the
+// signatures on the transaction object. This proves that the wallet owner
+// authorized spending each referenced output, on the transaction's chain only.
 func (w *Wallet) SignTransaction(tx *types.Transaction) error {
-	if tx.From != w.Address {
-		return fmt.Errorf("transaction sender does not match wallet address")
+	if len(tx.Inputs) == 0 {
+		return fmt.Errorf("transaction has no inputs to sign")
 	}
-	
-	// Get data to sign
-	dataToSign := tx.DataToSign()
-	
-	// Sign the data
-	signature, err := Sign(dataToSign, w.PrivateKey)
-	if err != nil {
-		return fmt.Errorf("failed to sign transaction: %w", err)
+
+	for i, in := range tx.Inputs {
+		if in.PubKey != w.Address {
+			return fmt.Errorf("input %d is not spent by wallet address", i)
+		}
+		
+		// Sign the data for this input
+		signature, err := Sign(tx.DataToSign(i), w.PrivateKey)
+		if err != nil {
+			return fmt.Errorf("failed to sign input %d: %w", i, err)
+		}
+		
+		tx.SetSignature(i, signature)
 	}
 	
-	// Set signature on transaction
-	tx.SetSignature(signature)
-	
 	return nil
 }
 
-// VerifyTransactionSignature verifies that a transaction signature is valid.
-// Extract the public key from the sender address and verify the signature
-// against the transaction data. This ensures the transaction hasn't been
-// tampered with and was actually signed by the claimed sender.
+// VerifyTransactionSignature verifies that every input signature is valid.
+// Extract the public key of each input and verify its signature against
+// the input's signature hash. This ensures the transaction hasn't been
+// tampered with and was actually signed by the owners of the spent outputs.
+// Whether those keys really own the outputs is checked against the UTXO set.
+// Inputs with an unlocking script are skipped: they are verified by running
+// it against the locking script of the output they spend.
 func VerifyTransactionSignature(tx *types.Transaction) (bool, error) {
 	if tx.IsCoinbase() {
 		return true, nil
 	}
 	
-	pubKey, err := AddressToPublicKey(tx.From)
-	if err != nil {
-		return false, fmt.Errorf("invalid sender address: %w", err)
-	}
-	
-	// Get data that was signed
-	dataToSign := tx.DataToSign()
+	for i, in := range tx.Inputs {
+		if len(in.Script) > 0 {
+			continue
+		}
+		pubKey, err := AddressToPublicKey(in.PubKey)
+		if err != nil {
+			return false, fmt.Errorf("input %d: invalid public key: %w", i, err)
+		}
 
-	valid, err := Verify(dataToSign, tx.Signature, pubKey)
-	if err != nil {
-		return false, fmt.Errorf("signature verification failed: %w", err)
+		valid, err := Verify(tx.DataToSign(i), in.Signature, pubKey)
+		if err != nil {
+			return false, fmt.Errorf("input %d: signature verification failed: %w", i, err)
+		}
+		if !valid {
+			return false, nil
+		}
 	}
 	
-	return valid, nil
+	return true, nil
 }
 
 // Export returns the wallet's private key and address for backup..
@@ -106,13 +116,135 @@ func (w *Wallet) Export() (privateKeyHex, address string) {
 	return PrivateKeyToHex(w.PrivateKey), w.Address
 }
 
-// CreateAndSignTransaction is a convenience method that creates and signs a transaction.
-// Build a new transaction with the provided parameters and sign it with
-// the wallet's private key in one step.
-func (w *Wallet) CreateAndSignTransaction(to string, amount, fee uint64) (*types.Transaction, error) {
-	tx := types.NewTransaction(w.Address, to, amount, fee)
+// Coin is an unspent output owned by the wallet that can fund a transaction.
+type Coin struct {
+	OutPoint types.OutPoint
+	Amount   uint64
+}
+
+// CreateAndSignTransaction is a convenience method that creates and signs a
+// transaction for the chain with the given ID.
+// Spend coins in the order given until amount plus fee is covered, pay any
+// remainder back to the wallet as change, and sign every input with the
+// wallet's private key in one step.
+func (w *Wallet) CreateAndSignTransaction(chainID uint32, coins []Coin, to string, amount, fee uint64) (*types.Transaction, error) {
+	return w.createTransaction(chainID, types.TxTransfer, coins, types.TxOutput{Amount: amount, Address: to}, fee)
+}
+
+// CreateScriptTransaction creates and signs a transaction that locks amount
+// in an output with the given locking script, funded like
+// CreateAndSignTransaction.
+func (w *Wallet) CreateScriptTransaction(chainID uint32, coins []Coin, lock []byte, amount, fee uint64) (*types.Transaction, error) {
+	payment := types.TxOutput{Amount: amount, Address: types.ScriptAddress(lock), Script: lock}
+	return w.createTransaction(chainID, types.TxTransfer, coins, payment, fee)
+}
+
+// CreateDataTransaction creates and signs a transaction with a data output
+// carrying data in the given locking script (see script.DataScript), such
+// as the hash of a document to anchor, funded like CreateAndSignTransaction.
+// Data outputs have no amount, so only the fee is spent.
+func (w *Wallet) CreateDataTransaction(chainID uint32, coins []Coin, lock []byte, fee uint64) (*types.Transaction, error) {
+	return w.createTransaction(chainID, types.TxTransfer, coins, types.TxOutput{Script: lock}, fee)
+}
+
+// CreateStakeTransaction creates and signs a transaction that locks amount
+// of the wallet's coins as stake, funded like CreateAndSignTransaction.
+func (w *Wallet) CreateStakeTransaction(chainID uint32, coins []Coin, amount, fee uint64) (*types.Transaction, error) {
+	return w.createTransaction(chainID, types.TxStake, coins, types.TxOutput{Amount: amount, Address: w.Address}, fee)
+}
+
+// CreateUnstakeTransaction creates and signs a transaction that releases
+// the wallet's stake outputs, in the order given, until amount plus fee is
+// covered. Stake outputs are released whole: everything but the fee is paid
+// back to the wallet and can be spent once the unbonding period is over.
+func (w *Wallet) CreateUnstakeTransaction(chainID uint32, stakes []Coin, amount, fee uint64) (*types.Transaction, error) {
+	prevOuts, total, err := selectCoins(stakes, amount, fee)
+	if err != nil {
+		return nil, err
+	}
+
+	outputs := []types.TxOutput{{Amount: total - fee, Address: w.Address}}
+	tx := types.NewTransaction(chainID, w.Address, prevOuts, outputs, fee)
+	tx.Type = types.TxUnstake
 	if err := w.SignTransaction(tx); err != nil {
 		return nil, fmt.Errorf("failed to sign transaction: %w", err)
 	}
 	return tx, nil
-}
\ No newline at end of file
+}
+
+func (w *Wallet) createTransaction(chainID uint32, txType types.TxType, coins []Coin, payment types.TxOutput, fee uint64) (*types.Transaction, error) {
+	tx, err := buildTransaction(chainID, coins, w.Address, w.Address, payment, fee)
+	if err != nil {
+		return nil, err
+	}
+
+	tx.Type = txType
+	if err := w.SignTransaction(tx); err != nil {
+		return nil, fmt.Errorf("failed to sign transaction: %w", err)
+	}
+	return tx, nil
+}
+
+// CreateMultisigTransaction creates an unsigned transaction spending coins
+// of a multisig address, paying any remainder back to it as change.
+// Every co-signer signs it with Cosign, and once enough did, the unlocking
+// script of each input is assembled from their signatures.
+func CreateMultisigTransaction(chainID uint32, coins []Coin, multisigAddress, to string, amount, fee uint64) (*types.Transaction, error) {
+	return buildTransaction(chainID, coins, "", multisigAddress, types.TxOutput{Amount: amount, Address: to}, fee)
+}
+
+// Cosign signs every input of a transaction spending coins the wallet's
+// key is one of several keys of, and returns the signatures by input.
+// Unlike SignTransaction, it doesn't put them into the transaction: the
+// inputs are only unlocked by the signatures of enough co-signers together.
+func (w *Wallet) Cosign(tx *types.Transaction) ([]string, error) {
+	signatures := make([]string, len(tx.Inputs))
+	for i := range tx.Inputs {
+		signature, err := Sign(tx.DataToSign(i), w.PrivateKey)
+		if err != nil {
+			return nil, fmt.Errorf("failed to sign input %d: %w", i, err)
+		}
+		signatures[i] = signature
+	}
+	return signatures, nil
+}
+
+// buildTransaction creates an unsigned transaction that pays payment and
+// fee from coins, with inputs spent by spender and change to change.
+func buildTransaction(chainID uint32, coins []Coin, spender, change string, payment types.TxOutput, fee uint64) (*types.Transaction, error) {
+	prevOuts, totalAvailable, err := selectCoins(coins, payment.Amount, fee)
+	if err != nil {
+		return nil, err
+	}
+
+	outputs := []types.TxOutput{payment}
+	if remainder := totalAvailable - payment.Amount - fee; remainder > 0 {
+		outputs = append(outputs, types.TxOutput{Amount: remainder, Address: change})
+	}
+
+	return types.NewTransaction(chainID, spender, prevOuts, outputs, fee), nil
+}
+
+// selectCoins picks coins in the order given until amount plus fee is
+// covered, and returns their outpoints and total.
+func selectCoins(coins []Coin, amount, fee uint64) ([]types.OutPoint, uint64, error) {
+	totalNeeded := amount + fee
+	if totalNeeded < amount {
+		return nil, 0, fmt.Errorf("amount plus fee overflows")
+	}
+
+	var prevOuts []types.OutPoint
+	var totalAvailable uint64
+	for _, coin := range coins {
+		if totalAvailable >= totalNeeded {
+			break
+		}
+		prevOuts = append(prevOuts, coin.OutPoint)
+		totalAvailable += coin.Amount
+	}
+
+	if totalAvailable < totalNeeded {
+		return nil, 0, fmt.Errorf("insufficient balance: have %d, need %d", totalAvailable, totalNeeded)
+	}
+	return prevOuts, totalAvailable, nil
+}